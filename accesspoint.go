@@ -0,0 +1,154 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"net"
+	"strings"
+)
+
+var (
+	ErrInvalidBucketName      = errors.New("the bucket name breaks the S3 bucket naming rules")
+	ErrMultiRegionAccessPoint = errors.New("multi-region access points require SigV4A signing which the AWS SDK for Go v1 doesn't support")
+)
+
+// validateBucket checks the bucket parameter passed to the functions in this package. Besides bucket names, S3
+// accepts access point ARNs (arn:aws:s3:<region>:<account>:accesspoint/<name>) and access point aliases anywhere a
+// bucket is expected. Requests to an access point ARN are sent to the access point's own endpoint in the ARN's
+// region, <name>-<account>.s3-accesspoint.<region>.amazonaws.com, which is also the host of UploadRes.S3URL.
+// S3 Express One Zone directory buckets are accepted too, see routeToDirectoryBucket. Multi-Region Access Points are
+// rejected with ErrMultiRegionAccessPoint and names S3 would refuse with ErrInvalidBucketName instead of failing deep
+// inside the SDK.
+func validateBucket(bucket string) error {
+	if bucket == "" {
+		return ErrParameterBucketEmpty
+	}
+
+	if isMultiRegionAccessPoint(bucket) {
+		return ErrMultiRegionAccessPoint
+	}
+
+	if isDirectoryBucket(bucket) {
+		if reason := directoryBucketNameProblem(bucket); reason != "" {
+			return fmt.Errorf("%w: %s %s", ErrInvalidBucketName, bucket, reason)
+		}
+
+		return nil
+	}
+
+	if arn.IsARN(bucket) {
+		return nil
+	}
+
+	if reason := legacyBucketNameProblem(bucket); reason != "" {
+		return fmt.Errorf("%w: %s %s", ErrInvalidBucketName, bucket, reason)
+	}
+
+	return nil
+}
+
+// validateNewBucket is validateBucket for buckets that are about to be created, which have to follow the current
+// naming rules rather than the legacy ones existing buckets may still use.
+func validateNewBucket(bucket string) error {
+	if bucket == "" {
+		return ErrParameterBucketEmpty
+	}
+
+	if arn.IsARN(bucket) || isMultiRegionAccessPoint(bucket) || isDirectoryBucket(bucket) {
+		return fmt.Errorf("%w: %s isn't a general purpose bucket", ErrInvalidBucketName, bucket)
+	}
+
+	if reason := bucketNameProblem(bucket); reason != "" {
+		return fmt.Errorf("%w: %s %s", ErrInvalidBucketName, bucket, reason)
+	}
+
+	return nil
+}
+
+// bucketNameProblem describes how bucket breaks the general purpose bucket naming rules, or is empty if it doesn't.
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucketnamingrules.html
+// Names containing dots are valid but can't be used with virtual-hosted-style requests over HTTPS since the
+// wildcard certificate only covers one level of subdomain. The SDK sends path-style requests for them instead,
+// which works, but transfer acceleration doesn't support them.
+func bucketNameProblem(bucket string) string {
+	if len(bucket) < 3 || len(bucket) > 63 {
+		return "must be between 3 and 63 characters long"
+	}
+
+	for _, r := range bucket {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-') {
+			return fmt.Sprintf("contains %q. only lowercase letters, numbers, dots, and hyphens are allowed", r)
+		}
+	}
+
+	if !isLowerAlphanumeric(bucket[0]) || !isLowerAlphanumeric(bucket[len(bucket)-1]) {
+		return "must begin and end with a letter or number"
+	}
+
+	if strings.Contains(bucket, "..") {
+		return "must not contain two adjacent dots"
+	}
+
+	if net.ParseIP(bucket) != nil {
+		return "must not be formatted as an IP address"
+	}
+
+	for _, prefix := range []string{"xn--", "sthree-"} {
+		if strings.HasPrefix(bucket, prefix) {
+			return fmt.Sprintf("must not start with the reserved prefix %s", prefix)
+		}
+	}
+
+	return ""
+}
+
+// legacyBucketNameProblem describes how bucket breaks the naming rules buckets created in us-east-1 before March
+// 2018 were held to, or is empty if it doesn't. S3 still serves those buckets so names that only break the current
+// rules, such as ones with uppercase letters or underscores, are let through.
+func legacyBucketNameProblem(bucket string) string {
+	if len(bucket) < 3 || len(bucket) > 255 {
+		return "must be between 3 and 255 characters long"
+	}
+
+	for _, r := range bucket {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return fmt.Sprintf("contains %q. only letters, numbers, dots, hyphens, and underscores are allowed", r)
+		}
+	}
+
+	return ""
+}
+
+// directoryBucketNameProblem describes how a directory bucket name breaks the directory bucket naming rules, or is
+// empty if it doesn't. Names are a base name followed by the zone the bucket is in and --x-s3, and can't have dots.
+func directoryBucketNameProblem(bucket string) string {
+	if directoryBucketZone(bucket) == "" {
+		return "must name its zone, as in <base-name>--<zone-id>--x-s3"
+	}
+
+	if strings.Contains(bucket, ".") {
+		return "must not contain dots"
+	}
+
+	return bucketNameProblem(bucket)
+}
+
+func isLowerAlphanumeric(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
+
+// isMultiRegionAccessPoint reports whether bucket is a Multi-Region Access Point ARN or alias. Their ARNs are the
+// only access point ARNs without a region and their aliases always end in .mrap.
+func isMultiRegionAccessPoint(bucket string) bool {
+	if !arn.IsARN(bucket) {
+		return strings.HasSuffix(bucket, ".mrap")
+	}
+
+	parsed, err := arn.Parse(bucket)
+	if err != nil {
+		return false
+	}
+
+	return parsed.Service == "s3" && parsed.Region == "" && strings.HasPrefix(parsed.Resource, "accesspoint")
+}
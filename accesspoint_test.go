@@ -0,0 +1,143 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	AccessPointARN            = "arn:aws:s3:us-west-2:123456789012:accesspoint/golang-s3-lambda-test"
+	DirectoryBucket           = "golang-s3-lambda-test--usw2-az1--x-s3"
+	MultiRegionAccessPointARN = "arn:aws:s3::123456789012:accesspoint/mfzwi23gnjvgw.mrap"
+)
+
+func TestValidateBucket(t *testing.T) {
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		assert.Equal(t, ErrParameterBucketEmpty, validateBucket(""))
+	})
+	t.Run("verify buckets, access point ARNs, and aliases are accepted", func(t *testing.T) {
+		for _, bucket := range []string{S3Bucket, AccessPointARN, "golang-s3-lambda-t-abcdefghijklmnopqrstuvwxyz0123-s3alias"} {
+			assert.Nil(t, validateBucket(bucket))
+		}
+	})
+	t.Run("verify err when bucket is a multi-region access point", func(t *testing.T) {
+		for _, bucket := range []string{MultiRegionAccessPointARN, "mfzwi23gnjvgw.mrap"} {
+			assert.Equal(t, ErrMultiRegionAccessPoint, validateBucket(bucket))
+
+			fileBytes, err := Download(Region, bucket, S3FileName)
+			assert.Equal(t, 0, len(fileBytes))
+			assert.Equal(t, ErrMultiRegionAccessPoint, err)
+		}
+	})
+	t.Run("verify directory buckets are accepted", func(t *testing.T) {
+		assert.Nil(t, validateBucket(DirectoryBucket))
+	})
+	t.Run("verify err when a directory bucket doesn't name its zone", func(t *testing.T) {
+		for _, bucket := range []string{"golang-s3-lambda-test--x-s3", "golang.s3--usw2-az1--x-s3"} {
+			assert.True(t, errors.Is(validateBucket(bucket), ErrInvalidBucketName))
+		}
+	})
+	t.Run("verify names only the legacy naming rules allow are accepted", func(t *testing.T) {
+		for _, bucket := range []string{"Golang-S3-Lambda", "golang_s3_lambda", "-golang-s3-lambda", "golang..s3", strings.Repeat("a", 255)} {
+			assert.Nil(t, validateBucket(bucket))
+		}
+	})
+	t.Run("verify err when bucket breaks the legacy naming rules", func(t *testing.T) {
+		for _, bucket := range []string{"ab", strings.Repeat("a", 256), "golang s3 lambda", "golang/s3/lambda", "golang!"} {
+			err := validateBucket(bucket)
+			assert.True(t, errors.Is(err, ErrInvalidBucketName))
+			assert.True(t, strings.Contains(err.Error(), bucket))
+
+			fileBytes, err := Download(Region, bucket, S3FileName)
+			assert.Equal(t, 0, len(fileBytes))
+			assert.Equal(t, http.StatusBadRequest, StatusCode(err))
+		}
+	})
+	t.Run("verify err when a new bucket breaks the naming rules", func(t *testing.T) {
+		for _, bucket := range []string{"ab", strings.Repeat("a", 64), "Golang-S3-Lambda", "golang_s3_lambda", "-golang-s3-lambda", "golang-s3-lambda.", "golang..s3", "192.168.5.4", "xn--golang-s3-lambda", "sthree-golang", AccessPointARN, MultiRegionAccessPointARN, DirectoryBucket} {
+			err := validateNewBucket(bucket)
+			assert.True(t, errors.Is(err, ErrInvalidBucketName))
+			assert.True(t, strings.Contains(err.Error(), bucket))
+		}
+	})
+	t.Run("verify names with dots are accepted", func(t *testing.T) {
+		assert.Nil(t, validateBucket("golang.s3.lambda"))
+		assert.Nil(t, validateNewBucket("golang.s3.lambda"))
+	})
+	t.Run("verify access point ARNs use the access point endpoint in the ARN's region", func(t *testing.T) {
+		awsSession, err := newOptions(nil).newSession(Region)
+		assert.Nil(t, err)
+
+		url := objectURL(s3.New(awsSession), AccessPointARN, S3FileName)
+		assert.Equal(t, "https://golang-s3-lambda-test-123456789012.s3-accesspoint.us-west-2.amazonaws.com/"+S3FileName, url)
+	})
+	t.Run("verify directory buckets use their zonal endpoint", func(t *testing.T) {
+		awsSession, err := newOptions(nil).newSession("us-west-2")
+		assert.Nil(t, err)
+
+		url := objectURL(s3.New(awsSession), DirectoryBucket, S3FileName)
+		assert.Equal(t, "https://"+DirectoryBucket+".s3express-usw2-az1.us-west-2.amazonaws.com/"+S3FileName, url)
+	})
+}
+
+func TestRouteDirectoryBucketRequests(t *testing.T) {
+	t.Run("verify directory bucket requests are signed with cached session credentials", func(t *testing.T) {
+		var createSessions int
+		var createSessionAuthorization, authorization, sessionToken, securityToken string
+		awsSession := newHandlerSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.URL.Query()["session"]; ok {
+				createSessions++
+				createSessionAuthorization = r.Header.Get("Authorization")
+				_, _ = w.Write([]byte(`<CreateSessionResult><Credentials><AccessKeyId>SESSIONAKID</AccessKeyId>` +
+					`<Expiration>` + time.Now().Add(5*time.Minute).UTC().Format(time.RFC3339) + `</Expiration>` +
+					`<SecretAccessKey>SESSIONSECRET</SecretAccessKey><SessionToken>SESSIONTOKEN</SessionToken></Credentials></CreateSessionResult>`))
+				return
+			}
+
+			authorization, sessionToken, securityToken = r.Header.Get("Authorization"), r.Header.Get(directoryBucketSessionTokenHeader), r.Header.Get("X-Amz-Security-Token")
+		}))
+		awsSession.Handlers.Validate.PushBack(routeDirectoryBucketRequests(awsSession))
+
+		bucket := "route-bucket-requests--usw2-az1--x-s3"
+		for i := 0; i < 2; i++ {
+			_, err := s3.New(awsSession).HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(S3FileName)})
+			assert.Nil(t, err)
+		}
+
+		assert.Equal(t, 1, createSessions)
+		assert.True(t, strings.HasPrefix(createSessionAuthorization, "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.True(t, strings.Contains(createSessionAuthorization, "/"+Region+"/s3express/aws4_request"))
+		assert.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=SESSIONAKID/"))
+		assert.True(t, strings.Contains(authorization, "/"+Region+"/s3express/aws4_request"))
+		assert.True(t, strings.Contains(authorization, strings.ToLower(directoryBucketSessionTokenHeader)))
+		assert.Equal(t, "SESSIONTOKEN", sessionToken)
+		assert.Equal(t, "", securityToken)
+	})
+	t.Run("verify other buckets are left alone", func(t *testing.T) {
+		var authorization string
+		awsSession := newHandlerSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		}))
+		awsSession.Handlers.Validate.PushBack(routeDirectoryBucketRequests(awsSession))
+
+		_, err := s3.New(awsSession).HeadObject(&s3.HeadObjectInput{Bucket: aws.String(S3Bucket), Key: aws.String(S3FileName)})
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(authorization, "/"+Region+"/s3/aws4_request"))
+	})
+	t.Run("verify err when no session can be created", func(t *testing.T) {
+		awsSession := newHandlerSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		awsSession.Handlers.Validate.PushBack(routeDirectoryBucketRequests(awsSession))
+
+		_, err := s3.New(awsSession).HeadObject(&s3.HeadObjectInput{Bucket: aws.String("forbidden-session--usw2-az1--x-s3"), Key: aws.String(S3FileName)})
+		assert.True(t, errors.Is(err, ErrCreatingSession))
+		assert.Equal(t, http.StatusBadGateway, StatusCode(err))
+	})
+}
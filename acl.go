@@ -0,0 +1,126 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// CannedACL is one of the predefined grants S3 can apply to an object.
+type CannedACL string
+
+const (
+	// ACLPrivate gives the object owner full control and nobody else access. It's what S3 uses by default.
+	ACLPrivate CannedACL = s3.ObjectCannedACLPrivate
+	// ACLPublicRead also lets anyone read the object. The bucket's public access block must allow it.
+	ACLPublicRead CannedACL = s3.ObjectCannedACLPublicRead
+	// ACLBucketOwnerFullControl also gives the bucket owner full control. Buckets in other accounts usually require
+	// it of cross-account uploads.
+	ACLBucketOwnerFullControl CannedACL = s3.ObjectCannedACLBucketOwnerFullControl
+)
+
+var (
+	ErrParameterACL = errors.New("required parameter acl must be ACLPrivate, ACLPublicRead, or ACLBucketOwnerFullControl")
+	ErrReadingACL   = errors.New("unable to read the object's ACL")
+	ErrUpdatingACL  = errors.New("unable to update the object's ACL")
+)
+
+// ACL is the access control list of an object.
+type ACL struct {
+	OwnerID string  `json:"ownerID"`
+	Grants  []Grant `json:"grants"`
+}
+
+// Grant gives Grantee a permission on an object. Grantee is the canonical user ID, email address, or group URI
+// S3 identifies the grantee by and Permission is one of FULL_CONTROL, READ, READ_ACP, or WRITE_ACP.
+type Grant struct {
+	Grantee    string `json:"grantee"`
+	Permission string `json:"permission"`
+}
+
+func (a CannedACL) validate() error {
+	switch a {
+	case ACLPrivate, ACLPublicRead, ACLBucketOwnerFullControl:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrParameterACL, a)
+	}
+}
+
+// GetACL returns the ACL of the object called name in bucket. Buckets whose object ownership is set to bucket
+// owner enforced have ACLs disabled and only ever report the owner's full control.
+func GetACL(region, bucket, name string, opts ...Option) (*ACL, error) {
+	s3Client, o, err := objectClient(region, bucket, name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s3Client.GetObjectAclWithContext(o.context(), &s3.GetObjectAclInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("%w: %s", ErrReadingACL, err)
+	}
+
+	acl := &ACL{}
+	if output.Owner != nil {
+		acl.OwnerID = aws.StringValue(output.Owner.ID)
+	}
+
+	for _, grant := range output.Grants {
+		if grant.Grantee == nil {
+			continue
+		}
+
+		acl.Grants = append(acl.Grants, Grant{
+			Grantee:    granteeName(grant.Grantee),
+			Permission: aws.StringValue(grant.Permission),
+		})
+	}
+
+	return acl, nil
+}
+
+// PutACL replaces the ACL of the object called name in bucket with acl. It fails with ErrUpdatingACL in buckets
+// that have ACLs disabled.
+func PutACL(region, bucket, name string, acl CannedACL, opts ...Option) error {
+	if err := acl.validate(); err != nil {
+		return err
+	}
+
+	s3Client, o, err := objectClient(region, bucket, name, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3Client.PutObjectAclWithContext(o.context(), &s3.PutObjectAclInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+		ACL:    aws.String(string(acl)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("%w: %s", ErrUpdatingACL, err)
+	}
+
+	return nil
+}
+
+// granteeName is how S3 identifies grantee, which depends on its type.
+func granteeName(grantee *s3.Grantee) string {
+	switch aws.StringValue(grantee.Type) {
+	case s3.TypeAmazonCustomerByEmail:
+		return aws.StringValue(grantee.EmailAddress)
+	case s3.TypeGroup:
+		return aws.StringValue(grantee.URI)
+	default:
+		return aws.StringValue(grantee.ID)
+	}
+}
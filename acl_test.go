@@ -0,0 +1,52 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestCannedACL(t *testing.T) {
+	t.Run("verify only the supported canned ACLs are accepted", func(t *testing.T) {
+		assert.Nil(t, ACLPrivate.validate())
+		assert.Nil(t, ACLPublicRead.validate())
+		assert.Nil(t, ACLBucketOwnerFullControl.validate())
+		assert.True(t, errors.Is(CannedACL("authenticated-read").validate(), ErrParameterACL))
+	})
+	t.Run("verify uploads WithCannedACL err before anything is sent when the ACL is unsupported", func(t *testing.T) {
+		_, err := UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), Region, S3Bucket, "acl/"+SampleFileName, WithCannedACL("public-read-write"))
+		assert.True(t, errors.Is(err, ErrParameterACL))
+	})
+	t.Run("verify grantees are named by how S3 identifies them", func(t *testing.T) {
+		assert.Equal(t, "owner", granteeName(&s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("owner")}))
+		assert.Equal(t, "user@example.com", granteeName(&s3.Grantee{Type: aws.String(s3.TypeAmazonCustomerByEmail), EmailAddress: aws.String("user@example.com")}))
+		assert.Equal(t, "http://acs.amazonaws.com/groups/global/AllUsers", granteeName(&s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")}))
+	})
+}
+
+func TestPutACL(t *testing.T) {
+	t.Run("verify err when the ACL is unsupported", func(t *testing.T) {
+		err := PutACL(Region, S3Bucket, S3FileName, "")
+		assert.True(t, errors.Is(err, ErrParameterACL))
+	})
+	t.Run("verify err when name is empty", func(t *testing.T) {
+		_, err := GetACL(Region, S3Bucket, "")
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+	})
+	t.Run("verify the ACL set on an object is read back", func(t *testing.T) {
+		uploadRes, err := UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), Region, S3Bucket, "acl/"+SampleFileName, WithCannedACL(ACLBucketOwnerFullControl))
+		assert.Nil(t, err)
+
+		assert.Nil(t, PutACL(Region, S3Bucket, uploadRes.Key, ACLPrivate))
+
+		acl, err := GetACL(Region, S3Bucket, uploadRes.Key)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(acl.Grants))
+		assert.Equal(t, acl.OwnerID, acl.Grants[0].Grantee)
+		assert.Equal(t, s3.PermissionFullControl, acl.Grants[0].Permission)
+
+		assert.Nil(t, Delete(Region, S3Bucket, uploadRes.Key))
+	})
+}
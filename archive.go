@@ -0,0 +1,438 @@
+package lambda_s3
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	// DefaultMaxArchiveEntries is the number of entries UploadArchiveContents accepts unless WithMaxArchiveEntries says otherwise.
+	DefaultMaxArchiveEntries = 1000
+	// DefaultMaxArchiveSize is the total uncompressed size UploadArchiveContents accepts unless WithMaxArchiveSize says otherwise.
+	DefaultMaxArchiveSize = 1 << 30 // 1 gigabyte
+)
+
+var (
+	ErrArchiveTooLarge    = errors.New("archive exceeds the maximum allowed number of entries or uncompressed size")
+	ErrCreatingArchive    = errors.New("unable to write the archive")
+	ErrParameterKeys      = errors.New("required parameter keys is empty")
+	ErrReadingArchive     = errors.New("unable to read the archive. make sure it isn't corrupt")
+	ErrUnsupportedArchive = errors.New("file is not a zip or tar.gz archive")
+)
+
+// DownloadAsZip writes a zip archive containing every key in keys from bucket to w. Each object is streamed from S3
+// straight into the archive one after the other so only a single small copy buffer is held in memory no matter how
+// large the objects are. Files are stored in the archive under their S3 key and objects uploaded WithKMSEncryption
+// are decrypted when it's passed too. If any object can't be downloaded an error is returned and w will contain a partially written
+// archive.
+func DownloadAsZip(region, bucket string, keys []string, w io.Writer) error {
+	if region == "" {
+		return ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return ErrParameterKeys
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			return ErrParameterNameEmpty
+		}
+	}
+
+	o := newOptions(nil)
+
+	awsSession, err := o.newSession(region)
+	if err != nil {
+		return ErrNewAWSSession
+	}
+
+	s3Client := s3.New(awsSession)
+	zipWriter := zip.NewWriter(w)
+
+	for _, key := range keys {
+		err = copyObjectToZip(awsSession, s3Client, zipWriter, bucket, key, o)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = zipWriter.Close(); err != nil {
+		return ErrCreatingArchive
+	}
+
+	return nil
+}
+
+func copyObjectToZip(awsSession *session.Session, s3Client *s3.S3, zipWriter *zip.Writer, bucket, key string, o *options) error {
+	getObjectOutput, err := getDecryptedObject(o.context(), s3Client, awsSession, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, o.kmsKeyID != "")
+	if err != nil {
+		return objectReadError(err, key)
+	}
+	defer getObjectOutput.Body.Close()
+
+	fileWriter, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     key,
+		Method:   zip.Deflate,
+		Modified: aws.TimeValue(getObjectOutput.LastModified),
+	})
+	if err != nil {
+		return ErrCreatingArchive
+	}
+
+	if _, err = copyBuffer(fileWriter, getObjectOutput.Body, o.bufferSize); err != nil {
+		return objectReadError(err, key)
+	}
+
+	return nil
+}
+
+// objectReadError reports why key couldn't be read into an archive.
+func objectReadError(err error, key string) error {
+	if isNotFound(err) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+
+	if errors.Is(err, ErrDecryptingFile) {
+		return fmt.Errorf("%w: %s", ErrDecryptingFile, key)
+	}
+
+	return fmt.Errorf("%w: %s", ErrDownloadingS3File, key)
+}
+
+// ZipResponse builds a zip archive of keys with DownloadAsZip and returns it as a base64 encoded API Gateway
+// proxy response that browsers will save as fileName. The archive is base64 encoded while it's being written
+// so it's never held in memory twice. Archives must fit within the 6 MB Lambda response limit once encoded.
+func ZipResponse(region, bucket string, keys []string, fileName string) (events.APIGatewayProxyResponse, error) {
+	var body strings.Builder
+	b64Writer := base64.NewEncoder(base64.StdEncoding, &body)
+
+	err := DownloadAsZip(region, bucket, keys, b64Writer)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	if err = b64Writer.Close(); err != nil {
+		return events.APIGatewayProxyResponse{}, ErrCreatingArchive
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":        "application/zip",
+			"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": fileName}),
+		},
+		Body:            body.String(),
+		IsBase64Encoded: true,
+	}, nil
+}
+
+// ArchivePrefix writes a tar.gz archive of every object in bucket under prefix to w. Objects are listed a page at a
+// time and each one is streamed from S3 straight through the gzip writer so nothing is buffered locally, however
+// many objects there are or however large they are. Files are stored in the archive relative to prefix, so
+// users/42/photos/cat.jpg archived with the prefix users/42 becomes photos/cat.jpg, folder placeholders are
+// skipped, and objects uploaded WithKMSEncryption are decrypted when it's passed too. If anything fails part way through an error is returned and w will contain a partially written archive.
+func ArchivePrefix(region, bucket, prefix string, w io.Writer, opts ...Option) error {
+	if region == "" && !detectsBucketRegion(opts) {
+		return ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return ErrNewAWSSession
+	}
+
+	s3Client := s3.New(awsSession)
+
+	listPrefix := prefix
+	if listPrefix != "" && !strings.HasSuffix(listPrefix, "/") {
+		listPrefix += "/"
+	}
+
+	gzipWriter := newGzipWriter(w)
+	defer releaseGzipWriter(gzipWriter)
+
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	var archiveErr error
+	err = s3Client.ListObjectsV2PagesWithContext(o.context(), &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(listPrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+
+			entryName := strings.TrimPrefix(key, listPrefix)
+			if entryName == "" || strings.HasSuffix(entryName, "/") { // folder placeholders
+				continue
+			}
+
+			if archiveErr = copyObjectToTar(awsSession, s3Client, tarWriter, bucket, key, entryName, o); archiveErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if archiveErr != nil {
+		return archiveErr
+	}
+
+	if err != nil {
+		return ErrListingS3Objects
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return ErrCreatingArchive
+	}
+
+	if err = gzipWriter.Close(); err != nil {
+		return ErrCreatingArchive
+	}
+
+	return nil
+}
+
+func copyObjectToTar(awsSession *session.Session, s3Client *s3.S3, tarWriter *tar.Writer, bucket, key, entryName string, o *options) error {
+	getObjectOutput, err := getDecryptedObject(o.context(), s3Client, awsSession, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, o.kmsKeyID != "")
+	if err != nil {
+		return objectReadError(err, key)
+	}
+	defer getObjectOutput.Body.Close()
+
+	// tar headers come before the contents so the size has to be known up front. It's taken from the GetObject
+	// response rather than the listing in case the object was overwritten in between, and is the decrypted size for
+	// objects uploaded WithKMSEncryption.
+	err = tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entryName,
+		Size:     aws.Int64Value(getObjectOutput.ContentLength),
+		Mode:     0644,
+		ModTime:  aws.TimeValue(getObjectOutput.LastModified),
+	})
+	if err != nil {
+		return ErrCreatingArchive
+	}
+
+	if _, err = copyBuffer(tarWriter, getObjectOutput.Body, o.bufferSize); err != nil {
+		return objectReadError(err, key)
+	}
+
+	return nil
+}
+
+// UploadArchiveContents expands a zip or tar.gz archive uploaded in fileHeader and uploads every file inside it
+// as its own object in bucket under prefix, so a.txt and docs/b.txt in the archive become <prefix>/a.txt and
+// <prefix>/docs/b.txt. The archive type is detected from its contents rather than its name. Directories,
+// symlinks and other special entries are skipped.
+//
+// To guard against zip bombs the archive is rejected with ErrArchiveTooLarge once it has more than
+// WithMaxArchiveEntries entries or more than WithMaxArchiveSize uncompressed bytes, and individual files over
+// WithMaxSize are rejected with ErrFileTooLarge. Limits are enforced on the bytes actually decompressed, not on
+// the sizes the archive claims. When an error is returned part way through, the files already uploaded are
+// returned along with it so they can be cleaned up.
+func UploadArchiveContents(fileHeader *multipart.FileHeader, region, bucket, prefix string, opts ...Option) ([]*UploadRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	file, err := OpenFileHeader(fileHeader)
+	if err != nil {
+		return nil, ErrOpeningMultiPartFile
+	}
+	defer file.Close()
+
+	magic := make([]byte, 4)
+	if _, err = file.ReadAt(magic, 0); err != nil {
+		return nil, ErrUnsupportedArchive
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	expander := &archiveExpander{
+		uploader:      s3manager.NewUploader(awsSession),
+		options:       o,
+		bucket:        bucket,
+		prefix:        prefix,
+		remainingSize: o.maxArchiveSize,
+	}
+
+	switch {
+	case string(magic) == "PK\x03\x04" || string(magic) == "PK\x05\x06": // regular and empty zip archives
+		err = expander.expandZip(file, fileHeader.Size)
+	case magic[0] == 0x1f && magic[1] == 0x8b: // gzip, which we assume wraps a tar archive
+		err = expander.expandTarGz(file)
+	default:
+		return nil, ErrUnsupportedArchive
+	}
+
+	return expander.uploadResults, err
+}
+
+type archiveExpander struct {
+	uploader      *s3manager.Uploader
+	options       *options
+	bucket        string
+	prefix        string
+	entries       int
+	remainingSize int64
+	uploadResults []*UploadRes
+}
+
+func (a *archiveExpander) expandZip(file io.ReaderAt, size int64) error {
+	zipReader, err := zip.NewReader(file, size)
+	if err != nil {
+		return ErrReadingArchive
+	}
+
+	if len(zipReader.File) > a.options.maxArchiveEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, a.options.maxArchiveEntries)
+	}
+
+	for _, zipFile := range zipReader.File {
+		if !zipFile.Mode().IsRegular() {
+			continue
+		}
+
+		entryReader, err := zipFile.Open()
+		if err != nil {
+			return ErrReadingArchive
+		}
+
+		err = a.uploadEntry(zipFile.Name, entryReader)
+		entryReader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *archiveExpander) expandTarGz(file io.Reader) error {
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return ErrReadingArchive
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		tarHeader, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return ErrReadingArchive
+		}
+
+		if tarHeader.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err = a.uploadEntry(tarHeader.Name, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+func (a *archiveExpander) uploadEntry(entryName string, entryReader io.Reader) error {
+	a.entries++
+	if a.entries > a.options.maxArchiveEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, a.options.maxArchiveEntries)
+	}
+
+	// normalize windows separators and strip any leading slashes or ../ so entries can't escape the prefix
+	entryName = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(entryName, "\\", "/")), "/")
+	if entryName == "" {
+		return nil
+	}
+
+	limitedReader := &limitReader{reader: entryReader, limit: a.remainingSize, err: ErrArchiveTooLarge}
+	if a.options.maxSizeBytes > 0 && a.options.maxSizeBytes < a.remainingSize {
+		limitedReader.limit = a.options.maxSizeBytes
+		limitedReader.err = ErrFileTooLarge
+	}
+
+	name := path.Join(a.prefix, entryName)
+
+	uploadRes, err := upload(a.uploader, a.bucket, name, limitedReader, mime.TypeByExtension(path.Ext(name)), 0, a.options)
+	if limitedReader.exceeded() {
+		return fmt.Errorf("%w: %s", limitedReader.err, entryName)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	uploadRes.BytesUploaded = limitedReader.read
+	a.remainingSize -= limitedReader.read
+	a.uploadResults = append(a.uploadResults, uploadRes)
+
+	return nil
+}
+
+// limitReader reads from reader until more than limit bytes have been read at which point it returns err.
+// Unlike io.LimitReader it fails loudly instead of silently truncating the data.
+type limitReader struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+	err    error
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	l.read += int64(n)
+
+	if l.exceeded() {
+		return n, l.err
+	}
+
+	return n, err
+}
+
+func (l *limitReader) exceeded() bool {
+	return l.read > l.limit
+}
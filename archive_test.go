@@ -0,0 +1,219 @@
+package lambda_s3
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jgroeneveld/trial/assert"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestDownloadAsZip(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := DownloadAsZip("", S3Bucket, []string{S3FileName}, &buf)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+		assert.Equal(t, 0, buf.Len())
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := DownloadAsZip(Region, "", []string{S3FileName}, &buf)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify err when keys is empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := DownloadAsZip(Region, S3Bucket, nil, &buf)
+		assert.True(t, errors.Is(err, ErrParameterKeys))
+	})
+	t.Run("verify err when a key is empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := DownloadAsZip(Region, S3Bucket, []string{S3FileName, ""}, &buf)
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+	})
+	t.Run("verify err when a key does not exist", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := DownloadAsZip(Region, S3Bucket, []string{"does_not_exist"}, &buf)
+		assert.True(t, errors.Is(err, ErrObjectNotFound))
+	})
+	t.Run("verify DownloadAsZip works with correct inputs", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := DownloadAsZip(Region, S3Bucket, []string{S3FileName, EmptyFileName}, &buf)
+		assert.Nil(t, err)
+
+		zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(zipReader.File))
+		assert.Equal(t, S3FileName, zipReader.File[0].Name)
+		assert.Equal(t, uint64(SampleFileSizeBytes), zipReader.File[0].UncompressedSize64)
+		assert.Equal(t, EmptyFileName, zipReader.File[1].Name)
+	})
+}
+
+func TestZipResponse(t *testing.T) {
+	t.Run("verify ZipResponse works with correct inputs", func(t *testing.T) {
+		res, err := ZipResponse(Region, S3Bucket, []string{S3FileName}, "files.zip")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, `attachment; filename=files.zip`, res.Headers["Content-Disposition"])
+		assert.True(t, res.IsBase64Encoded)
+
+		zipBytes, err := base64.StdEncoding.DecodeString(res.Body)
+		assert.Nil(t, err)
+
+		zipReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(zipReader.File))
+	})
+}
+
+func TestArchivePrefix(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := ArchivePrefix("", S3Bucket, S3ArchivePrefix, &buf)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+		assert.Equal(t, 0, buf.Len())
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := ArchivePrefix(Region, "", S3ArchivePrefix, &buf)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+		assert.Equal(t, 0, buf.Len())
+	})
+	t.Run("verify ArchivePrefix works with correct inputs", func(t *testing.T) {
+		_, err := UploadArchiveContents(generateFileHeader(t, "files.zip", generateZip(t, 2)), Region, S3Bucket, S3ArchivePrefix)
+		assert.Nil(t, err)
+
+		var buf bytes.Buffer
+		assert.Nil(t, ArchivePrefix(Region, S3Bucket, S3ArchivePrefix, &buf))
+
+		gzipReader, err := gzip.NewReader(&buf)
+		assert.Nil(t, err)
+
+		tarReader := tar.NewReader(gzipReader)
+
+		tarHeader, err := tarReader.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, "0/"+SampleFileName, tarHeader.Name)
+		assert.Equal(t, int64(SampleFileSizeBytes), tarHeader.Size)
+
+		tarHeader, err = tarReader.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, "1/"+SampleFileName, tarHeader.Name)
+	})
+}
+
+func TestUploadArchiveContents(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		uploadResults, err := UploadArchiveContents(generateFileHeader(t, "files.zip", generateZip(t, 1)), "", S3Bucket, S3ArchivePrefix)
+		assert.Equal(t, 0, len(uploadResults))
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		uploadResults, err := UploadArchiveContents(generateFileHeader(t, "files.zip", generateZip(t, 1)), Region, "", S3ArchivePrefix)
+		assert.Equal(t, 0, len(uploadResults))
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify err when file is not an archive", func(t *testing.T) {
+		uploadResults, err := UploadArchiveContents(generateFileHeader(t, SampleFileName, []byte("not,an,archive")), Region, S3Bucket, S3ArchivePrefix)
+		assert.Equal(t, 0, len(uploadResults))
+		assert.True(t, errors.Is(err, ErrUnsupportedArchive))
+	})
+	t.Run("verify err when archive has too many entries", func(t *testing.T) {
+		uploadResults, err := UploadArchiveContents(generateFileHeader(t, "files.zip", generateZip(t, 3)), Region, S3Bucket, S3ArchivePrefix, WithMaxArchiveEntries(2))
+		assert.Equal(t, 0, len(uploadResults))
+		assert.True(t, errors.Is(err, ErrArchiveTooLarge))
+	})
+	t.Run("verify err when an entry decompresses past WithMaxSize", func(t *testing.T) {
+		uploadResults, err := UploadArchiveContents(generateFileHeader(t, "files.tar.gz", generateTarGz(t)), Region, S3Bucket, S3ArchivePrefix, WithMaxSize(SampleFileSizeBytes-1))
+		assert.Equal(t, 0, len(uploadResults))
+		assert.True(t, errors.Is(err, ErrFileTooLarge))
+	})
+	t.Run("verify err when archive decompresses past WithMaxArchiveSize", func(t *testing.T) {
+		uploadResults, err := UploadArchiveContents(generateFileHeader(t, "files.tar.gz", generateTarGz(t)), Region, S3Bucket, S3ArchivePrefix, WithMaxArchiveSize(SampleFileSizeBytes-1))
+		assert.Equal(t, 0, len(uploadResults))
+		assert.True(t, errors.Is(err, ErrArchiveTooLarge))
+	})
+	t.Run("verify UploadArchiveContents works with a zip archive", func(t *testing.T) {
+		uploadResults, err := UploadArchiveContents(generateFileHeader(t, "files.zip", generateZip(t, 2)), Region, S3Bucket, S3ArchivePrefix)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(uploadResults))
+		assert.Equal(t, S3Bucket+"/"+S3ArchivePrefix+"/0/"+SampleFileName, uploadResults[0].S3Path)
+		assert.Equal(t, int64(SampleFileSizeBytes), uploadResults[0].BytesUploaded)
+	})
+	t.Run("verify UploadArchiveContents works with a tar.gz archive", func(t *testing.T) {
+		uploadResults, err := UploadArchiveContents(generateFileHeader(t, "files.tar.gz", generateTarGz(t)), Region, S3Bucket, S3ArchivePrefix)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(uploadResults))
+		assert.Equal(t, S3Bucket+"/"+S3ArchivePrefix+"/"+SampleFileName, uploadResults[0].S3Path)
+	})
+}
+
+// generateZip returns a zip archive containing count copies of the sample file each in its own directory.
+func generateZip(t *testing.T, count int) []byte {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+
+	for i := 0; i < count; i++ {
+		fileWriter, err := zipWriter.Create(fmt.Sprintf("%d/%s", i, SampleFileName))
+		assert.Nil(t, err)
+
+		_, err = fileWriter.Write(fileBytes)
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, zipWriter.Close())
+
+	return buf.Bytes()
+}
+
+// generateTarGz returns a tar.gz archive containing the sample file. The entry name tries to escape the prefix.
+func generateTarGz(t *testing.T) []byte {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	assert.Nil(t, tarWriter.WriteHeader(&tar.Header{
+		Name:     "../../" + SampleFileName,
+		Mode:     0600,
+		Size:     int64(len(fileBytes)),
+		Typeflag: tar.TypeReg,
+	}))
+
+	_, err = tarWriter.Write(fileBytes)
+	assert.Nil(t, err)
+	assert.Nil(t, tarWriter.Close())
+	assert.Nil(t, gzipWriter.Close())
+
+	return buf.Bytes()
+}
+
+// generateFileHeader returns the *multipart.FileHeader for fileBytes as if it had been uploaded through a form.
+func generateFileHeader(t *testing.T, fileName string, fileBytes []byte) *multipart.FileHeader {
+	var multiPartBuffer bytes.Buffer
+	writer := multipart.NewWriter(&multiPartBuffer)
+
+	part, err := writer.CreateFormFile("file", fileName)
+	assert.Nil(t, err)
+
+	_, err = part.Write(fileBytes)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	form, err := multipart.NewReader(&multiPartBuffer, writer.Boundary()).ReadForm(MaxFileSizeBytes)
+	assert.Nil(t, err)
+
+	return form.File["file"][0]
+}
@@ -0,0 +1,133 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"path"
+	"strings"
+)
+
+var ErrForbidden = errors.New("the request is not allowed")
+
+// AccessLevel is one of the key prefixes Amplify Storage divides a bucket into.
+type AccessLevel string
+
+const (
+	// AccessLevelPublic files are stored under public/ and shared by every user.
+	AccessLevelPublic AccessLevel = "public"
+	// AccessLevelProtected files are stored under protected/<identity ID>/. Amplify lets other users read them.
+	AccessLevelProtected AccessLevel = "protected"
+	// AccessLevelPrivate files are stored under private/<identity ID>/ and only their owner can use them.
+	AccessLevelPrivate AccessLevel = "private"
+)
+
+// Authorization is what an Authorizer decided about a request it allowed.
+type Authorization struct {
+	// UserID identifies the caller. e.g. the sub claim of their JWT.
+	UserID string
+	// KeyPrefix, when set, scopes the request to keys under it. Keys are joined to it and keys that would escape it,
+	// such as ../other-user/file, are rejected with ErrCrossTenantKey.
+	KeyPrefix string
+}
+
+// Authorizer is called by the handler factories before anything else. Returning an error rejects the request with
+// a 403 and ErrForbidden wrapping the error. Returning an Authorization scopes the request to the caller.
+type Authorizer func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (*Authorization, error)
+
+// Claims returns the claims API Gateway verified for lambdaReq: those of a Cognito user pool authorizer, of a JWT
+// authorizer on an HTTP API, or the context returned by a Lambda authorizer. It's nil if there are none.
+func Claims(lambdaReq events.APIGatewayProxyRequest) map[string]interface{} {
+	authorizer := lambdaReq.RequestContext.Authorizer
+
+	if claims, ok := authorizer["claims"].(map[string]interface{}); ok {
+		return claims
+	}
+
+	if jwt, ok := authorizer["jwt"].(map[string]interface{}); ok {
+		if claims, ok := jwt["claims"].(map[string]interface{}); ok {
+			return claims
+		}
+	}
+
+	return authorizer
+}
+
+// ClaimAuthorizer is an Authorizer that scopes every user to a prefix named after the value of their claim, e.g.
+// ClaimAuthorizer("sub") stores files under <sub>/<key>. Requests without the claim are rejected.
+func ClaimAuthorizer(claim string) Authorizer {
+	return func(_ context.Context, lambdaReq events.APIGatewayProxyRequest) (*Authorization, error) {
+		value, ok := Claims(lambdaReq)[claim]
+		if !ok {
+			return nil, fmt.Errorf("the request has no %s claim", claim)
+		}
+
+		userID := fmt.Sprint(value)
+		if err := validateTenantID(userID); err != nil {
+			return nil, fmt.Errorf("the %s claim can't be used as a prefix", claim)
+		}
+
+		return &Authorization{UserID: userID, KeyPrefix: userID}, nil
+	}
+}
+
+// CognitoIdentityAuthorizer is an Authorizer that scopes every user to their prefix under accessLevel following the
+// Amplify Storage convention, e.g. private/<identity ID>/<key>, so files uploaded through the handlers can be read
+// with Amplify and the other way round. The identity ID is the caller's Cognito identity pool identity, which API
+// Gateway only passes on for methods using AWS_IAM authorization. Requests without one are rejected.
+func CognitoIdentityAuthorizer(accessLevel AccessLevel) Authorizer {
+	return func(_ context.Context, lambdaReq events.APIGatewayProxyRequest) (*Authorization, error) {
+		identityID := lambdaReq.RequestContext.Identity.CognitoIdentityID
+		if identityID == "" {
+			return nil, errors.New("the request has no Cognito identity")
+		}
+
+		if err := validateTenantID(identityID); err != nil {
+			return nil, errors.New("the Cognito identity can't be used as a prefix")
+		}
+
+		switch accessLevel {
+		case AccessLevelPublic:
+			return &Authorization{UserID: identityID, KeyPrefix: string(AccessLevelPublic)}, nil
+		case AccessLevelProtected, AccessLevelPrivate:
+			return &Authorization{UserID: identityID, KeyPrefix: path.Join(string(accessLevel), identityID)}, nil
+		default:
+			return nil, fmt.Errorf("unknown access level %s", accessLevel)
+		}
+	}
+}
+
+// authorize runs config.Authorizer, if any. Requests are allowed unscoped without one.
+func (c Config) authorize(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (*Authorization, error) {
+	if c.Authorizer == nil {
+		return &Authorization{}, nil
+	}
+
+	authorization, err := c.Authorizer(ctx, lambdaReq)
+	if err != nil {
+		return nil, wrapCause(ErrForbidden, err)
+	}
+
+	if authorization == nil {
+		return &Authorization{}, nil
+	}
+
+	return authorization, nil
+}
+
+// scope puts key under a.KeyPrefix.
+func (a *Authorization) scope(key string) (string, error) {
+	if a.KeyPrefix == "" {
+		return key, nil
+	}
+
+	prefix := strings.TrimSuffix(a.KeyPrefix, "/")
+
+	scopedKey := path.Join(prefix, key)
+	if !strings.HasPrefix(scopedKey, prefix+"/") {
+		return "", fmt.Errorf("%w: %s", ErrCrossTenantKey, key)
+	}
+
+	return scopedKey, nil
+}
@@ -0,0 +1,111 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"testing"
+)
+
+func TestClaims(t *testing.T) {
+	t.Run("verify Cognito user pool claims", func(t *testing.T) {
+		lambdaReq := events.APIGatewayProxyRequest{}
+		lambdaReq.RequestContext.Authorizer = map[string]interface{}{"claims": map[string]interface{}{"sub": "user-1"}}
+		assert.Equal(t, "user-1", Claims(lambdaReq)["sub"])
+	})
+	t.Run("verify JWT authorizer claims", func(t *testing.T) {
+		lambdaReq := events.APIGatewayProxyRequest{}
+		lambdaReq.RequestContext.Authorizer = map[string]interface{}{"jwt": map[string]interface{}{"claims": map[string]interface{}{"sub": "user-1"}}}
+		assert.Equal(t, "user-1", Claims(lambdaReq)["sub"])
+	})
+	t.Run("verify Lambda authorizer context", func(t *testing.T) {
+		lambdaReq := events.APIGatewayProxyRequest{}
+		lambdaReq.RequestContext.Authorizer = map[string]interface{}{"sub": "user-1"}
+		assert.Equal(t, "user-1", Claims(lambdaReq)["sub"])
+	})
+}
+
+func TestCognitoIdentityAuthorizer(t *testing.T) {
+	lambdaReq := events.APIGatewayProxyRequest{PathParameters: map[string]string{DefaultKeyParameter: S3FileName}}
+	lambdaReq.RequestContext.Identity.CognitoIdentityID = "us-east-1:0b5c2e1a-identity"
+
+	t.Run("verify keys follow the Amplify Storage convention", func(t *testing.T) {
+		for accessLevel, expected := range map[AccessLevel]string{
+			AccessLevelPublic:    "public/" + S3FileName,
+			AccessLevelProtected: "protected/us-east-1:0b5c2e1a-identity/" + S3FileName,
+			AccessLevelPrivate:   "private/us-east-1:0b5c2e1a-identity/" + S3FileName,
+		} {
+			config := Config{Region: Region, Bucket: S3Bucket, Authorizer: CognitoIdentityAuthorizer(accessLevel)}
+
+			key, err := config.requestKey(context.Background(), lambdaReq)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, key)
+		}
+	})
+	t.Run("verify requests without a Cognito identity are forbidden", func(t *testing.T) {
+		config := Config{Region: Region, Bucket: S3Bucket, Authorizer: CognitoIdentityAuthorizer(AccessLevelPrivate)}
+
+		unauthenticatedReq := lambdaReq
+		unauthenticatedReq.RequestContext.Identity.CognitoIdentityID = ""
+
+		_, err := config.requestKey(context.Background(), unauthenticatedReq)
+		assert.True(t, errors.Is(err, ErrForbidden))
+	})
+	t.Run("verify unknown access levels are forbidden", func(t *testing.T) {
+		config := Config{Region: Region, Bucket: S3Bucket, Authorizer: CognitoIdentityAuthorizer("shared")}
+
+		_, err := config.requestKey(context.Background(), lambdaReq)
+		assert.True(t, errors.Is(err, ErrForbidden))
+	})
+}
+
+func TestAuthorizer(t *testing.T) {
+	lambdaReq := events.APIGatewayProxyRequest{PathParameters: map[string]string{DefaultKeyParameter: S3FileName}}
+	lambdaReq.RequestContext.Authorizer = map[string]interface{}{"claims": map[string]interface{}{"sub": "user-1"}}
+
+	t.Run("verify requests without the claim are forbidden", func(t *testing.T) {
+		config := Config{Region: Region, Bucket: S3Bucket, Authorizer: ClaimAuthorizer("email")}
+
+		_, err := config.requestKey(context.Background(), lambdaReq)
+		assert.True(t, errors.Is(err, ErrForbidden))
+
+		for _, handler := range []Handler{NewUploadHandler(config), NewDownloadHandler(config), NewDeleteHandler(config)} {
+			res, err := handler(context.Background(), lambdaReq)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		}
+	})
+	t.Run("verify the Authorizer's error is kept", func(t *testing.T) {
+		errUnknownUser := errors.New("unknown user")
+		config := Config{Authorizer: func(context.Context, events.APIGatewayProxyRequest) (*Authorization, error) {
+			return nil, errUnknownUser
+		}}
+
+		_, err := config.authorize(context.Background(), lambdaReq)
+		assert.True(t, errors.Is(err, ErrForbidden))
+		assert.True(t, errors.Is(err, errUnknownUser))
+	})
+	t.Run("verify keys are scoped to the user", func(t *testing.T) {
+		config := Config{Region: Region, Bucket: S3Bucket, Authorizer: ClaimAuthorizer("sub")}
+
+		key, err := config.requestKey(context.Background(), lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, "user-1/"+S3FileName, key)
+	})
+	t.Run("verify keys can't escape the user's prefix", func(t *testing.T) {
+		config := Config{Region: Region, Bucket: S3Bucket, Authorizer: ClaimAuthorizer("sub")}
+
+		escapingReq := lambdaReq
+		escapingReq.PathParameters = map[string]string{DefaultKeyParameter: "../user-2/" + S3FileName}
+
+		_, err := config.requestKey(context.Background(), escapingReq)
+		assert.True(t, errors.Is(err, ErrCrossTenantKey))
+	})
+	t.Run("verify requests are unscoped without an Authorizer", func(t *testing.T) {
+		key, err := Config{}.requestKey(context.Background(), lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, S3FileName, key)
+	})
+}
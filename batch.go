@@ -0,0 +1,474 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"mime/multipart"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDeleteObjects is the most keys S3 deletes in a single DeleteObjects request.
+const maxDeleteObjects = 1000
+
+var ErrDuplicateKey = errors.New("the batch contains more than one file for the key")
+
+// KeyError is the error a batch operation failed with for a single key.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// Result reports what a batch operation did with each of its keys so one bad file doesn't obscure what happened to
+// the others. Keys are listed in the order they were given.
+type Result struct {
+	Succeeded []string
+	Failed    []*KeyError
+}
+
+// Err returns nil when every key succeeded. Otherwise it returns an error made of every KeyError in Failed in the
+// same way as errors.Join: its message has one line per key and its Unwrap() []error method lets errors.Is and
+// errors.As, from Go 1.20 on, match the error of any key.
+func (r *Result) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(r.Failed))
+	for _, keyErr := range r.Failed {
+		errs = append(errs, keyErr)
+	}
+
+	return &joinedError{errs: errs}
+}
+
+// KeyErr returns the error key failed with or nil if it didn't fail.
+func (r *Result) KeyErr(key string) error {
+	for _, keyErr := range r.Failed {
+		if keyErr.Key == key {
+			return keyErr.Err
+		}
+	}
+
+	return nil
+}
+
+// newResult sorts keys into a Result using the errors runConcurrently returned for them.
+func newResult(keys []string, errs map[string]error) *Result {
+	result := &Result{}
+
+	for _, key := range keys {
+		if err, ok := errs[key]; ok {
+			result.Failed = append(result.Failed, &KeyError{Key: key, Err: err})
+		} else {
+			result.Succeeded = append(result.Succeeded, key)
+		}
+	}
+
+	return result
+}
+
+// failAll is a Result in which every key failed with err.
+func failAll(keys []string, err error) *Result {
+	errs := map[string]error{}
+	for _, key := range keys {
+		errs[key] = err
+	}
+
+	return newResult(keys, errs)
+}
+
+// joinedError is what errors.Join returns. It's copied here since errors.Join needs Go 1.20.
+type joinedError struct {
+	errs []error
+}
+
+func (e *joinedError) Error() string {
+	messages := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+func (e *joinedError) Unwrap() []error {
+	return e.errs
+}
+
+// causeError is sentinel wrapped around the error that caused it. Unlike fmt.Errorf("%w: %s") both stay reachable
+// with errors.Is and errors.As, which fmt.Errorf can only do with two %w verbs from Go 1.20 on.
+type causeError struct {
+	sentinel error
+	cause    error
+}
+
+func wrapCause(sentinel, cause error) error {
+	return &causeError{sentinel: sentinel, cause: cause}
+}
+
+func (e *causeError) Error() string {
+	return e.sentinel.Error() + ": " + e.cause.Error()
+}
+
+func (e *causeError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *causeError) Unwrap() error {
+	return e.cause
+}
+
+// DownloadMany downloads every key in keys from bucket concurrently using a pool of WithConcurrency workers
+// (DefaultConcurrency by default) that share a single AWS Session. It returns the bytes of every file that was
+// downloaded successfully keyed by name along with a Result holding the error for every key that failed so one bad
+// key doesn't prevent the others from being returned. Duplicate keys are only downloaded once.
+func DownloadMany(region, bucket string, keys []string, opts ...Option) (map[string][]byte, *Result) {
+	files := map[string][]byte{}
+	uniqueKeys := dedupeKeys(keys)
+
+	if region == "" && !detectsBucketRegion(opts) {
+		return files, failAll(uniqueKeys, ErrParameterRegionEmpty)
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return files, failAll(uniqueKeys, err)
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return files, failAll(uniqueKeys, ErrNewAWSSession)
+	}
+
+	downloader := s3manager.NewDownloader(awsSession)
+
+	var mutex sync.Mutex
+
+	errs := runConcurrently(o.concurrency, uniqueKeys, func(key string) error {
+		if key == "" {
+			return ErrParameterNameEmpty
+		}
+
+		fileBytes, err := download(downloader, bucket, key, o)
+		if err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		files[key] = fileBytes
+		mutex.Unlock()
+
+		return nil
+	})
+
+	return files, newResult(uniqueKeys, errs)
+}
+
+// PresignMany presigns a GET URL valid for expiry for every key in keys concurrently using a pool of
+// WithConcurrency workers that share a single AWS Session. Presigning doesn't call S3 so it's quick, but signing
+// hundreds of URLs one after the other still adds up. It returns the URL of every key that was presigned keyed by
+// name along with a Result holding the error for every key that wasn't. Duplicate keys are only presigned once.
+func PresignMany(region, bucket string, keys []string, expiry time.Duration, opts ...Option) (map[string]string, *Result) {
+	presignedURLs := map[string]string{}
+	uniqueKeys := dedupeKeys(keys)
+
+	if region == "" && !detectsBucketRegion(opts) {
+		return presignedURLs, failAll(uniqueKeys, ErrParameterRegionEmpty)
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return presignedURLs, failAll(uniqueKeys, err)
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return presignedURLs, failAll(uniqueKeys, ErrNewAWSSession)
+	}
+
+	s3Client := s3.New(awsSession)
+
+	var mutex sync.Mutex
+
+	errs := runConcurrently(o.concurrency, uniqueKeys, func(key string) error {
+		if key == "" {
+			return ErrParameterNameEmpty
+		}
+
+		getObjectReq, _ := s3Client.GetObjectRequest(o.presignedGetObjectInput(bucket, key))
+
+		presignedURL, err := getObjectReq.Presign(expiry)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrPresigningURL, err)
+		}
+
+		mutex.Lock()
+		presignedURLs[key] = presignedURL
+		mutex.Unlock()
+
+		return nil
+	})
+
+	return presignedURLs, newResult(uniqueKeys, errs)
+}
+
+// UploadMany uploads every file in fileHeaders to bucket under prefix, named after its Filename, concurrently using a
+// pool of WithConcurrency workers that share a single AWS Session. It returns the UploadRes of every file that was
+// uploaded successfully, in the order of fileHeaders, along with a Result keyed by the S3 key of each file. Filenames
+// are normalized first, see normalizeFilename. Files without a Filename, files whose Filename has a .. segment or
+// would otherwise put them outside of prefix, and files whose key is shared with an earlier file, aren't uploaded.
+// They're listed last in Result.Failed with ErrParameterNameEmpty, ErrInvalidKey and ErrDuplicateKey respectively.
+// Use WithManifest to also write a Manifest of the uploaded files for downstream jobs.
+func UploadMany(fileHeaders []*multipart.FileHeader, region, bucket, prefix string, opts ...Option) ([]*UploadRes, *Result) {
+	keys := make([]string, 0, len(fileHeaders))
+	keyHeaders := map[string]*multipart.FileHeader{}
+	var rejected []*KeyError
+
+	for _, fileHeader := range fileHeaders {
+		// normalizeFilename keeps only the last segment so names like ../../etc/passwd are refused rather than renamed
+		if containsString(strings.Split(strings.ReplaceAll(fileHeader.Filename, `\`, "/"), "/"), "..") {
+			rejected = append(rejected, &KeyError{Key: fileHeader.Filename, Err: fmt.Errorf("%w: %s has a .. segment", ErrInvalidKey, fileHeader.Filename)})
+			continue
+		}
+
+		filename := normalizeFilename(fileHeader)
+		if filename == "" {
+			rejected = append(rejected, &KeyError{Err: ErrParameterNameEmpty})
+			continue
+		}
+
+		key := path.Join(prefix, filename)
+		if cleanPrefix := path.Clean(prefix); cleanPrefix != "." && !strings.HasPrefix(key, strings.TrimSuffix(cleanPrefix, "/")+"/") {
+			rejected = append(rejected, &KeyError{Key: key, Err: fmt.Errorf("%w: %s is outside of %s", ErrInvalidKey, key, prefix)})
+			continue
+		}
+
+		if _, ok := keyHeaders[key]; ok {
+			rejected = append(rejected, &KeyError{Key: key, Err: fmt.Errorf("%w: %s", ErrDuplicateKey, key)})
+			continue
+		}
+
+		keyHeaders[key] = fileHeader
+		keys = append(keys, key)
+	}
+
+	fail := func(err error) ([]*UploadRes, *Result) {
+		result := failAll(keys, err)
+		result.Failed = append(result.Failed, rejected...)
+		return nil, result
+	}
+
+	if region == "" && !detectsBucketRegion(opts) {
+		return fail(ErrParameterRegionEmpty)
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return fail(err)
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return fail(ErrNewAWSSession)
+	}
+
+	uploader := s3manager.NewUploader(awsSession)
+
+	var mutex sync.Mutex
+	uploadResults := map[string]*UploadRes{}
+
+	errs := runConcurrently(o.concurrency, keys, func(key string) error {
+		fileHeader := keyHeaders[key]
+
+		if err := fileTooLarge(fileHeader, o); err != nil {
+			return err
+		}
+
+		uploadRes, err := uploadHeader(uploader, fileHeader, bucket, key, o)
+		if err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		uploadResults[key] = uploadRes
+		mutex.Unlock()
+
+		return nil
+	})
+
+	result := newResult(keys, errs)
+	result.Failed = append(result.Failed, rejected...)
+
+	uploadResultsInOrder := make([]*UploadRes, 0, len(result.Succeeded))
+	for _, key := range result.Succeeded {
+		uploadResultsInOrder = append(uploadResultsInOrder, uploadResults[key])
+	}
+
+	if o.manifestName != "" {
+		manifestKey := path.Join(prefix, o.manifestName)
+		if err = writeManifest(uploader.S3, bucket, manifestKey, newManifest(bucket, uploadResultsInOrder, result), o); err != nil {
+			result.Failed = append(result.Failed, &KeyError{Key: manifestKey, Err: err})
+		}
+	}
+
+	return uploadResultsInOrder, result
+}
+
+// DeleteMany deletes every key in keys from bucket using as few DeleteObjects requests as possible. It returns a
+// Result holding the error for every key S3 couldn't delete. Like Delete, keys that don't exist are deleted
+// successfully.
+func DeleteMany(region, bucket string, keys []string, opts ...Option) *Result {
+	if region == "" && !detectsBucketRegion(opts) {
+		return failAll(keys, ErrParameterRegionEmpty)
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return failAll(keys, err)
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return failAll(keys, ErrNewAWSSession)
+	}
+
+	s3Client := s3.New(awsSession)
+
+	errs := map[string]error{}
+	var objects []*s3.ObjectIdentifier
+
+	for _, key := range keys {
+		if key == "" {
+			errs[key] = ErrParameterNameEmpty
+			continue
+		}
+
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+	}
+
+	for start := 0; start < len(objects); start += maxDeleteObjects {
+		end := start + maxDeleteObjects
+		if end > len(objects) {
+			end = len(objects)
+		}
+
+		deleteObjectsOutput, err := s3Client.DeleteObjectsWithContext(o.context(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{
+				Objects: objects[start:end],
+				Quiet:   aws.Bool(true), // only report the keys that failed
+			},
+		})
+		if err != nil {
+			for _, object := range objects[start:end] {
+				errs[aws.StringValue(object.Key)] = fmt.Errorf("%w: %s", ErrDeletingS3Object, err)
+			}
+			continue
+		}
+
+		for _, deleteErr := range deleteObjectsOutput.Errors {
+			errs[aws.StringValue(deleteErr.Key)] = fmt.Errorf("%w: %s", ErrDeletingS3Object, aws.StringValue(deleteErr.Message))
+		}
+	}
+
+	for _, object := range objects {
+		key := aws.StringValue(object.Key)
+		if errs[key] == nil {
+			if err = invalidate(key, o); err != nil {
+				errs[key] = err
+			}
+		}
+	}
+
+	return newResult(keys, errs)
+}
+
+// transferSemaphore bounds how many S3 transfers run at once across every call sharing it. A nil transferSemaphore
+// doesn't limit anything.
+type transferSemaphore chan struct{}
+
+// acquire waits for a free slot or for ctx to be done.
+func (s transferSemaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire.
+func (s transferSemaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// runConcurrently calls fn for every key using concurrency goroutines and returns the error for each key fn failed on.
+func runConcurrently(concurrency int, keys []string, fn func(key string) error) map[string]error {
+	errs := map[string]error{}
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	keyChan := make(chan string)
+
+	for i := 0; i < concurrency && i < len(keys); i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for key := range keyChan {
+				if err := fn(key); err != nil {
+					mutex.Lock()
+					errs[key] = err
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, key := range keys {
+		keyChan <- key
+	}
+	close(keyChan)
+
+	waitGroup.Wait()
+
+	return errs
+}
+
+// dedupeKeys returns keys without duplicates, in the order each key first appears.
+func dedupeKeys(keys []string) []string {
+	uniqueKeys := make([]string, 0, len(keys))
+	seenKeys := map[string]bool{}
+	for _, key := range keys {
+		if !seenKeys[key] {
+			seenKeys[key] = true
+			uniqueKeys = append(uniqueKeys, key)
+		}
+	}
+
+	return uniqueKeys
+}
@@ -0,0 +1,177 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jgroeneveld/trial/assert"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResult(t *testing.T) {
+	t.Run("verify Err is nil when every key succeeded", func(t *testing.T) {
+		result := newResult([]string{S3FileName, EmptyFileName}, map[string]error{})
+		assert.Equal(t, 2, len(result.Succeeded))
+		assert.Nil(t, result.Err())
+	})
+	t.Run("verify Err joins the error of every failed key", func(t *testing.T) {
+		result := newResult([]string{S3FileName, EmptyFileName, "does_not_exist"}, map[string]error{
+			EmptyFileName:    ErrEmptyFileDownloaded,
+			"does_not_exist": ErrDownloadingS3File,
+		})
+		assert.Equal(t, 1, len(result.Succeeded))
+		assert.Equal(t, S3FileName, result.Succeeded[0])
+		assert.Equal(t, 2, len(result.Failed))
+		assert.Equal(t, EmptyFileName, result.Failed[0].Key)
+		assert.True(t, errors.Is(result.Failed[0], ErrEmptyFileDownloaded))
+		assert.True(t, errors.Is(result.KeyErr("does_not_exist"), ErrDownloadingS3File))
+		assert.Nil(t, result.KeyErr(S3FileName))
+
+		err := result.Err()
+		assert.Equal(t, 2, len(strings.Split(err.Error(), "\n")))
+		assert.Equal(t, 2, len(err.(interface{ Unwrap() []error }).Unwrap()))
+	})
+}
+
+func TestDownloadMany(t *testing.T) {
+	t.Run("verify every key errs when region is empty", func(t *testing.T) {
+		files, result := DownloadMany("", S3Bucket, []string{S3FileName, EmptyFileName})
+		assert.Equal(t, 0, len(files))
+		assert.Equal(t, 2, len(result.Failed))
+		assert.True(t, errors.Is(result.KeyErr(S3FileName), ErrParameterRegionEmpty))
+		assert.True(t, errors.Is(result.KeyErr(EmptyFileName), ErrParameterRegionEmpty))
+	})
+	t.Run("verify every key errs when bucket is empty", func(t *testing.T) {
+		files, result := DownloadMany(Region, "", []string{S3FileName})
+		assert.Equal(t, 0, len(files))
+		assert.True(t, errors.Is(result.KeyErr(S3FileName), ErrParameterBucketEmpty))
+	})
+	t.Run("verify DownloadMany reports per key errors alongside successful downloads", func(t *testing.T) {
+		files, result := DownloadMany(Region, S3Bucket, []string{S3FileName, S3FileName, "", "does_not_exist"}, WithConcurrency(2))
+		assert.Equal(t, 1, len(files))
+		assert.Equal(t, SampleFileSizeBytes, len(files[S3FileName]))
+		assert.Equal(t, 1, len(result.Succeeded))
+		assert.Equal(t, 2, len(result.Failed))
+		assert.True(t, errors.Is(result.KeyErr(""), ErrParameterNameEmpty))
+		assert.True(t, errors.Is(result.KeyErr("does_not_exist"), ErrDownloadingS3File))
+	})
+}
+
+func TestPresignMany(t *testing.T) {
+	t.Run("verify every key errs when region is empty", func(t *testing.T) {
+		presignedURLs, result := PresignMany("", S3Bucket, []string{S3FileName}, time.Minute)
+		assert.Equal(t, 0, len(presignedURLs))
+		assert.True(t, errors.Is(result.KeyErr(S3FileName), ErrParameterRegionEmpty))
+	})
+	t.Run("verify every unique key is presigned", func(t *testing.T) {
+		keys := make([]string, 0, 200)
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("gallery/%d.jpg", i)
+			keys = append(keys, key, key)
+		}
+
+		presignedURLs, result := PresignMany(Region, S3Bucket, append(keys, ""), time.Minute, WithConcurrency(8))
+		assert.Equal(t, 100, len(presignedURLs))
+		assert.Equal(t, 100, len(result.Succeeded))
+		assert.True(t, errors.Is(result.KeyErr(""), ErrParameterNameEmpty))
+		assert.True(t, strings.Contains(presignedURLs["gallery/42.jpg"], "gallery/42.jpg"))
+		assert.True(t, strings.Contains(presignedURLs["gallery/42.jpg"], "X-Amz-Expires=60"))
+	})
+}
+
+func TestUploadMany(t *testing.T) {
+	t.Run("verify files without a name or with a duplicate key are rejected", func(t *testing.T) {
+		fileHeaders := []*multipart.FileHeader{
+			generateFileHeader(t, SampleFileName, []byte("contents")),
+			generateFileHeader(t, SampleFileName, []byte("other contents")),
+			generateFileHeader(t, "unnamed", []byte("contents")),
+		}
+		fileHeaders[2].Filename = ""
+
+		uploadResults, result := UploadMany(fileHeaders, "", S3Bucket, "batch")
+		assert.Equal(t, 0, len(uploadResults))
+		assert.Equal(t, 3, len(result.Failed))
+		assert.True(t, errors.Is(result.Failed[0], ErrParameterRegionEmpty))
+		assert.Equal(t, "batch/"+SampleFileName, result.Failed[1].Key)
+		assert.True(t, errors.Is(result.Failed[1], ErrDuplicateKey))
+		assert.True(t, errors.Is(result.Failed[2], ErrParameterNameEmpty))
+	})
+	t.Run("verify files whose names would leave the prefix are rejected", func(t *testing.T) {
+		fileHeaders := []*multipart.FileHeader{
+			generateFileHeader(t, "passwd", []byte("contents")),
+			generateFileHeader(t, "secrets.csv", []byte("contents")),
+		}
+		fileHeaders[0].Filename = "../../etc/passwd"
+		fileHeaders[1].Filename = `..\..\secrets.csv`
+
+		uploadResults, result := UploadMany(fileHeaders, Region, S3Bucket, "batch")
+		assert.Equal(t, 0, len(uploadResults))
+		assert.Equal(t, 2, len(result.Failed))
+		for _, keyErr := range result.Failed {
+			assert.True(t, errors.Is(keyErr, ErrInvalidKey))
+		}
+	})
+	t.Run("verify UploadMany and DeleteMany report every key", func(t *testing.T) {
+		fileHeaders := []*multipart.FileHeader{
+			generateFileHeader(t, SampleFileName, []byte("contents")),
+			generateFileHeader(t, "other_"+SampleFileName, []byte("other contents")),
+		}
+
+		uploadResults, result := UploadMany(fileHeaders, Region, S3Bucket, "batch", WithConcurrency(2))
+		assert.Nil(t, result.Err())
+		assert.Equal(t, 2, len(uploadResults))
+		assert.Equal(t, "batch/"+SampleFileName, uploadResults[0].Key)
+		assert.Equal(t, "batch/other_"+SampleFileName, uploadResults[1].Key)
+
+		result = DeleteMany(Region, S3Bucket, []string{uploadResults[0].Key, uploadResults[1].Key, ""})
+		assert.Equal(t, 2, len(result.Succeeded))
+		assert.Equal(t, 1, len(result.Failed))
+		assert.True(t, errors.Is(result.KeyErr(""), ErrParameterNameEmpty))
+	})
+}
+
+func TestDeleteMany(t *testing.T) {
+	t.Run("verify every key errs when bucket is empty", func(t *testing.T) {
+		result := DeleteMany(Region, "", []string{S3FileName, EmptyFileName})
+		assert.Equal(t, 0, len(result.Succeeded))
+		assert.True(t, errors.Is(result.KeyErr(EmptyFileName), ErrParameterBucketEmpty))
+	})
+}
+
+func TestWithMaxConcurrentTransfers(t *testing.T) {
+	t.Run("verify the limit is shared by every call made with the option", func(t *testing.T) {
+		maxTransfers := WithMaxConcurrentTransfers(1)
+
+		first := newOptions([]Option{maxTransfers})
+		second := newOptions([]Option{maxTransfers})
+
+		assert.Nil(t, first.transfers.acquire(context.Background()))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.True(t, errors.Is(second.transfers.acquire(ctx), context.Canceled))
+
+		first.transfers.release()
+		assert.Nil(t, second.transfers.acquire(context.Background()))
+		second.transfers.release()
+	})
+	t.Run("verify transfers wait for a free slot", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		maxTransfers := WithMaxConcurrentTransfers(1)
+		assert.Nil(t, newOptions([]Option{maxTransfers}).transfers.acquire(context.Background()))
+
+		_, err := Download(Region, S3Bucket, S3FileName, maxTransfers, WithContext(ctx))
+		assert.True(t, errors.Is(err, ErrDownloadingS3File))
+	})
+	t.Run("verify there's no limit by default", func(t *testing.T) {
+		o := newOptions([]Option{WithMaxConcurrentTransfers(0)})
+		assert.True(t, o.transfers == nil)
+		assert.Nil(t, o.transfers.acquire(context.Background()))
+		o.transfers.release()
+	})
+}
@@ -0,0 +1,303 @@
+package lambda_s3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3control"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+)
+
+// BatchReportPrefix is the prefix, in the manifest's bucket, S3 Batch Operations writes the report of the tasks that
+// failed in jobs created by CreateBatchJob under.
+const BatchReportPrefix = "batch-reports"
+
+// batchJobPriority is the priority jobs are created with. S3 runs jobs with higher priorities first.
+const batchJobPriority = 10
+
+// The result codes of S3 Batch Operations tasks.
+const (
+	BatchResultSucceeded        = "Succeeded"
+	BatchResultTemporaryFailure = "TemporaryFailure"
+	BatchResultPermanentFailure = "PermanentFailure"
+)
+
+var (
+	ErrCreatingBatchJob        = errors.New("unable to create the S3 Batch Operations job")
+	ErrParameterBatchOperation = errors.New("required parameter operation is missing or invalid")
+	ErrParsingBatchTask        = errors.New("unable to parse the S3 Batch Operations task")
+)
+
+// BatchManifest is the CSV file in Bucket under Key listing the objects an S3 Batch Operations job acts on, one
+// bucket,key line per object with the key URL encoded. With VersionIDs set each line has the version ID of the
+// object as a third column. ETag is looked up with a HeadObject request when it's empty.
+type BatchManifest struct {
+	Bucket     string
+	Key        string
+	ETag       string
+	VersionIDs bool
+}
+
+// BatchOperation is what an S3 Batch Operations job does to every object in its manifest. Use BatchCopy, BatchTag,
+// BatchRestore, or BatchInvokeLambda.
+type BatchOperation func(partition string) (*s3control.JobOperation, error)
+
+// BatchCopy copies every object into targetBucket under targetPrefix, keeping their keys after the prefix.
+func BatchCopy(targetBucket, targetPrefix string) BatchOperation {
+	return func(partition string) (*s3control.JobOperation, error) {
+		if err := validateBucket(targetBucket); err != nil {
+			return nil, err
+		}
+
+		copyOperation := &s3control.S3CopyObjectOperation{
+			TargetResource: aws.String(bucketARN(partition, targetBucket)),
+		}
+
+		if targetPrefix != "" {
+			copyOperation.TargetKeyPrefix = aws.String(targetPrefix)
+		}
+
+		return &s3control.JobOperation{S3PutObjectCopy: copyOperation}, nil
+	}
+}
+
+// BatchTag replaces the tags of every object with tags.
+func BatchTag(tags map[string]string) BatchOperation {
+	return func(string) (*s3control.JobOperation, error) {
+		keys := make([]string, 0, len(tags))
+		for key := range tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		tagSet := make([]*s3control.S3Tag, 0, len(tags))
+		for _, key := range keys {
+			tagSet = append(tagSet, &s3control.S3Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+		}
+
+		return &s3control.JobOperation{S3PutObjectTagging: &s3control.S3SetObjectTaggingOperation{TagSet: tagSet}}, nil
+	}
+}
+
+// BatchRestore restores every archived object for days, like Restore. Batch Operations only supports
+// RestoreTierStandard and RestoreTierBulk.
+func BatchRestore(days int64, tier RestoreTier) BatchOperation {
+	return func(string) (*s3control.JobOperation, error) {
+		var glacierJobTier string
+		switch tier {
+		case RestoreTierStandard:
+			glacierJobTier = s3control.S3GlacierJobTierStandard
+		case RestoreTierBulk:
+			glacierJobTier = s3control.S3GlacierJobTierBulk
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedRestoreTier, tier)
+		}
+
+		if days < 1 {
+			return nil, ErrParameterDays
+		}
+
+		return &s3control.JobOperation{S3InitiateRestoreObject: &s3control.S3InitiateRestoreObjectOperation{
+			ExpirationInDays: aws.Int64(days),
+			GlacierJobTier:   aws.String(glacierJobTier),
+		}}, nil
+	}
+}
+
+// BatchInvokeLambda invokes the Lambda function functionARN with every object. The function receives an
+// events.S3BatchJobEvent which BatchTasksFromEvent parses.
+func BatchInvokeLambda(functionARN string) BatchOperation {
+	return func(string) (*s3control.JobOperation, error) {
+		if parsed, err := arn.Parse(functionARN); err != nil || parsed.Service != "lambda" {
+			return nil, fmt.Errorf("%w: %s is not a Lambda function ARN", ErrParameterBatchOperation, functionARN)
+		}
+
+		return &s3control.JobOperation{LambdaInvoke: &s3control.LambdaInvokeOperation{FunctionArn: aws.String(functionARN)}}, nil
+	}
+}
+
+// CreateBatchJob creates an S3 Batch Operations job that runs operation on every object listed in manifest as
+// roleARN, which needs permission to read the manifest, perform the operation, and write the report, and returns
+// the job's ID. Jobs start without needing to be confirmed. A report of the tasks that failed is written to the
+// manifest's bucket under BatchReportPrefix. The account the job is created in is the account of the caller.
+func CreateBatchJob(region string, manifest BatchManifest, operation BatchOperation, roleARN string, opts ...Option) (string, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return "", ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(manifest.Bucket); err != nil {
+		return "", err
+	}
+
+	if manifest.Key == "" {
+		return "", ErrParameterNameEmpty
+	}
+
+	if !isRoleARN(roleARN) {
+		return "", fmt.Errorf("%w: %s", ErrParameterRoleARN, roleARN)
+	}
+
+	if operation == nil {
+		return "", ErrParameterBatchOperation
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, manifest.Bucket)
+	if err != nil {
+		return "", ErrNewAWSSession
+	}
+
+	region = aws.StringValue(awsSession.Config.Region)
+
+	jobOperation, err := operation(partition(region))
+	if err != nil {
+		return "", err
+	}
+
+	if manifest.ETag == "" {
+		headOutput, err := s3.New(awsSession).HeadObjectWithContext(o.context(), &s3.HeadObjectInput{
+			Bucket: aws.String(manifest.Bucket),
+			Key:    aws.String(manifest.Key),
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return "", fmt.Errorf("%w: %s", ErrObjectNotFound, manifest.Key)
+			}
+			return "", ErrHeadingS3Object
+		}
+
+		manifest.ETag = aws.StringValue(headOutput.ETag)
+	}
+
+	identity, err := sts.New(awsSession).GetCallerIdentityWithContext(o.context(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrCreatingBatchJob, err)
+	}
+
+	token := make([]byte, 16)
+	if _, err = rand.Read(token); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrCreatingBatchJob, err)
+	}
+
+	createJobOutput, err := s3control.New(awsSession).CreateJobWithContext(o.context(), &s3control.CreateJobInput{
+		AccountId:            identity.Account,
+		ClientRequestToken:   aws.String(hex.EncodeToString(token)),
+		ConfirmationRequired: aws.Bool(false),
+		Manifest:             manifest.jobManifest(partition(region)),
+		Operation:            jobOperation,
+		Priority:             aws.Int64(batchJobPriority),
+		Report: &s3control.JobReport{
+			Bucket:      aws.String(bucketARN(partition(region), manifest.Bucket)),
+			Enabled:     aws.Bool(true),
+			Format:      aws.String(s3control.JobReportFormatReportCsv20180820),
+			Prefix:      aws.String(BatchReportPrefix),
+			ReportScope: aws.String(s3control.JobReportScopeFailedTasksOnly),
+		},
+		RoleArn: aws.String(roleARN),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrCreatingBatchJob, err)
+	}
+
+	return aws.StringValue(createJobOutput.JobId), nil
+}
+
+func (m BatchManifest) jobManifest(partition string) *s3control.JobManifest {
+	fields := []string{s3control.JobManifestFieldNameBucket, s3control.JobManifestFieldNameKey}
+	if m.VersionIDs {
+		fields = append(fields, s3control.JobManifestFieldNameVersionId)
+	}
+
+	return &s3control.JobManifest{
+		Location: &s3control.JobManifestLocation{
+			ETag:      aws.String(m.ETag),
+			ObjectArn: aws.String(bucketARN(partition, m.Bucket) + "/" + m.Key),
+		},
+		Spec: &s3control.JobManifestSpec{
+			Fields: aws.StringSlice(fields),
+			Format: aws.String(s3control.JobManifestFormatS3batchOperationsCsv20180820),
+		},
+	}
+}
+
+func bucketARN(partition, bucket string) string {
+	return arn.ARN{Partition: partition, Service: "s3", Resource: bucket}.String()
+}
+
+// BatchTask is an object an S3 Batch Operations job invoked a Lambda function to act on with BatchInvokeLambda. Its
+// ObjectRef's Region is the Lambda's own region from RegionEnvVar since the event doesn't say.
+type BatchTask struct {
+	ObjectRef
+	TaskID string `json:"taskID"`
+}
+
+// BatchTasksFromEvent returns a BatchTask for every task in event with the keys, which S3 URL encodes, decoded.
+func BatchTasksFromEvent(event events.S3BatchJobEvent) ([]*BatchTask, error) {
+	batchTasks := make([]*BatchTask, 0, len(event.Tasks))
+
+	for _, task := range event.Tasks {
+		parsed, err := arn.Parse(task.S3BucketARN)
+		if err != nil {
+			return nil, fmt.Errorf("%w: task %s: %s", ErrParsingBatchTask, task.TaskID, err)
+		}
+
+		key, err := url.QueryUnescape(task.S3Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrDecodingEventKey, task.S3Key)
+		}
+
+		batchTasks = append(batchTasks, &BatchTask{
+			ObjectRef: ObjectRef{
+				Region:    os.Getenv(RegionEnvVar),
+				Bucket:    parsed.Resource,
+				Key:       key,
+				VersionID: task.S3VersionID,
+			},
+			TaskID: task.TaskID,
+		})
+	}
+
+	return batchTasks, nil
+}
+
+// Result is the result of the task for the job's completion report. A nil err succeeds with message. Otherwise
+// errors that StatusCode considers the server's fault, such as S3 failing, are temporary failures S3 retries and
+// the rest are permanent failures with the error as their message.
+func (t *BatchTask) Result(message string, err error) events.S3BatchJobResult {
+	result := events.S3BatchJobResult{
+		TaskID:       t.TaskID,
+		ResultCode:   BatchResultSucceeded,
+		ResultString: message,
+	}
+
+	if err != nil {
+		result.ResultCode = BatchResultPermanentFailure
+		if StatusCode(err) >= http.StatusInternalServerError {
+			result.ResultCode = BatchResultTemporaryFailure
+		}
+		result.ResultString = err.Error()
+	}
+
+	return result
+}
+
+// BatchJobResponse is the response to event a Lambda function invoked by an S3 Batch Operations job returns.
+// Tasks missing from results are treated as permanent failures.
+func BatchJobResponse(event events.S3BatchJobEvent, results []events.S3BatchJobResult) events.S3BatchJobResponse {
+	return events.S3BatchJobResponse{
+		InvocationSchemaVersion: event.InvocationSchemaVersion,
+		TreatMissingKeysAs:      BatchResultPermanentFailure,
+		InvocationID:            event.InvocationID,
+		Results:                 results,
+	}
+}
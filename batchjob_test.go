@@ -0,0 +1,136 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3control"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+const batchRoleARN = "arn:aws:iam::123456789012:role/batch-operations"
+
+func TestBatchOperations(t *testing.T) {
+	t.Run("verify BatchCopy targets the bucket ARN in the partition", func(t *testing.T) {
+		jobOperation, err := BatchCopy(S3Bucket, "copies/")("aws-cn")
+		assert.Nil(t, err)
+		assert.Equal(t, "arn:aws-cn:s3:::"+S3Bucket, aws.StringValue(jobOperation.S3PutObjectCopy.TargetResource))
+		assert.Equal(t, "copies/", aws.StringValue(jobOperation.S3PutObjectCopy.TargetKeyPrefix))
+	})
+	t.Run("verify BatchCopy err when the target bucket is empty", func(t *testing.T) {
+		_, err := BatchCopy("", "copies/")("aws")
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify BatchTag sorts the tags by key", func(t *testing.T) {
+		jobOperation, err := BatchTag(map[string]string{"team": "media", "env": "prod"})("aws")
+		assert.Nil(t, err)
+
+		tagSet := jobOperation.S3PutObjectTagging.TagSet
+		assert.Equal(t, 2, len(tagSet))
+		assert.Equal(t, "env", aws.StringValue(tagSet[0].Key))
+		assert.Equal(t, "prod", aws.StringValue(tagSet[0].Value))
+		assert.Equal(t, "team", aws.StringValue(tagSet[1].Key))
+	})
+	t.Run("verify BatchRestore maps the tier", func(t *testing.T) {
+		jobOperation, err := BatchRestore(7, RestoreTierBulk)("aws")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(7), aws.Int64Value(jobOperation.S3InitiateRestoreObject.ExpirationInDays))
+		assert.Equal(t, s3control.S3GlacierJobTierBulk, aws.StringValue(jobOperation.S3InitiateRestoreObject.GlacierJobTier))
+	})
+	t.Run("verify BatchRestore err when the tier isn't supported by Batch Operations", func(t *testing.T) {
+		_, err := BatchRestore(7, RestoreTierExpedited)("aws")
+		assert.True(t, errors.Is(err, ErrUnsupportedRestoreTier))
+	})
+	t.Run("verify BatchRestore err when days is less than one", func(t *testing.T) {
+		_, err := BatchRestore(0, RestoreTierStandard)("aws")
+		assert.True(t, errors.Is(err, ErrParameterDays))
+	})
+	t.Run("verify BatchInvokeLambda err when the ARN isn't a Lambda function", func(t *testing.T) {
+		_, err := BatchInvokeLambda(batchRoleARN)("aws")
+		assert.True(t, errors.Is(err, ErrParameterBatchOperation))
+
+		jobOperation, err := BatchInvokeLambda("arn:aws:lambda:us-east-1:123456789012:function:resize")("aws")
+		assert.Nil(t, err)
+		assert.Equal(t, "arn:aws:lambda:us-east-1:123456789012:function:resize", aws.StringValue(jobOperation.LambdaInvoke.FunctionArn))
+	})
+}
+
+func TestCreateBatchJob(t *testing.T) {
+	manifest := BatchManifest{Bucket: S3Bucket, Key: "manifests/photos.csv"}
+
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		_, err := CreateBatchJob("", manifest, BatchTag(nil), batchRoleARN)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when the manifest bucket is empty", func(t *testing.T) {
+		_, err := CreateBatchJob(Region, BatchManifest{Key: manifest.Key}, BatchTag(nil), batchRoleARN)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify err when the manifest key is empty", func(t *testing.T) {
+		_, err := CreateBatchJob(Region, BatchManifest{Bucket: S3Bucket}, BatchTag(nil), batchRoleARN)
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+	})
+	t.Run("verify err when roleARN isn't a role", func(t *testing.T) {
+		_, err := CreateBatchJob(Region, manifest, BatchTag(nil), "arn:aws:iam::123456789012:user/alice")
+		assert.True(t, errors.Is(err, ErrParameterRoleARN))
+	})
+	t.Run("verify err when operation is nil", func(t *testing.T) {
+		_, err := CreateBatchJob(Region, manifest, nil, batchRoleARN)
+		assert.True(t, errors.Is(err, ErrParameterBatchOperation))
+	})
+	t.Run("verify the manifest lists version IDs when asked to", func(t *testing.T) {
+		jobManifest := BatchManifest{Bucket: S3Bucket, Key: "manifest.csv", ETag: "etag", VersionIDs: true}.jobManifest("aws")
+		assert.Equal(t, "arn:aws:s3:::"+S3Bucket+"/manifest.csv", aws.StringValue(jobManifest.Location.ObjectArn))
+		assert.Equal(t, 3, len(jobManifest.Spec.Fields))
+		assert.Equal(t, s3control.JobManifestFieldNameVersionId, aws.StringValue(jobManifest.Spec.Fields[2]))
+	})
+}
+
+func TestBatchTasksFromEvent(t *testing.T) {
+	event := events.S3BatchJobEvent{
+		InvocationSchemaVersion: "1.0",
+		InvocationID:            "invocation",
+		Tasks: []events.S3BatchJobTask{
+			{TaskID: "a", S3Key: "photos/summer+2023%2Fbeach.jpg", S3VersionID: "v1", S3BucketARN: "arn:aws:s3:::" + S3Bucket},
+			{TaskID: "b", S3Key: "photos/c.jpg", S3BucketARN: "arn:aws:s3:::" + S3Bucket},
+		},
+	}
+
+	t.Run("verify tasks are parsed with their keys decoded", func(t *testing.T) {
+		t.Setenv(RegionEnvVar, Region)
+
+		batchTasks, err := BatchTasksFromEvent(event)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(batchTasks))
+		assert.Equal(t, "a", batchTasks[0].TaskID)
+		assert.Equal(t, Region, batchTasks[0].Region)
+		assert.Equal(t, S3Bucket, batchTasks[0].Bucket)
+		assert.Equal(t, "photos/summer 2023/beach.jpg", batchTasks[0].Key)
+		assert.Equal(t, "v1", batchTasks[0].VersionID)
+	})
+	t.Run("verify err when the bucket ARN is invalid", func(t *testing.T) {
+		_, err := BatchTasksFromEvent(events.S3BatchJobEvent{Tasks: []events.S3BatchJobTask{{TaskID: "a", S3Key: "k", S3BucketARN: S3Bucket}}})
+		assert.True(t, errors.Is(err, ErrParsingBatchTask))
+	})
+	t.Run("verify err when the key can't be decoded", func(t *testing.T) {
+		_, err := BatchTasksFromEvent(events.S3BatchJobEvent{Tasks: []events.S3BatchJobTask{{TaskID: "a", S3Key: "%zz", S3BucketARN: "arn:aws:s3:::" + S3Bucket}}})
+		assert.True(t, errors.Is(err, ErrDecodingEventKey))
+	})
+	t.Run("verify results are temporary failures when S3 is at fault", func(t *testing.T) {
+		batchTask := &BatchTask{TaskID: "a"}
+
+		assert.Equal(t, BatchResultSucceeded, batchTask.Result("resized", nil).ResultCode)
+		assert.Equal(t, "resized", batchTask.Result("resized", nil).ResultString)
+		assert.Equal(t, BatchResultTemporaryFailure, batchTask.Result("", fmt.Errorf("%w: timeout", ErrDownloadingS3File)).ResultCode)
+		assert.Equal(t, BatchResultPermanentFailure, batchTask.Result("", ErrObjectNotFound).ResultCode)
+	})
+	t.Run("verify the response echoes the invocation", func(t *testing.T) {
+		response := BatchJobResponse(event, []events.S3BatchJobResult{{TaskID: "a", ResultCode: BatchResultSucceeded}})
+		assert.Equal(t, "1.0", response.InvocationSchemaVersion)
+		assert.Equal(t, "invocation", response.InvocationID)
+		assert.Equal(t, BatchResultPermanentFailure, response.TreatMissingKeysAs)
+		assert.Equal(t, 1, len(response.Results))
+	})
+}
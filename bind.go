@@ -0,0 +1,171 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"io"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ErrBindingForm = errors.New("unable to bind the form to the struct")
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	bytesType       = reflect.TypeOf([]byte(nil))
+)
+
+// Bind parses the files and values uploaded in lambdaReq, see ParseRequest, into the struct dst points to. Fields
+// tagged `form:"name"` are set from the value called name and fields tagged `file:"name"` from the file called name.
+// Values bind to strings, bools, ints, uints, floats and slices of them. Files bind to *multipart.FileHeader,
+// []*multipart.FileHeader or, to read the file's contents, []byte fields. Adding ",required" to a tag, e.g.
+// `form:"title,required"`, makes a missing value or file an error. Errors wrap ErrBindingForm and name the field.
+// Since API Gateway limits requests to 10 MB the whole form is held in memory so it doesn't need cleaning up.
+func Bind(lambdaReq events.APIGatewayProxyRequest, dst interface{}, opts ...Option) error {
+	form, err := ParseRequest(lambdaReq, APIGatewayPayloadLimit, opts...)
+	if err != nil {
+		return err
+	}
+
+	return BindForm(form, dst)
+}
+
+// BindForm is Bind for forms that have already been parsed.
+func BindForm(form *multipart.Form, dst interface{}) error {
+	dstValue := reflect.ValueOf(dst)
+	if dstValue.Kind() != reflect.Pointer || dstValue.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: dst must be a pointer to a struct", ErrBindingForm)
+	}
+
+	structValue := dstValue.Elem()
+	structType := structValue.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		if tag, ok := field.Tag.Lookup("form"); ok {
+			name, required := parseBindTag(tag)
+
+			values := form.Value[name]
+			if len(values) == 0 {
+				if required {
+					return fmt.Errorf("%w: %s is required", ErrBindingForm, name)
+				}
+				continue
+			}
+
+			if err := bindValues(structValue.Field(i), values); err != nil {
+				return fmt.Errorf("%w: %s: %s", ErrBindingForm, name, err)
+			}
+		}
+
+		if tag, ok := field.Tag.Lookup("file"); ok {
+			name, required := parseBindTag(tag)
+
+			fileHeaders := form.File[name]
+			if len(fileHeaders) == 0 {
+				if required {
+					return fmt.Errorf("%w: %s is required", ErrBindingForm, name)
+				}
+				continue
+			}
+
+			if err := bindFiles(structValue.Field(i), fileHeaders); err != nil {
+				return fmt.Errorf("%w: %s: %s", ErrBindingForm, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseBindTag splits a form or file tag into the name of the value and whether it's required.
+func parseBindTag(tag string) (string, bool) {
+	name, flags, _ := strings.Cut(tag, ",")
+
+	return name, flags == "required"
+}
+
+// bindFiles sets field to the uploaded files.
+func bindFiles(field reflect.Value, fileHeaders []*multipart.FileHeader) error {
+	switch field.Type() {
+	case fileHeaderType:
+		field.Set(reflect.ValueOf(fileHeaders[0]))
+	case fileHeadersType:
+		field.Set(reflect.ValueOf(fileHeaders))
+	case bytesType:
+		file, err := OpenFileHeader(fileHeaders[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		fileBytes, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+
+		field.SetBytes(fileBytes)
+	default:
+		return fmt.Errorf("files can't be bound to %s", field.Type())
+	}
+
+	return nil
+}
+
+// bindValues sets field to the form values, converted to the field's type.
+func bindValues(field reflect.Value, values []string) error {
+	if field.Kind() != reflect.Slice {
+		return bindValue(field, values[0])
+	}
+
+	slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+	for i, value := range values {
+		if err := bindValue(slice.Index(i), value); err != nil {
+			return err
+		}
+	}
+
+	field.Set(slice)
+
+	return nil
+}
+
+func bindValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("values can't be bound to %s", field.Type())
+	}
+
+	return nil
+}
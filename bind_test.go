@@ -0,0 +1,86 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"mime/multipart"
+	"os"
+	"testing"
+)
+
+func generateBindReq(t *testing.T, values map[string]string) events.APIGatewayProxyRequest {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	var multiPartBuffer bytes.Buffer
+	writer := multipart.NewWriter(&multiPartBuffer)
+
+	for field, value := range values {
+		assert.Nil(t, writer.WriteField(field, value))
+	}
+
+	part, err := writer.CreateFormFile("attachment", SampleFileName)
+	assert.Nil(t, err)
+	_, err = part.Write(fileBytes)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	return events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Content-Type": writer.FormDataContentType()},
+		Body:    multiPartBuffer.String(),
+	}
+}
+
+func TestBind(t *testing.T) {
+	type upload struct {
+		Title       string                `form:"title,required"`
+		Count       int                   `form:"count"`
+		Public      bool                  `form:"public"`
+		Attachment  *multipart.FileHeader `file:"attachment,required"`
+		Contents    []byte                `file:"attachment"`
+		Unsupported map[string]string
+	}
+
+	t.Run("verify err when dst is not a pointer to a struct", func(t *testing.T) {
+		var dst upload
+		assert.True(t, errors.Is(Bind(generateBindReq(t, nil), dst), ErrBindingForm))
+	})
+	t.Run("verify err when a required value is missing", func(t *testing.T) {
+		var dst upload
+		err := Bind(generateBindReq(t, map[string]string{"count": "3"}), &dst)
+		assert.True(t, errors.Is(err, ErrBindingForm))
+		assert.Equal(t, "unable to bind the form to the struct: title is required", err.Error())
+	})
+	t.Run("verify err when a value has the wrong type", func(t *testing.T) {
+		var dst upload
+		err := Bind(generateBindReq(t, map[string]string{"title": "rates", "count": "three"}), &dst)
+		assert.True(t, errors.Is(err, ErrBindingForm))
+	})
+	t.Run("verify Bind works with correct inputs", func(t *testing.T) {
+		var dst upload
+		assert.Nil(t, Bind(generateBindReq(t, map[string]string{"title": "rates", "count": "3", "public": "true"}), &dst))
+		assert.Equal(t, "rates", dst.Title)
+		assert.Equal(t, 3, dst.Count)
+		assert.True(t, dst.Public)
+		assert.Equal(t, SampleFileName, dst.Attachment.Filename)
+		assert.Equal(t, SampleFileSizeBytes, len(dst.Contents))
+	})
+	t.Run("verify repeated values bind to slices", func(t *testing.T) {
+		var dst struct {
+			Tags  []string                `form:"tag"`
+			Files []*multipart.FileHeader `file:"attachment"`
+		}
+
+		form := &multipart.Form{
+			Value: map[string][]string{"tag": {"a", "b"}},
+			File:  map[string][]*multipart.FileHeader{"attachment": {{Filename: "a"}, {Filename: "b"}}},
+		}
+
+		assert.Nil(t, BindForm(form, &dst))
+		assert.Equal(t, 2, len(dst.Tags))
+		assert.Equal(t, "b", dst.Tags[1])
+		assert.Equal(t, 2, len(dst.Files))
+	})
+}
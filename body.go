@@ -0,0 +1,113 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path"
+)
+
+// PathParameterKey is a KeyFunc that uses the value of the path parameter called parameter as the key. e.g.
+// PathParameterKey("key") for a PUT /files/{key+} route.
+func PathParameterKey(parameter string) KeyFunc {
+	return func(lambdaReq events.APIGatewayProxyRequest, _ *multipart.FileHeader) (string, error) {
+		return lambdaReq.PathParameters[parameter], nil
+	}
+}
+
+// GetBodyHeader is GetHeaders for clients that send the raw bytes of a single file as the request body, e.g.
+// PUT /files/report.pdf with a Content-Type of application/pdf. The file's name is taken from the filename in the
+// request's Content-Disposition header, if there is one, and the last segment of the request path otherwise. The
+// file is returned as a *multipart.FileHeader so it can be uploaded with UploadHeader and friends.
+func GetBodyHeader(lambdaReq events.APIGatewayProxyRequest, opts ...Option) (*multipart.FileHeader, error) {
+	return getBodyHeader(APIGatewayProxySource(lambdaReq), newOptions(opts))
+}
+
+func getBodyHeader(source RequestSource, o *options) (*multipart.FileHeader, error) {
+	data := []byte(source.Body())
+	if source.IsBase64() {
+		decodedBody, err := base64.StdEncoding.DecodeString(source.Body())
+		if err != nil {
+			return nil, ErrReadingMultiPartForm
+		}
+		data = decodedBody
+	}
+
+	if len(data) == 0 {
+		return nil, ErrNoFilesFound
+	}
+
+	headers := source.Headers()
+
+	filename := path.Base(source.Path())
+	if _, params, err := mime.ParseMediaType(headers.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		filename = params["filename"]
+	}
+
+	contentType := headers.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return newFileHeader(filename, contentType, data, o)
+}
+
+// UploadBody uploads the raw file in the body of lambdaReq, see GetBodyHeader, to bucket under the key returned by
+// keyFn, or a UUIDKey if keyFn is nil. e.g. UploadBody(lambdaReq, region, bucket, PathParameterKey("key")). The
+// request's Content-Type is stored as the object's Content-Type.
+func UploadBody(lambdaReq events.APIGatewayProxyRequest, region, bucket string, keyFn KeyFunc, opts ...Option) (*UploadRes, error) {
+	fileHeader, err := GetBodyHeader(lambdaReq, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := Config{KeyFunc: keyFn}.key(lambdaReq, fileHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return UploadHeader(fileHeader, region, bucket, key, opts...)
+}
+
+// newFileHeader wraps data in a *multipart.FileHeader, which can only be created by reading a form, so files that
+// didn't arrive in a multipart form can go through the same code as those that did. The file's name is normalized as
+// it is by GetHeaders and WithMaxSize and WithTempDir apply.
+func newFileHeader(filename, contentType string, data []byte, o *options) (*multipart.FileHeader, error) {
+	if o.maxSizeBytes > 0 && int64(len(data)) > o.maxSizeBytes {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrFileTooLarge, filename, o.maxSizeBytes)
+	}
+
+	var formBuffer bytes.Buffer
+	multipartWriter := multipart.NewWriter(&formBuffer)
+
+	partHeader := textproto.MIMEHeader{}
+	partHeader.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "file", "filename": filename}))
+	if contentType != "" {
+		partHeader.Set("Content-Type", contentType)
+	}
+
+	partWriter, err := multipartWriter.CreatePart(partHeader)
+	if err == nil {
+		_, err = partWriter.Write(data)
+	}
+	if err == nil {
+		err = multipartWriter.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrReadingMultiPartForm, err)
+	}
+
+	form, err := readForm(multipart.NewReader(&formBuffer, multipartWriter.Boundary()), int64(len(data)), o)
+	if err != nil || len(form.File["file"]) == 0 {
+		return nil, ErrReadingMultiPartForm
+	}
+
+	fileHeader := form.File["file"][0]
+	fileHeader.Filename = normalizeFilename(fileHeader)
+
+	return fileHeader, nil
+}
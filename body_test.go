@@ -0,0 +1,76 @@
+package lambda_s3
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+func generateUploadBodyReq(fileBytes []byte) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		Path:            "/files/" + SampleFileName,
+		PathParameters:  map[string]string{"key": S3FileName},
+		Headers:         map[string]string{"Content-Type": "text/csv"},
+		Body:            base64.StdEncoding.EncodeToString(fileBytes),
+		IsBase64Encoded: true,
+	}
+}
+
+func TestGetBodyHeader(t *testing.T) {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	t.Run("verify err when the body is empty", func(t *testing.T) {
+		_, err := GetBodyHeader(generateUploadBodyReq(nil))
+		assert.Equal(t, ErrNoFilesFound, err)
+	})
+	t.Run("verify err when the body is larger than WithMaxSize", func(t *testing.T) {
+		_, err := GetBodyHeader(generateUploadBodyReq(fileBytes), WithMaxSize(SampleFileSizeBytes-1))
+		assert.True(t, errors.Is(err, ErrFileTooLarge))
+	})
+	t.Run("verify GetBodyHeader works with correct inputs", func(t *testing.T) {
+		fileHeader, err := GetBodyHeader(generateUploadBodyReq(fileBytes))
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileName, fileHeader.Filename)
+		assert.Equal(t, "text/csv", fileHeader.Header.Get("Content-Type"))
+		assert.Equal(t, int64(SampleFileSizeBytes), fileHeader.Size)
+
+		file, err := fileHeader.Open()
+		assert.Nil(t, err)
+
+		contents, err := io.ReadAll(file)
+		assert.Nil(t, err)
+		assert.Equal(t, string(fileBytes), string(contents))
+	})
+	t.Run("verify the filename comes from Content-Disposition", func(t *testing.T) {
+		lambdaReq := generateUploadBodyReq(fileBytes)
+		lambdaReq.Headers["Content-Disposition"] = `attachment; filename="rates.csv"`
+		delete(lambdaReq.Headers, "Content-Type")
+
+		fileHeader, err := GetBodyHeader(lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, "rates.csv", fileHeader.Filename)
+		assert.Equal(t, "application/octet-stream", fileHeader.Header.Get("Content-Type"))
+	})
+}
+
+func TestUploadBody(t *testing.T) {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	t.Run("verify err when the key is empty", func(t *testing.T) {
+		_, err := UploadBody(generateUploadBodyReq(fileBytes), Region, S3Bucket, PathParameterKey("missing"))
+		assert.Equal(t, ErrInvalidKey, err)
+	})
+	t.Run("verify UploadBody works with correct inputs", func(t *testing.T) {
+		uploadRes, err := UploadBody(generateUploadBodyReq(fileBytes), Region, S3Bucket, PathParameterKey("key"))
+		assert.Nil(t, err)
+		assert.Equal(t, S3FileName, uploadRes.Key)
+		assert.Equal(t, "text/csv", uploadRes.ContentType)
+		assert.Equal(t, int64(SampleFileSizeBytes), uploadRes.BytesUploaded)
+	})
+}
@@ -0,0 +1,126 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var (
+	ErrBucketNameTaken   = errors.New("the bucket name is already taken by another account")
+	ErrConfiguringBucket = errors.New("unable to configure the bucket")
+	ErrCreatingBucket    = errors.New("unable to create the bucket")
+)
+
+// EnsureBucket creates bucket in region unless it already exists and returns whether it was created. Use
+// WithVersioning, WithDefaultEncryption, and WithPublicAccessBlock to configure the bucket. They're applied whether
+// or not the bucket was just created so EnsureBucket can be called every time an environment starts. Names owned
+// by another account fail with ErrBucketNameTaken and names that break the current naming rules, which are stricter
+// than the ones older buckets may follow, fail with ErrInvalidBucketName.
+func EnsureBucket(region, bucket string, opts ...Option) (bool, error) {
+	if region == "" {
+		return false, ErrParameterRegionEmpty
+	}
+
+	if err := validateNewBucket(bucket); err != nil {
+		return false, err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newSession(region)
+	if err != nil {
+		return false, ErrNewAWSSession
+	}
+
+	s3Client := s3.New(awsSession)
+
+	created, err := createBucket(s3Client, region, bucket, o)
+	if err != nil {
+		return created, err
+	}
+
+	if o.versioning {
+		_, err = s3Client.PutBucketVersioningWithContext(o.context(), &s3.PutBucketVersioningInput{
+			Bucket:                  aws.String(bucket),
+			VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(s3.BucketVersioningStatusEnabled)},
+		})
+		if err != nil {
+			return created, fmt.Errorf("%w: versioning: %s", ErrConfiguringBucket, err)
+		}
+	}
+
+	if o.defaultEncryption != nil {
+		_, err = s3Client.PutBucketEncryptionWithContext(o.context(), &s3.PutBucketEncryptionInput{
+			Bucket: aws.String(bucket),
+			ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+				Rules: []*s3.ServerSideEncryptionRule{{
+					ApplyServerSideEncryptionByDefault: o.defaultEncryption,
+					BucketKeyEnabled:                   aws.Bool(o.defaultEncryption.KMSMasterKeyID != nil), // cuts KMS requests and their cost
+				}},
+			},
+		})
+		if err != nil {
+			return created, fmt.Errorf("%w: default encryption: %s", ErrConfiguringBucket, err)
+		}
+	}
+
+	if o.publicAccessBlock {
+		_, err = s3Client.PutPublicAccessBlockWithContext(o.context(), &s3.PutPublicAccessBlockInput{
+			Bucket: aws.String(bucket),
+			PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(true),
+				BlockPublicPolicy:     aws.Bool(true),
+				IgnorePublicAcls:      aws.Bool(true),
+				RestrictPublicBuckets: aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return created, fmt.Errorf("%w: public access block: %s", ErrConfiguringBucket, err)
+		}
+	}
+
+	return created, nil
+}
+
+// createBucket creates bucket unless it already exists. Buckets are looked up first since, in us-east-1, creating a
+// bucket the caller already owns succeeds as if it had been created.
+func createBucket(s3Client *s3.S3, region, bucket string, o *options) (bool, error) {
+	_, err := s3Client.HeadBucketWithContext(o.context(), &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err == nil {
+		return false, nil
+	}
+
+	// a denied HeadBucket usually means another account owns the name. CreateBucket says so for certain
+	if _, probeErr := probeAllowed(err); probeErr != nil && !isNotFound(err) {
+		return false, fmt.Errorf("%w: %s", ErrCreatingBucket, err)
+	}
+
+	createBucketInput := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	if region != "us-east-1" { // us-east-1 is the default and S3 rejects it as a LocationConstraint
+		createBucketInput.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+	}
+
+	_, err = s3Client.CreateBucketWithContext(o.context(), createBucketInput)
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) {
+			switch awsErr.Code() {
+			case s3.ErrCodeBucketAlreadyOwnedByYou: // created by someone else since it was looked up
+				return false, nil
+			case s3.ErrCodeBucketAlreadyExists:
+				return false, fmt.Errorf("%w: %s", ErrBucketNameTaken, bucket)
+			}
+		}
+		return false, fmt.Errorf("%w: %s", ErrCreatingBucket, err)
+	}
+
+	err = s3Client.WaitUntilBucketExistsWithContext(o.context(), &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return true, fmt.Errorf("%w: %s", ErrCreatingBucket, err)
+	}
+
+	return true, nil
+}
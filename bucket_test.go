@@ -0,0 +1,38 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestEnsureBucket(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		_, err := EnsureBucket("", S3Bucket)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is invalid", func(t *testing.T) {
+		_, err := EnsureBucket(Region, "Invalid_Bucket")
+		assert.True(t, errors.Is(err, ErrInvalidBucketName))
+	})
+	t.Run("verify WithDefaultEncryption picks SSE-KMS only with a key", func(t *testing.T) {
+		encryption := newOptions([]Option{WithDefaultEncryption("")}).defaultEncryption
+		assert.Equal(t, s3.ServerSideEncryptionAes256, aws.StringValue(encryption.SSEAlgorithm))
+		assert.True(t, encryption.KMSMasterKeyID == nil)
+
+		encryption = newOptions([]Option{WithDefaultEncryption("alias/uploads")}).defaultEncryption
+		assert.Equal(t, s3.ServerSideEncryptionAwsKms, aws.StringValue(encryption.SSEAlgorithm))
+		assert.Equal(t, "alias/uploads", aws.StringValue(encryption.KMSMasterKeyID))
+	})
+	t.Run("verify existing buckets aren't created again", func(t *testing.T) {
+		created, err := EnsureBucket(Region, S3Bucket)
+		assert.Nil(t, err)
+		assert.False(t, created)
+	})
+	t.Run("verify err when another account owns the name", func(t *testing.T) {
+		_, err := EnsureBucket(Region, "test")
+		assert.True(t, errors.Is(err, ErrBucketNameTaken))
+	})
+}
@@ -0,0 +1,65 @@
+package lambda_s3
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// DefaultBufferSize is the size of the buffers files are copied through unless WithBufferSize says otherwise.
+// It's the size io.Copy allocates on every call.
+const DefaultBufferSize = 32 << 10 // 32 kilobytes
+
+// bufferPools holds a *sync.Pool of *[]byte for every buffer size in use. Pools are package wide so buffers are
+// reused across invocations handled by the same warm Lambda container instead of being allocated and collected on
+// every call.
+var bufferPools sync.Map
+
+func bufferPool(size int) *sync.Pool {
+	if pool, ok := bufferPools.Load(size); ok {
+		return pool.(*sync.Pool)
+	}
+
+	pool, _ := bufferPools.LoadOrStore(size, &sync.Pool{
+		New: func() interface{} {
+			buffer := make([]byte, size)
+			return &buffer
+		},
+	})
+
+	return pool.(*sync.Pool)
+}
+
+// copyBuffer is io.Copy through a pooled buffer of size bytes.
+func copyBuffer(dst io.Writer, src io.Reader, size int) (int64, error) {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+
+	pool := bufferPool(size)
+
+	buffer := pool.Get().(*[]byte)
+	defer pool.Put(buffer)
+
+	return io.CopyBuffer(dst, src, *buffer)
+}
+
+// gzipWriters pools gzip writers, which allocate several hundred kilobytes of compression state each.
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// newGzipWriter returns a pooled gzip writer that writes to w. Pass it to releaseGzipWriter once it's closed.
+func newGzipWriter(w io.Writer) *gzip.Writer {
+	gzipWriter := gzipWriters.Get().(*gzip.Writer)
+	gzipWriter.Reset(w)
+
+	return gzipWriter
+}
+
+func releaseGzipWriter(gzipWriter *gzip.Writer) {
+	gzipWriter.Reset(nil) // don't keep the last destination reachable from the pool
+	gzipWriters.Put(gzipWriter)
+}
@@ -0,0 +1,58 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCopyBuffer(t *testing.T) {
+	t.Run("verify everything is copied through buffers smaller than the source", func(t *testing.T) {
+		contents := strings.Repeat("contents", 1000)
+
+		var dst strings.Builder
+		n, err := copyBuffer(struct{ io.Writer }{&dst}, struct{ io.Reader }{strings.NewReader(contents)}, 7)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(contents)), n)
+		assert.Equal(t, contents, dst.String())
+	})
+	t.Run("verify buffers of the same size come from the same pool", func(t *testing.T) {
+		assert.True(t, bufferPool(DefaultBufferSize) == bufferPool(DefaultBufferSize))
+		assert.False(t, bufferPool(DefaultBufferSize) == bufferPool(DefaultBufferSize*2))
+		assert.Equal(t, DefaultBufferSize*2, len(*bufferPool(DefaultBufferSize * 2).Get().(*[]byte)))
+	})
+}
+
+func TestGzipWriterPool(t *testing.T) {
+	t.Run("verify reused gzip writers don't leak state between uses", func(t *testing.T) {
+		for _, contents := range []string{"first contents", "second"} {
+			var compressed bytes.Buffer
+
+			gzipWriter := newGzipWriter(&compressed)
+			_, err := gzipWriter.Write([]byte(contents))
+			assert.Nil(t, err)
+			assert.Nil(t, gzipWriter.Close())
+			releaseGzipWriter(gzipWriter)
+
+			gzReader, err := gzip.NewReader(&compressed)
+			assert.Nil(t, err)
+
+			decompressed, err := io.ReadAll(gzReader)
+			assert.Nil(t, err)
+			assert.Equal(t, contents, string(decompressed))
+		}
+	})
+}
+
+func TestWithBufferSize(t *testing.T) {
+	t.Run("verify DefaultBufferSize is used by default", func(t *testing.T) {
+		assert.Equal(t, DefaultBufferSize, newOptions(nil).bufferSize)
+	})
+	t.Run("verify sizes < 1 are ignored", func(t *testing.T) {
+		assert.Equal(t, DefaultBufferSize, newOptions([]Option{WithBufferSize(0)}).bufferSize)
+		assert.Equal(t, 1<<20, newOptions([]Option{WithBufferSize(1 << 20)}).bufferSize)
+	})
+}
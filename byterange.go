@@ -0,0 +1,58 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrRangeNotSatisfiable = errors.New("the requested range is outside the file")
+
+// singleByteRange matches a Range header asking for one range of bytes: the first-last bytes, every byte from
+// first on, or the last suffix bytes.
+var singleByteRange = regexp.MustCompile(`^bytes=(\d+)-(\d*)$|^bytes=-(\d+)$`)
+
+// byteRange returns the value of a Range header if it asks for a single range of bytes, which S3 can serve, or an
+// empty string otherwise. Servers are allowed to ignore Range headers they can't serve and respond with the whole
+// file, which is what the download handlers do for multiple ranges and malformed headers.
+func byteRange(rangeHeader string) string {
+	rangeHeader = strings.TrimSpace(rangeHeader)
+
+	matches := singleByteRange.FindStringSubmatch(rangeHeader)
+	if matches == nil {
+		return ""
+	}
+
+	if matches[3] != "" {
+		if suffix, err := strconv.ParseInt(matches[3], 10, 64); err != nil || suffix == 0 {
+			return ""
+		}
+
+		return rangeHeader
+	}
+
+	first, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return ""
+	}
+
+	if matches[2] != "" {
+		if last, err := strconv.ParseInt(matches[2], 10, 64); err != nil || last < first {
+			return ""
+		}
+	}
+
+	return rangeHeader
+}
+
+// isInvalidRange reports whether err is S3 refusing a range that starts after the end of the object.
+func isInvalidRange(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == "InvalidRange"
+	}
+
+	return false
+}
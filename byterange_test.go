@@ -0,0 +1,24 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestByteRange(t *testing.T) {
+	t.Run("verify single byte ranges are passed on", func(t *testing.T) {
+		for _, rangeHeader := range []string{"bytes=0-99", "bytes=100-", "bytes=-500", "bytes=5-5"} {
+			assert.Equal(t, rangeHeader, byteRange(rangeHeader))
+		}
+	})
+	t.Run("verify ranges S3 can't serve are ignored", func(t *testing.T) {
+		for _, rangeHeader := range []string{"", "bytes=0-99,200-299", "bytes=99-0", "bytes=-0", "items=0-9", "bytes=a-b", "bytes=99999999999999999999-"} {
+			assert.Equal(t, "", byteRange(rangeHeader))
+		}
+	})
+	t.Run("verify S3's InvalidRange error is recognized", func(t *testing.T) {
+		assert.True(t, isInvalidRange(awserr.New("InvalidRange", "The requested range is not satisfiable", nil)))
+		assert.False(t, isInvalidRange(awserr.New("NoSuchKey", "", nil)))
+	})
+}
@@ -0,0 +1,267 @@
+package lambda_s3
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrCreatingCacheDir = errors.New("unable to create the cache directory")
+
+// Cache keeps downloaded files around between invocations of a warm Lambda container so repeated Download calls
+// for the same object don't transfer it again. Files are evicted least recently used first once the cache holds
+// more than its maximum number of bytes. Cached files younger than the TTL are returned without contacting S3 at
+// all while older ones are revalidated with a conditional GET on their ETag and only downloaded again if they
+// changed. Create a Cache once, outside the handler, and pass it to Download with WithCache.
+// Files decrypted on the way down, whether they were uploaded WithKMSEncryption or are read WithCustomerKey, aren't
+// cached unless the download is also made WithCacheDecrypted, so their plaintext doesn't end up in memory or on disk
+// by accident. A Cache is safe for concurrent use.
+type Cache struct {
+	mutex    sync.Mutex
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List // front is most recently used
+}
+
+type cacheEntry struct {
+	key       string
+	object    string // bucket/name, the same for every variant of the object
+	eTag      string
+	fetched   time.Time
+	size      int64
+	fileBytes []byte // nil for disk caches
+}
+
+// NewMemoryCache returns a Cache holding up to maxBytes of files in memory.
+func NewMemoryCache(maxBytes int64, ttl time.Duration) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+// NewDiskCache returns a Cache holding up to maxBytes of files on disk in dir which is created if necessary.
+// Lambda only allows writing to /tmp so dir must be inside it when running in Lambda.
+func NewDiskCache(dir string, maxBytes int64, ttl time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, ErrCreatingCacheDir
+	}
+
+	cache := NewMemoryCache(maxBytes, ttl)
+	cache.dir = dir
+
+	return cache, nil
+}
+
+// Invalidate removes the cached copy of bucket/name, if any, so the next Download fetches it from S3.
+func (c *Cache) Invalidate(bucket, name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	object := cacheObject(bucket, name)
+	for _, element := range c.entries {
+		if element.Value.(*cacheEntry).object == object {
+			c.remove(element)
+		}
+	}
+}
+
+// Clear removes every file from the cache.
+func (c *Cache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// download serves bucket/name from the cache when possible and from S3 otherwise, caching the result. Files are
+// cached before o's download transformers run, and the limits in o are checked against cached files too, so every
+// download gets the file it would have gotten from S3.
+func (c *Cache) download(downloader *s3manager.Downloader, bucket, name string, o *options) ([]byte, error) {
+	key := cacheKey(bucket, name, o)
+	eTag, fetched, cachedBytes, ok := c.get(key)
+
+	if ok && time.Since(fetched) < c.ttl {
+		return cachedFile(cachedBytes, name, o)
+	}
+
+	conditionalOptions := *o
+	conditionalOptions.downloadTransformers = nil
+	if ok {
+		conditionalOptions.knownETag = eTag
+	}
+
+	fileBytes, headers, err := downloadWithHeaders(downloader, bucket, name, &conditionalOptions)
+	if ok && errors.Is(err, ErrNotModified) {
+		c.refresh(key)
+		return cachedFile(cachedBytes, name, o)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheable(headers, o) {
+		c.put(key, cacheObject(bucket, name), headers.Get("ETag"), fileBytes)
+	}
+
+	return transformBytes(fileBytes, o.downloadTransformers)
+}
+
+// cacheable reports whether the file downloaded with o, whose response had headers, may be cached: unless the
+// download was made WithCacheDecrypted, files that were decrypted on the way down aren't. Encrypted files that
+// weren't decrypted aren't either so their ciphertext isn't later served to a download that would decrypt them.
+func cacheable(headers http.Header, o *options) bool {
+	if isEncrypted(headers) && o.kmsKeyID == "" {
+		return false
+	}
+
+	return o.cacheDecrypted || !(isEncrypted(headers) || o.customerKey != nil)
+}
+
+// cachedFile checks the cached copy of name against the limits in o, since it may have been cached by a download
+// with different ones, and runs o's download transformers on it.
+func cachedFile(fileBytes []byte, name string, o *options) ([]byte, error) {
+	if len(fileBytes) == 0 && !o.allowEmpty {
+		return nil, ErrEmptyFileDownloaded
+	}
+
+	if o.maxDownloadBytes > 0 && int64(len(fileBytes)) > o.maxDownloadBytes {
+		return nil, fmt.Errorf("%w: %s is %d bytes", ErrObjectTooLarge, name, len(fileBytes))
+	}
+
+	return transformBytes(fileBytes, o.downloadTransformers)
+}
+
+func (c *Cache) get(key string) (string, time.Time, []byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return "", time.Time{}, nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+
+	fileBytes := entry.fileBytes
+	if c.dir != "" {
+		var err error
+		fileBytes, err = os.ReadFile(c.path(key))
+		if err != nil { // someone cleaned up /tmp under us
+			c.remove(element)
+			return "", time.Time{}, nil, false
+		}
+	} else {
+		fileBytes = append([]byte(nil), fileBytes...) // callers may modify what we return
+	}
+
+	c.lru.MoveToFront(element)
+
+	return entry.eTag, entry.fetched, fileBytes, true
+}
+
+func (c *Cache) put(key, object, eTag string, fileBytes []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	size := int64(len(fileBytes))
+	if size > c.maxBytes {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:     key,
+		object:  object,
+		eTag:    eTag,
+		fetched: time.Now(),
+		size:    size,
+	}
+
+	if c.dir != "" {
+		if err := os.WriteFile(c.path(key), fileBytes, 0600); err != nil {
+			return // caching is best effort
+		}
+	} else {
+		entry.fileBytes = append([]byte(nil), fileBytes...)
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) refresh(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).fetched = time.Now()
+	}
+}
+
+// remove must be called with the mutex held.
+func (c *Cache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+
+	if c.dir != "" {
+		os.Remove(c.path(entry.key))
+	}
+
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+func (c *Cache) path(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(digest[:]))
+}
+
+func cacheObject(bucket, name string) string {
+	return bucket + "/" + name
+}
+
+// cacheKey is what bucket/name is cached under when downloaded with o. The options that change the file a download
+// returns are part of it so downloads made with different ones are never served each other's copies. The SSE-C key
+// is included as a digest so only callers holding the key are served the file it decrypts.
+func cacheKey(bucket, name string, o *options) string {
+	key := cacheObject(bucket, name)
+
+	if o.gzip {
+		key += "\x00gzip"
+	}
+
+	if o.checksum {
+		key += "\x00checksum"
+	}
+
+	if o.customerKey != nil {
+		digest := sha256.Sum256([]byte(o.customerKey.key))
+		key += "\x00sse-c:" + hex.EncodeToString(digest[:])
+	}
+
+	return key
+}
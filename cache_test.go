@@ -0,0 +1,131 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	noOptions := newOptions(nil)
+
+	t.Run("verify least recently used files are evicted past maxBytes", func(t *testing.T) {
+		cache := NewMemoryCache(10, time.Minute)
+		cache.put(cacheKey(S3Bucket, "a", noOptions), cacheObject(S3Bucket, "a"), `"a"`, []byte("aaaa"))
+		cache.put(cacheKey(S3Bucket, "b", noOptions), cacheObject(S3Bucket, "b"), `"b"`, []byte("bbbb"))
+
+		_, _, _, ok := cache.get(cacheKey(S3Bucket, "a", noOptions)) // a is now more recently used than b
+		assert.True(t, ok)
+
+		cache.put(cacheKey(S3Bucket, "c", noOptions), cacheObject(S3Bucket, "c"), `"c"`, []byte("cccc"))
+
+		_, _, _, ok = cache.get(cacheKey(S3Bucket, "b", noOptions))
+		assert.False(t, ok)
+
+		eTag, _, fileBytes, ok := cache.get(cacheKey(S3Bucket, "a", noOptions))
+		assert.True(t, ok)
+		assert.Equal(t, `"a"`, eTag)
+		assert.Equal(t, "aaaa", string(fileBytes))
+	})
+	t.Run("verify files larger than maxBytes are not cached", func(t *testing.T) {
+		cache := NewMemoryCache(3, time.Minute)
+		cache.put(cacheKey(S3Bucket, "a", noOptions), cacheObject(S3Bucket, "a"), `"a"`, []byte("aaaa"))
+
+		_, _, _, ok := cache.get(cacheKey(S3Bucket, "a", noOptions))
+		assert.False(t, ok)
+	})
+	t.Run("verify Invalidate and Clear remove files", func(t *testing.T) {
+		cache, err := NewDiskCache(filepath.Join(t.TempDir(), "cache"), 100, time.Minute)
+		assert.Nil(t, err)
+
+		cache.put(cacheKey(S3Bucket, "a", noOptions), cacheObject(S3Bucket, "a"), `"a"`, []byte("aaaa"))
+		cache.put(cacheKey(S3Bucket, "b", noOptions), cacheObject(S3Bucket, "b"), `"b"`, []byte("bbbb"))
+
+		_, _, fileBytes, ok := cache.get(cacheKey(S3Bucket, "a", noOptions))
+		assert.True(t, ok)
+		assert.Equal(t, "aaaa", string(fileBytes))
+
+		cache.Invalidate(S3Bucket, "a")
+		_, _, _, ok = cache.get(cacheKey(S3Bucket, "a", noOptions))
+		assert.False(t, ok)
+
+		_, err = os.Stat(cache.path(cacheKey(S3Bucket, "b", noOptions)))
+		assert.Nil(t, err)
+
+		cache.Clear()
+		_, err = os.Stat(cache.path(cacheKey(S3Bucket, "b", noOptions)))
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+	t.Run("verify options that change the downloaded file change the key", func(t *testing.T) {
+		gzipKey := cacheKey(S3Bucket, "a", newOptions([]Option{WithGzip()}))
+		assert.NotEqual(t, cacheKey(S3Bucket, "a", noOptions), gzipKey)
+
+		customerKey := cacheKey(S3Bucket, "a", newOptions([]Option{WithCustomerKey([]byte(strings.Repeat("k", customerKeyLen)), "")}))
+		otherCustomerKey := cacheKey(S3Bucket, "a", newOptions([]Option{WithCustomerKey([]byte(strings.Repeat("o", customerKeyLen)), "")}))
+		assert.NotEqual(t, customerKey, otherCustomerKey)
+		assert.False(t, strings.Contains(customerKey, strings.Repeat("k", customerKeyLen)))
+
+		cache := NewMemoryCache(100, time.Minute)
+		cache.put(cacheKey(S3Bucket, "a", noOptions), cacheObject(S3Bucket, "a"), `"a"`, []byte("aaaa"))
+		cache.put(gzipKey, cacheObject(S3Bucket, "a"), `"a"`, []byte("aaaa"))
+
+		cache.Invalidate(S3Bucket, "a")
+		assert.Equal(t, 0, len(cache.entries))
+	})
+	t.Run("verify decrypted files are only cached WithCacheDecrypted", func(t *testing.T) {
+		encrypted := http.Header{}
+		encrypted.Set(encryptionWrappedKeyMetadataHeader, "wrapped")
+
+		assert.True(t, cacheable(http.Header{}, noOptions))
+		assert.False(t, cacheable(encrypted, noOptions))
+		assert.False(t, cacheable(http.Header{}, newOptions([]Option{WithCustomerKey([]byte(strings.Repeat("k", customerKeyLen)), "")})))
+		assert.True(t, cacheable(encrypted, newOptions([]Option{WithCacheDecrypted()})))
+	})
+	t.Run("verify cached files are checked against the limits of each download and transformed", func(t *testing.T) {
+		fake := newFakeS3()
+		fake.objects["/"+S3Bucket+"/a"] = []byte("aaaa")
+		downloader := s3manager.NewDownloader(newHandlerSession(t, fake))
+
+		cache := NewMemoryCache(100, time.Hour)
+
+		fileBytes, err := cache.download(downloader, S3Bucket, "a", noOptions)
+		assert.Nil(t, err)
+		assert.Equal(t, "aaaa", string(fileBytes))
+
+		_, err = cache.download(downloader, S3Bucket, "a", newOptions([]Option{WithMaxDownloadBytes(3)}))
+		assert.True(t, errors.Is(err, ErrObjectTooLarge))
+
+		upper := TransformerFunc(func(r io.Reader) (io.Reader, error) {
+			fileBytes, err := io.ReadAll(r)
+			return bytes.NewReader(bytes.ToUpper(fileBytes)), err
+		})
+
+		fileBytes, err = cache.download(downloader, S3Bucket, "a", newOptions([]Option{WithDownloadTransformers(upper)}))
+		assert.Nil(t, err)
+		assert.Equal(t, "AAAA", string(fileBytes))
+
+		_, _, cachedBytes, ok := cache.get(cacheKey(S3Bucket, "a", noOptions))
+		assert.True(t, ok)
+		assert.Equal(t, "aaaa", string(cachedBytes))
+	})
+	t.Run("verify Download WithCache serves fresh files from the cache", func(t *testing.T) {
+		cache := NewMemoryCache(MaxFileSizeBytes, time.Hour)
+
+		fileBytes, err := Download(Region, S3Bucket, S3FileName, WithCache(cache))
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+
+		// an invalid region can't reach S3 so this only works if the file comes from the cache
+		fileBytes, err = Download("us-east-sean", S3Bucket, S3FileName, WithCache(cache))
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+	})
+}
@@ -0,0 +1,93 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"mime/multipart"
+	"path"
+	"path/filepath"
+)
+
+// UploadContentAddressed stores fileHeader under the hex encoded SHA-256 digest of its contents, optionally under
+// prefix, so identical files are only ever stored once. The file is hashed before anything is sent to S3 and, when
+// an object with that digest already exists, the upload is skipped entirely and UploadRes.Deduplicated is set.
+// UploadRes.ChecksumSHA256 is always set and, since it's the key, WithChecksum is implied.
+func UploadContentAddressed(fileHeader *multipart.FileHeader, region, bucket, prefix string, opts ...Option) (*UploadRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+	o.checksum = true
+
+	if err := fileTooLarge(fileHeader, o); err != nil {
+		return nil, err
+	}
+
+	file, err := OpenFileHeader(fileHeader)
+	if err != nil {
+		return nil, ErrOpeningMultiPartFile
+	}
+	defer file.Close()
+
+	checksum := newSHA256Reader(file)
+	if err = checksum.precompute(file, o.bufferSize); err != nil {
+		return nil, ErrOpeningMultiPartFile
+	}
+
+	name := path.Join(prefix, checksum.hexSum())
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	uploader := s3manager.NewUploader(awsSession)
+
+	headOutput, err := uploader.S3.HeadObjectWithContext(o.context(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	if err == nil {
+		uploadRes := &UploadRes{
+			Key:            name,
+			S3Path:         filepath.Join(bucket, name),
+			S3URL:          o.objectURL(bucket, name, objectURL(uploader.S3, bucket, name)),
+			ETag:           aws.StringValue(headOutput.ETag),
+			VersionID:      aws.StringValue(headOutput.VersionId),
+			BytesUploaded:  fileHeader.Size,
+			ContentType:    fileHeader.Header.Get("Content-Type"),
+			ChecksumSHA256: checksum.hexSum(),
+			Deduplicated:   true,
+		}
+
+		return uploadRes, presignResult(uploader.S3, bucket, uploadRes, o)
+	}
+
+	if !isNotFound(err) {
+		return nil, ErrUploadingMultiPartFileToS3
+	}
+
+	return upload(uploader, bucket, name, file, fileHeader.Header.Get("Content-Type"), fileHeader.Size, o)
+}
+
+// objectURL is the URL of bucket/name on the endpoint s3Client is configured for. It's the URL s3manager would
+// have returned as the Location of an upload to the same key.
+func objectURL(s3Client s3iface.S3API, bucket, name string) string {
+	req, _ := s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+
+	if err := req.Build(); err != nil {
+		return ""
+	}
+
+	return req.HTTPRequest.URL.String()
+}
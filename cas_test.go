@@ -0,0 +1,52 @@
+package lambda_s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"os"
+	"testing"
+)
+
+func TestUploadContentAddressed(t *testing.T) {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	sum := sha256.Sum256(fileBytes)
+	digest := hex.EncodeToString(sum[:])
+
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		uploadRes, err := UploadContentAddressed(generateFileHeader(t, SampleFileName, fileBytes), "", S3Bucket, "")
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.Equal(t, ErrParameterRegionEmpty, err)
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		uploadRes, err := UploadContentAddressed(generateFileHeader(t, SampleFileName, fileBytes), Region, "", "")
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.Equal(t, ErrParameterBucketEmpty, err)
+	})
+	t.Run("verify objectURL matches the S3 endpoint", func(t *testing.T) {
+		awsSession, err := session.NewSession(&aws.Config{Region: aws.String(Region)})
+		assert.Nil(t, err)
+
+		url := objectURL(s3.New(awsSession), S3Bucket, "cas/"+digest)
+		assert.Equal(t, "https://"+S3Bucket+".s3."+Region+".amazonaws.com/cas/"+digest, url)
+	})
+	t.Run("verify identical files are stored once under their digest", func(t *testing.T) {
+		firstRes, err := UploadContentAddressed(generateFileHeader(t, SampleFileName, fileBytes), Region, S3Bucket, "cas")
+		assert.Nil(t, err)
+		assert.Equal(t, "cas/"+digest, firstRes.Key)
+		assert.Equal(t, digest, firstRes.ChecksumSHA256)
+
+		secondRes, err := UploadContentAddressed(generateFileHeader(t, "copy.csv", fileBytes), Region, S3Bucket, "cas")
+		assert.Nil(t, err)
+		assert.Equal(t, firstRes.Key, secondRes.Key)
+		assert.Equal(t, firstRes.ETag, secondRes.ETag)
+		assert.True(t, secondRes.Deduplicated)
+
+		assert.Nil(t, Delete(Region, S3Bucket, firstRes.Key))
+	})
+}
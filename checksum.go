@@ -0,0 +1,98 @@
+package lambda_s3
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+const (
+	checksumMetadataKey    = "sha256"
+	checksumMetadataHeader = "X-Amz-Meta-" + checksumMetadataKey
+)
+
+var (
+	ErrChecksumMismatch = errors.New("the checksum of the downloaded file doesn't match the stored checksum. the file may be corrupt")
+	ErrChecksumMissing  = errors.New("the file has no stored checksum to verify against. upload it WithChecksum first")
+)
+
+// sha256Reader hashes everything read through it so the digest of a stream can be computed while it's uploaded.
+type sha256Reader struct {
+	reader io.Reader
+	hash   hash.Hash
+}
+
+func newSHA256Reader(reader io.Reader) *sha256Reader {
+	return &sha256Reader{
+		reader: reader,
+		hash:   sha256.New(),
+	}
+}
+
+func (s *sha256Reader) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	s.hash.Write(p[:n])
+
+	return n, err
+}
+
+// precompute hashes all of seeker, through a pooled buffer of bufferSize bytes, and rewinds it so the digest is
+// known before the upload starts.
+func (s *sha256Reader) precompute(seeker io.ReadSeeker, bufferSize int) error {
+	if _, err := copyBuffer(s.hash, seeker, bufferSize); err != nil {
+		return err
+	}
+
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err
+}
+
+// spool hashes body, which can't be rewound, while copying it to a temporary file in dir, or os.TempDir if dir is
+// empty, so the digest is known before the upload starts and the upload can be sent from the file. cleanup closes
+// and removes the file and must be called even when err isn't nil.
+func (s *sha256Reader) spool(body io.Reader, dir string, bufferSize int) (*os.File, func(), error) {
+	file, err := os.CreateTemp(dir, "lambda_s3-checksum-")
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+
+	if _, err = copyBuffer(io.MultiWriter(s.hash, file), body, bufferSize); err != nil {
+		return nil, cleanup, err
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, cleanup, err
+	}
+
+	return file, cleanup, nil
+}
+
+func (s *sha256Reader) hexSum() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+func (s *sha256Reader) base64Sum() string {
+	return base64.StdEncoding.EncodeToString(s.hash.Sum(nil))
+}
+
+func verifyChecksum(fileBytes []byte, storedChecksum string) error {
+	if storedChecksum == "" {
+		return ErrChecksumMissing
+	}
+
+	digest := sha256.Sum256(fileBytes)
+	if hex.EncodeToString(digest[:]) != storedChecksum {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
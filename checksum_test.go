@@ -0,0 +1,90 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	digest := sha256.Sum256(fileBytes)
+	expectedChecksum := hex.EncodeToString(digest[:])
+
+	t.Run("verify sha256Reader hashes while streaming", func(t *testing.T) {
+		checksum := newSHA256Reader(bytes.NewReader(fileBytes))
+		_, err := io.Copy(io.Discard, checksum)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedChecksum, checksum.hexSum())
+	})
+	t.Run("verify sha256Reader precompute rewinds the seeker", func(t *testing.T) {
+		seeker := bytes.NewReader(fileBytes)
+		checksum := newSHA256Reader(seeker)
+		assert.Nil(t, checksum.precompute(seeker, DefaultBufferSize))
+		assert.Equal(t, expectedChecksum, checksum.hexSum())
+		assert.Equal(t, SampleFileSizeBytes, seeker.Len())
+	})
+	t.Run("verify sha256Reader spool hashes bodies that can't be rewound into a file", func(t *testing.T) {
+		checksum := newSHA256Reader(nil)
+		spooled, cleanup, err := checksum.spool(io.MultiReader(bytes.NewReader(fileBytes)), t.TempDir(), DefaultBufferSize)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedChecksum, checksum.hexSum())
+
+		spooledBytes, err := io.ReadAll(spooled)
+		assert.Nil(t, err)
+		assert.Equal(t, len(fileBytes), len(spooledBytes))
+
+		cleanup()
+		_, err = os.Stat(spooled.Name())
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("verify the checksum of bodies that can't be rewound is stored with the object", func(t *testing.T) {
+		var storedChecksum string
+		fake := newFakeS3()
+		awsSession := newHandlerSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				storedChecksum = r.Header.Get(checksumMetadataHeader)
+			}
+			fake.ServeHTTP(w, r)
+		}))
+
+		body := io.MultiReader(bytes.NewReader(fileBytes)) // hides bytes.Reader's Seek
+		uploadRes, err := uploadObject(s3manager.NewUploader(awsSession), S3Bucket, S3FileName, body, "text/csv", int64(len(fileBytes)), newOptions([]Option{WithChecksum(), WithTempDir(t.TempDir())}))
+		assert.Nil(t, err)
+		assert.Equal(t, expectedChecksum, uploadRes.ChecksumSHA256)
+		assert.Equal(t, expectedChecksum, storedChecksum)
+	})
+	t.Run("verify files rejected while they're spooled fail with the scanner's rejection", func(t *testing.T) {
+		infected := append(append([]byte{}, fileBytes...), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")...)
+
+		_, err := uploadObject(s3manager.NewUploader(newFakeS3Session(t)), S3Bucket, S3FileName, bytes.NewReader(infected), "text/csv", int64(len(infected)), newOptions([]Option{WithChecksum(), WithScanner(eicarScanner)}))
+		assert.True(t, errors.Is(err, ErrFileRejectedByScanner))
+	})
+	t.Run("verify verifyChecksum errs when checksums differ", func(t *testing.T) {
+		assert.Nil(t, verifyChecksum(fileBytes, expectedChecksum))
+		assert.True(t, errors.Is(verifyChecksum(fileBytes[1:], expectedChecksum), ErrChecksumMismatch))
+		assert.True(t, errors.Is(verifyChecksum(fileBytes, ""), ErrChecksumMissing))
+	})
+	t.Run("verify WithChecksum stores and verifies the checksum", func(t *testing.T) {
+		fileHeaders, err := GetHeaders(generateUploadFileReq(), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+
+		uploadRes, err := UploadHeader(fileHeaders[0], Region, S3Bucket, S3FileName, WithChecksum())
+		assert.Nil(t, err)
+		assert.Equal(t, expectedChecksum, uploadRes.ChecksumSHA256)
+
+		downloadedBytes, err := Download(Region, S3Bucket, S3FileName, WithChecksum())
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(downloadedBytes))
+	})
+}
@@ -0,0 +1,199 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"path"
+	"strings"
+)
+
+var (
+	ErrCrossTenantKey    = errors.New("the key resolves outside of the tenant's prefix")
+	ErrParameterTenantID = errors.New("required parameter tenantID is empty or contains a /")
+	ErrUploadRejected    = errors.New("the upload was rejected by the BeforeUpload hook")
+)
+
+// Router picks the bucket and key the file called name belongs to for tenantID. Routers are how a Client scopes
+// every call to a tenant so one tenant can never read, overwrite, or delete another tenant's files.
+type Router func(tenantID, name string) (bucket, key string, err error)
+
+// TenantPrefixRouter keeps every tenant in bucket under a prefix named after the tenant. e.g. <tenantID>/<name>
+// Names that would escape the tenant's prefix, such as ../other-tenant/file, are rejected with ErrCrossTenantKey.
+func TenantPrefixRouter(bucket string) Router {
+	return func(tenantID, name string) (string, string, error) {
+		if err := validateTenantID(tenantID); err != nil {
+			return "", "", err
+		}
+
+		key := path.Join(tenantID, name)
+		if !strings.HasPrefix(key, tenantID+"/") {
+			return "", "", fmt.Errorf("%w: %s", ErrCrossTenantKey, name)
+		}
+
+		return bucket, key, nil
+	}
+}
+
+// TenantBucketRouter gives every tenant its own bucket named by formatting bucketFormat with the tenant's ID.
+// e.g. TenantBucketRouter("uploads-%s") stores tenant acme's files in the bucket uploads-acme.
+func TenantBucketRouter(bucketFormat string) Router {
+	return func(tenantID, name string) (string, string, error) {
+		if err := validateTenantID(tenantID); err != nil {
+			return "", "", err
+		}
+
+		return fmt.Sprintf(bucketFormat, tenantID), name, nil
+	}
+}
+
+func validateTenantID(tenantID string) error {
+	if tenantID == "" || strings.Contains(tenantID, "/") || tenantID == "." || tenantID == ".." {
+		return ErrParameterTenantID
+	}
+
+	return nil
+}
+
+// UploadReq describes an upload about to be made by a Client. It's passed to Hooks.BeforeUpload which must not
+// change it.
+type UploadReq struct {
+	// TenantID is the tenant the Client was scoped to with ForTenant, if any.
+	TenantID   string
+	Bucket     string
+	Key        string
+	FileHeader *multipart.FileHeader
+}
+
+// Hooks are called by a Client around every upload it makes. Either may be nil. ctx is the context passed
+// WithContext or a context that's never done.
+type Hooks struct {
+	// BeforeUpload is called before any bytes are sent to S3. Returning an error, for example when a virus scan or
+	// quota check fails, aborts the upload with ErrUploadRejected wrapping the error.
+	BeforeUpload func(ctx context.Context, uploadReq *UploadReq) error
+	// AfterUpload is called after each successful upload, for example to write an audit log.
+	AfterUpload func(ctx context.Context, uploadRes *UploadRes)
+}
+
+// Client holds the configuration shared by many calls so it doesn't have to be passed to every one of them.
+// Its methods behave like the package level functions of the same name. Region is required as is one of Bucket or
+// Router, although empty Regions and Buckets are read from the environment. See RegionEnvVar and BucketEnvVar.
+// A Client is safe for concurrent use as long as its fields aren't changed while it's being used.
+type Client struct {
+	Region string
+	// Bucket is the bucket files are stored in when there's no Router.
+	Bucket string
+	// Router, when set, resolves the bucket and key of every file from the tenant set with ForTenant and the name
+	// passed to the call. Calls made without a tenant fail with ErrParameterTenantID.
+	Router Router
+	// Options are applied to every call before the options passed to the call itself.
+	Options []Option
+	// Hooks are called around every upload.
+	Hooks Hooks
+	// Quota, when set, is checked with the tenant set with ForTenant before every upload. Uploads over quota fail
+	// with ErrQuotaExceeded.
+	Quota Quota
+	// UsageRecorder, when set, is told the size of every file uploaded for the tenant set with ForTenant.
+	UsageRecorder UsageRecorder
+	// PublicURL, when set, is the CDN or custom domain UploadRes.S3URL is reported on. See WithPublicURL.
+	PublicURL string
+
+	tenantID string
+}
+
+// ForTenant returns a copy of c scoped to tenantID. The copy shares c's configuration.
+func (c *Client) ForTenant(tenantID string) *Client {
+	tenantClient := *c
+	tenantClient.tenantID = tenantID
+
+	return &tenantClient
+}
+
+// route resolves the bucket and key name is stored under.
+func (c *Client) route(name string) (string, string, error) {
+	if c.Router == nil {
+		bucket := c.bucket()
+		if bucket == "" {
+			return "", "", ErrParameterBucketEmpty
+		}
+
+		return bucket, name, nil
+	}
+
+	if name == "" {
+		return "", "", ErrParameterNameEmpty
+	}
+
+	return c.Router(c.tenantID, name)
+}
+
+// options merges c.Options with the options of a single call.
+func (c *Client) options(opts []Option) []Option {
+	var clientOpts []Option
+	if c.PublicURL != "" {
+		clientOpts = append(clientOpts, WithPublicURL(c.PublicURL))
+	}
+
+	return append(append(clientOpts, c.Options...), opts...)
+}
+
+// UploadHeader uploads fileHeader under name. See UploadHeader.
+func (c *Client) UploadHeader(fileHeader *multipart.FileHeader, name string, opts ...Option) (*UploadRes, error) {
+	bucket, key, err := c.route(name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = c.options(opts)
+	ctx := newOptions(opts).context()
+
+	if err = checkQuota(c.Quota, c.tenantID, fileHeader); err != nil {
+		return nil, err
+	}
+
+	if c.Hooks.BeforeUpload != nil {
+		err = c.Hooks.BeforeUpload(ctx, &UploadReq{
+			TenantID:   c.tenantID,
+			Bucket:     bucket,
+			Key:        key,
+			FileHeader: fileHeader,
+		})
+		if err != nil {
+			return nil, wrapCause(ErrUploadRejected, err)
+		}
+	}
+
+	uploadRes, err := UploadHeader(fileHeader, c.region(), bucket, key, opts...)
+	if err != nil {
+		return uploadRes, err
+	}
+
+	recordUsage(c.UsageRecorder, c.tenantID, uploadRes)
+
+	if c.Hooks.AfterUpload != nil {
+		c.Hooks.AfterUpload(ctx, uploadRes)
+	}
+
+	return uploadRes, nil
+}
+
+// Download downloads the file called name. See Download.
+func (c *Client) Download(name string, opts ...Option) ([]byte, error) {
+	bucket, key, err := c.route(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return Download(c.region(), bucket, key, c.options(opts)...)
+}
+
+// Delete deletes the file called name. See Delete.
+func (c *Client) Delete(name string, opts ...Option) error {
+	bucket, key, err := c.route(name)
+	if err != nil {
+		return err
+	}
+
+	return Delete(c.region(), bucket, key, c.options(opts)...)
+}
@@ -0,0 +1,152 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"os"
+	"testing"
+)
+
+func TestRouters(t *testing.T) {
+	t.Run("verify TenantPrefixRouter puts keys under the tenant", func(t *testing.T) {
+		bucket, key, err := TenantPrefixRouter(S3Bucket)("acme", "invoices/2023.pdf")
+		assert.Nil(t, err)
+		assert.Equal(t, S3Bucket, bucket)
+		assert.Equal(t, "acme/invoices/2023.pdf", key)
+	})
+	t.Run("verify TenantPrefixRouter rejects keys escaping the tenant", func(t *testing.T) {
+		_, _, err := TenantPrefixRouter(S3Bucket)("acme", "../globex/invoices/2023.pdf")
+		assert.True(t, errors.Is(err, ErrCrossTenantKey))
+
+		_, _, err = TenantPrefixRouter(S3Bucket)("acme", "..")
+		assert.True(t, errors.Is(err, ErrCrossTenantKey))
+	})
+	t.Run("verify TenantBucketRouter gives every tenant a bucket", func(t *testing.T) {
+		bucket, key, err := TenantBucketRouter("uploads-%s")("acme", "invoices/2023.pdf")
+		assert.Nil(t, err)
+		assert.Equal(t, "uploads-acme", bucket)
+		assert.Equal(t, "invoices/2023.pdf", key)
+	})
+	t.Run("verify err when the tenant is invalid", func(t *testing.T) {
+		for _, tenantID := range []string{"", "acme/globex", ".."} {
+			_, _, err := TenantPrefixRouter(S3Bucket)(tenantID, "file")
+			assert.Equal(t, ErrParameterTenantID, err)
+
+			_, _, err = TenantBucketRouter("uploads-%s")(tenantID, "file")
+			assert.Equal(t, ErrParameterTenantID, err)
+		}
+	})
+}
+
+func TestClient(t *testing.T) {
+	t.Run("verify err when the Client has no Bucket or Router", func(t *testing.T) {
+		fileBytes, err := (&Client{Region: Region}).Download(S3FileName)
+		assert.Equal(t, 0, len(fileBytes))
+		assert.Equal(t, ErrParameterBucketEmpty, err)
+	})
+	t.Run("verify err when a routed Client has no tenant", func(t *testing.T) {
+		client := &Client{Region: Region, Router: TenantPrefixRouter(S3Bucket)}
+
+		fileBytes, err := client.Download(S3FileName)
+		assert.Equal(t, 0, len(fileBytes))
+		assert.Equal(t, ErrParameterTenantID, err)
+		assert.Equal(t, ErrParameterTenantID, client.Delete(S3FileName))
+	})
+	t.Run("verify ForTenant does not change the original Client", func(t *testing.T) {
+		client := &Client{Region: Region, Router: TenantPrefixRouter(S3Bucket)}
+		tenantClient := client.ForTenant("acme")
+
+		_, key, err := tenantClient.route(S3FileName)
+		assert.Nil(t, err)
+		assert.Equal(t, "acme/"+S3FileName, key)
+
+		_, _, err = client.route(S3FileName)
+		assert.Equal(t, ErrParameterTenantID, err)
+	})
+	t.Run("verify PublicURL is applied before the Client's Options", func(t *testing.T) {
+		client := &Client{PublicURL: "cdn.example.com", Options: []Option{WithPublicURL("other.example.com")}}
+
+		o := newOptions(client.options(nil))
+		assert.Equal(t, "https://other.example.com/"+S3FileName, o.objectURL(S3Bucket, S3FileName, ""))
+
+		o = newOptions((&Client{PublicURL: "cdn.example.com"}).options(nil))
+		assert.Equal(t, "https://cdn.example.com/"+S3FileName, o.objectURL(S3Bucket, S3FileName, ""))
+	})
+	t.Run("verify tenants can't read each other's files", func(t *testing.T) {
+		client := &Client{Region: Region, Router: TenantPrefixRouter(S3Bucket)}
+
+		sampleBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		uploadRes, err := client.ForTenant("acme").UploadHeader(generateFileHeader(t, SampleFileName, sampleBytes), SampleFileName)
+		assert.Nil(t, err)
+		assert.Equal(t, "acme/"+SampleFileName, uploadRes.Key)
+
+		_, err = client.ForTenant("globex").Download(SampleFileName)
+		assert.NotNil(t, err)
+
+		fileBytes, err := client.ForTenant("acme").Download(SampleFileName)
+		assert.Nil(t, err)
+		assert.Equal(t, len(sampleBytes), len(fileBytes))
+
+		assert.Nil(t, client.ForTenant("acme").Delete(SampleFileName))
+	})
+}
+
+func TestHooks(t *testing.T) {
+	type ctxKey struct{}
+	errQuotaExceeded := errors.New("quota exceeded")
+
+	t.Run("verify BeforeUpload errors reject the upload", func(t *testing.T) {
+		var uploadReq *UploadReq
+		var hookCtx context.Context
+
+		client := &Client{
+			Region: Region,
+			Router: TenantPrefixRouter(S3Bucket),
+			Hooks: Hooks{
+				BeforeUpload: func(ctx context.Context, req *UploadReq) error {
+					hookCtx = ctx
+					uploadReq = req
+					return errQuotaExceeded
+				},
+				AfterUpload: func(ctx context.Context, uploadRes *UploadRes) {
+					t.Error("AfterUpload called for a rejected upload")
+				},
+			},
+		}
+
+		ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+		fileHeader := generateFileHeader(t, SampleFileName, []byte("contents"))
+
+		uploadRes, err := client.ForTenant("acme").UploadHeader(fileHeader, SampleFileName, WithContext(ctx))
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.True(t, errors.Is(err, ErrUploadRejected))
+		assert.True(t, errors.Is(err, errQuotaExceeded))
+		assert.Equal(t, "request", hookCtx.Value(ctxKey{}))
+		assert.Equal(t, "acme", uploadReq.TenantID)
+		assert.Equal(t, S3Bucket, uploadReq.Bucket)
+		assert.Equal(t, "acme/"+SampleFileName, uploadReq.Key)
+		assert.True(t, fileHeader == uploadReq.FileHeader)
+	})
+	t.Run("verify AfterUpload is called after uploading", func(t *testing.T) {
+		var afterRes *UploadRes
+
+		client := &Client{
+			Region: Region,
+			Bucket: S3Bucket,
+			Hooks: Hooks{
+				AfterUpload: func(ctx context.Context, uploadRes *UploadRes) {
+					afterRes = uploadRes
+				},
+			},
+		}
+
+		uploadRes, err := client.UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), "hooks/"+SampleFileName)
+		assert.Nil(t, err)
+		assert.True(t, uploadRes == afterRes)
+
+		assert.Nil(t, client.Delete("hooks/"+SampleFileName))
+	})
+}
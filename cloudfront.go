@@ -0,0 +1,175 @@
+package lambda_s3
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cloudFrontRegion is the region CloudFront's global API is signed for.
+const cloudFrontRegion = "us-east-1"
+
+var (
+	ErrInvalidatingCloudFront       = errors.New("unable to create the CloudFront invalidation")
+	ErrParameterDistributionEmpty   = errors.New("required parameter distributionDomain is empty")
+	ErrParameterDistributionIDEmpty = errors.New("required parameter distributionID is empty")
+	ErrParameterKeyPairIDEmpty      = errors.New("required parameter keyPairID is empty")
+	ErrParameterPathsEmpty          = errors.New("required parameter paths is empty")
+	ErrParameterPrivateKeyNil       = errors.New("required parameter privateKey is nil")
+	ErrPresigningCloudFrontURL      = errors.New("unable to sign the CloudFront URL")
+)
+
+// CloudFrontPolicy restricts how a URL signed by PresignCloudFrontWithPolicy can be used beyond the expiry of a
+// canned policy. Only Expires is required.
+type CloudFrontPolicy struct {
+	// Expires is when the URL stops working.
+	Expires time.Time
+	// NotBefore is when the URL starts working. The zero value means immediately.
+	NotBefore time.Time
+	// SourceIP limits the URL to clients in the IP range, in CIDR notation. e.g. 192.0.2.0/24
+	SourceIP string
+	// Resource is the URL the signature is valid for which may contain * wildcards so one signature covers many
+	// files. e.g. https://d111111abcdef8.cloudfront.net/reports/* Defaults to the URL being signed.
+	Resource string
+}
+
+// PresignCloudFront returns a URL to the file called key, served through the CloudFront distribution at
+// distributionDomain, which is valid for expiry. e.g. d111111abcdef8.cloudfront.net or cdn.example.com
+// keyPairID is the ID of the CloudFront public key, or legacy key pair, whose private key is privateKey.
+// The URL is signed with a canned policy which keeps it short. Use PresignCloudFrontWithPolicy for more control.
+// Load privateKey with sign.LoadPEMPrivKey from github.com/aws/aws-sdk-go/service/cloudfront/sign.
+func PresignCloudFront(distributionDomain, key, keyPairID string, privateKey *rsa.PrivateKey, expiry time.Duration) (string, error) {
+	rawURL, err := cloudFrontURL(distributionDomain, key, keyPairID, privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	signedURL, err := sign.NewURLSigner(keyPairID, privateKey).Sign(rawURL, time.Now().Add(expiry))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrPresigningCloudFrontURL, err)
+	}
+
+	return signedURL, nil
+}
+
+// PresignCloudFrontWithPolicy is PresignCloudFront using a custom policy. See CloudFrontPolicy.
+func PresignCloudFrontWithPolicy(distributionDomain, key, keyPairID string, privateKey *rsa.PrivateKey, policy CloudFrontPolicy) (string, error) {
+	rawURL, err := cloudFrontURL(distributionDomain, key, keyPairID, privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	if policy.Expires.IsZero() {
+		return "", fmt.Errorf("%w: the policy has no expiry", ErrPresigningCloudFrontURL)
+	}
+
+	resource := policy.Resource
+	if resource == "" {
+		resource = rawURL
+	}
+
+	condition := sign.Condition{DateLessThan: sign.NewAWSEpochTime(policy.Expires)}
+
+	if !policy.NotBefore.IsZero() {
+		condition.DateGreaterThan = sign.NewAWSEpochTime(policy.NotBefore)
+	}
+
+	if policy.SourceIP != "" {
+		condition.IPAddress = &sign.IPAddress{SourceIP: policy.SourceIP}
+	}
+
+	signedURL, err := sign.NewURLSigner(keyPairID, privateKey).SignWithPolicy(rawURL, &sign.Policy{
+		Statements: []sign.Statement{{Resource: resource, Condition: condition}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrPresigningCloudFrontURL, err)
+	}
+
+	return signedURL, nil
+}
+
+// cloudFrontURL validates the parameters shared by the PresignCloudFront functions and returns the unsigned URL.
+func cloudFrontURL(distributionDomain, key, keyPairID string, privateKey *rsa.PrivateKey) (string, error) {
+	distributionDomain = strings.TrimSuffix(strings.TrimPrefix(distributionDomain, "https://"), "/")
+	if distributionDomain == "" {
+		return "", ErrParameterDistributionEmpty
+	}
+
+	if key == "" {
+		return "", ErrParameterNameEmpty
+	}
+
+	if keyPairID == "" {
+		return "", ErrParameterKeyPairIDEmpty
+	}
+
+	if privateKey == nil {
+		return "", ErrParameterPrivateKeyNil
+	}
+
+	return (&url.URL{Scheme: "https", Host: distributionDomain, Path: "/" + key}).String(), nil
+}
+
+// InvalidateCloudFront removes paths from the edge caches of the CloudFront distribution distributionID so the next
+// request for them is fetched from the origin. Paths are relative to the distribution, may end in a * wildcard, and
+// get a leading / if they're missing one. e.g. /reports/q1.csv or /reports/*
+// It returns the ID of the invalidation, which CloudFront processes asynchronously.
+func InvalidateCloudFront(distributionID string, paths []string, opts ...Option) (string, error) {
+	if distributionID == "" {
+		return "", ErrParameterDistributionIDEmpty
+	}
+
+	if len(paths) == 0 {
+		return "", ErrParameterPathsEmpty
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newSession(cloudFrontRegion)
+	if err != nil {
+		return "", ErrNewAWSSession
+	}
+
+	itemPaths := make([]*string, 0, len(paths))
+	for _, itemPath := range paths {
+		if !strings.HasPrefix(itemPath, "/") {
+			itemPath = "/" + itemPath
+		}
+		itemPaths = append(itemPaths, aws.String(itemPath))
+	}
+
+	invalidationOutput, err := cloudfront.New(awsSession).CreateInvalidationWithContext(o.context(), &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(distributionID),
+		InvalidationBatch: &cloudfront.InvalidationBatch{
+			// CloudFront treats batches with the same caller reference as retries of one another
+			CallerReference: aws.String(strconv.FormatInt(time.Now().UnixNano(), 10)),
+			Paths: &cloudfront.Paths{
+				Items:    itemPaths,
+				Quantity: aws.Int64(int64(len(itemPaths))),
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidatingCloudFront, err)
+	}
+
+	return aws.StringValue(invalidationOutput.Invalidation.Id), nil
+}
+
+// invalidate invalidates name in the distribution passed WithInvalidation, if any.
+func invalidate(name string, o *options) error {
+	if o.invalidationDistributionID == "" {
+		return nil
+	}
+
+	_, err := InvalidateCloudFront(o.invalidationDistributionID, []string{o.invalidationPrefix + name}, WithContext(o.context()))
+
+	return err
+}
@@ -0,0 +1,85 @@
+package lambda_s3
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	CloudFrontDistributionID = "EDFDVBD6EXAMPLE"
+	CloudFrontDomain         = "d111111abcdef8.cloudfront.net"
+	CloudFrontKeyPairID      = "K2JCJMDEHXQW5F"
+)
+
+func TestPresignCloudFront(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	t.Run("verify err when parameters are missing", func(t *testing.T) {
+		_, err := PresignCloudFront("", S3FileName, CloudFrontKeyPairID, privateKey, time.Hour)
+		assert.Equal(t, ErrParameterDistributionEmpty, err)
+
+		_, err = PresignCloudFront(CloudFrontDomain, "", CloudFrontKeyPairID, privateKey, time.Hour)
+		assert.Equal(t, ErrParameterNameEmpty, err)
+
+		_, err = PresignCloudFront(CloudFrontDomain, S3FileName, "", privateKey, time.Hour)
+		assert.Equal(t, ErrParameterKeyPairIDEmpty, err)
+
+		_, err = PresignCloudFront(CloudFrontDomain, S3FileName, CloudFrontKeyPairID, nil, time.Hour)
+		assert.Equal(t, ErrParameterPrivateKeyNil, err)
+	})
+	t.Run("verify canned policy URLs expire", func(t *testing.T) {
+		signedURL, err := PresignCloudFront("https://"+CloudFrontDomain+"/", "reports/q1 2023.csv", CloudFrontKeyPairID, privateKey, time.Hour)
+		assert.Nil(t, err)
+
+		parsed, err := url.Parse(signedURL)
+		assert.Nil(t, err)
+		assert.Equal(t, CloudFrontDomain, parsed.Host)
+		assert.Equal(t, "/reports/q1 2023.csv", parsed.Path)
+		assert.Equal(t, CloudFrontKeyPairID, parsed.Query().Get("Key-Pair-Id"))
+		assert.NotEqual(t, "", parsed.Query().Get("Signature"))
+		assert.NotEqual(t, "", parsed.Query().Get("Expires"))
+		assert.Equal(t, "", parsed.Query().Get("Policy"))
+	})
+	t.Run("verify custom policy URLs carry the policy", func(t *testing.T) {
+		signedURL, err := PresignCloudFrontWithPolicy(CloudFrontDomain, S3FileName, CloudFrontKeyPairID, privateKey, CloudFrontPolicy{
+			Expires:  time.Now().Add(time.Hour),
+			SourceIP: "192.0.2.0/24",
+			Resource: "https://" + CloudFrontDomain + "/*",
+		})
+		assert.Nil(t, err)
+
+		parsed, err := url.Parse(signedURL)
+		assert.Nil(t, err)
+
+		encodedPolicy := strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(parsed.Query().Get("Policy"))
+		policy, err := base64.StdEncoding.DecodeString(encodedPolicy)
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(string(policy), `"AWS:SourceIp":"192.0.2.0/24"`))
+		assert.True(t, strings.Contains(string(policy), `"Resource":"https://`+CloudFrontDomain+`/*"`))
+	})
+	t.Run("verify err when the custom policy has no expiry", func(t *testing.T) {
+		_, err := PresignCloudFrontWithPolicy(CloudFrontDomain, S3FileName, CloudFrontKeyPairID, privateKey, CloudFrontPolicy{})
+		assert.True(t, errors.Is(err, ErrPresigningCloudFrontURL))
+	})
+}
+
+func TestInvalidateCloudFront(t *testing.T) {
+	t.Run("verify err when parameters are missing", func(t *testing.T) {
+		_, err := InvalidateCloudFront("", []string{S3FileName})
+		assert.Equal(t, ErrParameterDistributionIDEmpty, err)
+
+		_, err = InvalidateCloudFront(CloudFrontDistributionID, nil)
+		assert.Equal(t, ErrParameterPathsEmpty, err)
+	})
+	t.Run("verify nothing is invalidated without WithInvalidation", func(t *testing.T) {
+		assert.Nil(t, invalidate(S3FileName, newOptions(nil)))
+	})
+}
@@ -0,0 +1,46 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+var ErrDecompressingFile = errors.New("unable to decompress the gzip encoded file")
+
+// gzipReader returns a reader of the gzip compressed contents of r. Compression happens in a goroutine as the
+// returned reader is read so r is never buffered in full. Closing the reader stops the goroutine. r is copied
+// through a pooled buffer of bufferSize bytes.
+func gzipReader(r io.Reader, bufferSize int) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+
+	go func() {
+		gzipWriter := newGzipWriter(pipeWriter)
+		defer releaseGzipWriter(gzipWriter)
+
+		_, err := copyBuffer(gzipWriter, r, bufferSize)
+		if err == nil {
+			err = gzipWriter.Close()
+		}
+
+		pipeWriter.CloseWithError(err)
+	}()
+
+	return pipeReader
+}
+
+func gunzip(fileBytes []byte) ([]byte, error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(fileBytes))
+	if err != nil {
+		return nil, ErrDecompressingFile
+	}
+	defer gzReader.Close()
+
+	decompressedBytes, err := io.ReadAll(gzReader)
+	if err != nil {
+		return nil, ErrDecompressingFile
+	}
+
+	return decompressedBytes, nil
+}
@@ -0,0 +1,47 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	t.Run("verify gzipReader output round trips through gunzip", func(t *testing.T) {
+		fileBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		gzipBody := gzipReader(bytes.NewReader(fileBytes), DefaultBufferSize)
+		compressedBytes, err := io.ReadAll(gzipBody)
+		assert.Nil(t, err)
+		assert.Nil(t, gzipBody.Close())
+
+		decompressedBytes, err := gunzip(compressedBytes)
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(fileBytes, decompressedBytes))
+	})
+	t.Run("verify err when gunzip is given uncompressed bytes", func(t *testing.T) {
+		decompressedBytes, err := gunzip([]byte("not gzip"))
+		assert.Equal(t, 0, len(decompressedBytes))
+		assert.True(t, errors.Is(err, ErrDecompressingFile))
+	})
+	t.Run("verify WithGzip uploads compressed and downloads decompressed", func(t *testing.T) {
+		fileHeaders, err := GetHeaders(generateUploadFileReq(), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+
+		_, err = UploadHeader(fileHeaders[0], Region, S3Bucket, S3GzipFileName, WithGzip())
+		assert.Nil(t, err)
+
+		compressedBytes, err := Download(Region, S3Bucket, S3GzipFileName)
+		assert.Nil(t, err)
+		assert.True(t, len(compressedBytes) != SampleFileSizeBytes)
+
+		fileBytes, err := Download(Region, S3Bucket, S3GzipFileName, WithGzip())
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+	})
+}
@@ -0,0 +1,34 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/http"
+)
+
+// setConditions passes a client's conditional request headers on to S3 so the object is only downloaded when the
+// client's copy is out of date. If-Modified-Since is ignored when If-None-Match is present, as RFC 9110 says.
+func setConditions(getObjectInput *s3.GetObjectInput, headers http.Header) {
+	if ifNoneMatch := headers.Get("If-None-Match"); ifNoneMatch != "" {
+		getObjectInput.IfNoneMatch = aws.String(ifNoneMatch)
+		return
+	}
+
+	if ifModifiedSince, err := http.ParseTime(headers.Get("If-Modified-Since")); err == nil {
+		getObjectInput.IfModifiedSince = aws.Time(ifModifiedSince)
+	}
+}
+
+// notModifiedHeaders are the headers of a 304 Not Modified response. S3 answers a failed condition with an error
+// rather than a GetObjectOutput so they're taken from the raw response.
+func notModifiedHeaders(responseHeaders *responseHeaderRecorder) map[string]string {
+	headers := map[string]string{}
+
+	for _, header := range []string{"ETag", "Last-Modified"} {
+		if value := responseHeaders.get(header); value != "" {
+			headers[header] = value
+		}
+	}
+
+	return headers
+}
@@ -0,0 +1,32 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSetConditions(t *testing.T) {
+	lastModified := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("verify If-None-Match takes precedence over If-Modified-Since", func(t *testing.T) {
+		getObjectInput := &s3.GetObjectInput{}
+		setConditions(getObjectInput, http.Header{"If-None-Match": {`"etag"`}, "If-Modified-Since": {lastModified.Format(http.TimeFormat)}})
+		assert.Equal(t, `"etag"`, aws.StringValue(getObjectInput.IfNoneMatch))
+		assert.True(t, getObjectInput.IfModifiedSince == nil)
+	})
+	t.Run("verify If-Modified-Since is passed on by itself", func(t *testing.T) {
+		getObjectInput := &s3.GetObjectInput{}
+		setConditions(getObjectInput, http.Header{"If-Modified-Since": {lastModified.Format(http.TimeFormat)}})
+		assert.True(t, getObjectInput.IfNoneMatch == nil)
+		assert.True(t, lastModified.Equal(aws.TimeValue(getObjectInput.IfModifiedSince)))
+	})
+	t.Run("verify malformed dates are ignored", func(t *testing.T) {
+		getObjectInput := &s3.GetObjectInput{}
+		setConditions(getObjectInput, http.Header{"If-Modified-Since": {"yesterday"}})
+		assert.True(t, getObjectInput.IfModifiedSince == nil)
+	})
+}
@@ -0,0 +1,136 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"strings"
+	"time"
+)
+
+// ScopedUploadSessionName is the session name scoped upload credentials are issued under. It's what CloudTrail
+// records for requests made with them.
+const ScopedUploadSessionName = "lambda_s3-scoped-upload"
+
+// STS issues credentials for between 15 minutes and 12 hours. The upper limit is also capped by the role's maximum
+// session duration.
+const (
+	minScopedCredentialsTTL = 15 * time.Minute
+	maxScopedCredentialsTTL = 12 * time.Hour
+)
+
+var (
+	ErrIssuingCredentials = errors.New("unable to issue the scoped credentials")
+	ErrParameterPrefix    = errors.New("required parameter prefix must not contain wildcards")
+	ErrParameterRoleARN   = errors.New("required parameter roleARN is not an IAM role ARN")
+	ErrParameterTTL       = errors.New("required parameter ttl must be between 15 minutes and 12 hours")
+)
+
+// ScopedCredentials are temporary AWS credentials that can only upload to Bucket under Prefix. They're shaped so
+// they can be returned to a browser or mobile client as is and passed to its AWS SDK.
+type ScopedCredentials struct {
+	AccessKeyID     string    `json:"accessKeyID"`
+	SecretAccessKey string    `json:"secretAccessKey"`
+	SessionToken    string    `json:"sessionToken"`
+	Expiration      time.Time `json:"expiration"`
+	Region          string    `json:"region"`
+	Bucket          string    `json:"bucket"`
+	Prefix          string    `json:"prefix"`
+}
+
+// IssueScopedUploadCredentials assumes roleARN with a session policy that only allows uploading to bucket under
+// prefix and returns the credentials, valid for ttl. Unlike presigned URLs they let clients run multipart uploads
+// of any size, and resume them, with their own AWS SDK. The Lambda's role needs sts:AssumeRole on roleARN and
+// roleARN needs s3:PutObject and s3:AbortMultipartUpload on the bucket since the session policy can only narrow
+// what the role allows. Lambda execution roles can't call GetFederationToken, which is why a role is needed.
+//
+// prefix is matched as is so end it with a / to stop uploads to user-1/ matching user-10/ as well.
+func IssueScopedUploadCredentials(region, bucket, prefix, roleARN string, ttl time.Duration, opts ...Option) (*ScopedCredentials, error) {
+	if region == "" {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	if strings.ContainsAny(prefix, "*?") {
+		return nil, fmt.Errorf("%w: %s", ErrParameterPrefix, prefix)
+	}
+
+	if !isRoleARN(roleARN) {
+		return nil, fmt.Errorf("%w: %s", ErrParameterRoleARN, roleARN)
+	}
+
+	if ttl < minScopedCredentialsTTL || ttl > maxScopedCredentialsTTL {
+		return nil, ErrParameterTTL
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newSession(region)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	output, err := sts.New(awsSession).AssumeRoleWithContext(o.context(), &sts.AssumeRoleInput{
+		RoleArn:         aws.String(roleARN),
+		RoleSessionName: aws.String(ScopedUploadSessionName),
+		DurationSeconds: aws.Int64(int64(ttl / time.Second)),
+		Policy:          aws.String(scopedUploadPolicy(region, bucket, prefix)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrIssuingCredentials, err)
+	}
+
+	return &ScopedCredentials{
+		AccessKeyID:     aws.StringValue(output.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(output.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(output.Credentials.SessionToken),
+		Expiration:      aws.TimeValue(output.Credentials.Expiration),
+		Region:          region,
+		Bucket:          bucket,
+		Prefix:          prefix,
+	}, nil
+}
+
+// scopedUploadPolicy is the session policy allowing uploads to bucket under prefix. s3:PutObject covers every
+// request of a multipart upload except aborting it and listing the parts uploaded so far.
+func scopedUploadPolicy(region, bucket, prefix string) string {
+	resource := fmt.Sprintf("arn:%s:s3:::%s/%s*", partition(region), bucket, prefix)
+	if arn.IsARN(bucket) {
+		resource = fmt.Sprintf("%s/object/%s*", bucket, prefix)
+	}
+
+	policy := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":   "Allow",
+			"Action":   []string{"s3:PutObject", "s3:AbortMultipartUpload", "s3:ListMultipartUploadParts"},
+			"Resource": resource,
+		}},
+	}
+
+	policyBytes, _ := json.Marshal(policy) // the policy only contains strings so marshalling can't fail
+
+	return string(policyBytes)
+}
+
+// isRoleARN reports whether roleARN is the ARN of an IAM role.
+func isRoleARN(roleARN string) bool {
+	parsed, err := arn.Parse(roleARN)
+	return err == nil && parsed.Service == "iam" && strings.HasPrefix(parsed.Resource, "role/")
+}
+
+// partition is the AWS partition region is in, e.g. aws or aws-cn, which ARNs of resources in region start with.
+func partition(region string) string {
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return p.ID()
+	}
+
+	return endpoints.AwsPartitionID
+}
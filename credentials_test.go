@@ -0,0 +1,53 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+	"time"
+)
+
+const testRoleARN = "arn:aws:iam::123456789012:role/uploader"
+
+func TestIssueScopedUploadCredentials(t *testing.T) {
+	t.Run("verify err when parameters are invalid", func(t *testing.T) {
+		_, err := IssueScopedUploadCredentials("", S3Bucket, "uploads/", testRoleARN, time.Hour)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+
+		_, err = IssueScopedUploadCredentials(Region, S3Bucket, "uploads/*", testRoleARN, time.Hour)
+		assert.True(t, errors.Is(err, ErrParameterPrefix))
+
+		_, err = IssueScopedUploadCredentials(Region, S3Bucket, "uploads/", "arn:aws:iam::123456789012:user/uploader", time.Hour)
+		assert.True(t, errors.Is(err, ErrParameterRoleARN))
+
+		_, err = IssueScopedUploadCredentials(Region, S3Bucket, "uploads/", testRoleARN, time.Minute)
+		assert.True(t, errors.Is(err, ErrParameterTTL))
+	})
+}
+
+func TestScopedUploadPolicy(t *testing.T) {
+	resource := func(t *testing.T, policy string) string {
+		var parsed struct {
+			Statement []struct {
+				Resource string
+			}
+		}
+		assert.Nil(t, json.Unmarshal([]byte(policy), &parsed))
+		assert.Equal(t, 1, len(parsed.Statement))
+
+		return parsed.Statement[0].Resource
+	}
+
+	t.Run("verify uploads are only allowed under the prefix", func(t *testing.T) {
+		assert.Equal(t, "arn:aws:s3:::my-bucket/uploads/user-1/*", resource(t, scopedUploadPolicy("us-east-1", "my-bucket", "uploads/user-1/")))
+	})
+	t.Run("verify the ARN is in the region's partition", func(t *testing.T) {
+		assert.Equal(t, "arn:aws-cn:s3:::my-bucket/*", resource(t, scopedUploadPolicy("cn-north-1", "my-bucket", "")))
+		assert.Equal(t, "arn:aws-us-gov:s3:::my-bucket/*", resource(t, scopedUploadPolicy("us-gov-west-1", "my-bucket", "")))
+	})
+	t.Run("verify access points are scoped to their objects", func(t *testing.T) {
+		accessPoint := "arn:aws:s3:us-east-1:123456789012:accesspoint/uploads"
+		assert.Equal(t, accessPoint+"/object/user-1/*", resource(t, scopedUploadPolicy("us-east-1", accessPoint, "user-1/")))
+	})
+}
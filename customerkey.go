@@ -0,0 +1,59 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// customerKeyLen is the length of the AES-256 keys SSE-C encrypts objects with.
+const customerKeyLen = 32
+
+var ErrParameterCustomerKey = errors.New("required parameter key must be a 32 byte AES-256 key")
+
+// customerKey is the key objects are encrypted with on S3's side when using SSE-C. S3 never stores it so every
+// request reading or writing the object has to send it again.
+type customerKey struct {
+	key    string
+	keyMD5 string
+}
+
+// setParams sets the SSE-C key on the inputs of the requests that read or write an object's contents. It runs
+// before the SDK's own validation, which refuses to send the key over plain HTTP, and before the SDK base64 encodes
+// the key and computes its MD5 digest when keyMD5 wasn't given.
+func (k *customerKey) setParams(r *request.Request) {
+	if r.ClientInfo.ServiceName != s3.ServiceName {
+		return
+	}
+
+	if len(k.key) != customerKeyLen {
+		r.Error = ErrParameterCustomerKey
+		return
+	}
+
+	algorithm := aws.String(s3.ServerSideEncryptionAes256)
+	key := aws.String(k.key)
+
+	var keyMD5 *string
+	if k.keyMD5 != "" {
+		keyMD5 = aws.String(k.keyMD5)
+	}
+
+	switch input := r.Params.(type) {
+	case *s3.GetObjectInput:
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = algorithm, key, keyMD5
+	case *s3.HeadObjectInput:
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = algorithm, key, keyMD5
+	case *s3.PutObjectInput:
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = algorithm, key, keyMD5
+	case *s3.CreateMultipartUploadInput:
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = algorithm, key, keyMD5
+	case *s3.UploadPartInput:
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = algorithm, key, keyMD5
+	case *s3.CopyObjectInput:
+		// copies, like moving an object to the trash, read and write objects encrypted with the same key
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = algorithm, key, keyMD5
+		input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = algorithm, key, keyMD5
+	}
+}
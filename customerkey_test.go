@@ -0,0 +1,75 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestWithCustomerKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, customerKeyLen)
+
+	t.Run("verify the key is sent with requests for the object's contents", func(t *testing.T) {
+		awsSession, err := newOptions([]Option{WithCustomerKey(key, "")}).newSession(Region)
+		assert.Nil(t, err)
+
+		req, _ := s3.New(awsSession).GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(S3Bucket),
+			Key:    aws.String(S3FileName),
+		})
+		assert.Nil(t, req.Build())
+		assert.Equal(t, s3.ServerSideEncryptionAes256, req.HTTPRequest.Header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"))
+		assert.Equal(t, "BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc=", req.HTTPRequest.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key"))
+		assert.True(t, req.HTTPRequest.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5") != "")
+	})
+	t.Run("verify a given MD5 is sent as is and copies send the key for both objects", func(t *testing.T) {
+		awsSession, err := newOptions([]Option{WithCustomerKey(key, "given")}).newSession(Region)
+		assert.Nil(t, err)
+
+		req, _ := s3.New(awsSession).CopyObjectRequest(&s3.CopyObjectInput{
+			Bucket:     aws.String(S3Bucket),
+			CopySource: aws.String(S3Bucket + "/" + S3FileName),
+			Key:        aws.String("copy/" + S3FileName),
+		})
+		assert.Nil(t, req.Build())
+		assert.Equal(t, "given", req.HTTPRequest.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"))
+		assert.Equal(t, "given", req.HTTPRequest.Header.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-Md5"))
+	})
+	t.Run("verify other requests don't carry the key", func(t *testing.T) {
+		awsSession, err := newOptions([]Option{WithCustomerKey(key, "")}).newSession(Region)
+		assert.Nil(t, err)
+
+		req, _ := s3.New(awsSession).DeleteObjectRequest(&s3.DeleteObjectInput{
+			Bucket: aws.String(S3Bucket),
+			Key:    aws.String(S3FileName),
+		})
+		assert.Nil(t, req.Build())
+		assert.Equal(t, "", req.HTTPRequest.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key"))
+	})
+	t.Run("verify err when the key isn't 32 bytes long", func(t *testing.T) {
+		awsSession, err := newOptions([]Option{WithCustomerKey([]byte("short"), "")}).newSession(Region)
+		assert.Nil(t, err)
+
+		req, _ := s3.New(awsSession).HeadObjectRequest(&s3.HeadObjectInput{
+			Bucket: aws.String(S3Bucket),
+			Key:    aws.String(S3FileName),
+		})
+		assert.True(t, errors.Is(req.Build(), ErrParameterCustomerKey))
+	})
+	t.Run("verify objects uploaded with a key are only downloaded with it", func(t *testing.T) {
+		uploadRes, err := UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), Region, S3Bucket, "sse-c/"+SampleFileName, WithCustomerKey(key, ""))
+		assert.Nil(t, err)
+
+		fileBytes, err := Download(Region, S3Bucket, uploadRes.Key, WithCustomerKey(key, ""))
+		assert.Nil(t, err)
+		assert.Equal(t, "contents", string(fileBytes))
+
+		_, err = Download(Region, S3Bucket, uploadRes.Key)
+		assert.True(t, errors.Is(err, ErrDownloadingS3File))
+
+		assert.Nil(t, Delete(Region, S3Bucket, uploadRes.Key))
+	})
+}
@@ -0,0 +1,73 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"time"
+)
+
+// DefaultDeadlineMargin is how long before the deadline of the context passed WithContext transfers are stopped
+// unless WithDeadlineMargin says otherwise.
+const DefaultDeadlineMargin = time.Second
+
+var ErrDeadlineTooClose = errors.New("the transfer can't finish before the context's deadline")
+
+// transferContext is the context transfers are made with. When the context passed WithContext has a deadline, such
+// as the invocation deadline the Lambda runtime puts on a handler's context, transfers are stopped o.deadlineMargin
+// before it so there's time left to clean up and respond before the Lambda is frozen. It returns
+// ErrDeadlineTooClose when the deadline is already within the margin.
+func (o *options) transferContext() (context.Context, context.CancelFunc, error) {
+	ctx := o.context()
+
+	deadline, ok := ctx.Deadline()
+	if !ok || o.deadlineMargin <= 0 {
+		return ctx, func() {}, nil
+	}
+
+	transferDeadline := deadline.Add(-o.deadlineMargin)
+	if !time.Now().Before(transferDeadline) {
+		return nil, nil, ErrDeadlineTooClose
+	}
+
+	transferCtx, cancel := context.WithDeadline(ctx, transferDeadline)
+
+	return transferCtx, cancel, nil
+}
+
+// deadlineExceeded reports whether transferCtx was stopped by transferContext rather than by the caller.
+func (o *options) deadlineExceeded(transferCtx context.Context) bool {
+	return errors.Is(transferCtx.Err(), context.DeadlineExceeded) && o.context().Err() == nil
+}
+
+// leavePartsOnError stops s3manager aborting failed multipart uploads itself. It would abort them with the
+// transfer's context which is already done when the deadline is what failed them so abortFailedUpload does it instead.
+func leavePartsOnError(uploader *s3manager.Uploader) {
+	uploader.LeavePartsOnError = true
+}
+
+// abortFailedUpload aborts the multipart upload left behind by the failed upload that returned err, if any, so S3
+// doesn't keep its parts around. The abort is given the deadline margin to finish in since the transfer's context
+// may already be done. Without a margin it's made with the context passed WithContext.
+func abortFailedUpload(s3Client s3iface.S3API, bucket, name string, err error, o *options) {
+	var multiUploadFailure s3manager.MultiUploadFailure
+	if !errors.As(err, &multiUploadFailure) || multiUploadFailure.UploadID() == "" {
+		return
+	}
+
+	ctx, cancel := o.context(), func() {}
+	if o.deadlineMargin > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), o.deadlineMargin)
+	}
+	defer cancel()
+
+	// best effort. AbortIncompleteUploads or a lifecycle rule cleans up anything left behind
+	s3Client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(name),
+		UploadId: aws.String(multiUploadFailure.UploadID()),
+	})
+}
@@ -0,0 +1,103 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+	"time"
+)
+
+type abortRecorder struct {
+	s3iface.S3API
+	input  *s3.AbortMultipartUploadInput
+	ctxErr error
+}
+
+func (a *abortRecorder) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, _ ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	a.ctxErr = ctx.Err()
+	a.input = input
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+type multiUploadError struct {
+	error
+	uploadID string
+}
+
+func (m multiUploadError) Code() string     { return "RequestCanceled" }
+func (m multiUploadError) Message() string  { return m.Error() }
+func (m multiUploadError) OrigErr() error   { return m.error }
+func (m multiUploadError) UploadID() string { return m.uploadID }
+
+func TestTransferContext(t *testing.T) {
+	t.Run("verify contexts without a deadline are used as they are", func(t *testing.T) {
+		ctx := context.Background()
+
+		transferCtx, cancel, err := newOptions([]Option{WithContext(ctx)}).transferContext()
+		assert.Nil(t, err)
+		defer cancel()
+
+		assert.True(t, transferCtx == ctx)
+	})
+	t.Run("verify transfers stop the margin before the deadline", func(t *testing.T) {
+		deadline := time.Now().Add(time.Minute)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+
+		transferCtx, cancelTransfer, err := newOptions([]Option{WithContext(ctx), WithDeadlineMargin(5 * time.Second)}).transferContext()
+		assert.Nil(t, err)
+		defer cancelTransfer()
+
+		transferDeadline, ok := transferCtx.Deadline()
+		assert.True(t, ok)
+		assert.True(t, transferDeadline.Equal(deadline.Add(-5*time.Second)))
+	})
+	t.Run("verify transfers within the margin of the deadline fail", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultDeadlineMargin/2)
+		defer cancel()
+
+		_, _, err := newOptions([]Option{WithContext(ctx)}).transferContext()
+		assert.True(t, errors.Is(err, ErrDeadlineTooClose))
+
+		_, err = Download(Region, S3Bucket, S3FileName, WithContext(ctx))
+		assert.True(t, errors.Is(err, ErrDeadlineTooClose))
+
+		_, err = UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), Region, S3Bucket, SampleFileName, WithContext(ctx))
+		assert.True(t, errors.Is(err, ErrDeadlineTooClose))
+	})
+	t.Run("verify a zero margin lets transfers run up to the deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultDeadlineMargin/2)
+		defer cancel()
+
+		transferCtx, cancelTransfer, err := newOptions([]Option{WithContext(ctx), WithDeadlineMargin(0)}).transferContext()
+		assert.Nil(t, err)
+		defer cancelTransfer()
+
+		assert.True(t, transferCtx == ctx)
+	})
+}
+
+func TestAbortFailedUpload(t *testing.T) {
+	t.Run("verify failed multipart uploads are aborted with a live context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		recorder := &abortRecorder{}
+		abortFailedUpload(recorder, S3Bucket, SampleFileName, multiUploadError{error: context.Canceled, uploadID: "upload-1"}, newOptions([]Option{WithContext(ctx)}))
+
+		assert.Equal(t, "upload-1", aws.StringValue(recorder.input.UploadId))
+		assert.Equal(t, SampleFileName, aws.StringValue(recorder.input.Key))
+		assert.Nil(t, recorder.ctxErr)
+	})
+	t.Run("verify failures before the multipart upload started are ignored", func(t *testing.T) {
+		recorder := &abortRecorder{}
+		abortFailedUpload(recorder, S3Bucket, SampleFileName, errors.New("failed"), newOptions(nil))
+
+		assert.True(t, recorder.input == nil)
+	})
+}
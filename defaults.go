@@ -0,0 +1,66 @@
+package lambda_s3
+
+import (
+	"mime/multipart"
+	"os"
+	"sync"
+)
+
+// The environment variables Clients read their Region and Bucket from when they're empty. Change them before the
+// first call if your Lambda uses different names. AWS_REGION is set by Lambda itself.
+var (
+	RegionEnvVar = "AWS_REGION"
+	BucketEnvVar = "S3_BUCKET"
+)
+
+var (
+	defaultClient     *Client
+	defaultClientOnce sync.Once
+)
+
+// DefaultClient returns the Client used by Upload, Get, and Remove. It's created on first use with the Region and
+// Bucket in the environment variables named by RegionEnvVar and BucketEnvVar so simple Lambdas don't have to thread
+// any configuration through. Set its fields before using it to configure it further.
+func DefaultClient() *Client {
+	defaultClientOnce.Do(func() {
+		defaultClient = &Client{
+			Region: os.Getenv(RegionEnvVar),
+			Bucket: os.Getenv(BucketEnvVar),
+		}
+	})
+
+	return defaultClient
+}
+
+// Upload uploads fileHeader under key with DefaultClient.
+func Upload(fileHeader *multipart.FileHeader, key string, opts ...Option) (*UploadRes, error) {
+	return DefaultClient().UploadHeader(fileHeader, key, opts...)
+}
+
+// Get downloads the file stored under key with DefaultClient.
+func Get(key string, opts ...Option) ([]byte, error) {
+	return DefaultClient().Download(key, opts...)
+}
+
+// Remove deletes the file stored under key with DefaultClient.
+func Remove(key string, opts ...Option) error {
+	return DefaultClient().Delete(key, opts...)
+}
+
+// region is c.Region or, when that's empty, the region in the environment.
+func (c *Client) region() string {
+	if c.Region == "" {
+		return os.Getenv(RegionEnvVar)
+	}
+
+	return c.Region
+}
+
+// bucket is c.Bucket or, when that's empty, the bucket in the environment.
+func (c *Client) bucket() string {
+	if c.Bucket == "" {
+		return os.Getenv(BucketEnvVar)
+	}
+
+	return c.Bucket
+}
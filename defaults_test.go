@@ -0,0 +1,63 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestClientEnvironment(t *testing.T) {
+	t.Run("verify empty regions and buckets are read from the environment", func(t *testing.T) {
+		t.Setenv(RegionEnvVar, "eu-west-1")
+		t.Setenv(BucketEnvVar, "environment-bucket")
+
+		client := &Client{}
+		assert.Equal(t, "eu-west-1", client.region())
+
+		bucket, key, err := client.route(S3FileName)
+		assert.Nil(t, err)
+		assert.Equal(t, "environment-bucket", bucket)
+		assert.Equal(t, S3FileName, key)
+	})
+	t.Run("verify the fields take precedence over the environment", func(t *testing.T) {
+		t.Setenv(RegionEnvVar, "eu-west-1")
+		t.Setenv(BucketEnvVar, "environment-bucket")
+
+		client := &Client{Region: Region, Bucket: S3Bucket}
+		assert.Equal(t, Region, client.region())
+
+		bucket, _, err := client.route(S3FileName)
+		assert.Nil(t, err)
+		assert.Equal(t, S3Bucket, bucket)
+	})
+	t.Run("verify the environment variable names can be changed", func(t *testing.T) {
+		defer func(bucketEnvVar string) { BucketEnvVar = bucketEnvVar }(BucketEnvVar)
+
+		BucketEnvVar = "UPLOADS_BUCKET"
+		t.Setenv("UPLOADS_BUCKET", "uploads")
+
+		bucket, _, err := (&Client{}).route(S3FileName)
+		assert.Nil(t, err)
+		assert.Equal(t, "uploads", bucket)
+	})
+	t.Run("verify a missing bucket is still an error", func(t *testing.T) {
+		t.Setenv(BucketEnvVar, "")
+
+		_, _, err := (&Client{}).route(S3FileName)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+}
+
+func TestDefaultClient(t *testing.T) {
+	t.Run("verify the default client is created once from the environment", func(t *testing.T) {
+		t.Setenv(RegionEnvVar, Region)
+		t.Setenv(BucketEnvVar, S3Bucket)
+
+		client := DefaultClient()
+		assert.True(t, client == DefaultClient())
+
+		fileBytes, err := Get(S3FileName)
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+	})
+}
@@ -0,0 +1,230 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directory buckets are authenticated with short lived credentials from CreateSession rather than the caller's own.
+// Requests are signed with them for the s3express service and carry their token in its own header.
+const (
+	createSessionOperation            = "CreateSession"
+	directoryBucketService            = "s3express"
+	directoryBucketSessionTokenHeader = "X-Amz-S3session-Token"
+
+	// directoryBucketSessionRefresh is how long before it expires a session is replaced. Sessions last five minutes.
+	directoryBucketSessionRefresh = time.Minute
+)
+
+var ErrCreatingSession = errors.New("unable to create a session for the directory bucket")
+
+// directoryBucketSessions caches the credentials CreateSession returned for every directory bucket, keyed by bucket
+// and the access key they were created with, so they're reused across invocations until shortly before they expire.
+var directoryBucketSessions = struct {
+	sync.Mutex
+	sessions map[string]*directoryBucketSession
+}{sessions: map[string]*directoryBucketSession{}}
+
+type directoryBucketSession struct {
+	credentials credentials.Value
+	expiration  time.Time
+}
+
+// createSessionInput and createSessionOutput describe the CreateSession operation, which the AWS SDK for Go v1
+// predates, so its requests are marshalled and unmarshalled by the S3 client like any other.
+type createSessionInput struct {
+	_ struct{} `locationName:"CreateSessionRequest" type:"structure"`
+
+	Bucket *string `location:"uri" locationName:"Bucket" type:"string" required:"true"`
+}
+
+type createSessionOutput struct {
+	_ struct{} `type:"structure"`
+
+	Credentials *sessionCredentials `type:"structure"`
+}
+
+type sessionCredentials struct {
+	_ struct{} `type:"structure"`
+
+	AccessKeyId     *string    `type:"string"`
+	Expiration      *time.Time `type:"timestamp"`
+	SecretAccessKey *string    `type:"string"`
+	SessionToken    *string    `type:"string"`
+}
+
+// isDirectoryBucket reports whether bucket is an S3 Express One Zone directory bucket. Their names always end in
+// the zone they're stored in followed by --x-s3. e.g. my-bucket--usw2-az1--x-s3
+func isDirectoryBucket(bucket string) bool {
+	return strings.HasSuffix(bucket, "--x-s3")
+}
+
+// directoryBucketZone is the ID of the zone a directory bucket is in, e.g. usw2-az1 for my-bucket--usw2-az1--x-s3.
+func directoryBucketZone(bucket string) string {
+	name := strings.TrimSuffix(bucket, "--x-s3")
+
+	separator := strings.LastIndex(name, "--")
+	if separator <= 0 {
+		return ""
+	}
+
+	return name[separator+2:]
+}
+
+// routeDirectoryBucketRequests returns a Validate handler that routes the S3 requests made with awsSession to
+// directory buckets, see routeToDirectoryBucket, and leaves every other request alone.
+func routeDirectoryBucketRequests(awsSession *session.Session) func(r *request.Request) {
+	return func(r *request.Request) {
+		if r.ClientInfo.ServiceName != s3.ServiceName {
+			return
+		}
+
+		if bucket := requestBucket(r.Params); isDirectoryBucket(bucket) {
+			routeToDirectoryBucket(awsSession, r, bucket)
+		}
+	}
+}
+
+// routeToDirectoryBucket sends r to the zonal endpoint of bucket, <bucket>.s3express-<zone>.<region>.amazonaws.com,
+// which is also the host of UploadRes.S3URL. Requests are still signed by the SDK's SigV4 signer, only for the
+// s3express service. CreateSession itself is signed with the caller's credentials and every other request with the
+// session's, whose token goes in its own header rather than X-Amz-Security-Token. Presigned URLs carry the token in
+// their query string and stop working when the session expires, within five minutes.
+func routeToDirectoryBucket(awsSession *session.Session, r *request.Request, bucket string) {
+	region := aws.StringValue(r.Config.Region)
+	r.Config.S3UseAccelerate = aws.Bool(false)
+	r.ClientInfo.SigningName = directoryBucketService
+
+	host := bucket + "." + directoryBucketService + "-" + directoryBucketZone(bucket) + "." + region + "." + dnsSuffix(region)
+	r.Handlers.Build.PushBack(func(r *request.Request) {
+		moveToEndpoint(r, bucket, host)
+	})
+
+	if r.Operation.Name == createSessionOperation {
+		return
+	}
+
+	// the caller's credentials are kept aside since the request's are replaced with the session's when it's signed
+	callerCredentials := r.Config.Credentials
+	if callerCredentials == credentials.AnonymousCredentials {
+		return
+	}
+
+	r.Handlers.Sign.PushFront(func(r *request.Request) {
+		sessionCredentials, err := directoryBucketCredentials(awsSession, r, callerCredentials, bucket)
+		if err != nil {
+			r.Error = err
+			return
+		}
+
+		// the token is left out of the credentials so the signer doesn't also send it as X-Amz-Security-Token
+		r.Config.Credentials = credentials.NewStaticCredentials(sessionCredentials.AccessKeyID, sessionCredentials.SecretAccessKey, "")
+		r.HTTPRequest.Header.Set(directoryBucketSessionTokenHeader, sessionCredentials.SessionToken)
+	})
+}
+
+// directoryBucketCredentials returns the session credentials r is signed with, creating a session with
+// callerCredentials when there isn't one that's still good for at least directoryBucketSessionRefresh.
+func directoryBucketCredentials(awsSession *session.Session, r *request.Request, callerCredentials *credentials.Credentials, bucket string) (credentials.Value, error) {
+	callerValue, err := callerCredentials.GetWithContext(r.Context())
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	cacheKey := bucket + "\x00" + callerValue.AccessKeyID
+
+	directoryBucketSessions.Lock()
+	cached, ok := directoryBucketSessions.sessions[cacheKey]
+	directoryBucketSessions.Unlock()
+
+	if ok && time.Until(cached.expiration) > directoryBucketSessionRefresh {
+		return cached.credentials, nil
+	}
+
+	output := &createSessionOutput{}
+	createSessionReq := s3.New(awsSession).NewRequest(&request.Operation{
+		Name:       createSessionOperation,
+		HTTPMethod: "GET",
+		HTTPPath:   "/{Bucket}?session",
+	}, &createSessionInput{Bucket: aws.String(bucket)}, output)
+	createSessionReq.SetContext(r.Context())
+
+	if err = createSessionReq.Send(); err != nil {
+		return credentials.Value{}, wrapCause(ErrCreatingSession, err)
+	}
+
+	if output.Credentials == nil || aws.StringValue(output.Credentials.AccessKeyId) == "" {
+		return credentials.Value{}, fmt.Errorf("%w: no credentials were returned", ErrCreatingSession)
+	}
+
+	created := &directoryBucketSession{
+		credentials: credentials.Value{
+			AccessKeyID:     aws.StringValue(output.Credentials.AccessKeyId),
+			SecretAccessKey: aws.StringValue(output.Credentials.SecretAccessKey),
+			SessionToken:    aws.StringValue(output.Credentials.SessionToken),
+		},
+		expiration: aws.TimeValue(output.Credentials.Expiration),
+	}
+
+	directoryBucketSessions.Lock()
+	directoryBucketSessions.sessions[cacheKey] = created
+	directoryBucketSessions.Unlock()
+
+	return created.credentials, nil
+}
+
+// moveToEndpoint points the built request r for bucket at host, taking the bucket out of the host or path the SDK
+// put it in.
+func moveToEndpoint(r *request.Request, bucket, host string) {
+	if aws.StringValue(r.Config.Endpoint) != "" {
+		return
+	}
+
+	u := r.HTTPRequest.URL
+	if !strings.HasPrefix(u.Host, bucket+".") {
+		u.Path = strings.TrimPrefix(u.Path, "/"+bucket)
+		u.RawPath = strings.TrimPrefix(u.RawPath, "/"+bucket)
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+
+	u.Host = host
+	r.HTTPRequest.Host = ""
+}
+
+// dnsSuffix is the DNS suffix of the partition region is in.
+func dnsSuffix(region string) string {
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return partition.DNSSuffix()
+	}
+
+	return "amazonaws.com"
+}
+
+// requestBucket is the Bucket of the input params of an S3 request, if it has one.
+func requestBucket(params interface{}) string {
+	value := reflect.ValueOf(params)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+
+	field := value.Elem().FieldByName("Bucket")
+	if !field.IsValid() {
+		return ""
+	}
+
+	bucket, _ := field.Interface().(*string)
+
+	return aws.StringValue(bucket)
+}
@@ -0,0 +1,400 @@
+package lambda_s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io"
+	"net/http"
+)
+
+// Objects encrypted WithKMSEncryption are split into chunks of encryptionChunkSize bytes which are sealed one at a
+// time with AES-256-GCM so the file can be encrypted while it's streamed to S3. Each chunk's nonce is a random
+// prefix stored with the object followed by the chunk's index and a flag marking the final chunk, so chunks can't
+// be reordered, dropped, or truncated without the decryption failing.
+const (
+	encryptionAlgorithm      = "AES256-GCM-STREAM-64K"
+	encryptionChunkSize      = 64 << 10
+	encryptionNoncePrefixLen = 7
+	encryptionTagSize        = 16
+
+	encryptionAlgorithmMetadataKey  = "cse-algorithm"
+	encryptionNonceMetadataKey      = "cse-nonce"
+	encryptionWrappedKeyMetadataKey = "cse-wrapped-key"
+
+	encryptionAlgorithmMetadataHeader  = "X-Amz-Meta-" + encryptionAlgorithmMetadataKey
+	encryptionNonceMetadataHeader      = "X-Amz-Meta-" + encryptionNonceMetadataKey
+	encryptionWrappedKeyMetadataHeader = "X-Amz-Meta-" + encryptionWrappedKeyMetadataKey
+)
+
+var (
+	ErrDecryptingFile = errors.New("unable to decrypt the downloaded file")
+	ErrEncryptingFile = errors.New("unable to encrypt the file for upload")
+)
+
+// dataKey is a KMS data key. plaintext encrypts the object and is never stored. wrapped is plaintext encrypted under
+// the KMS key and is stored in the object's metadata so the object can be decrypted later.
+type dataKey struct {
+	plaintext []byte
+	wrapped   []byte
+}
+
+// generateDataKey asks KMS for a new AES-256 data key under kmsKeyID.
+func generateDataKey(ctx aws.Context, awsSession *session.Session, kmsKeyID string) (*dataKey, error) {
+	if awsSession == nil {
+		return nil, fmt.Errorf("%w: no AWS Session to reach KMS with", ErrEncryptingFile)
+	}
+
+	output, err := kms.New(awsSession).GenerateDataKeyWithContext(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(kmsKeyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrEncryptingFile, err)
+	}
+
+	return &dataKey{plaintext: output.Plaintext, wrapped: output.CiphertextBlob}, nil
+}
+
+// unwrapDataKey asks KMS to decrypt a data key stored with an object. The wrapped key identifies its KMS key
+// so callers don't need to know which key the object was encrypted with.
+func unwrapDataKey(ctx aws.Context, awsSession *session.Session, wrapped []byte) ([]byte, error) {
+	if awsSession == nil {
+		return nil, fmt.Errorf("%w: no AWS Session to reach KMS with", ErrDecryptingFile)
+	}
+
+	output, err := kms.New(awsSession).DecryptWithContext(ctx, &kms.DecryptInput{
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecryptingFile, err)
+	}
+
+	return output.Plaintext, nil
+}
+
+// encryptionMetadata is the object metadata needed to decrypt an object encrypted with key and noncePrefix.
+func encryptionMetadata(key *dataKey, noncePrefix []byte) map[string]*string {
+	return map[string]*string{
+		encryptionAlgorithmMetadataKey:  aws.String(encryptionAlgorithm),
+		encryptionNonceMetadataKey:      aws.String(base64.StdEncoding.EncodeToString(noncePrefix)),
+		encryptionWrappedKeyMetadataKey: aws.String(base64.StdEncoding.EncodeToString(key.wrapped)),
+	}
+}
+
+// isEncrypted reports whether headers belong to an object uploaded WithKMSEncryption.
+func isEncrypted(headers http.Header) bool {
+	return headers.Get(encryptionWrappedKeyMetadataHeader) != ""
+}
+
+func newNoncePrefix() ([]byte, error) {
+	noncePrefix := make([]byte, encryptionNoncePrefixLen)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return nil, err
+	}
+
+	return noncePrefix, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce builds the nonce for the chunk at index. The last byte is 1 for the final chunk and 0 otherwise.
+func chunkNonce(noncePrefix []byte, index uint32, final bool) []byte {
+	nonce := make([]byte, encryptionNoncePrefixLen+5)
+	copy(nonce, noncePrefix)
+	binary.BigEndian.PutUint32(nonce[encryptionNoncePrefixLen:], index)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+
+	return nonce
+}
+
+// encryptingReader encrypts everything read through it one chunk at a time.
+type encryptingReader struct {
+	source      *bufio.Reader
+	gcm         cipher.AEAD
+	noncePrefix []byte
+	index       uint32
+	plaintext   []byte
+	sealed      []byte
+	done        bool
+	err         error
+}
+
+func newEncryptingReader(source io.Reader, key, noncePrefix []byte) (*encryptingReader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptingReader{
+		source:      bufio.NewReaderSize(source, encryptionChunkSize),
+		gcm:         gcm,
+		noncePrefix: noncePrefix,
+		plaintext:   make([]byte, encryptionChunkSize),
+	}, nil
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.sealed) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+
+		if e.done {
+			return 0, io.EOF
+		}
+
+		e.sealNextChunk()
+	}
+
+	n := copy(p, e.sealed)
+	e.sealed = e.sealed[n:]
+
+	return n, nil
+}
+
+// sealNextChunk reads and encrypts the next chunk. A chunk is final when nothing follows it, which is found out
+// by peeking so the final chunk is flagged even when the file is an exact multiple of the chunk size.
+func (e *encryptingReader) sealNextChunk() {
+	n, err := io.ReadFull(e.source, e.plaintext)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		e.err = err
+		return
+	}
+
+	final := err != nil
+	if !final {
+		if _, peekErr := e.source.Peek(1); peekErr == io.EOF {
+			final = true
+		} else if peekErr != nil {
+			e.err = peekErr
+			return
+		}
+	}
+
+	e.sealed = e.gcm.Seal(nil, chunkNonce(e.noncePrefix, e.index, final), e.plaintext[:n], nil)
+	e.index++
+	e.done = final
+}
+
+// decryptingReader reverses encryptingReader one chunk at a time so objects can be decrypted while they're read.
+type decryptingReader struct {
+	source      *bufio.Reader
+	gcm         cipher.AEAD
+	noncePrefix []byte
+	index       uint32
+	sealed      []byte
+	plaintext   []byte
+	done        bool
+	err         error
+}
+
+func newDecryptingReader(source io.Reader, key, noncePrefix []byte) (*decryptingReader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptingReader{
+		source:      bufio.NewReaderSize(source, encryptionChunkSize+gcm.Overhead()),
+		gcm:         gcm,
+		noncePrefix: noncePrefix,
+		sealed:      make([]byte, encryptionChunkSize+gcm.Overhead()),
+	}, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.plaintext) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		if d.done {
+			return 0, io.EOF
+		}
+
+		d.openNextChunk()
+	}
+
+	n := copy(p, d.plaintext)
+	d.plaintext = d.plaintext[n:]
+
+	return n, nil
+}
+
+// openNextChunk reads and decrypts the next sealed chunk. Like sealNextChunk it peeks to find the final chunk, and
+// a stream that ends early fails to open because its last chunk wasn't sealed as the final one.
+func (d *decryptingReader) openNextChunk() {
+	n, err := io.ReadFull(d.source, d.sealed)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		d.err = err
+		return
+	}
+
+	final := err != nil
+	if !final {
+		if _, peekErr := d.source.Peek(1); peekErr == io.EOF {
+			final = true
+		} else if peekErr != nil {
+			d.err = peekErr
+			return
+		}
+	}
+
+	d.plaintext, err = d.gcm.Open(d.sealed[:0], chunkNonce(d.noncePrefix, d.index, final), d.sealed[:n], nil)
+	if err != nil {
+		d.err = fmt.Errorf("%w: %s", ErrDecryptingFile, err)
+		return
+	}
+
+	d.index++
+	d.done = final
+}
+
+// decryptBytes reverses encryptingReader for a downloaded object.
+func decryptBytes(ciphertext, key, noncePrefix []byte) ([]byte, error) {
+	decryptedBody, err := newDecryptingReader(bytes.NewReader(ciphertext), key, noncePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecryptingFile, err)
+	}
+
+	return io.ReadAll(decryptedBody)
+}
+
+// plaintextSize is the size of an object encrypted WithKMSEncryption once it's decrypted. Every chunk, including
+// the final one which may be empty, grows by the GCM tag when it's sealed.
+func plaintextSize(ciphertextSize int64) int64 {
+	sealedChunkSize := int64(encryptionChunkSize + encryptionTagSize)
+	chunks := (ciphertextSize + sealedChunkSize - 1) / sealedChunkSize
+	if chunks == 0 {
+		return 0
+	}
+
+	return ciphertextSize - chunks*encryptionTagSize
+}
+
+// decryptionKey unwraps the data key and reads the nonce prefix of an object encrypted WithKMSEncryption from the
+// metadata in headers.
+func decryptionKey(ctx aws.Context, awsSession *session.Session, headers http.Header) ([]byte, []byte, error) {
+	if algorithm := headers.Get(encryptionAlgorithmMetadataHeader); algorithm != encryptionAlgorithm {
+		return nil, nil, fmt.Errorf("%w: unsupported algorithm %q", ErrDecryptingFile, algorithm)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(headers.Get(encryptionWrappedKeyMetadataHeader))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrDecryptingFile, err)
+	}
+
+	noncePrefix, err := base64.StdEncoding.DecodeString(headers.Get(encryptionNonceMetadataHeader))
+	if err != nil || len(noncePrefix) != encryptionNoncePrefixLen {
+		return nil, nil, fmt.Errorf("%w: invalid nonce", ErrDecryptingFile)
+	}
+
+	key, err := unwrapDataKey(ctx, awsSession, wrapped)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, noncePrefix, nil
+}
+
+// decrypt decrypts a downloaded object encrypted WithKMSEncryption using the metadata in headers.
+func decrypt(ctx aws.Context, awsSession *session.Session, ciphertext []byte, headers http.Header) ([]byte, error) {
+	key, noncePrefix, err := decryptionKey(ctx, awsSession, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptBytes(ciphertext, key, noncePrefix)
+}
+
+// decryptReader decrypts body as it's read using the metadata in headers.
+func decryptReader(ctx aws.Context, awsSession *session.Session, body io.Reader, headers http.Header) (io.Reader, error) {
+	key, noncePrefix, err := decryptionKey(ctx, awsSession, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptedBody, err := newDecryptingReader(body, key, noncePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecryptingFile, err)
+	}
+
+	return decryptedBody, nil
+}
+
+// metadataHeaders turns the Metadata of a GetObjectOutput back into the X-Amz-Meta- headers it was returned in.
+func metadataHeaders(metadata map[string]*string) http.Header {
+	headers := http.Header{}
+	for key, value := range metadata {
+		headers.Set("X-Amz-Meta-"+key, aws.StringValue(value))
+	}
+
+	return headers
+}
+
+// getDecryptedObject is GetObjectWithContext for the download paths that read the body themselves. When decrypts is
+// set, objects uploaded WithKMSEncryption come back decrypted as their body is read with ContentLength set to the
+// decrypted size. Ranges of their ciphertext can't be decrypted on their own so a ranged request for one returns the
+// whole object instead, which HTTP allows a server to do and ContentRange being nil reports. Otherwise they come
+// back as the ciphertext S3 stores.
+func getDecryptedObject(ctx aws.Context, s3Client s3iface.S3API, awsSession *session.Session, getObjectInput *s3.GetObjectInput, decrypts bool, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	getObjectOutput, err := s3Client.GetObjectWithContext(ctx, getObjectInput, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := metadataHeaders(getObjectOutput.Metadata)
+	if !decrypts || !isEncrypted(headers) {
+		return getObjectOutput, nil
+	}
+
+	if getObjectOutput.ContentRange != nil {
+		_ = getObjectOutput.Body.Close()
+
+		wholeObjectInput := *getObjectInput
+		wholeObjectInput.Range = nil
+
+		getObjectOutput, err = s3Client.GetObjectWithContext(ctx, &wholeObjectInput, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decryptedBody, err := decryptReader(ctx, awsSession, getObjectOutput.Body, headers)
+	if err != nil {
+		_ = getObjectOutput.Body.Close()
+		return nil, err
+	}
+
+	getObjectOutput.Body = struct {
+		io.Reader
+		io.Closer
+	}{decryptedBody, getObjectOutput.Body}
+	if getObjectOutput.ContentLength != nil {
+		getObjectOutput.ContentLength = aws.Int64(plaintextSize(*getObjectOutput.ContentLength))
+	}
+
+	return getObjectOutput, nil
+}
@@ -0,0 +1,196 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEncryption(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.Nil(t, err)
+
+	noncePrefix, err := newNoncePrefix()
+	assert.Nil(t, err)
+
+	encrypt := func(t *testing.T, plaintext []byte) []byte {
+		encryptedBody, err := newEncryptingReader(bytes.NewReader(plaintext), key, noncePrefix)
+		assert.Nil(t, err)
+
+		ciphertext, err := io.ReadAll(encryptedBody)
+		assert.Nil(t, err)
+
+		return ciphertext
+	}
+
+	t.Run("verify encryptingReader output round trips through decryptBytes", func(t *testing.T) {
+		for _, size := range []int{0, 1, SampleFileSizeBytes, encryptionChunkSize, encryptionChunkSize + 1, 3 * encryptionChunkSize} {
+			plaintext := make([]byte, size)
+			_, err := rand.Read(plaintext)
+			assert.Nil(t, err)
+
+			ciphertext := encrypt(t, plaintext)
+			assert.False(t, bytes.Contains(ciphertext, plaintext) && size > 0)
+
+			decrypted, err := decryptBytes(ciphertext, key, noncePrefix)
+			assert.Nil(t, err)
+			assert.True(t, bytes.Equal(plaintext, decrypted))
+		}
+	})
+	t.Run("verify decryptBytes rejects tampered ciphertext", func(t *testing.T) {
+		ciphertext := encrypt(t, []byte("some secret file contents"))
+		ciphertext[0] ^= 1
+
+		_, err := decryptBytes(ciphertext, key, noncePrefix)
+		assert.NotNil(t, err)
+	})
+	t.Run("verify decryptBytes rejects truncated ciphertext", func(t *testing.T) {
+		ciphertext := encrypt(t, make([]byte, 2*encryptionChunkSize+10))
+
+		_, err := decryptBytes(ciphertext[:encryptionChunkSize+16], key, noncePrefix)
+		assert.NotNil(t, err)
+	})
+	t.Run("verify decryptingReader decrypts a byte at a time and plaintextSize matches", func(t *testing.T) {
+		for _, size := range []int{0, 1, encryptionChunkSize, encryptionChunkSize + 1, 3 * encryptionChunkSize} {
+			plaintext := make([]byte, size)
+			_, err := rand.Read(plaintext)
+			assert.Nil(t, err)
+
+			ciphertext := encrypt(t, plaintext)
+			assert.Equal(t, int64(size), plaintextSize(int64(len(ciphertext))))
+
+			decryptedBody, err := newDecryptingReader(iotest.OneByteReader(bytes.NewReader(ciphertext)), key, noncePrefix)
+			assert.Nil(t, err)
+
+			decrypted, err := io.ReadAll(decryptedBody)
+			assert.Nil(t, err)
+			assert.True(t, bytes.Equal(plaintext, decrypted))
+		}
+	})
+	t.Run("verify decryptingReader reports tampered ciphertext as ErrDecryptingFile", func(t *testing.T) {
+		ciphertext := encrypt(t, make([]byte, 2*encryptionChunkSize))
+		ciphertext[encryptionChunkSize+encryptionTagSize] ^= 1
+
+		decryptedBody, err := newDecryptingReader(bytes.NewReader(ciphertext), key, noncePrefix)
+		assert.Nil(t, err)
+
+		_, err = io.ReadAll(decryptedBody)
+		assert.True(t, errors.Is(err, ErrDecryptingFile))
+	})
+	t.Run("verify getDecryptedObject decrypts encrypted objects when asked and serves them whole for ranges", func(t *testing.T) {
+		plaintext := make([]byte, encryptionChunkSize+100)
+		_, err := rand.Read(plaintext)
+		assert.Nil(t, err)
+
+		ciphertext := encrypt(t, plaintext)
+		metadata := encryptionMetadata(&dataKey{plaintext: key, wrapped: []byte("wrapped")}, noncePrefix)
+
+		var ranged int
+		awsSession := newHandlerSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Amz-Target") == "TrentService.Decrypt" {
+				_ = json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": key})
+				return
+			}
+
+			for name, value := range metadata {
+				w.Header().Set("X-Amz-Meta-"+name, aws.StringValue(value))
+			}
+
+			if r.Header.Get("Range") != "" {
+				ranged++
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-9/%d", len(ciphertext)))
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write(ciphertext[:10])
+				return
+			}
+
+			w.Header().Set("Content-Length", strconv.Itoa(len(ciphertext)))
+			_, _ = w.Write(ciphertext)
+		}))
+
+		for _, byteRange := range []*string{nil, aws.String("bytes=0-9")} {
+			getObjectOutput, err := getDecryptedObject(aws.BackgroundContext(), s3.New(awsSession), awsSession, &s3.GetObjectInput{
+				Bucket: aws.String(S3Bucket),
+				Key:    aws.String(S3EncryptedFileName),
+				Range:  byteRange,
+			}, true)
+			assert.Nil(t, err)
+			assert.Equal(t, (*string)(nil), getObjectOutput.ContentRange)
+			assert.Equal(t, int64(len(plaintext)), aws.Int64Value(getObjectOutput.ContentLength))
+
+			decrypted, err := io.ReadAll(getObjectOutput.Body)
+			assert.Nil(t, err)
+			assert.True(t, bytes.Equal(plaintext, decrypted))
+			assert.Nil(t, getObjectOutput.Body.Close())
+		}
+		assert.Equal(t, 1, ranged)
+
+		getObjectOutput, err := getDecryptedObject(aws.BackgroundContext(), s3.New(awsSession), awsSession, &s3.GetObjectInput{
+			Bucket: aws.String(S3Bucket),
+			Key:    aws.String(S3EncryptedFileName),
+		}, false)
+		assert.Nil(t, err)
+
+		stored, err := io.ReadAll(getObjectOutput.Body)
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(ciphertext, stored))
+		assert.Nil(t, getObjectOutput.Body.Close())
+	})
+	t.Run("verify KMS requests are made with the caller's context", func(t *testing.T) {
+		var requests int
+		awsSession := newHandlerSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := generateDataKey(ctx, awsSession, KMSKeyID)
+		assert.True(t, errors.Is(err, ErrEncryptingFile))
+
+		_, err = unwrapDataKey(ctx, awsSession, []byte("wrapped"))
+		assert.True(t, errors.Is(err, ErrDecryptingFile))
+		assert.Equal(t, 0, requests)
+	})
+	t.Run("verify decrypt rejects objects with unknown algorithms", func(t *testing.T) {
+		headers := map[string][]string{
+			encryptionAlgorithmMetadataHeader:  {"ROT13"},
+			encryptionWrappedKeyMetadataHeader: {"a2V5"},
+		}
+
+		_, err := decrypt(aws.BackgroundContext(), nil, []byte("ciphertext"), headers)
+		assert.True(t, errors.Is(err, ErrDecryptingFile))
+	})
+	t.Run("verify WithKMSEncryption uploads encrypted and downloads decrypted", func(t *testing.T) {
+		fileHeaders, err := GetHeaders(generateUploadFileReq(), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+
+		_, err = UploadHeader(fileHeaders[0], Region, S3Bucket, S3EncryptedFileName, WithKMSEncryption(KMSKeyID), WithChecksum())
+		assert.Nil(t, err)
+
+		sampleBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		fileBytes, err := Download(Region, S3Bucket, S3EncryptedFileName, WithKMSEncryption(KMSKeyID), WithChecksum())
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(sampleBytes, fileBytes))
+
+		fileBytes, err = Download(Region, S3Bucket, S3EncryptedFileName)
+		assert.Nil(t, err)
+		assert.False(t, bytes.Equal(sampleBytes, fileBytes))
+	})
+}
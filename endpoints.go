@@ -0,0 +1,32 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectURL returns the URL of the object called name in bucket without making any requests. The URL comes from
+// the SDK's endpoint resolver, just like UploadRes.S3URL, so it's right for every partition, e.g. it ends in
+// amazonaws.com.cn in the China regions, and for the endpoints chosen WithFIPS, WithDualStack, and
+// WithTransferAcceleration. WithPublicURL takes precedence.
+func ObjectURL(region, bucket, name string, opts ...Option) (string, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return "", ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		return "", ErrParameterNameEmpty
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return "", ErrNewAWSSession
+	}
+
+	return o.objectURL(bucket, name, objectURL(s3.New(awsSession), bucket, name)), nil
+}
@@ -0,0 +1,42 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"strings"
+	"testing"
+)
+
+func TestObjectURL(t *testing.T) {
+	t.Run("verify URLs are built for the region's partition", func(t *testing.T) {
+		url, err := ObjectURL("cn-north-1", S3Bucket, S3FileName)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://"+S3Bucket+".s3.cn-north-1.amazonaws.com.cn/"+S3FileName, url)
+
+		url, err = ObjectURL("us-gov-west-1", S3Bucket, S3FileName)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://"+S3Bucket+".s3.us-gov-west-1.amazonaws.com/"+S3FileName, url)
+	})
+	t.Run("verify WithFIPS uses the FIPS endpoint", func(t *testing.T) {
+		url, err := ObjectURL("us-gov-west-1", S3Bucket, S3FileName, WithFIPS())
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(url, "s3-fips"))
+	})
+	t.Run("verify WithDualStack uses the dual-stack endpoint", func(t *testing.T) {
+		url, err := ObjectURL(Region, S3Bucket, S3FileName, WithDualStack())
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(url, ".s3.dualstack."+Region+".amazonaws.com/"))
+	})
+	t.Run("verify WithPublicURL takes precedence", func(t *testing.T) {
+		url, err := ObjectURL(Region, S3Bucket, S3FileName, WithPublicURL("cdn.example.com"))
+		assert.Nil(t, err)
+		assert.Equal(t, "https://cdn.example.com/"+S3FileName, url)
+	})
+	t.Run("verify the parameters are validated", func(t *testing.T) {
+		_, err := ObjectURL("", S3Bucket, S3FileName)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+
+		_, err = ObjectURL(Region, S3Bucket, "")
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+	})
+}
@@ -0,0 +1,506 @@
+package lambda_s3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrStrippingMetadata = errors.New("unable to strip the image's metadata")
+
+// StripImageMetadata is a Transformer that removes the metadata photos carry, which often includes the GPS location
+// they were taken at and the device that took them, from JPEG, PNG, and HEIF images such as HEIC and AVIF. Other
+// files pass through unchanged. Use it WithUploadTransformers.
+//
+// JPEGs lose their EXIF, XMP, IPTC, and comment segments but keep a minimal EXIF segment holding only the
+// orientation, when there was one, so photos aren't displayed rotated. PNGs lose their eXIf, text, and time chunks.
+// Both are stripped as they're streamed. HEIF images are read into memory and the bytes of their Exif and XMP items
+// overwritten with zeros, which keeps every offset in the file valid. Images that look like one of these formats but
+// can't be parsed are rejected with ErrStrippingMetadata rather than uploaded with their metadata.
+var StripImageMetadata Transformer = TransformerFunc(stripImageMetadata)
+
+var (
+	jpegMagic = []byte{0xff, 0xd8, 0xff}
+	pngMagic  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// heifBrands are the major brands of the ISO base media files whose metadata is stored as HEIF items.
+var heifBrands = []string{"avif", "heic", "heim", "heis", "heix", "hevc", "hevx", "mif1", "msf1"}
+
+func stripImageMetadata(r io.Reader) (io.Reader, error) {
+	bufferedReader := bufio.NewReader(r)
+
+	magic, err := bufferedReader.Peek(12)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, jpegMagic):
+		return stripJPEG(bufferedReader)
+	case bytes.HasPrefix(magic, pngMagic):
+		return &pngStripper{reader: bufferedReader}, nil
+	case len(magic) == 12 && string(magic[4:8]) == "ftyp" && containsString(heifBrands, string(magic[8:12])):
+		return stripHEIF(bufferedReader)
+	default:
+		return bufferedReader, nil
+	}
+}
+
+// JPEG markers. Every segment before the image data starts with 0xFF followed by one of these.
+const (
+	jpegEOI  = 0xd9 // end of image
+	jpegSOS  = 0xda // start of scan, after which the entropy coded image data follows
+	jpegAPP0 = 0xe0 // JFIF
+	jpegAPP1 = 0xe1 // EXIF and XMP
+	jpegAPPD = 0xed // Photoshop image resources, including IPTC
+	jpegCOM  = 0xfe // comment
+)
+
+// stripJPEG reads the segments before the image data, dropping the ones that hold metadata, and returns a reader of
+// the kept segments followed by the rest of the file.
+func stripJPEG(r *bufio.Reader) (io.Reader, error) {
+	var kept bytes.Buffer
+	orientation := uint16(0)
+
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrStrippingMetadata, err)
+	}
+	kept.Write(soi)
+
+	// the EXIF segment goes after the JFIF segment, when there is one, which has to come first
+	insertAt := kept.Len()
+
+	for segment := 0; ; segment++ {
+		marker, err := readJPEGMarker(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrStrippingMetadata, err)
+		}
+
+		if marker == jpegEOI {
+			kept.Write([]byte{0xff, marker})
+			break
+		}
+
+		lengthBytes := make([]byte, 2)
+		if _, err = io.ReadFull(r, lengthBytes); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrStrippingMetadata, err)
+		}
+
+		length := binary.BigEndian.Uint16(lengthBytes)
+		if length < 2 {
+			return nil, fmt.Errorf("%w: a segment has an invalid length", ErrStrippingMetadata)
+		}
+
+		payload := make([]byte, length-2)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrStrippingMetadata, err)
+		}
+
+		switch marker {
+		case jpegAPP1:
+			if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientation = exifOrientation(payload[6:])
+			}
+			continue
+		case jpegAPPD, jpegCOM:
+			continue
+		}
+
+		kept.Write([]byte{0xff, marker})
+		kept.Write(lengthBytes)
+		kept.Write(payload)
+
+		if segment == 0 && marker == jpegAPP0 {
+			insertAt = kept.Len()
+		}
+
+		if marker == jpegSOS {
+			break
+		}
+	}
+
+	keptBytes := kept.Bytes()
+
+	if orientation > 1 {
+		orientationSegment := orientationExifSegment(orientation)
+		keptBytes = append(keptBytes[:insertAt:insertAt], append(orientationSegment, keptBytes[insertAt:]...)...)
+	}
+
+	return io.MultiReader(bytes.NewReader(keptBytes), r), nil
+}
+
+// readJPEGMarker reads the marker starting the next segment, skipping the fill bytes allowed before it.
+func readJPEGMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if b != 0xff {
+		return 0, errors.New("expected a segment marker")
+	}
+
+	for b == 0xff {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+
+	return b, nil
+}
+
+// exifOrientationTag is the EXIF tag saying how the image has to be rotated and flipped to be displayed upright.
+const exifOrientationTag = 0x0112
+
+// exifOrientation returns the orientation in the first IFD of the TIFF structure in an EXIF segment, or 0 when it
+// has none.
+func exifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var byteOrder binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		byteOrder = binary.LittleEndian
+	case "MM":
+		byteOrder = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifdOffset := int(byteOrder.Uint32(tiff[4:8]))
+	if ifdOffset < 8 || ifdOffset+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(byteOrder.Uint16(tiff[ifdOffset:]))
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		if byteOrder.Uint16(tiff[entry:]) == exifOrientationTag {
+			orientation := byteOrder.Uint16(tiff[entry+8:])
+			if orientation > 8 {
+				return 0
+			}
+			return orientation
+		}
+	}
+
+	return 0
+}
+
+// orientationExifSegment is an APP1 segment holding an EXIF structure with nothing but orientation.
+func orientationExifSegment(orientation uint16) []byte {
+	segment := []byte{0xff, jpegAPP1, 0, 34}
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, "MM\x00\x2a\x00\x00\x00\x08"...) // big endian TIFF header with the IFD right after it
+	segment = append(segment, 0, 1)                            // one entry
+	segment = append(segment, 0x01, 0x12, 0, 3, 0, 0, 0, 1)    // orientation, a single SHORT
+	segment = append(segment, byte(orientation>>8), byte(orientation))
+	segment = append(segment, 0, 0, 0, 0, 0, 0) // the rest of the value and no next IFD
+
+	return segment
+}
+
+// pngMetadataChunks are the chunks pngStripper drops.
+var pngMetadataChunks = []string{"eXIf", "iTXt", "tEXt", "tIME", "zTXt"}
+
+// pngStripper copies a PNG chunk by chunk, leaving out pngMetadataChunks. PNGs can have metadata after the image
+// data so the whole file is filtered as it's read rather than just its start.
+type pngStripper struct {
+	reader    *bufio.Reader
+	signature bool
+	chunk     io.Reader
+	done      bool
+}
+
+func (p *pngStripper) Read(b []byte) (int, error) {
+	for {
+		if p.chunk != nil {
+			n, err := p.chunk.Read(b)
+			if err == io.EOF {
+				p.chunk = nil
+				err = nil
+			}
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		if p.done {
+			return 0, io.EOF
+		}
+
+		if !p.signature {
+			p.signature = true
+			p.chunk = io.LimitReader(p.reader, int64(len(pngMagic)))
+			continue
+		}
+
+		// every chunk is its length, type, data, and a CRC of the type and data
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(p.reader, header); err != nil {
+			return 0, fmt.Errorf("%w: the PNG ends before its IEND chunk", ErrStrippingMetadata)
+		}
+
+		remaining := int64(binary.BigEndian.Uint32(header[:4])) + 4
+		chunkType := string(header[4:])
+
+		if containsString(pngMetadataChunks, chunkType) {
+			if _, err := io.CopyN(io.Discard, p.reader, remaining); err != nil {
+				return 0, fmt.Errorf("%w: %s", ErrStrippingMetadata, err)
+			}
+			continue
+		}
+
+		p.chunk = io.MultiReader(bytes.NewReader(header), io.LimitReader(p.reader, remaining))
+		p.done = chunkType == "IEND"
+	}
+}
+
+// stripHEIF reads a HEIF file into memory and overwrites the contents of its Exif and XMP items with zeros.
+func stripHEIF(r io.Reader) (io.Reader, error) {
+	file, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, ok := findBox(file, "meta")
+	if !ok || len(meta) < 4 {
+		return nil, fmt.Errorf("%w: the HEIF file has no meta box", ErrStrippingMetadata)
+	}
+	meta = meta[4:] // meta is a full box so it starts with a version and flags
+
+	metadataItems, err := heifMetadataItems(meta)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrStrippingMetadata, err)
+	}
+
+	if len(metadataItems) == 0 {
+		return bytes.NewReader(file), nil
+	}
+
+	iloc, ok := findBox(meta, "iloc")
+	if !ok {
+		return nil, fmt.Errorf("%w: the HEIF file has no iloc box", ErrStrippingMetadata)
+	}
+
+	idat, _ := findBox(meta, "idat")
+
+	if err = zeroHEIFItems(file, idat, iloc, metadataItems); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrStrippingMetadata, err)
+	}
+
+	return bytes.NewReader(file), nil
+}
+
+// findBox returns the contents of the first ISO base media box of boxType directly inside boxes.
+func findBox(boxes []byte, boxType string) ([]byte, bool) {
+	for len(boxes) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(boxes))
+		headerSize := uint64(8)
+
+		switch size {
+		case 0: // the box runs to the end of the file
+			size = uint64(len(boxes))
+		case 1: // the size didn't fit in 32 bits
+			if len(boxes) < 16 {
+				return nil, false
+			}
+			size = binary.BigEndian.Uint64(boxes[8:])
+			headerSize = 16
+		}
+
+		if size < headerSize || size > uint64(len(boxes)) {
+			return nil, false
+		}
+
+		if string(boxes[4:8]) == boxType {
+			return boxes[headerSize:size], true
+		}
+
+		boxes = boxes[size:]
+	}
+
+	return nil, false
+}
+
+// heifMetadataItems returns the IDs of the Exif and XMP items listed in the iinf box in meta.
+func heifMetadataItems(meta []byte) (map[uint32]bool, error) {
+	iinf, ok := findBox(meta, "iinf")
+	if !ok {
+		return nil, errors.New("the HEIF file has no iinf box")
+	}
+
+	if len(iinf) < 6 {
+		return nil, errors.New("the iinf box is truncated")
+	}
+
+	entries := iinf[6:]
+	if iinf[0] > 0 { // the entry count is 32 bits from version 1
+		if len(iinf) < 8 {
+			return nil, errors.New("the iinf box is truncated")
+		}
+		entries = iinf[8:]
+	}
+
+	metadataItems := map[uint32]bool{}
+
+	for len(entries) >= 8 {
+		size := binary.BigEndian.Uint32(entries)
+		if size < 8 || int(size) > len(entries) {
+			return nil, errors.New("an infe box is truncated")
+		}
+
+		infe := entries[8:size]
+		entries = entries[size:]
+
+		if len(infe) < 4 || infe[0] < 2 {
+			continue // versions before 2 don't have item types and can't hold Exif or XMP items
+		}
+
+		var itemID uint32
+		var rest []byte
+		if infe[0] == 2 {
+			if len(infe) < 12 {
+				return nil, errors.New("an infe box is truncated")
+			}
+			itemID, rest = uint32(binary.BigEndian.Uint16(infe[4:])), infe[8:]
+		} else {
+			if len(infe) < 14 {
+				return nil, errors.New("an infe box is truncated")
+			}
+			itemID, rest = binary.BigEndian.Uint32(infe[4:]), infe[10:]
+		}
+
+		itemType := string(rest[:4])
+		if itemType == "Exif" {
+			metadataItems[itemID] = true
+		}
+
+		// XMP is stored as a mime item. Its item name and content type follow as null terminated strings
+		if itemType == "mime" {
+			fields := bytes.SplitN(rest[4:], []byte{0}, 3)
+			if len(fields) >= 2 && string(fields[1]) == "application/rdf+xml" {
+				metadataItems[itemID] = true
+			}
+		}
+	}
+
+	return metadataItems, nil
+}
+
+// zeroHEIFItems overwrites the extents the iloc box says hold items with zeros. Extents are either offsets in file
+// or, for construction method 1, offsets in the contents of the idat box.
+func zeroHEIFItems(file, idat, iloc []byte, items map[uint32]bool) error {
+	if len(iloc) < 6 {
+		return errors.New("the iloc box is truncated")
+	}
+
+	version := iloc[0]
+	offsetSize := int(iloc[4] >> 4)
+	lengthSize := int(iloc[4] & 0xf)
+	baseOffsetSize := int(iloc[5] >> 4)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(iloc[5] & 0xf)
+	}
+
+	// item IDs and the item count are 32 bits from version 2
+	itemIDSize := 2
+	if version == 2 {
+		itemIDSize = 4
+	}
+
+	reader := &boxReader{data: iloc[6:]}
+
+	itemCount := reader.uint(itemIDSize)
+
+	for i := uint64(0); i < itemCount; i++ {
+		itemID := uint32(reader.uint(itemIDSize))
+
+		constructionMethod := uint64(0)
+		if version == 1 || version == 2 {
+			constructionMethod = reader.uint(2) & 0xf
+		}
+
+		reader.uint(2) // data reference index
+		baseOffset := reader.uint(baseOffsetSize)
+		extentCount := reader.uint(2)
+
+		for j := uint64(0); j < extentCount; j++ {
+			reader.uint(indexSize)
+			extentOffset := reader.uint(offsetSize)
+			extentLength := reader.uint(lengthSize)
+
+			if reader.err != nil {
+				return reader.err
+			}
+
+			if !items[itemID] {
+				continue
+			}
+
+			target := file
+			switch constructionMethod {
+			case 0:
+			case 1:
+				target = idat
+			default:
+				return fmt.Errorf("item %d uses an unsupported construction method", itemID)
+			}
+
+			start := baseOffset + extentOffset
+			end := start + extentLength
+			if extentLength == 0 { // the extent runs to the end of the data
+				end = uint64(len(target))
+			}
+
+			if start > end || end > uint64(len(target)) {
+				return fmt.Errorf("item %d is outside the file", itemID)
+			}
+
+			for k := start; k < end; k++ {
+				target[k] = 0
+			}
+		}
+	}
+
+	return reader.err
+}
+
+// boxReader reads big endian unsigned integers of 0, 2, 4, or 8 bytes from data, remembering the first error.
+type boxReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (b *boxReader) uint(size int) uint64 {
+	if b.err != nil {
+		return 0
+	}
+
+	if b.offset+size > len(b.data) {
+		b.err = errors.New("the iloc box is truncated")
+		return 0
+	}
+
+	value := uint64(0)
+	for _, byteValue := range b.data[b.offset : b.offset+size] {
+		value = value<<8 | uint64(byteValue)
+	}
+	b.offset += size
+
+	return value
+}
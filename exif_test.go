@@ -0,0 +1,152 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// exifSegment is an APP1 segment with a little endian EXIF structure holding orientation and a GPS IFD pointer.
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00")
+	tiff = append(tiff, 2, 0)
+	tiff = append(tiff, 0x12, 0x01, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0)
+	tiff = append(tiff, 0x25, 0x88, 4, 0, 1, 0, 0, 0, 38, 0, 0, 0)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, "GPS 51.5007N 0.1246W"...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	return append(segment, payload...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i)
+	}
+	return img
+}
+
+func strip(t *testing.T, imageBytes []byte) []byte {
+	stripped, err := StripImageMetadata.Transform(bytes.NewReader(imageBytes))
+	assert.Nil(t, err)
+
+	strippedBytes, err := io.ReadAll(stripped)
+	assert.Nil(t, err)
+
+	return strippedBytes
+}
+
+func TestStripImageMetadata(t *testing.T) {
+	t.Run("verify JPEGs lose their metadata but keep their orientation", func(t *testing.T) {
+		var encoded bytes.Buffer
+		assert.Nil(t, jpeg.Encode(&encoded, testImage(), nil))
+
+		comment := []byte{0xff, 0xfe, 0, 9, 'i', 'P', 'h', 'o', 'n', 'e', '1'}
+		jpegBytes := append([]byte{0xff, 0xd8}, exifSegment(6)...)
+		jpegBytes = append(jpegBytes, comment...)
+		jpegBytes = append(jpegBytes, encoded.Bytes()[2:]...)
+
+		strippedBytes := strip(t, jpegBytes)
+		assert.False(t, bytes.Contains(strippedBytes, []byte("GPS")))
+		assert.False(t, bytes.Contains(strippedBytes, []byte("iPhone")))
+		assert.True(t, bytes.HasPrefix(strippedBytes[2:], orientationExifSegment(6)))
+		assert.Equal(t, uint16(6), exifOrientation(strippedBytes[12:]))
+
+		_, err := jpeg.Decode(bytes.NewReader(strippedBytes))
+		assert.Nil(t, err)
+	})
+	t.Run("verify JPEGs without an orientation don't get one", func(t *testing.T) {
+		var encoded bytes.Buffer
+		assert.Nil(t, jpeg.Encode(&encoded, testImage(), nil))
+
+		jpegBytes := append([]byte{0xff, 0xd8}, exifSegment(1)...)
+		jpegBytes = append(jpegBytes, encoded.Bytes()[2:]...)
+
+		assert.True(t, bytes.Equal(encoded.Bytes(), strip(t, jpegBytes)))
+	})
+	t.Run("verify truncated JPEGs are rejected", func(t *testing.T) {
+		jpegBytes := append([]byte{0xff, 0xd8}, exifSegment(6)[:20]...)
+
+		_, err := StripImageMetadata.Transform(bytes.NewReader(jpegBytes))
+		assert.True(t, errors.Is(err, ErrStrippingMetadata))
+	})
+	t.Run("verify PNGs lose their text chunks", func(t *testing.T) {
+		var encoded bytes.Buffer
+		assert.Nil(t, png.Encode(&encoded, testImage()))
+
+		text := []byte("tEXtLocation\x0051.5007N 0.1246W")
+		chunk := make([]byte, 4)
+		binary.BigEndian.PutUint32(chunk, uint32(len(text)-4))
+		chunk = append(chunk, text...)
+		chunk = appendUint32(chunk, crc32.ChecksumIEEE(text))
+
+		ihdrEnd := 8 + 4 + 4 + 13 + 4
+		pngBytes := append(append(append([]byte{}, encoded.Bytes()[:ihdrEnd]...), chunk...), encoded.Bytes()[ihdrEnd:]...)
+
+		_, err := png.Decode(bytes.NewReader(pngBytes))
+		assert.Nil(t, err)
+
+		strippedBytes := strip(t, pngBytes)
+		assert.True(t, bytes.Equal(encoded.Bytes(), strippedBytes))
+	})
+	t.Run("verify HEIF Exif items are zeroed in place", func(t *testing.T) {
+		heifBytes := testHEIF()
+		strippedBytes := strip(t, heifBytes)
+
+		assert.Equal(t, len(heifBytes), len(strippedBytes))
+		assert.False(t, bytes.Contains(strippedBytes, []byte("GPS")))
+		assert.True(t, bytes.Contains(strippedBytes, []byte("pixels")))
+	})
+	t.Run("verify other files pass through unchanged", func(t *testing.T) {
+		assert.Equal(t, "name,value\n", string(strip(t, []byte("name,value\n"))))
+		assert.Equal(t, "", string(strip(t, nil)))
+	})
+}
+
+// testHEIF is a minimal HEIF file with an Exif item stored in its mdat box alongside the image data.
+func testHEIF() []byte {
+	box := func(boxType string, contents ...[]byte) []byte {
+		joined := bytes.Join(contents, nil)
+		b := appendUint32(nil, uint32(8+len(joined)))
+		return append(append(b, boxType...), joined...)
+	}
+
+	ftyp := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	infe := box("infe", []byte{2, 0, 0, 0, 0, 1, 0, 0}, []byte("Exif"), []byte{0})
+	iinf := box("iinf", []byte{0, 0, 0, 0, 0, 1}, infe)
+
+	exif := []byte("\x00\x00\x00\x06Exif\x00\x00GPS 51.5007N 0.1246W")
+	pixels := []byte("pixels")
+
+	// the iloc box points at the Exif data in mdat, which comes after it, so its size is worked out up front
+	ilocSize := 8 + 4 + 2 + 2 + 2 + 2 + 2 + 4 + 4
+	metaSize := 8 + 4 + len(iinf) + ilocSize
+	exifOffset := len(ftyp) + metaSize + 8 + len(pixels)
+
+	ilocContents := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1, 0, 1, 0, 0, 0, 1}
+	ilocContents = appendUint32(ilocContents, uint32(exifOffset))
+	ilocContents = appendUint32(ilocContents, uint32(len(exif)))
+	iloc := box("iloc", ilocContents)
+
+	meta := box("meta", []byte{0, 0, 0, 0}, iinf, iloc)
+	mdat := box("mdat", pixels, exif)
+
+	return bytes.Join([][]byte{ftyp, meta, mdat}, nil)
+}
@@ -0,0 +1,45 @@
+package lambda_s3
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ExpiryTagKey is the key of the tag WithExpiry puts on uploaded objects. Its value is the number of days the object
+// should live followed by a d, e.g. 1d.
+const ExpiryTagKey = "lambda_s3-expiry"
+
+// expiryDays rounds expiry up to the whole days lifecycle rules work in.
+func expiryDays(expiry time.Duration) int64 {
+	days := int64((expiry + 24*time.Hour - 1) / (24 * time.Hour))
+	if days < 1 {
+		return 1
+	}
+
+	return days
+}
+
+// expiryTagging is the tag set, in the URL encoded form PutObject expects, marking an object to expire after expiry.
+func expiryTagging(expiry time.Duration) string {
+	return url.Values{ExpiryTagKey: {fmt.Sprintf("%dd", expiryDays(expiry))}}.Encode()
+}
+
+// ExpiryRule is the lifecycle rule that deletes objects uploaded WithExpiry(expiry). It matches on the tag
+// WithExpiry sets so one rule covers every object with the same expiry, whatever its key.
+func ExpiryRule(expiry time.Duration) LifecycleRule {
+	days := expiryDays(expiry)
+
+	return LifecycleRule{
+		ID:             fmt.Sprintf("%s-%dd", ExpiryTagKey, days),
+		Tags:           map[string]string{ExpiryTagKey: fmt.Sprintf("%dd", days)},
+		ExpirationDays: days,
+		Enabled:        true,
+	}
+}
+
+// PutExpiryRule installs ExpiryRule(expiry) on bucket so objects uploaded WithExpiry(expiry) are deleted once they
+// expire. It only has to be called once per bucket and expiry, e.g. when the bucket is created.
+func PutExpiryRule(region, bucket string, expiry time.Duration, opts ...Option) error {
+	return PutLifecycleRule(region, bucket, ExpiryRule(expiry), opts...)
+}
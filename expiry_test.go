@@ -0,0 +1,42 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	t.Run("verify expiries are rounded up to whole days", func(t *testing.T) {
+		assert.Equal(t, int64(1), expiryDays(time.Minute))
+		assert.Equal(t, int64(1), expiryDays(24*time.Hour))
+		assert.Equal(t, int64(2), expiryDays(25*time.Hour))
+		assert.Equal(t, "lambda_s3-expiry=2d", expiryTagging(36*time.Hour))
+	})
+	t.Run("verify ExpiryRule matches the tag WithExpiry sets", func(t *testing.T) {
+		rule := ExpiryRule(24 * time.Hour)
+		assert.Equal(t, "lambda_s3-expiry-1d", rule.ID)
+		assert.Equal(t, "1d", rule.Tags[ExpiryTagKey])
+		assert.Equal(t, int64(1), rule.ExpirationDays)
+	})
+	t.Run("verify uploads WithExpiry are tagged", func(t *testing.T) {
+		uploadRes, err := UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), Region, S3Bucket, "expiry/"+SampleFileName, WithExpiry(time.Hour))
+		assert.Nil(t, err)
+
+		awsSession, err := newOptions(nil).newSession(Region)
+		assert.Nil(t, err)
+
+		tagging, err := s3.New(awsSession).GetObjectTagging(&s3.GetObjectTaggingInput{
+			Bucket: aws.String(S3Bucket),
+			Key:    aws.String(uploadRes.Key),
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(tagging.TagSet))
+		assert.Equal(t, ExpiryTagKey, aws.StringValue(tagging.TagSet[0].Key))
+		assert.Equal(t, "1d", aws.StringValue(tagging.TagSet[0].Value))
+
+		assert.Nil(t, Delete(Region, S3Bucket, uploadRes.Key))
+	})
+}
@@ -0,0 +1,74 @@
+package lambda_s3
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"mime/multipart"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// extendedFilenameRegex finds the RFC 5987 filename* parameter of a Content-Disposition header. e.g.
+// filename*=UTF-8'en'%E2%82%AC%20rates.csv
+var extendedFilenameRegex = regexp.MustCompile(`(?i)(?:^|;)\s*filename\*\s*=\s*"?([^;"]*)"?`)
+
+// normalizeFilename fixes up the Filename of fileHeader so it can be used as an S3 key. Go only decodes RFC 5987
+// filename* parameters in UTF-8 so ISO-8859-1 ones are decoded here, filenames that aren't valid UTF-8 are assumed to
+// be ISO-8859-1, and the result is NFC normalized so the same name always maps to the same key no matter whether the
+// client's OS composes accented characters, as Windows does, or decomposes them, as macOS does. Names that are left
+// empty, ".", or ".." once any path is taken off are returned empty so callers report ErrParameterNameEmpty.
+func normalizeFilename(fileHeader *multipart.FileHeader) string {
+	filename := fileHeader.Filename
+
+	if match := extendedFilenameRegex.FindStringSubmatch(fileHeader.Header.Get("Content-Disposition")); match != nil {
+		if decoded, ok := decodeExtendedValue(match[1]); ok && decoded != "" {
+			filename = decoded
+		}
+	}
+
+	if !utf8.ValidString(filename) {
+		filename = latin1ToUTF8([]byte(filename))
+	}
+
+	// browsers send the name of the file not its path but some clients send the whole Windows path
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if filename == "." || filename == ".." || filename == "/" {
+		return ""
+	}
+
+	return norm.NFC.String(filename)
+}
+
+// decodeExtendedValue decodes an RFC 5987 ext-value of the form charset'language'percent-encoded-value.
+func decodeExtendedValue(extValue string) (string, bool) {
+	parts := strings.SplitN(extValue, "'", 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	value, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "utf-8", "us-ascii":
+		return value, utf8.ValidString(value)
+	case "iso-8859-1":
+		return latin1ToUTF8([]byte(value)), true
+	default:
+		return "", false
+	}
+}
+
+// latin1ToUTF8 converts ISO-8859-1 bytes, whose values are the Unicode code points they encode, to UTF-8.
+func latin1ToUTF8(latin1 []byte) string {
+	runes := make([]rune, len(latin1))
+	for i, b := range latin1 {
+		runes[i] = rune(b)
+	}
+
+	return string(runes)
+}
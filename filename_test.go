@@ -0,0 +1,51 @@
+package lambda_s3
+
+import (
+	"github.com/jgroeneveld/trial/assert"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+)
+
+func TestNormalizeFilename(t *testing.T) {
+	newFileHeader := func(filename, contentDisposition string) *multipart.FileHeader {
+		return &multipart.FileHeader{
+			Filename: filename,
+			Header:   textproto.MIMEHeader{"Content-Disposition": {contentDisposition}},
+		}
+	}
+
+	t.Run("verify ASCII filenames are unchanged", func(t *testing.T) {
+		fileHeader := newFileHeader(SampleFileName, `form-data; name="file"; filename="`+SampleFileName+`"`)
+		assert.Equal(t, SampleFileName, normalizeFilename(fileHeader))
+	})
+	t.Run("verify filename* is decoded", func(t *testing.T) {
+		fileHeader := newFileHeader("rates.csv", `form-data; name="file"; filename="rates.csv"; filename*=UTF-8''%E2%82%AC%20rates.csv`)
+		assert.Equal(t, "€ rates.csv", normalizeFilename(fileHeader))
+
+		fileHeader = newFileHeader("cafe.csv", `form-data; name="file"; filename="cafe.csv"; filename*=iso-8859-1'fr'caf%E9.csv`)
+		assert.Equal(t, "café.csv", normalizeFilename(fileHeader))
+	})
+	t.Run("verify unsupported filename* charsets fall back to filename", func(t *testing.T) {
+		fileHeader := newFileHeader("rates.csv", `form-data; name="file"; filename="rates.csv"; filename*=Shift_JIS''%82%A0.csv`)
+		assert.Equal(t, "rates.csv", normalizeFilename(fileHeader))
+	})
+	t.Run("verify invalid UTF-8 is read as ISO-8859-1", func(t *testing.T) {
+		fileHeader := newFileHeader("caf\xe9.csv", `form-data; name="file"; filename="caf\xe9.csv"`)
+		assert.Equal(t, "café.csv", normalizeFilename(fileHeader))
+	})
+	t.Run("verify filenames are NFC normalized", func(t *testing.T) {
+		fileHeader := newFileHeader("cafe\u0301.csv", `form-data; name="file"; filename="cafe\u0301.csv"`)
+		assert.Equal(t, "caf\u00e9.csv", normalizeFilename(fileHeader))
+	})
+	t.Run("verify Windows paths are reduced to the filename", func(t *testing.T) {
+		fileHeader := newFileHeader(`C:\Users\sean\rates.csv`, `form-data; name="file"; filename="C:\\Users\\sean\\rates.csv"`)
+		assert.Equal(t, "rates.csv", normalizeFilename(fileHeader))
+	})
+	t.Run("verify dot segments are returned empty", func(t *testing.T) {
+		for _, filename := range []string{".", "..", `..\`, "../", `C:\Users\..`} {
+			fileHeader := newFileHeader(filename, `form-data; name="file"`)
+			assert.Equal(t, "", normalizeFilename(fileHeader))
+		}
+	})
+}
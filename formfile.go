@@ -0,0 +1,190 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"sync"
+)
+
+// spilledFiles holds the temporary files readForm spilled WithTempDir, keyed by the FileHeader they belong to.
+// FileHeader.Open only knows about the temporary files ReadForm creates itself, which always go in os.TempDir, so
+// these are opened with OpenFileHeader and removed with RemoveForm instead.
+var spilledFiles = struct {
+	sync.Mutex
+	paths map[*multipart.FileHeader]string
+}{paths: map[*multipart.FileHeader]string{}}
+
+// readForm reads the form as ReadForm would, spilling the files that don't fit in maxMemory to the directory passed
+// WithTempDir, if any. Its parts are streamed so only the part being read is ever held in memory on top of maxMemory.
+func readForm(multipartReader *multipart.Reader, maxMemory int64, o *options) (*multipart.Form, error) {
+	if o.tempDir == "" {
+		return multipartReader.ReadForm(maxMemory)
+	}
+
+	form := &multipart.Form{Value: map[string][]string{}, File: map[string][]*multipart.FileHeader{}}
+
+	// as with ReadForm values get 10 MB on top of maxMemory
+	if maxMemory > math.MaxInt64-10<<20-1 {
+		maxMemory = math.MaxInt64 - 10<<20 - 1
+	}
+	maxValueBytes := maxMemory + 10<<20
+
+	for {
+		part, err := multipartReader.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			_ = RemoveForm(form)
+			return nil, err
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		if part.FileName() == "" {
+			var value bytes.Buffer
+			size, err := io.CopyN(&value, part, maxValueBytes+1)
+			if err != nil && err != io.EOF {
+				_ = RemoveForm(form)
+				return nil, err
+			}
+
+			maxValueBytes -= size
+			if maxValueBytes < 0 {
+				_ = RemoveForm(form)
+				return nil, multipart.ErrMessageTooLarge
+			}
+
+			form.Value[name] = append(form.Value[name], value.String())
+			continue
+		}
+
+		var buffered bytes.Buffer
+		size, err := io.CopyN(&buffered, part, maxMemory+1)
+		if err != nil && err != io.EOF {
+			_ = RemoveForm(form)
+			return nil, err
+		}
+
+		var fileHeader *multipart.FileHeader
+		if size <= maxMemory {
+			maxMemory -= size
+			fileHeader, err = memoryFileHeader(part.Header, buffered.Bytes())
+		} else {
+			fileHeader, err = spillFileHeader(part, io.MultiReader(&buffered, part), o.tempDir)
+		}
+		if err != nil {
+			_ = RemoveForm(form)
+			return nil, err
+		}
+
+		form.File[name] = append(form.File[name], fileHeader)
+	}
+}
+
+// memoryFileHeader is a FileHeader holding data in memory. A part with header is written and read back with
+// ReadForm, which keeps it in memory since it fits, as FileHeaders can only be created by reading a form.
+func memoryFileHeader(header textproto.MIMEHeader, data []byte) (*multipart.FileHeader, error) {
+	var formBuffer bytes.Buffer
+	multipartWriter := multipart.NewWriter(&formBuffer)
+
+	partWriter, err := multipartWriter.CreatePart(header)
+	if err == nil {
+		_, err = partWriter.Write(data)
+	}
+	if err == nil {
+		err = multipartWriter.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	form, err := multipart.NewReader(&formBuffer, multipartWriter.Boundary()).ReadForm(int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fileHeaders := range form.File {
+		return fileHeaders[0], nil
+	}
+
+	return nil, ErrReadingMultiPartForm
+}
+
+// spillFileHeader copies the contents of part from body to a temporary file in dir and returns a FileHeader for it
+// that's opened with OpenFileHeader.
+func spillFileHeader(part *multipart.Part, body io.Reader, dir string) (*multipart.FileHeader, error) {
+	file, err := os.CreateTemp(dir, "multipart-")
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+
+	fileHeader := &multipart.FileHeader{Filename: part.FileName(), Header: part.Header, Size: size}
+
+	spilledFiles.Lock()
+	spilledFiles.paths[fileHeader] = file.Name()
+	spilledFiles.Unlock()
+
+	return fileHeader, nil
+}
+
+// OpenFileHeader opens the file fileHeader describes. It's fileHeader.Open for files that were also spilled to the
+// directory passed WithTempDir, which fileHeader.Open can't find.
+func OpenFileHeader(fileHeader *multipart.FileHeader) (multipart.File, error) {
+	spilledFiles.Lock()
+	path, ok := spilledFiles.paths[fileHeader]
+	spilledFiles.Unlock()
+
+	if !ok {
+		return fileHeader.Open()
+	}
+
+	return os.Open(path)
+}
+
+// RemoveForm is form.RemoveAll that also removes the files spilled to the directory passed WithTempDir. Forms read
+// WithTempDir have to be removed with it rather than RemoveAll or their files are left behind.
+func RemoveForm(form *multipart.Form) error {
+	var removeErr error
+
+	for _, fileHeaders := range form.File {
+		for _, fileHeader := range fileHeaders {
+			spilledFiles.Lock()
+			path, ok := spilledFiles.paths[fileHeader]
+			delete(spilledFiles.paths, fileHeader)
+			spilledFiles.Unlock()
+
+			if !ok {
+				continue
+			}
+
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) && removeErr == nil {
+				removeErr = err
+			}
+		}
+	}
+
+	if err := form.RemoveAll(); err != nil && removeErr == nil {
+		removeErr = err
+	}
+
+	return removeErr
+}
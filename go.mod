@@ -3,10 +3,11 @@ module github.com/seantcanavan/lambda_s3
 go 1.18
 
 require (
-	github.com/aws/aws-lambda-go v1.37.0
+	github.com/aws/aws-lambda-go v1.41.0
 	github.com/aws/aws-sdk-go v1.44.182
 	github.com/jgroeneveld/trial v2.0.0+incompatible
 	github.com/joho/godotenv v1.4.0
+	golang.org/x/text v0.14.0
 )
 
 require (
@@ -0,0 +1,470 @@
+package lambda_s3
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxSize is the MaxSize used by the handler factories when Config.MaxSize isn't set.
+	DefaultMaxSize = 10 << 20 // 10 megabytes, the API Gateway payload limit
+	// APIGatewayPayloadLimit is the largest request body, after base64 decoding, API Gateway passes to Lambda.
+	APIGatewayPayloadLimit = 10 << 20 // 10 megabytes
+	// DefaultKeyParameter is the KeyParameter used by NewDownloadHandler when Config.KeyParameter isn't set.
+	DefaultKeyParameter = "key"
+)
+
+var (
+	ErrInvalidKey                 = errors.New("unable to determine a valid key for the uploaded file")
+	ErrNoFilesFound               = errors.New("request contained no files")
+	ErrPayloadExceedsGatewayLimit = errors.New("request payload is larger than API Gateway allows. upload the file with a presigned URL instead")
+	ErrPresigningURL              = errors.New("unable to presign the S3 URL")
+)
+
+// Handler is an API Gateway proxy Lambda handler. It can be passed directly to lambda.Start.
+type Handler func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// KeyFunc returns the S3 key a file uploaded in lambdaReq should be stored under.
+type KeyFunc func(lambdaReq events.APIGatewayProxyRequest, fileHeader *multipart.FileHeader) (string, error)
+
+// Config configures the handlers returned by the handler factories in this package.
+// Region and Bucket are required.
+type Config struct {
+	Region string
+	Bucket string
+	// KeyFunc picks the S3 key for each uploaded file. Defaults to UUIDKey so clients can't pick, and overwrite, the
+	// keys of existing objects by naming their files after them.
+	KeyFunc KeyFunc
+	// MaxSize is the maximum size in bytes of each uploaded file. Defaults to DefaultMaxSize.
+	MaxSize int64
+	// MaxMemory is how many bytes of the multipart form are held in memory before the rest is spilled to TempDir.
+	// Defaults to MaxSize. Lower it for Lambdas with little memory.
+	MaxMemory int64
+	// TempDir is where form parts over MaxMemory are spilled. Defaults to os.TempDir, which is /tmp on Lambda.
+	TempDir string
+	// MaxTotalSize is the maximum size in bytes of the whole multipart form. Zero means no limit beyond MaxSize.
+	MaxTotalSize int64
+	// MaxPayloadSize is the maximum size in bytes of the decoded request body. Larger requests are rejected with
+	// ErrPayloadExceedsGatewayLimit. Defaults to APIGatewayPayloadLimit.
+	MaxPayloadSize int64
+	// PresignFallbackExpiry makes upload handlers answer requests over MaxPayloadSize with a 413 whose body is a
+	// PresignedUpload, valid for this long, that the client can upload the file to instead. The key comes from
+	// KeyFunc called with the first file in the form, whose FileHeader only has Filename, Header, and Size set. The
+	// file is checked against MaxSize and Quota first and the URL only accepts a file of the same size. Uploads made
+	// to the URL aren't seen by the Lambda so they aren't passed to UsageRecorder. Zero disables the fallback.
+	PresignFallbackExpiry time.Duration
+	// KeyParameter is the name of the path parameter, or query string parameter if there's no such path parameter,
+	// holding the key of the file to download. Defaults to DefaultKeyParameter.
+	KeyParameter string
+	// Authorizer, when set, is called before every request to reject it or scope its keys to the caller.
+	Authorizer Authorizer
+	// Quota, when set, is checked with the Authorization's UserID and the total size of the uploaded files before
+	// any of them are uploaded. Uploads over quota are rejected with a 413 and ErrQuotaExceeded.
+	Quota Quota
+	// UsageRecorder, when set, is told the size of every file uploaded by upload handlers.
+	UsageRecorder UsageRecorder
+	// IdempotencyStore, when set, records the results of uploads sent with an Idempotency-Key header. Retries of a
+	// completed upload with the same key, by the same user, are answered with the original results, and an
+	// Idempotent-Replayed: true header, without uploading the files again. Uploads still in progress aren't
+	// recorded so concurrent retries are uploaded as usual. Keys are only scoped to the user by the Authorizer's
+	// UserID. Without one every caller shares the same keys, so anyone sending a key already used is answered with
+	// the results of that upload, including its keys and URLs. Set an Authorizer unless all callers are trusted.
+	IdempotencyStore IdempotencyStore
+	// PresignExpiry makes download handlers redirect to a presigned URL valid for this long instead of
+	// returning the file in the response body. Zero disables presigning.
+	PresignExpiry time.Duration
+	// KMSKeyID, when set, makes upload handlers encrypt files WithKMSEncryption under this KMS key and download
+	// handlers decrypt the files that were. Without it encrypted files are served as the ciphertext S3 stores.
+	KMSKeyID string
+}
+
+func (c Config) keyParameter() string {
+	if c.KeyParameter == "" {
+		return DefaultKeyParameter
+	}
+
+	return c.KeyParameter
+}
+
+func (c Config) maxSize() int64 {
+	if c.MaxSize <= 0 {
+		return DefaultMaxSize
+	}
+
+	return c.MaxSize
+}
+
+func (c Config) maxMemory() int64 {
+	if c.MaxMemory <= 0 {
+		return c.maxSize()
+	}
+
+	return c.MaxMemory
+}
+
+// uploadOptions are the options upload handlers upload each file with.
+func (c Config) uploadOptions(ctx context.Context) []Option {
+	opts := []Option{WithMaxSize(c.maxSize()), WithContext(ctx)}
+	if c.KMSKeyID != "" {
+		opts = append(opts, WithKMSEncryption(c.KMSKeyID))
+	}
+
+	return opts
+}
+
+func (c Config) maxPayloadSize() int64 {
+	if c.MaxPayloadSize <= 0 {
+		return APIGatewayPayloadLimit
+	}
+
+	return c.MaxPayloadSize
+}
+
+// requestKey authorizes lambdaReq and returns the key in its KeyParameter path or query string parameter.
+func (c Config) requestKey(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (string, error) {
+	authorization, err := c.authorize(ctx, lambdaReq)
+	if err != nil {
+		return "", err
+	}
+
+	name := lambdaReq.PathParameters[c.keyParameter()]
+	if name == "" {
+		name = lambdaReq.QueryStringParameters[c.keyParameter()]
+	}
+
+	if name == "" {
+		return "", ErrParameterNameEmpty
+	}
+
+	return authorization.scope(name)
+}
+
+func (c Config) key(lambdaReq events.APIGatewayProxyRequest, fileHeader *multipart.FileHeader) (string, error) {
+	keyFn := c.KeyFunc
+	if keyFn == nil {
+		keyFn = KeyGenerator(UUIDKey).KeyFunc()
+	}
+
+	key, err := keyFn(lambdaReq, fileHeader)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+
+	if key == "" {
+		return "", ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// NewUploadHandler returns a Handler that parses the multipart form in the request, uploads every file in it to
+// config.Bucket and responds with a JSON array containing the UploadRes for each file. Files sent in other forms,
+// such as a JSON body, are read too. See ParseRequest.
+func NewUploadHandler(config Config) Handler {
+	return func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		authorization, err := config.authorize(ctx, lambdaReq)
+		if err != nil {
+			return ErrorResponse(err), nil
+		}
+
+		idempotencyKey, err := config.idempotencyKey(lambdaReq, authorization)
+		if err != nil {
+			return ErrorResponse(err), nil
+		}
+
+		if idempotencyKey != "" {
+			uploadResults, err := config.IdempotencyStore.Get(ctx, idempotencyKey)
+			if err != nil {
+				return ErrorResponse(err), nil
+			}
+
+			if uploadResults != nil {
+				response, err := uploadResultsResponse(uploadResults)
+				if err != nil {
+					return response, err
+				}
+
+				response.Headers[IdempotentReplayedHeader] = "true"
+				return response, nil
+			}
+		}
+
+		if PayloadSize(lambdaReq) > config.maxPayloadSize() {
+			if config.PresignFallbackExpiry > 0 {
+				return presignFallback(config, authorization, lambdaReq), nil
+			}
+			return ErrorResponse(ErrPayloadExceedsGatewayLimit), nil
+		}
+
+		form, err := ParseRequest(lambdaReq, config.maxMemory(), WithMaxSize(config.maxSize()), WithMaxTotalSize(config.MaxTotalSize), WithTempDir(config.TempDir))
+		if err != nil {
+			return ErrorResponse(err), nil
+		}
+		defer RemoveForm(form)
+
+		fileHeaders := FormFiles(form)
+
+		if len(fileHeaders) == 0 {
+			return ErrorResponse(ErrNoFilesFound), nil
+		}
+
+		if err = checkQuota(config.Quota, authorization.UserID, fileHeaders...); err != nil {
+			return ErrorResponse(err), nil
+		}
+
+		uploadResults := make([]*UploadRes, 0, len(fileHeaders))
+
+		for _, fileHeader := range fileHeaders {
+			key, err := config.key(lambdaReq, fileHeader)
+			if err == nil {
+				key, err = authorization.scope(key)
+			}
+			if err != nil {
+				return ErrorResponse(err), nil
+			}
+
+			uploadRes, err := UploadHeader(fileHeader, config.Region, config.Bucket, key, config.uploadOptions(ctx)...)
+			if err != nil {
+				return ErrorResponse(err), nil
+			}
+
+			recordUsage(config.UsageRecorder, authorization.UserID, uploadRes)
+
+			uploadResults = append(uploadResults, uploadRes)
+		}
+
+		if idempotencyKey != "" {
+			// the files are uploaded whether or not they can be recorded. failing the request now would only make the
+			// client retry and upload them again
+			_ = config.IdempotencyStore.Put(ctx, idempotencyKey, uploadResults)
+		}
+
+		return uploadResultsResponse(uploadResults)
+	}
+}
+
+// uploadResultsResponse responds with uploadResults as JSON.
+func uploadResultsResponse(uploadResults []*UploadRes) (events.APIGatewayProxyResponse, error) {
+	uploadResultsBytes, err := json.Marshal(uploadResults)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(uploadResultsBytes),
+	}, nil
+}
+
+// PayloadSize is the size in bytes of the body of lambdaReq after base64 decoding.
+func PayloadSize(lambdaReq events.APIGatewayProxyRequest) int64 {
+	if !lambdaReq.IsBase64Encoded {
+		return int64(len(lambdaReq.Body))
+	}
+
+	padding := len(lambdaReq.Body) - len(strings.TrimRight(lambdaReq.Body, "="))
+
+	return int64(base64.StdEncoding.DecodedLen(len(lambdaReq.Body)) - padding)
+}
+
+// presignFallback responds to an upload too large for API Gateway with a PresignedUpload for the first file in it.
+// The file is only measured, not parsed, and has to pass config.MaxSize and config.Quota like any other upload. The
+// URL is signed for exactly that many bytes so a larger file can't be uploaded to it instead.
+func presignFallback(config Config, authorization *Authorization, lambdaReq events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	_, params, err := mime.ParseMediaType(requestHeaders(lambdaReq).Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return ErrorResponse(ErrPayloadExceedsGatewayLimit)
+	}
+
+	multipartReader := multipart.NewReader(requestBody(APIGatewayProxySource(lambdaReq)), params["boundary"])
+
+	for {
+		part, err := multipartReader.NextPart()
+		if err != nil {
+			return ErrorResponse(ErrPayloadExceedsGatewayLimit)
+		}
+
+		if part.FileName() == "" {
+			continue
+		}
+
+		size, err := io.Copy(io.Discard, part)
+		if err != nil {
+			return ErrorResponse(ErrPayloadExceedsGatewayLimit)
+		}
+
+		if size > config.maxSize() {
+			return ErrorResponse(fmt.Errorf("%w: %s is %d bytes", ErrFileTooLarge, part.FileName(), size))
+		}
+
+		fileHeader := &multipart.FileHeader{Filename: part.FileName(), Header: part.Header, Size: size}
+
+		if err = checkQuota(config.Quota, authorization.UserID, fileHeader); err != nil {
+			return ErrorResponse(err)
+		}
+
+		key, err := config.key(lambdaReq, fileHeader)
+		if err == nil {
+			key, err = authorization.scope(key)
+		}
+		if err != nil {
+			return ErrorResponse(err)
+		}
+
+		presignedUpload, err := PresignUpload(config.Region, config.Bucket, key, config.PresignFallbackExpiry, WithContentLength(size))
+		if err != nil {
+			return ErrorResponse(err)
+		}
+
+		presignedUploadBytes, _ := json.Marshal(presignedUpload) // PresignedUpload only contains strings and a time so marshalling can't fail
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       string(presignedUploadBytes),
+		}
+	}
+}
+
+// NewDownloadHandler returns a Handler that serves the file whose key is stored in the config.KeyParameter
+// path or query string parameter. The file is returned base64 encoded in the response body along with its
+// Content-Type or, when config.PresignExpiry is set, the client is redirected to a presigned URL for it instead.
+// Requests with a Range header for a single range of bytes are served the range with 206 Partial Content so media
+// players can seek. Responses carry the object's ETag and Last-Modified, along with any Cache-Control,
+// Content-Disposition, Content-Language, and Expires it was uploaded with, and requests whose If-None-Match or
+// If-Modified-Since shows the client's copy is current get a 304 Not Modified without the file being downloaded.
+// With config.KMSKeyID set, files uploaded WithKMSEncryption are decrypted and served whole, even for Range requests,
+// since a range of their ciphertext can't be decrypted on its own. Presigned URLs serve files as they're stored so they can't be used for
+// encrypted files. Files over the 6 MB Lambda response limit should be presigned or served with
+// NewStreamingDownloadHandler.
+func NewDownloadHandler(config Config) Handler {
+	return func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		name, err := config.requestKey(ctx, lambdaReq)
+		if err != nil {
+			return ErrorResponse(err), nil
+		}
+
+		if config.Region == "" {
+			return ErrorResponse(ErrParameterRegionEmpty), nil
+		}
+
+		if err := validateBucket(config.Bucket); err != nil {
+			return ErrorResponse(err), nil
+		}
+
+		awsSession, err := newOptions(nil).newSession(config.Region)
+		if err != nil {
+			return ErrorResponse(ErrNewAWSSession), nil
+		}
+
+		s3Client := s3.New(awsSession)
+
+		getObjectInput := &s3.GetObjectInput{
+			Bucket: aws.String(config.Bucket),
+			Key:    aws.String(name),
+		}
+
+		if config.PresignExpiry > 0 {
+			getObjectReq, _ := s3Client.GetObjectRequest(getObjectInput)
+
+			presignedURL, err := getObjectReq.Presign(config.PresignExpiry)
+			if err != nil {
+				return ErrorResponse(ErrPresigningURL), nil
+			}
+
+			return events.APIGatewayProxyResponse{
+				StatusCode: http.StatusFound,
+				Headers:    map[string]string{"Location": presignedURL},
+			}, nil
+		}
+
+		reqHeaders := requestHeaders(lambdaReq)
+
+		if rangeHeader := byteRange(reqHeaders.Get("Range")); rangeHeader != "" {
+			getObjectInput.Range = aws.String(rangeHeader)
+		}
+
+		setConditions(getObjectInput, reqHeaders)
+
+		var responseHeaders responseHeaderRecorder
+
+		getObjectOutput, err := getDecryptedObject(ctx, s3Client, awsSession, getObjectInput, config.KMSKeyID != "", responseHeaders.record)
+		if err != nil {
+			if isNotFound(err) {
+				return ErrorResponse(ErrObjectNotFound), nil
+			}
+			if isNotModified(err) {
+				return events.APIGatewayProxyResponse{
+					StatusCode: http.StatusNotModified,
+					Headers:    notModifiedHeaders(&responseHeaders),
+				}, nil
+			}
+			if isInvalidRange(err) {
+				return ErrorResponse(ErrRangeNotSatisfiable), nil
+			}
+			if errors.Is(err, ErrDecryptingFile) {
+				return ErrorResponse(err), nil
+			}
+			return ErrorResponse(ErrDownloadingS3File), nil
+		}
+		defer getObjectOutput.Body.Close()
+
+		fileBytes, err := io.ReadAll(getObjectOutput.Body)
+		if err != nil {
+			if errors.Is(err, ErrDecryptingFile) {
+				return ErrorResponse(err), nil
+			}
+			return ErrorResponse(ErrDownloadingS3File), nil
+		}
+
+		statusCode := http.StatusOK
+		headers := objectHeaders(getObjectOutput)
+		headers["Accept-Ranges"] = "bytes"
+		headers["Content-Type"] = aws.StringValue(getObjectOutput.ContentType)
+
+		if getObjectOutput.ContentRange != nil {
+			statusCode = http.StatusPartialContent
+			headers["Content-Range"] = aws.StringValue(getObjectOutput.ContentRange)
+		}
+
+		return events.APIGatewayProxyResponse{
+			StatusCode:      statusCode,
+			Headers:         headers,
+			Body:            base64.StdEncoding.EncodeToString(fileBytes),
+			IsBase64Encoded: true,
+		}, nil
+	}
+}
+
+// NewDeleteHandler returns a Handler that deletes the file whose key is stored in the config.KeyParameter path or
+// query string parameter and responds with 204 No Content.
+func NewDeleteHandler(config Config) Handler {
+	return func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		name, err := config.requestKey(ctx, lambdaReq)
+		if err != nil {
+			return ErrorResponse(err), nil
+		}
+
+		if err = Delete(config.Region, config.Bucket, name, WithContext(ctx)); err != nil {
+			if StatusCode(err) == http.StatusInternalServerError { // Delete returns S3's errors as they are
+				err = fmt.Errorf("%w: %s", ErrDeletingS3Object, err)
+			}
+			return ErrorResponse(err), nil
+		}
+
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusNoContent}, nil
+	}
+}
@@ -0,0 +1,216 @@
+package lambda_s3
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewUploadHandler(t *testing.T) {
+	config := Config{
+		Region: Region,
+		Bucket: S3Bucket,
+		KeyFunc: func(lambdaReq events.APIGatewayProxyRequest, fileHeader *multipart.FileHeader) (string, error) {
+			return S3FileName, nil
+		},
+		MaxSize: MaxFileSizeBytes,
+	}
+
+	t.Run("verify bad request when Content-Type header not set", func(t *testing.T) {
+		lambdaReq := generateUploadFileReq()
+		lambdaReq.Headers = map[string]string{}
+
+		res, err := NewUploadHandler(config)(context.Background(), lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify bad request when KeyFunc fails", func(t *testing.T) {
+		keyFuncConfig := config
+		keyFuncConfig.KeyFunc = func(lambdaReq events.APIGatewayProxyRequest, fileHeader *multipart.FileHeader) (string, error) {
+			return "", errors.New("no key for you")
+		}
+
+		res, err := NewUploadHandler(keyFuncConfig)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify keys are generated when there's no KeyFunc instead of taken from the client", func(t *testing.T) {
+		key, err := Config{}.key(generateUploadFileReq(), &multipart.FileHeader{Filename: "reports/Q4.PDF"})
+		assert.Nil(t, err)
+		assert.False(t, strings.Contains(key, "Q4"))
+		assert.True(t, strings.HasSuffix(key, ".pdf"))
+		assert.Equal(t, 36+len(".pdf"), len(key))
+	})
+	t.Run("verify request entity too large when file exceeds MaxSize", func(t *testing.T) {
+		maxSizeConfig := config
+		maxSizeConfig.MaxSize = SampleFileSizeBytes - 1
+
+		res, err := NewUploadHandler(maxSizeConfig)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+	t.Run("verify request entity too large when the payload exceeds MaxPayloadSize", func(t *testing.T) {
+		maxPayloadConfig := config
+		maxPayloadConfig.MaxPayloadSize = SampleFileSizeBytes
+
+		res, err := NewUploadHandler(maxPayloadConfig)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+		assert.True(t, strings.Contains(res.Body, "presigned URL"))
+	})
+	t.Run("verify a presigned upload is returned when the payload exceeds MaxPayloadSize", func(t *testing.T) {
+		fallbackConfig := config
+		fallbackConfig.MaxPayloadSize = SampleFileSizeBytes
+		fallbackConfig.PresignFallbackExpiry = time.Minute
+
+		res, err := NewUploadHandler(fallbackConfig)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+		var presignedUpload PresignedUpload
+		assert.Nil(t, json.Unmarshal([]byte(res.Body), &presignedUpload))
+		assert.Equal(t, S3FileName, presignedUpload.Key)
+		assert.Equal(t, http.MethodPut, presignedUpload.Method)
+		assert.True(t, strings.Contains(presignedUpload.URL, "X-Amz-Signature="))
+		assert.True(t, strings.Contains(presignedUpload.URL, "X-Amz-SignedHeaders=content-length"))
+	})
+	t.Run("verify the fallback is refused for files over MaxSize or the Quota", func(t *testing.T) {
+		fallbackConfig := config
+		fallbackConfig.MaxPayloadSize = SampleFileSizeBytes
+		fallbackConfig.PresignFallbackExpiry = time.Minute
+		fallbackConfig.MaxSize = SampleFileSizeBytes - 1
+
+		res, err := NewUploadHandler(fallbackConfig)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+		assert.False(t, strings.Contains(res.Body, "X-Amz-Signature="))
+
+		var checkedBytes int64
+		fallbackConfig.MaxSize = 0
+		fallbackConfig.Quota = QuotaFunc(func(userID string, incomingBytes int64) error {
+			checkedBytes = incomingBytes
+			return errors.New("over quota")
+		})
+
+		res, err = NewUploadHandler(fallbackConfig)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, StatusCode(ErrQuotaExceeded), res.StatusCode)
+		assert.Equal(t, int64(SampleFileSizeBytes), checkedBytes)
+	})
+	t.Run("verify NewUploadHandler works with correct inputs", func(t *testing.T) {
+		res, err := NewUploadHandler(config)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var uploadResults []*UploadRes
+		assert.Nil(t, json.Unmarshal([]byte(res.Body), &uploadResults))
+		assert.Equal(t, 1, len(uploadResults))
+		assert.Equal(t, filepath.Join(S3Bucket, S3FileName), uploadResults[0].S3Path)
+		assert.Equal(t, int64(SampleFileSizeBytes), uploadResults[0].BytesUploaded)
+	})
+}
+
+func TestPayloadSize(t *testing.T) {
+	t.Run("verify base64 encoded bodies are measured decoded", func(t *testing.T) {
+		for _, body := range []string{"", "a", "ab", "abc", "abcd"} {
+			assert.Equal(t, int64(len(body)), PayloadSize(events.APIGatewayProxyRequest{Body: body}))
+			assert.Equal(t, int64(len(body)), PayloadSize(events.APIGatewayProxyRequest{
+				Body:            base64.StdEncoding.EncodeToString([]byte(body)),
+				IsBase64Encoded: true,
+			}))
+		}
+	})
+}
+
+func TestNewDownloadHandler(t *testing.T) {
+	config := Config{
+		Region: Region,
+		Bucket: S3Bucket,
+	}
+
+	t.Run("verify bad request when key parameter is missing", func(t *testing.T) {
+		res, err := NewDownloadHandler(config)(context.Background(), events.APIGatewayProxyRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify not found when key does not exist", func(t *testing.T) {
+		res, err := NewDownloadHandler(config)(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{DefaultKeyParameter: "does_not_exist"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+	t.Run("verify redirect to presigned URL when PresignExpiry is set", func(t *testing.T) {
+		presignConfig := config
+		presignConfig.KeyParameter = "id"
+		presignConfig.PresignExpiry = time.Minute
+
+		res, err := NewDownloadHandler(presignConfig)(context.Background(), events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"id": S3FileName},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusFound, res.StatusCode)
+		assert.True(t, strings.Contains(res.Headers["Location"], S3FileName))
+		assert.True(t, strings.Contains(res.Headers["Location"], "X-Amz-Signature="))
+	})
+	t.Run("verify NewDownloadHandler works with correct inputs", func(t *testing.T) {
+		res, err := NewDownloadHandler(config)(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{DefaultKeyParameter: S3FileName},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.True(t, res.IsBase64Encoded)
+
+		fileBytes, err := base64.StdEncoding.DecodeString(res.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+	})
+	t.Run("verify a single byte range is served as partial content", func(t *testing.T) {
+		res, err := NewDownloadHandler(config)(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{DefaultKeyParameter: S3FileName},
+			Headers:        map[string]string{"range": "bytes=0-9"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+		assert.Equal(t, fmt.Sprintf("bytes 0-9/%d", SampleFileSizeBytes), res.Headers["Content-Range"])
+
+		fileBytes, err := base64.StdEncoding.DecodeString(res.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(fileBytes))
+	})
+	t.Run("verify clients with a current copy are told it's not modified", func(t *testing.T) {
+		res, err := NewDownloadHandler(config)(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{DefaultKeyParameter: S3FileName},
+		})
+		assert.Nil(t, err)
+		assert.True(t, res.Headers["ETag"] != "")
+		assert.True(t, res.Headers["Last-Modified"] != "")
+
+		res, err = NewDownloadHandler(config)(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{DefaultKeyParameter: S3FileName},
+			Headers:        map[string]string{"If-None-Match": res.Headers["ETag"]},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+		assert.Equal(t, "", res.Body)
+		assert.True(t, res.Headers["ETag"] != "")
+	})
+	t.Run("verify ranges past the end of the file aren't satisfiable", func(t *testing.T) {
+		res, err := NewDownloadHandler(config)(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{DefaultKeyParameter: S3FileName},
+			Headers:        map[string]string{"Range": fmt.Sprintf("bytes=%d-", SampleFileSizeBytes)},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.StatusCode)
+	})
+}
@@ -0,0 +1,50 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"mime"
+	"net/http"
+)
+
+// The dispositions ContentDisposition accepts.
+const (
+	DispositionInline     = "inline"
+	DispositionAttachment = "attachment"
+)
+
+// ContentDisposition returns a Content-Disposition header value for WithContentDisposition, e.g.
+// ContentDisposition(DispositionAttachment, "report.pdf") makes browsers download the file as report.pdf rather
+// than show it. Filenames outside ASCII are encoded as RFC 6266 requires. An empty filename leaves the name up to
+// the browser.
+func ContentDisposition(disposition, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+
+	return mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+}
+
+// objectHeaders returns the headers S3 stored with the object that the download handlers pass on to clients:
+// those browsers and caches act on, and the validators clients make conditional requests with.
+func objectHeaders(getObjectOutput *s3.GetObjectOutput) map[string]string {
+	headers := map[string]string{}
+
+	for header, value := range map[string]*string{
+		"Cache-Control":       getObjectOutput.CacheControl,
+		"Content-Disposition": getObjectOutput.ContentDisposition,
+		"Content-Language":    getObjectOutput.ContentLanguage,
+		"ETag":                getObjectOutput.ETag,
+		"Expires":             getObjectOutput.Expires,
+	} {
+		if value != nil {
+			headers[header] = aws.StringValue(value)
+		}
+	}
+
+	if getObjectOutput.LastModified != nil {
+		headers["Last-Modified"] = getObjectOutput.LastModified.UTC().Format(http.TimeFormat)
+	}
+
+	return headers
+}
@@ -0,0 +1,62 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestContentDisposition(t *testing.T) {
+	t.Run("verify filenames are quoted and encoded when needed", func(t *testing.T) {
+		assert.Equal(t, "attachment; filename=report.pdf", ContentDisposition(DispositionAttachment, "report.pdf"))
+		assert.Equal(t, `attachment; filename="Q1 report.pdf"`, ContentDisposition(DispositionAttachment, "Q1 report.pdf"))
+		assert.Equal(t, "attachment; filename*=utf-8''r%C3%A9sum%C3%A9.pdf", ContentDisposition(DispositionAttachment, "résumé.pdf"))
+		assert.Equal(t, "inline", ContentDisposition(DispositionInline, ""))
+	})
+}
+
+func TestObjectHeaders(t *testing.T) {
+	t.Run("verify stored headers and validators are passed on", func(t *testing.T) {
+		headers := objectHeaders(&s3.GetObjectOutput{
+			CacheControl:       aws.String("max-age=60"),
+			ContentDisposition: aws.String("inline"),
+			ETag:               aws.String(`"etag"`),
+			LastModified:       aws.Time(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)),
+		})
+		assert.Equal(t, 4, len(headers))
+		assert.Equal(t, "max-age=60", headers["Cache-Control"])
+		assert.Equal(t, "inline", headers["Content-Disposition"])
+		assert.Equal(t, `"etag"`, headers["ETag"])
+		assert.Equal(t, "Mon, 02 Jan 2023 03:04:05 GMT", headers["Last-Modified"])
+	})
+	t.Run("verify uploads are served with the headers they were uploaded with", func(t *testing.T) {
+		uploadRes, err := UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), Region, S3Bucket, "headers/"+SampleFileName,
+			WithCacheControl("no-cache"),
+			WithContentDisposition(ContentDisposition(DispositionAttachment, SampleFileName)),
+			WithContentLanguage("en-US"),
+			WithExpires(time.Now().Add(time.Hour)))
+		assert.Nil(t, err)
+
+		awsSession, err := newOptions(nil).newSession(Region)
+		assert.Nil(t, err)
+
+		getObjectOutput, err := s3.New(awsSession).GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(S3Bucket),
+			Key:    aws.String(uploadRes.Key),
+		})
+		assert.Nil(t, err)
+		getObjectOutput.Body.Close()
+
+		headers := objectHeaders(getObjectOutput)
+		assert.Equal(t, "no-cache", headers["Cache-Control"])
+		assert.Equal(t, "attachment; filename="+SampleFileName, headers["Content-Disposition"])
+		assert.Equal(t, "en-US", headers["Content-Language"])
+		_, err = http.ParseTime(headers["Expires"])
+		assert.Nil(t, err)
+
+		assert.Nil(t, Delete(Region, S3Bucket, uploadRes.Key))
+	})
+}
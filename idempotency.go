@@ -0,0 +1,263 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io"
+	"path"
+	"strconv"
+	"time"
+)
+
+// IdempotencyKeyHeader is the header clients send a unique key for each upload in so retries of it can be recognized.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set to true on responses to retried uploads that were answered from an IdempotencyStore.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key accepted.
+const maxIdempotencyKeyLength = 255
+
+// The attributes of the items written by a DynamoDBIdempotencyStore. The table's partition key must be
+// IdempotencyKeyAttribute, a string. Enable TTL on IdempotencyExpiresAtAttribute to have DynamoDB delete expired items.
+const (
+	IdempotencyKeyAttribute       = "idempotencyKey"
+	IdempotencyResultsAttribute   = "uploadResults"
+	IdempotencyExpiresAtAttribute = "expiresAt"
+)
+
+var (
+	ErrIdempotencyStore      = errors.New("unable to look up or record the Idempotency-Key")
+	ErrInvalidIdempotencyKey = errors.New("the Idempotency-Key header must be at most 255 printable ASCII characters")
+)
+
+// IdempotencyStore remembers the results of completed uploads by the Idempotency-Key they were made with so upload
+// handlers can answer retries, e.g. after the client timed out waiting for the response, with the original
+// UploadRes instead of uploading the files again. See Config.IdempotencyStore.
+type IdempotencyStore interface {
+	// Get returns the results recorded for key, or nil if there are none.
+	Get(ctx context.Context, key string) ([]*UploadRes, error)
+	// Put records the results of the upload made with key.
+	Put(ctx context.Context, key string, uploadResults []*UploadRes) error
+}
+
+// idempotencyKey is the key the upload in lambdaReq is recorded under, scoped to the caller so one user can't
+// replay another's results, or "" if the request has no Idempotency-Key or c has no IdempotencyStore. Without an
+// Authorization.UserID, e.g. when c has no Authorizer, the key is used as is and shared by every caller.
+func (c Config) idempotencyKey(lambdaReq events.APIGatewayProxyRequest, authorization *Authorization) (string, error) {
+	key := requestHeaders(lambdaReq).Get(IdempotencyKeyHeader)
+	if key == "" || c.IdempotencyStore == nil {
+		return "", nil
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		return "", ErrInvalidIdempotencyKey
+	}
+
+	for _, r := range key {
+		if r < ' ' || r > '~' {
+			return "", ErrInvalidIdempotencyKey
+		}
+	}
+
+	if authorization.UserID == "" {
+		return key, nil
+	}
+
+	return authorization.UserID + ":" + key, nil
+}
+
+// DynamoDBIdempotencyStore is an IdempotencyStore keeping results in a DynamoDB table. Create one once, outside the
+// handler.
+type DynamoDBIdempotencyStore struct {
+	dynamoDBClient dynamodbiface.DynamoDBAPI
+	table          string
+	ttl            time.Duration
+}
+
+// NewDynamoDBIdempotencyStore returns a DynamoDBIdempotencyStore keeping results in table for ttl. See
+// IdempotencyKeyAttribute for the layout of the table.
+func NewDynamoDBIdempotencyStore(region, table string, ttl time.Duration, opts ...Option) (*DynamoDBIdempotencyStore, error) {
+	if region == "" {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	awsSession, err := newOptions(opts).newSession(region)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	return &DynamoDBIdempotencyStore{dynamoDBClient: dynamodb.New(awsSession), table: table, ttl: ttl}, nil
+}
+
+// Get returns the results recorded for key. Items DynamoDB hasn't got round to deleting since they expired are
+// ignored.
+func (s *DynamoDBIdempotencyStore) Get(ctx context.Context, key string) ([]*UploadRes, error) {
+	getItemOutput, err := s.dynamoDBClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]*dynamodb.AttributeValue{IdempotencyKeyAttribute: {S: aws.String(key)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, wrapCause(ErrIdempotencyStore, err)
+	}
+
+	item := getItemOutput.Item
+	if item == nil || item[IdempotencyResultsAttribute] == nil {
+		return nil, nil
+	}
+
+	if expiresAt := item[IdempotencyExpiresAtAttribute]; expiresAt != nil {
+		if unix, err := strconv.ParseInt(aws.StringValue(expiresAt.N), 10, 64); err == nil && time.Now().Unix() >= unix {
+			return nil, nil
+		}
+	}
+
+	return unmarshalUploadResults([]byte(aws.StringValue(item[IdempotencyResultsAttribute].S)))
+}
+
+// Put records uploadResults under key unless results are already recorded for it, in which case those stay. Results
+// that have expired but that DynamoDB hasn't deleted yet are replaced, as Get ignores them.
+func (s *DynamoDBIdempotencyStore) Put(ctx context.Context, key string, uploadResults []*UploadRes) error {
+	uploadResultsBytes, err := json.Marshal(uploadResults)
+	if err != nil {
+		return wrapCause(ErrIdempotencyStore, err)
+	}
+
+	item := map[string]*dynamodb.AttributeValue{
+		IdempotencyKeyAttribute:     {S: aws.String(key)},
+		IdempotencyResultsAttribute: {S: aws.String(string(uploadResultsBytes))},
+	}
+
+	now := time.Now()
+	if s.ttl > 0 {
+		item[IdempotencyExpiresAtAttribute] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(now.Add(s.ttl).Unix(), 10))}
+	}
+
+	_, err = s.dynamoDBClient.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(" + IdempotencyKeyAttribute + ") OR " + IdempotencyExpiresAtAttribute + " <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+
+	if err != nil {
+		return wrapCause(ErrIdempotencyStore, err)
+	}
+
+	return nil
+}
+
+// S3IdempotencyStore is an IdempotencyStore keeping results in marker objects in an S3 bucket, for Lambdas that
+// don't otherwise use DynamoDB. Create one once, outside the handler.
+type S3IdempotencyStore struct {
+	s3Client s3iface.S3API
+	bucket   string
+	prefix   string
+	ttl      time.Duration
+}
+
+// NewS3IdempotencyStore returns an S3IdempotencyStore keeping results for ttl in marker objects in bucket under
+// prefix, named after the SHA-256 digest of their key. Markers are tagged like objects uploaded WithExpiry(ttl) so
+// PutExpiryRule(region, bucket, ttl) deletes them once they expire. Expired markers that haven't been deleted yet
+// are ignored.
+func NewS3IdempotencyStore(region, bucket, prefix string, ttl time.Duration, opts ...Option) (*S3IdempotencyStore, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	awsSession, err := newOptions(opts).newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	return &S3IdempotencyStore{s3Client: s3.New(awsSession), bucket: bucket, prefix: prefix, ttl: ttl}, nil
+}
+
+// marker is the key of the marker object for key.
+func (s *S3IdempotencyStore) marker(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return path.Join(s.prefix, hex.EncodeToString(digest[:])+".json")
+}
+
+// Get returns the results recorded for key.
+func (s *S3IdempotencyStore) Get(ctx context.Context, key string) ([]*UploadRes, error) {
+	getObjectOutput, err := s.s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.marker(key)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, wrapCause(ErrIdempotencyStore, err)
+	}
+	defer getObjectOutput.Body.Close()
+
+	if s.ttl > 0 && getObjectOutput.LastModified != nil && time.Since(*getObjectOutput.LastModified) >= s.ttl {
+		return nil, nil
+	}
+
+	uploadResultsBytes, err := io.ReadAll(getObjectOutput.Body)
+	if err != nil {
+		return nil, wrapCause(ErrIdempotencyStore, err)
+	}
+
+	return unmarshalUploadResults(uploadResultsBytes)
+}
+
+// Put records uploadResults under key.
+func (s *S3IdempotencyStore) Put(ctx context.Context, key string, uploadResults []*UploadRes) error {
+	uploadResultsBytes, err := json.Marshal(uploadResults)
+	if err != nil {
+		return wrapCause(ErrIdempotencyStore, err)
+	}
+
+	putObjectInput := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.marker(key)),
+		Body:        bytes.NewReader(uploadResultsBytes),
+		ContentType: aws.String("application/json"),
+	}
+
+	if s.ttl > 0 {
+		putObjectInput.Tagging = aws.String(expiryTagging(s.ttl))
+	}
+
+	if _, err = s.s3Client.PutObjectWithContext(ctx, putObjectInput); err != nil {
+		return wrapCause(ErrIdempotencyStore, err)
+	}
+
+	return nil
+}
+
+func unmarshalUploadResults(uploadResultsBytes []byte) ([]*UploadRes, error) {
+	var uploadResults []*UploadRes
+	if err := json.Unmarshal(uploadResultsBytes, &uploadResults); err != nil {
+		return nil, wrapCause(ErrIdempotencyStore, err)
+	}
+
+	return uploadResults, nil
+}
@@ -0,0 +1,162 @@
+package lambda_s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// memoryIdempotencyStore is an IdempotencyStore in memory.
+type memoryIdempotencyStore map[string][]*UploadRes
+
+func (m memoryIdempotencyStore) Get(_ context.Context, key string) ([]*UploadRes, error) {
+	return m[key], nil
+}
+
+func (m memoryIdempotencyStore) Put(_ context.Context, key string, uploadResults []*UploadRes) error {
+	m[key] = uploadResults
+	return nil
+}
+
+// itemTable gets and conditionally puts items in memory keyed by IdempotencyKeyAttribute. Conditional puts replace
+// items whose IdempotencyExpiresAtAttribute is at or before :now, as the DynamoDBIdempotencyStore's condition does.
+type itemTable struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (i *itemTable) GetItemWithContext(_ aws.Context, input *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: i.items[aws.StringValue(input.Key[IdempotencyKeyAttribute].S)]}, nil
+}
+
+func (i *itemTable) PutItemWithContext(_ aws.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	key := aws.StringValue(input.Item[IdempotencyKeyAttribute].S)
+	if existing, ok := i.items[key]; ok && input.ConditionExpression != nil {
+		expired := false
+		if expiresAt, now := existing[IdempotencyExpiresAtAttribute], input.ExpressionAttributeValues[":now"]; expiresAt != nil && now != nil {
+			expiresAtUnix, _ := strconv.ParseInt(aws.StringValue(expiresAt.N), 10, 64)
+			nowUnix, _ := strconv.ParseInt(aws.StringValue(now.N), 10, 64)
+			expired = expiresAtUnix <= nowUnix
+		}
+
+		if !expired {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+		}
+	}
+
+	i.items[key] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	uploadResults := []*UploadRes{{Key: S3FileName, BytesUploaded: SampleFileSizeBytes, ETag: `"etag"`}}
+
+	t.Run("verify retried uploads are answered with the recorded results", func(t *testing.T) {
+		config := Config{Region: Region, Bucket: S3Bucket, IdempotencyStore: memoryIdempotencyStore{"retry-1": uploadResults}}
+
+		lambdaReq := generateUploadFileReq()
+		lambdaReq.Headers[IdempotencyKeyHeader] = "retry-1"
+
+		res, err := NewUploadHandler(config)(context.Background(), lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "true", res.Headers[IdempotentReplayedHeader])
+
+		var replayed []*UploadRes
+		assert.Nil(t, json.Unmarshal([]byte(res.Body), &replayed))
+		assert.Equal(t, 1, len(replayed))
+		assert.Equal(t, `"etag"`, replayed[0].ETag)
+	})
+	t.Run("verify bad request when the Idempotency-Key is invalid", func(t *testing.T) {
+		config := Config{Region: Region, Bucket: S3Bucket, IdempotencyStore: memoryIdempotencyStore{}}
+
+		lambdaReq := generateUploadFileReq()
+		lambdaReq.Headers[IdempotencyKeyHeader] = "retry\n1"
+
+		res, err := NewUploadHandler(config)(context.Background(), lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify keys are scoped to the caller", func(t *testing.T) {
+		config := Config{IdempotencyStore: memoryIdempotencyStore{}}
+
+		lambdaReq := generateUploadFileReq()
+		lambdaReq.Headers[IdempotencyKeyHeader] = "retry-1"
+
+		key, err := config.idempotencyKey(lambdaReq, &Authorization{UserID: "user-42"})
+		assert.Nil(t, err)
+		assert.Equal(t, "user-42:retry-1", key)
+
+		key, err = config.idempotencyKey(lambdaReq, &Authorization{})
+		assert.Nil(t, err)
+		assert.Equal(t, "retry-1", key)
+
+		key, err = Config{}.idempotencyKey(lambdaReq, &Authorization{UserID: "user-42"})
+		assert.Nil(t, err)
+		assert.Equal(t, "", key)
+	})
+	t.Run("verify the DynamoDB store keeps the first results and ignores expired ones", func(t *testing.T) {
+		table := &itemTable{items: map[string]map[string]*dynamodb.AttributeValue{}}
+		store := &DynamoDBIdempotencyStore{dynamoDBClient: table, table: "idempotency", ttl: time.Hour}
+
+		stored, err := store.Get(context.Background(), "retry-1")
+		assert.Nil(t, err)
+		assert.True(t, stored == nil)
+
+		assert.Nil(t, store.Put(context.Background(), "retry-1", uploadResults))
+		assert.Nil(t, store.Put(context.Background(), "retry-1", []*UploadRes{{Key: "other"}}))
+
+		stored, err = store.Get(context.Background(), "retry-1")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(stored))
+		assert.Equal(t, S3FileName, stored[0].Key)
+
+		table.items["retry-1"][IdempotencyExpiresAtAttribute].N = aws.String(strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+		stored, err = store.Get(context.Background(), "retry-1")
+		assert.Nil(t, err)
+		assert.True(t, stored == nil)
+	})
+	t.Run("verify the DynamoDB store records results again once the recorded ones expire", func(t *testing.T) {
+		table := &itemTable{items: map[string]map[string]*dynamodb.AttributeValue{}}
+		store := &DynamoDBIdempotencyStore{dynamoDBClient: table, table: "idempotency", ttl: time.Hour}
+
+		assert.Nil(t, store.Put(context.Background(), "retry-1", []*UploadRes{{Key: "expired"}}))
+		table.items["retry-1"][IdempotencyExpiresAtAttribute].N = aws.String(strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+
+		assert.Nil(t, store.Put(context.Background(), "retry-1", uploadResults))
+
+		stored, err := store.Get(context.Background(), "retry-1")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(stored))
+		assert.Equal(t, S3FileName, stored[0].Key)
+	})
+	t.Run("verify the S3 store keeps results in marker objects", func(t *testing.T) {
+		store := &S3IdempotencyStore{s3Client: s3.New(newFakeS3Session(t)), bucket: S3Bucket, prefix: "idempotency"}
+
+		stored, err := store.Get(context.Background(), "retry-1")
+		assert.Nil(t, err)
+		assert.True(t, stored == nil)
+
+		assert.Nil(t, store.Put(context.Background(), "retry-1", uploadResults))
+
+		stored, err = store.Get(context.Background(), "retry-1")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(stored))
+		assert.Equal(t, S3FileName, stored[0].Key)
+	})
+	t.Run("verify err when results can't be decoded", func(t *testing.T) {
+		_, err := unmarshalUploadResults([]byte("{"))
+		assert.True(t, errors.Is(err, ErrIdempotencyStore))
+	})
+}
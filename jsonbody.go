@@ -0,0 +1,99 @@
+package lambda_s3
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"mime"
+	"mime/multipart"
+	"strings"
+)
+
+var ErrReadingJSONBody = errors.New("request body is not a valid JSON file upload")
+
+// jsonFile is the body of a JSON file upload. Data is the base64 encoded file, optionally as a data URL.
+type jsonFile struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Data        string `json:"data"`
+}
+
+// IsJSONRequest reports whether the Content-Type of lambdaReq is JSON, meaning it should be read with GetJSONHeader
+// rather than GetHeaders.
+func IsJSONRequest(lambdaReq events.APIGatewayProxyRequest) bool {
+	return isJSONRequest(APIGatewayProxySource(lambdaReq))
+}
+
+func isJSONRequest(source RequestSource) bool {
+	mediaType, _, err := mime.ParseMediaType(source.Headers().Get("Content-Type"))
+
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// GetJSONHeader is GetHeaders for clients, such as single page apps, that upload a file as a JSON body of the form
+// {"filename": "report.pdf", "contentType": "application/pdf", "data": "<base64>"} instead of a multipart form.
+// data may also be a data URL, e.g. data:application/pdf;base64,<base64>, whose media type is used when
+// contentType is missing. The file is returned as a *multipart.FileHeader so it can be uploaded with UploadHeader
+// and friends. WithMaxSize, WithTempDir and filename normalization apply as they do to GetHeaders.
+func GetJSONHeader(lambdaReq events.APIGatewayProxyRequest, opts ...Option) (*multipart.FileHeader, error) {
+	return getJSONHeader(APIGatewayProxySource(lambdaReq), newOptions(opts))
+}
+
+func getJSONHeader(source RequestSource, o *options) (*multipart.FileHeader, error) {
+	body := []byte(source.Body())
+	if source.IsBase64() {
+		decodedBody, err := base64.StdEncoding.DecodeString(source.Body())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrReadingJSONBody, err)
+		}
+		body = decodedBody
+	}
+
+	var file jsonFile
+	if err := json.Unmarshal(body, &file); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrReadingJSONBody, err)
+	}
+
+	if file.Filename == "" {
+		return nil, fmt.Errorf("%w: filename is empty", ErrReadingJSONBody)
+	}
+
+	data, contentType, err := decodeBase64Data(file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrReadingJSONBody, err)
+	}
+
+	if file.ContentType != "" {
+		contentType = file.ContentType
+	}
+
+	return newFileHeader(file.Filename, contentType, data, o)
+}
+
+// decodeBase64Data decodes a file sent as a base64 string in a JSON or urlencoded body, returning the media type too if data is a data URL.
+// Padded and unpadded, standard and URL safe base64 are all accepted since clients vary.
+func decodeBase64Data(data string) ([]byte, string, error) {
+	var contentType string
+
+	if strings.HasPrefix(data, "data:") {
+		comma := strings.Index(data, ",")
+		if comma < 0 || !strings.HasSuffix(data[:comma], ";base64") {
+			return nil, "", errors.New("data URLs have to be base64 encoded")
+		}
+
+		contentType = strings.TrimSuffix(strings.TrimPrefix(data[:comma], "data:"), ";base64")
+		data = data[comma+1:]
+	}
+
+	data = strings.TrimRight(data, "=")
+	if strings.ContainsAny(data, "-_") {
+		decoded, err := base64.RawURLEncoding.DecodeString(data)
+		return decoded, contentType, err
+	}
+
+	decoded, err := base64.RawStdEncoding.DecodeString(data)
+
+	return decoded, contentType, err
+}
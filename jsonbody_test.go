@@ -0,0 +1,68 @@
+package lambda_s3
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+func generateJSONUploadReq(body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		Body:    body,
+	}
+}
+
+func TestGetJSONHeader(t *testing.T) {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString(fileBytes)
+
+	t.Run("verify IsJSONRequest recognizes JSON requests", func(t *testing.T) {
+		assert.True(t, IsJSONRequest(generateJSONUploadReq("{}")))
+		assert.False(t, IsJSONRequest(generateUploadFileReq()))
+	})
+	t.Run("verify err when the body is invalid", func(t *testing.T) {
+		for _, body := range []string{"", "[]", `{"data": "` + encoded + `"}`, `{"filename": "a.csv", "data": "!!!"}`} {
+			_, err := GetJSONHeader(generateJSONUploadReq(body))
+			assert.True(t, errors.Is(err, ErrReadingJSONBody))
+		}
+	})
+	t.Run("verify err when the file is larger than WithMaxSize", func(t *testing.T) {
+		_, err := GetJSONHeader(generateJSONUploadReq(`{"filename": "`+SampleFileName+`", "data": "`+encoded+`"}`), WithMaxSize(SampleFileSizeBytes-1))
+		assert.True(t, errors.Is(err, ErrFileTooLarge))
+	})
+	t.Run("verify GetJSONHeader works with correct inputs", func(t *testing.T) {
+		for _, body := range []string{
+			`{"filename": "` + SampleFileName + `", "contentType": "text/csv", "data": "` + encoded + `"}`,
+			`{"filename": "` + SampleFileName + `", "data": "data:text/csv;base64,` + encoded + `"}`,
+			`{"filename": "` + SampleFileName + `", "contentType": "text/csv", "data": "` + base64.RawURLEncoding.EncodeToString(fileBytes) + `"}`,
+		} {
+			fileHeader, err := GetJSONHeader(generateJSONUploadReq(body))
+			assert.Nil(t, err)
+			assert.Equal(t, SampleFileName, fileHeader.Filename)
+			assert.Equal(t, "text/csv", fileHeader.Header.Get("Content-Type"))
+			assert.Equal(t, int64(SampleFileSizeBytes), fileHeader.Size)
+
+			file, err := fileHeader.Open()
+			assert.Nil(t, err)
+
+			contents, err := io.ReadAll(file)
+			assert.Nil(t, err)
+			assert.Equal(t, string(fileBytes), string(contents))
+		}
+	})
+	t.Run("verify base64 encoded requests are decoded", func(t *testing.T) {
+		lambdaReq := generateJSONUploadReq(base64.StdEncoding.EncodeToString([]byte(`{"filename": "` + SampleFileName + `", "data": "` + encoded + `"}`)))
+		lambdaReq.IsBase64Encoded = true
+
+		fileHeader, err := GetJSONHeader(lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(SampleFileSizeBytes), fileHeader.Size)
+	})
+}
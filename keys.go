@@ -0,0 +1,191 @@
+package lambda_s3
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"mime/multipart"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxKeyAttempts is how many keys UploadHeaderAutoKey generates before giving up when used WithIfNoneMatch
+// and every generated key is already taken.
+const MaxKeyAttempts = 3
+
+var ErrGeneratingKey = errors.New("unable to generate an S3 key for the file")
+
+// KeyGenerator generates the S3 key a file is stored under. The generators in this package keep the extension of
+// the uploaded file, lowercased, so the key still hints at what's inside.
+type KeyGenerator func(fileHeader *multipart.FileHeader) (string, error)
+
+// UUIDKey generates keys from a random (version 4) UUID. e.g. 1b4e28ba-2fa1-41d2-883f-0016d3cca427.png
+func UUIDKey(fileHeader *multipart.FileHeader) (string, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	return uuid + extension(fileHeader), nil
+}
+
+// newUUID generates a random (version 4) UUID.
+func newUUID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrGeneratingKey, err)
+	}
+
+	id[6] = (id[6] & 0x0f) | 0x40 // version 4
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	encoded := hex.EncodeToString(id)
+
+	return strings.Join([]string{encoded[:8], encoded[8:12], encoded[12:16], encoded[16:20], encoded[20:]}, "-"), nil
+}
+
+// crockfordBase32 is the alphabet ULIDs are encoded with.
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDKey generates keys from a ULID. ULIDs start with the time they were generated at so keys sort by upload time
+// when listed. e.g. 01ARZ3NDEKTSV4RRFFQ69G5FAV.png
+func ULIDKey(fileHeader *multipart.FileHeader) (string, error) {
+	ulid, err := newULID()
+	if err != nil {
+		return "", err
+	}
+
+	return ulid + extension(fileHeader), nil
+}
+
+// newULID generates a ULID for the current time.
+func newULID() (string, error) {
+	id := make([]byte, 16)
+	// a 48 bit millisecond timestamp followed by 80 bits of randomness
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrGeneratingKey, err)
+	}
+
+	// 128 bits encode to 26 characters of 5 bits each. the first character only holds the top 3 bits
+	high := binary.BigEndian.Uint64(id[:8])
+	low := binary.BigEndian.Uint64(id[8:])
+	ulid := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		ulid[i] = crockfordBase32[low&0x1f]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+
+	return string(ulid), nil
+}
+
+// TimestampKey generates keys prefixed with the UTC time they were generated at followed by a random suffix so
+// files uploaded at the same moment don't collide. e.g. 20230117T150405.123456789Z-9f86d081.png
+func TimestampKey(fileHeader *multipart.FileHeader) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrGeneratingKey, err)
+	}
+
+	timestamp := time.Now().UTC().Format("20060102T150405.000000000Z")
+
+	return timestamp + "-" + hex.EncodeToString(suffix) + extension(fileHeader), nil
+}
+
+// ContentHashKey generates keys from the hex encoded SHA-256 digest of the file's contents so identical files
+// always get the same key. e.g. 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08.png
+func ContentHashKey(fileHeader *multipart.FileHeader) (string, error) {
+	file, err := OpenFileHeader(fileHeader)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrGeneratingKey, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = copyBuffer(hash, file, DefaultBufferSize); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrGeneratingKey, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)) + extension(fileHeader), nil
+}
+
+// WithPrefix returns a KeyGenerator that puts the keys generated by g under prefix. e.g. uploads/<key>
+func (g KeyGenerator) WithPrefix(prefix string) KeyGenerator {
+	return func(fileHeader *multipart.FileHeader) (string, error) {
+		key, err := g(fileHeader)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(prefix, key), nil
+	}
+}
+
+// KeyFunc adapts g to a KeyFunc so it can be used in a handler Config.
+func (g KeyGenerator) KeyFunc() KeyFunc {
+	return func(_ events.APIGatewayProxyRequest, fileHeader *multipart.FileHeader) (string, error) {
+		return g(fileHeader)
+	}
+}
+
+// extension is the lowercased extension of the uploaded file, including the dot, or "" if it has none.
+func extension(fileHeader *multipart.FileHeader) string {
+	return strings.ToLower(filepath.Ext(fileHeader.Filename))
+}
+
+// UploadHeaderAutoKey is UploadHeader for callers that don't want to name files themselves. The key is generated
+// by generator and returned in UploadRes.Key.
+// Used WithIfNoneMatch, keys that are already taken are detected and a new key is generated, up to MaxKeyAttempts
+// times, before ErrObjectAlreadyExists is returned. Without it a collision silently overwrites the existing object.
+func UploadHeaderAutoKey(fileHeader *multipart.FileHeader, region, bucket string, generator KeyGenerator, opts ...Option) (*UploadRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	if generator == nil {
+		return nil, fmt.Errorf("%w: generator is nil", ErrGeneratingKey)
+	}
+
+	o := newOptions(opts)
+
+	if err := fileTooLarge(fileHeader, o); err != nil {
+		return nil, err
+	}
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	uploader := s3manager.NewUploader(awsSession)
+
+	for attempt := 1; ; attempt++ {
+		name, err := generator(fileHeader)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("%w: generator returned an empty key", ErrGeneratingKey)
+		}
+
+		uploadRes, err := uploadHeader(uploader, fileHeader, bucket, name, o)
+		if errors.Is(err, ErrObjectAlreadyExists) && attempt < MaxKeyAttempts {
+			continue
+		}
+
+		return uploadRes, err
+	}
+}
@@ -0,0 +1,93 @@
+package lambda_s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestKeyGenerators(t *testing.T) {
+	fileHeader := generateFileHeader(t, "Photo.PNG", []byte("not really a png"))
+
+	t.Run("verify UUIDKey generates version 4 UUIDs", func(t *testing.T) {
+		key, err := UUIDKey(fileHeader)
+		assert.Nil(t, err)
+		assert.True(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\.png$`).MatchString(key))
+
+		otherKey, err := UUIDKey(fileHeader)
+		assert.Nil(t, err)
+		assert.NotEqual(t, key, otherKey)
+	})
+	t.Run("verify ULIDKey generates sortable ULIDs", func(t *testing.T) {
+		key, err := ULIDKey(fileHeader)
+		assert.Nil(t, err)
+		assert.True(t, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}\.png$`).MatchString(key))
+
+		otherKey, err := ULIDKey(fileHeader)
+		assert.Nil(t, err)
+		assert.NotEqual(t, key, otherKey)
+		assert.True(t, key[:10] <= otherKey[:10]) // the first 10 characters hold the timestamp
+	})
+	t.Run("verify TimestampKey generates keys prefixed with the time", func(t *testing.T) {
+		key, err := TimestampKey(fileHeader)
+		assert.Nil(t, err)
+		assert.True(t, regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}Z-[0-9a-f]{8}\.png$`).MatchString(key))
+	})
+	t.Run("verify ContentHashKey generates the SHA-256 digest of the file", func(t *testing.T) {
+		sum := sha256.Sum256([]byte("not really a png"))
+
+		key, err := ContentHashKey(fileHeader)
+		assert.Nil(t, err)
+		assert.Equal(t, hex.EncodeToString(sum[:])+".png", key)
+	})
+	t.Run("verify WithPrefix puts keys under the prefix", func(t *testing.T) {
+		key, err := KeyGenerator(UUIDKey).WithPrefix("uploads/")(fileHeader)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(key, "uploads/"))
+		assert.False(t, strings.HasPrefix(key, "uploads//"))
+	})
+	t.Run("verify keys have no extension when the file has none", func(t *testing.T) {
+		key, err := UUIDKey(generateFileHeader(t, "README", []byte("readme")))
+		assert.Nil(t, err)
+		assert.Equal(t, 36, len(key))
+	})
+}
+
+func TestUploadHeaderAutoKey(t *testing.T) {
+	fileHeader := generateFileHeader(t, SampleFileName, []byte("contents"))
+
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		uploadRes, err := UploadHeaderAutoKey(fileHeader, "", S3Bucket, UUIDKey)
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.Equal(t, ErrParameterRegionEmpty, err)
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		uploadRes, err := UploadHeaderAutoKey(fileHeader, Region, "", UUIDKey)
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.Equal(t, ErrParameterBucketEmpty, err)
+	})
+	t.Run("verify err when generator is nil", func(t *testing.T) {
+		uploadRes, err := UploadHeaderAutoKey(fileHeader, Region, S3Bucket, nil)
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.True(t, errors.Is(err, ErrGeneratingKey))
+	})
+	t.Run("verify UploadHeaderAutoKey uploads under the generated key", func(t *testing.T) {
+		fileBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		uploadRes, err := UploadHeaderAutoKey(generateFileHeader(t, SampleFileName, fileBytes), Region, S3Bucket, ULIDKey, WithIfNoneMatch())
+		assert.Nil(t, err)
+		assert.True(t, strings.HasSuffix(uploadRes.Key, ".csv"))
+
+		downloadedBytes, err := Download(Region, S3Bucket, uploadRes.Key)
+		assert.Nil(t, err)
+		assert.Equal(t, len(fileBytes), len(downloadedBytes))
+
+		assert.Nil(t, Delete(Region, S3Bucket, uploadRes.Key))
+	})
+}
@@ -0,0 +1,211 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"mime/multipart"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidKeyTemplate = errors.New("the key template is invalid")
+
+// keyTemplateVariables are the variables of a KeyTemplate that aren't followed by a name.
+var keyTemplateVariables = map[string]bool{
+	"filename":  true,
+	"name":      true,
+	"ext":       true,
+	"uuid":      true,
+	"ulid":      true,
+	"date":      true,
+	"year":      true,
+	"month":     true,
+	"day":       true,
+	"timestamp": true,
+	"userID":    true,
+	"requestID": true,
+}
+
+// keyTemplateNamespaces are the variables of a KeyTemplate that are followed by a name. e.g. {claim.tenant}
+var keyTemplateNamespaces = map[string]bool{
+	"claim":  true,
+	"path":   true,
+	"query":  true,
+	"header": true,
+}
+
+// KeyTemplate lays out the keys of uploaded files, e.g. "{userID}/{date}/{uuid}-{filename}", so every handler
+// doesn't build them by concatenating strings. Each {variable} is replaced by its value for the request and file:
+//
+//	{filename}   the name of the file as sent by the client, e.g. q3 report.PDF
+//	{name}       the name of the file without its extension, e.g. q3 report
+//	{ext}        the lowercased extension of the file including the dot, e.g. .pdf, or nothing if it has none
+//	{uuid}       a random UUID, like UUIDKey
+//	{ulid}       a ULID, like ULIDKey
+//	{date}       the UTC date of the upload, e.g. 2023-01-17
+//	{year}       the UTC year, month, and day of the upload, e.g. 2023, 01, and 17
+//	{month}
+//	{day}
+//	{timestamp}  the Unix time of the upload in seconds
+//	{userID}     the sub claim of the caller or, without one, their Cognito identity ID
+//	{requestID}  the API Gateway request ID
+//	{claim.X}    the claim X of the caller. See Claims
+//	{path.X}     the path parameter X
+//	{query.X}    the query string parameter X
+//	{header.X}   the header X, ignoring case
+//
+// Values other than {ext} can't be empty, and none can contain a slash or be . or .., so a variable can't add or
+// escape a "folder" of the layout. Keys with such a value are rejected with ErrInvalidKey.
+type KeyTemplate struct {
+	template string
+	parts    []keyTemplatePart
+}
+
+// keyTemplatePart is either literal text or a variable of a KeyTemplate.
+type keyTemplatePart struct {
+	literal  string
+	variable string
+}
+
+// ParseKeyTemplate parses template. Templates with unbalanced braces or unknown variables are rejected with
+// ErrInvalidKeyTemplate so mistakes are caught when the Lambda starts rather than when a file is uploaded.
+func ParseKeyTemplate(template string) (*KeyTemplate, error) {
+	keyTemplate := &KeyTemplate{template: template}
+
+	for rest := template; rest != ""; {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			keyTemplate.parts = append(keyTemplate.parts, keyTemplatePart{literal: rest})
+			break
+		}
+
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("%w: unexpected } in %s", ErrInvalidKeyTemplate, template)
+		}
+
+		if open > 0 {
+			keyTemplate.parts = append(keyTemplate.parts, keyTemplatePart{literal: rest[:open]})
+		}
+
+		variable, after, found := strings.Cut(rest[open+1:], "}")
+		if !found || strings.Contains(variable, "{") {
+			return nil, fmt.Errorf("%w: unclosed { in %s", ErrInvalidKeyTemplate, template)
+		}
+
+		if !isKeyTemplateVariable(variable) {
+			return nil, fmt.Errorf("%w: unknown variable {%s}", ErrInvalidKeyTemplate, variable)
+		}
+
+		keyTemplate.parts = append(keyTemplate.parts, keyTemplatePart{variable: variable})
+		rest = after
+	}
+
+	if len(keyTemplate.parts) == 0 {
+		return nil, fmt.Errorf("%w: the template is empty", ErrInvalidKeyTemplate)
+	}
+
+	return keyTemplate, nil
+}
+
+func isKeyTemplateVariable(variable string) bool {
+	if keyTemplateVariables[variable] {
+		return true
+	}
+
+	namespace, name, found := strings.Cut(variable, ".")
+
+	return found && name != "" && keyTemplateNamespaces[namespace]
+}
+
+// String returns the template t was parsed from.
+func (t *KeyTemplate) String() string {
+	return t.template
+}
+
+// Key fills in t for a file uploaded in lambdaReq.
+func (t *KeyTemplate) Key(lambdaReq events.APIGatewayProxyRequest, fileHeader *multipart.FileHeader) (string, error) {
+	uploadedAt := time.Now().UTC()
+
+	var key strings.Builder
+	for _, part := range t.parts {
+		if part.variable == "" {
+			key.WriteString(part.literal)
+			continue
+		}
+
+		value, err := keyTemplateValue(part.variable, lambdaReq, fileHeader, uploadedAt)
+		if err != nil {
+			return "", err
+		}
+
+		if value == "" && part.variable != "ext" || strings.Contains(value, "/") || value == "." || value == ".." {
+			return "", fmt.Errorf("%w: {%s} is %q", ErrInvalidKey, part.variable, value)
+		}
+
+		key.WriteString(value)
+	}
+
+	return key.String(), nil
+}
+
+// KeyFunc adapts t to a KeyFunc so it can be used in a handler Config.
+func (t *KeyTemplate) KeyFunc() KeyFunc {
+	return t.Key
+}
+
+// keyTemplateValue is the value of variable for a file uploaded in lambdaReq at uploadedAt.
+func keyTemplateValue(variable string, lambdaReq events.APIGatewayProxyRequest, fileHeader *multipart.FileHeader, uploadedAt time.Time) (string, error) {
+	switch variable {
+	case "filename":
+		return normalizeFilename(fileHeader), nil
+	case "name":
+		filename := normalizeFilename(fileHeader)
+		return strings.TrimSuffix(filename, path.Ext(filename)), nil
+	case "ext":
+		return strings.ToLower(path.Ext(normalizeFilename(fileHeader))), nil
+	case "uuid":
+		return newUUID()
+	case "ulid":
+		return newULID()
+	case "date":
+		return uploadedAt.Format("2006-01-02"), nil
+	case "year":
+		return uploadedAt.Format("2006"), nil
+	case "month":
+		return uploadedAt.Format("01"), nil
+	case "day":
+		return uploadedAt.Format("02"), nil
+	case "timestamp":
+		return strconv.FormatInt(uploadedAt.Unix(), 10), nil
+	case "userID":
+		if sub, ok := Claims(lambdaReq)["sub"]; ok {
+			return fmt.Sprint(sub), nil
+		}
+		return lambdaReq.RequestContext.Identity.CognitoIdentityID, nil
+	case "requestID":
+		return lambdaReq.RequestContext.RequestID, nil
+	}
+
+	namespace, name, _ := strings.Cut(variable, ".")
+	switch namespace {
+	case "claim":
+		if value, ok := Claims(lambdaReq)[name]; ok {
+			return fmt.Sprint(value), nil
+		}
+	case "path":
+		return lambdaReq.PathParameters[name], nil
+	case "query":
+		return lambdaReq.QueryStringParameters[name], nil
+	case "header":
+		for header, value := range lambdaReq.Headers {
+			if strings.EqualFold(header, name) {
+				return value, nil
+			}
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,68 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyTemplate(t *testing.T) {
+	lambdaReq := events.APIGatewayProxyRequest{
+		Headers:               map[string]string{"X-Tenant-ID": "acme"},
+		PathParameters:        map[string]string{"folder": "invoices"},
+		QueryStringParameters: map[string]string{"version": "2"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "c6af9ac6-7b61-11e6-9a41-93e8deadbeef",
+			Authorizer: map[string]interface{}{"claims": map[string]interface{}{"sub": "user-42", "org": "acme"}},
+		},
+	}
+
+	t.Run("verify templates with unbalanced braces or unknown variables are rejected", func(t *testing.T) {
+		for _, template := range []string{"", "{userID", "userID}", "{user{ID}}", "{owner}/{filename}", "{claim.}"} {
+			_, err := ParseKeyTemplate(template)
+			assert.True(t, errors.Is(err, ErrInvalidKeyTemplate))
+		}
+	})
+	t.Run("verify every variable is filled in from the request and file", func(t *testing.T) {
+		keyTemplate, err := ParseKeyTemplate("{header.x-tenant-id}/{claim.org}/{userID}/{path.folder}/v{query.version}/{name}{ext}")
+		assert.Nil(t, err)
+
+		key, err := keyTemplate.Key(lambdaReq, generateFileHeader(t, "Q3 Report.PDF", []byte("report")))
+		assert.Nil(t, err)
+		assert.Equal(t, "acme/acme/user-42/invoices/v2/Q3 Report.pdf", key)
+	})
+	t.Run("verify generated variables", func(t *testing.T) {
+		keyTemplate, err := ParseKeyTemplate("{year}/{month}/{day}/{date}-{timestamp}-{requestID}-{uuid}-{ulid}-{filename}")
+		assert.Nil(t, err)
+
+		key, err := keyTemplate.KeyFunc()(lambdaReq, generateFileHeader(t, SampleFileName, []byte("contents")))
+		assert.Nil(t, err)
+
+		now := time.Now().UTC()
+		assert.True(t, strings.HasPrefix(key, now.Format("2006/01/02/2006-01-02-")))
+		assert.True(t, regexp.MustCompile(`-[0-9]+-c6af9ac6-7b61-11e6-9a41-93e8deadbeef-[0-9a-f-]{36}-[0-9A-Z]{26}-`).MatchString(key))
+		assert.True(t, strings.HasSuffix(key, "-"+SampleFileName))
+	})
+	t.Run("verify values that are missing or would escape the layout are rejected", func(t *testing.T) {
+		keyTemplate, err := ParseKeyTemplate("{path.folder}/{filename}")
+		assert.Nil(t, err)
+
+		_, err = keyTemplate.Key(events.APIGatewayProxyRequest{}, generateFileHeader(t, SampleFileName, []byte("contents")))
+		assert.True(t, errors.Is(err, ErrInvalidKey))
+
+		_, err = keyTemplate.Key(events.APIGatewayProxyRequest{PathParameters: map[string]string{"folder": ".."}}, generateFileHeader(t, SampleFileName, []byte("contents")))
+		assert.True(t, errors.Is(err, ErrInvalidKey))
+	})
+	t.Run("verify files without an extension have an empty ext", func(t *testing.T) {
+		keyTemplate, err := ParseKeyTemplate("{uuid}{ext}")
+		assert.Nil(t, err)
+
+		key, err := keyTemplate.Key(lambdaReq, generateFileHeader(t, "README", []byte("contents")))
+		assert.Nil(t, err)
+		assert.Equal(t, 36, len(key))
+	})
+}
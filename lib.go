@@ -8,10 +8,13 @@ package lambda_s3
 import (
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"io"
 	"mime"
@@ -19,6 +22,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 var (
@@ -26,33 +30,45 @@ var (
 	ErrContentTypeHeaderMissing   = errors.New("request contained no Content-Type header")
 	ErrDownloadingS3File          = errors.New("unable to download the given file from S3")
 	ErrEmptyFileDownloaded        = errors.New("the provided S3 file to download is empty")
+	ErrFileTooLarge               = errors.New("file exceeds the maximum allowed size")
+	ErrFormTooLarge               = errors.New("multipart form exceeds the maximum allowed total size")
 	ErrNewAWSSession              = errors.New("error creating new AWS Session")
+	ErrNotModified                = errors.New("the S3 object has not been modified")
+	ErrObjectAlreadyExists        = errors.New("an S3 object with the given name already exists")
+	ErrObjectNotFound             = errors.New("the requested S3 object does not exist")
+	ErrObjectTooLarge             = errors.New("S3 object exceeds the maximum allowed download size")
 	ErrOpeningMultiPartFile       = errors.New("unable to open *multipart.FileHeader")
 	ErrParameterBucketEmpty       = errors.New("required parameter bucket is empty")
 	ErrParameterNameEmpty         = errors.New("required parameter name is empty")
 	ErrParameterRegionEmpty       = errors.New("required parameter region is empty")
 	ErrParsingMediaType           = errors.New("error parsing media type from Content-Type header. Make sure your request is formatted correctly")
-	ErrReadingMultiPartFile       = errors.New("unable to read *multipart.FileHeader")
 	ErrReadingMultiPartForm       = errors.New("reading of multipart form failed. verify input size is <= maxFileSizeBytes")
 	ErrUploadingMultiPartFileToS3 = errors.New("unable to upload *multipart.FileHeader bytes to S3")
 )
 
-func Delete(region, bucket, name string) error {
-	if region == "" {
+// ErrReadingMultiPartFile was returned when an uploaded file could be opened but not read.
+//
+// Deprecated: files are streamed to S3 instead of being read up front so this is no longer returned. A file that
+// can't be opened fails with ErrOpeningMultiPartFile and one that can't be read fails the upload.
+var ErrReadingMultiPartFile = errors.New("unable to read *multipart.FileHeader")
+
+// Delete deletes the file called name from bucket. Use WithWait to return only once the object is gone.
+func Delete(region, bucket, name string, opts ...Option) error {
+	if region == "" && !detectsBucketRegion(opts) {
 		return ErrParameterRegionEmpty
 	}
 
-	if bucket == "" {
-		return ErrParameterBucketEmpty
+	if err := validateBucket(bucket); err != nil {
+		return err
 	}
 
 	if name == "" {
 		return ErrParameterNameEmpty
 	}
 
-	awsSession, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
 	if err != nil {
 		return ErrNewAWSSession
 	}
@@ -70,71 +86,379 @@ func Delete(region, bucket, name string) error {
 		},
 	}
 
-	return batcher.Delete(aws.BackgroundContext(), &s3manager.DeleteObjectsIterator{Objects: objects})
+	spanOptions, done := o.instrument(OperationDelete, bucket, name)
+
+	err = batcher.Delete(spanOptions.context(), &s3manager.DeleteObjectsIterator{Objects: objects})
+	if err != nil {
+		done(0, fmt.Errorf("%w: %s", ErrDeletingS3Object, err))
+		return err
+	}
+	done(0, nil)
+
+	if o.waitTimeout > 0 {
+		if err = waitUntilNotExists(s3.New(awsSession), bucket, name, o.waitTimeout); err != nil {
+			return err
+		}
+	}
+
+	return invalidate(name, o)
+}
+
+// DeleteRes reports what DeleteChecked did. Existed is whether the object existed before the call. Deleted is
+// whether the call removed it, which is never the case for a dry run. On versioned buckets a delete only adds a
+// delete marker, whose version is DeleteMarkerVersionID, and the object's previous versions are kept.
+type DeleteRes struct {
+	Existed               bool   `json:"existed"`
+	Deleted               bool   `json:"deleted"`
+	DryRun                bool   `json:"dryRun,omitempty"`
+	DeleteMarkerVersionID string `json:"deleteMarkerVersionID,omitempty"`
+}
+
+// DeleteChecked is Delete for callers that need to know whether anything was actually removed. S3 deletes succeed
+// whether or not the object exists so the object is looked up with HeadObject first.
+// WithDryRun makes it only look the object up. That shows the object exists and the caller can read it but,
+// since S3 has no way to check a delete is allowed without deleting, not that the caller is allowed to delete it.
+func DeleteChecked(region, bucket, name string, opts ...Option) (*DeleteRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		return nil, ErrParameterNameEmpty
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	s3Client := s3.New(awsSession)
+
+	existed, err := objectExists(s3Client, bucket, name)
+	if err != nil {
+		return nil, ErrHeadingS3Object
+	}
+
+	deleteRes := &DeleteRes{Existed: existed, DryRun: o.dryRun}
+	if o.dryRun || !existed {
+		return deleteRes, nil
+	}
+
+	spanOptions, done := o.instrument(OperationDelete, bucket, name)
+
+	deleteOutput, err := s3Client.DeleteObjectWithContext(spanOptions.context(), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		done(0, ErrDeletingS3Object)
+		return nil, ErrDeletingS3Object
+	}
+	done(0, nil)
+
+	deleteRes.Deleted = true
+	if aws.BoolValue(deleteOutput.DeleteMarker) {
+		deleteRes.DeleteMarkerVersionID = aws.StringValue(deleteOutput.VersionId)
+	}
+
+	if o.waitTimeout > 0 {
+		if err = waitUntilNotExists(s3Client, bucket, name, o.waitTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = invalidate(name, o); err != nil {
+		return deleteRes, err
+	}
+
+	return deleteRes, nil
 }
 
 // Download accepts an AWS Region, the name of an S3 bucket, and the key or name of a file to download.
 // It will create a new AWS Session in the specified region and proceed to try to download the file.
 // All three parameters, region, bucket, and name are required.
 // If the download is successful, it will return a byte array containing the bytes for the file.
-func Download(region, bucket, name string) ([]byte, error) {
-	if region == "" {
+// Use WithFallback to retry the download against a replica of the bucket when S3 fails.
+func Download(region, bucket, name string, opts ...Option) ([]byte, error) {
+	if region == "" && !detectsBucketRegion(opts) {
 		return nil, ErrParameterRegionEmpty
 	}
 
-	if bucket == "" {
-		return nil, ErrParameterBucketEmpty
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
 	}
 
 	if name == "" {
 		return nil, ErrParameterNameEmpty
 	}
 
-	awsSession, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+	o := newOptions(opts)
+
+	fileBytes, err := downloadFrom(region, bucket, name, o)
+	if err != nil && o.fallbackBucket != "" && shouldFallBack(err) {
+		return downloadFrom(o.fallbackRegion, o.fallbackBucket, name, o)
+	}
+
+	return fileBytes, err
+}
+
+// downloadFrom is Download from bucket in region once the parameters are validated.
+func downloadFrom(region, bucket, name string, o *options) ([]byte, error) {
+	awsSession, err := o.newBucketSession(region, bucket)
 	if err != nil {
 		return nil, ErrNewAWSSession
 	}
 
 	downloader := s3manager.NewDownloader(awsSession)
 
+	if o.cache != nil {
+		return o.cache.download(downloader, bucket, name, o)
+	}
+
+	return download(downloader, bucket, name, o)
+}
+
+// shouldFallBack reports whether a download that failed with err should be retried WithFallback: when S3 or the
+// connection to it failed, or the object is corrupt, but not when the request itself was the problem, the object is
+// empty or there's no time left to retry.
+func shouldFallBack(err error) bool {
+	for _, retryableErr := range []error{ErrDownloadingS3File, ErrNewAWSSession, ErrChecksumMismatch} {
+		if errors.Is(err, retryableErr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// download does the actual work for Download once the parameters are validated so batch helpers
+// can share a single *s3manager.Downloader across many keys.
+func download(downloader *s3manager.Downloader, bucket, name string, o *options) ([]byte, error) {
+	fileBytes, _, err := downloadWithHeaders(downloader, bucket, name, o)
+	return fileBytes, err
+}
+
+// downloadWithHeaders is download but also returns the headers of the S3 response for callers that need the
+// object's metadata without making a separate HeadObject request.
+func downloadWithHeaders(downloader *s3manager.Downloader, bucket, name string, o *options) ([]byte, http.Header, error) {
+	spanOptions, done := o.instrument(OperationDownload, bucket, name)
+
+	fileBytes, headers, err := downloadObject(downloader, bucket, name, spanOptions)
+	done(int64(len(fileBytes)), err)
+
+	return fileBytes, headers, err
+}
+
+// downloadObject is downloadWithHeaders without the metrics and tracing.
+func downloadObject(downloader *s3manager.Downloader, bucket, name string, o *options) ([]byte, http.Header, error) {
 	var fileBytes []byte
 	writeAtBuffer := aws.NewWriteAtBuffer(fileBytes)
+	// without room to grow into the buffer is reallocated and copied on every write of every part
+	writeAtBuffer.GrowthCoeff = 2
 
 	getObjectInput := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(name),
 	}
 
+	if o.knownETag != "" {
+		getObjectInput.IfNoneMatch = aws.String(o.knownETag)
+	}
+
+	if !o.ifModifiedSince.IsZero() {
+		getObjectInput.IfModifiedSince = aws.Time(o.ifModifiedSince)
+	}
+
+	var responseHeaders responseHeaderRecorder
+
+	ctx, cancel, err := o.transferContext()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cancel()
+
+	if err = o.transfers.acquire(ctx); err != nil {
+		if o.deadlineExceeded(ctx) {
+			return nil, nil, ErrDeadlineTooClose
+		}
+		return nil, nil, ErrDownloadingS3File
+	}
+	defer o.transfers.release()
+
+	var size int64
+	if o.parallelDownload || o.maxDownloadBytes > 0 {
+		size, err = headForDownload(ctx, downloader.S3, getObjectInput)
+		if err != nil {
+			if o.deadlineExceeded(ctx) {
+				return nil, nil, ErrDeadlineTooClose
+			}
+			if isNotModified(err) {
+				return nil, nil, ErrNotModified
+			}
+			return nil, nil, ErrDownloadingS3File
+		}
+
+		if o.maxDownloadBytes > 0 && size > o.maxDownloadBytes {
+			return nil, nil, fmt.Errorf("%w: %s is %d bytes", ErrObjectTooLarge, name, size)
+		}
+
+		// the parts are written straight into place instead of growing the buffer as they arrive
+		writeAtBuffer = aws.NewWriteAtBuffer(make([]byte, size))
+	}
+
 	// functional options pattern
-	bytesDownloaded, err := downloader.Download(writeAtBuffer, getObjectInput, func(downloader *s3manager.Downloader) {
-		downloader.Concurrency = 0
-	})
+	bytesDownloaded, err := downloader.DownloadWithContext(ctx, writeAtBuffer, getObjectInput, o.configureDownloader(size), s3manager.WithDownloaderRequestOptions(responseHeaders.record))
+	if err != nil {
+		if o.deadlineExceeded(ctx) {
+			return nil, nil, ErrDeadlineTooClose
+		}
+		if isNotModified(err) {
+			return nil, nil, ErrNotModified
+		}
+		return nil, nil, ErrDownloadingS3File
+	}
+
+	if bytesDownloaded == 0 && !o.allowEmpty {
+		return nil, nil, ErrEmptyFileDownloaded
+	}
+
+	fileBytes = writeAtBuffer.Bytes()[:bytesDownloaded]
+	if fileBytes == nil {
+		fileBytes = []byte{} // empty objects downloaded WithAllowEmpty are still non-nil
+	}
+
+	if o.kmsKeyID != "" && isEncrypted(responseHeaders.all()) {
+		fileBytes, err = decrypt(ctx, o.awsSession, fileBytes, responseHeaders.all())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if o.gzip && strings.EqualFold(responseHeaders.get("Content-Encoding"), "gzip") {
+		fileBytes, err = gunzip(fileBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if o.checksum {
+		err = verifyChecksum(fileBytes, responseHeaders.get(checksumMetadataHeader))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(o.downloadTransformers) > 0 {
+		fileBytes, err = transformBytes(fileBytes, o.downloadTransformers)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return fileBytes, responseHeaders.all(), nil
+}
+
+// DownloadIfChanged is Download for callers that keep a copy of the file around, such as a warm Lambda container
+// caching configuration files. knownETag is the ETag of the copy the caller already has. If the object in S3 still
+// has that ETag it isn't downloaded again and ErrNotModified is returned. Otherwise the file is downloaded and
+// returned along with its new ETag. An empty knownETag always downloads the file.
+func DownloadIfChanged(region, bucket, name, knownETag string, opts ...Option) ([]byte, string, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, "", ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, "", err
+	}
+
+	if name == "" {
+		return nil, "", ErrParameterNameEmpty
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
 	if err != nil {
-		return nil, ErrDownloadingS3File
+		return nil, "", ErrNewAWSSession
 	}
 
-	if bytesDownloaded == 0 {
-		return nil, ErrEmptyFileDownloaded
+	o.knownETag = knownETag
+
+	fileBytes, headers, err := downloadWithHeaders(s3manager.NewDownloader(awsSession), bucket, name, o)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return writeAtBuffer.Bytes(), nil
+	return fileBytes, headers.Get("ETag"), nil
+}
+
+// responseHeaderRecorder remembers the headers of the responses to the requests it's attached to.
+// s3manager.Downloader only returns the object's bytes so this is how we find out about its metadata.
+type responseHeaderRecorder struct {
+	mutex   sync.Mutex
+	headers http.Header
+}
+
+func (r *responseHeaderRecorder) record(req *request.Request) {
+	req.Handlers.Complete.PushBack(func(req *request.Request) {
+		if req.HTTPResponse == nil {
+			return
+		}
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.headers = req.HTTPResponse.Header
+	})
+}
+
+func (r *responseHeaderRecorder) get(header string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.headers.Get(header)
+}
+
+func (r *responseHeaderRecorder) all() http.Header {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.headers.Clone()
 }
 
 // GetHeaders accepts a lambda request directly from AWS Lambda after it has been proxied through
 // API Gateway. It returns an array of *multipart.FileHeader values. One for each file uploaded to Lambda.
-func GetHeaders(lambdaReq events.APIGatewayProxyRequest, maxFileSizeBytes int64) ([]*multipart.FileHeader, error) {
-	//parse the lambda body
-	// workaround for case-sensitive headers. thanks AWS!
-	// https://github.com/aws/aws-lambda-go/issues/117
-	headers := http.Header{}
-
-	for header, values := range lambdaReq.Headers {
-		headers.Add(header, values)
+// maxFileSizeBytes is how much of the form is held in memory. The rest is spilled to temporary files, in the directory
+// passed WithTempDir or os.TempDir, which are only removed when the process exits. Warm Lambdas handling many
+// uploads should use GetForm instead so they can remove them as soon as the files are uploaded.
+// Filenames are decoded and normalized so they're safe to use as keys. See normalizeFilename.
+// Parts sent with a base64 or quoted-printable Content-Transfer-Encoding are decoded.
+// WithMaxSize and WithMaxTotalSize limit the size of each file and of the whole form. They're checked before the form
+// is read, so nothing is spilled to disk for rejected forms, and violations return ErrFileTooLarge or ErrFormTooLarge
+// naming the offending file.
+func GetHeaders(lambdaReq events.APIGatewayProxyRequest, maxFileSizeBytes int64, opts ...Option) ([]*multipart.FileHeader, error) {
+	form, err := GetForm(lambdaReq, maxFileSizeBytes, opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	contentType := headers.Get("Content-Type")
+	return FormFiles(form), nil
+}
+
+// GetForm is GetHeaders for callers that need the whole *multipart.Form, including its non file values. Call
+// RemoveForm once its files have been uploaded to delete any temporary files it spilled to disk, otherwise they're
+// left in /tmp for the life of the container.
+func GetForm(lambdaReq events.APIGatewayProxyRequest, maxFileSizeBytes int64, opts ...Option) (*multipart.Form, error) {
+	return getForm(APIGatewayProxySource(lambdaReq), maxFileSizeBytes, newOptions(opts))
+}
+
+func getForm(source RequestSource, maxFileSizeBytes int64, o *options) (*multipart.Form, error) {
+	contentType := source.Headers().Get("Content-Type")
 	if contentType == "" {
 		return nil, ErrContentTypeHeaderMissing
 	}
@@ -149,82 +473,596 @@ func GetHeaders(lambdaReq events.APIGatewayProxyRequest, maxFileSizeBytes int64)
 		return nil, ErrBoundaryValueMissing
 	}
 
-	var readerImpl io.Reader
-	stringReader := strings.NewReader(lambdaReq.Body) // default to a string reader to read the body contents
-	readerImpl = stringReader
-	if lambdaReq.IsBase64Encoded {
-		b64Reader := base64.NewDecoder(base64.StdEncoding, stringReader) // if the lambda isBase64Encoded then we need the base64 decoder
-		readerImpl = b64Reader
+	hasEncodedParts, err := scanForm(multipart.NewReader(requestBody(source), boundary), o)
+	if err != nil {
+		return nil, err
 	}
 
-	multipartReader := multipart.NewReader(readerImpl, boundary)
+	body := requestBody(source)
+	if hasEncodedParts {
+		decodedBody, decodedBoundary := decodeParts(multipart.NewReader(body, boundary), boundary)
+		defer decodedBody.Close() // stops the decoding goroutine if ReadForm gives up early
 
-	form, err := multipartReader.ReadForm(maxFileSizeBytes)
+		body, boundary = decodedBody, decodedBoundary
+	}
+
+	form, err := readForm(multipart.NewReader(body, boundary), maxFileSizeBytes, o)
 	if err != nil {
 		return nil, ErrReadingMultiPartForm
 	}
 
+	for _, fileHeaders := range form.File {
+		for _, fileHeader := range fileHeaders {
+			fileHeader.Filename = normalizeFilename(fileHeader)
+		}
+	}
+
+	return form, nil
+}
+
+// FormFiles returns the first file uploaded under each field of form.
+func FormFiles(form *multipart.Form) []*multipart.FileHeader {
 	var files []*multipart.FileHeader
 
 	for currentFileName := range form.File {
 		files = append(files, form.File[currentFileName][0])
 	}
 
-	return files, nil
+	return files
+}
+
+// requestBody reads the body of source, decoding it if it's base64 encoded.
+func requestBody(source RequestSource) io.Reader {
+	stringReader := strings.NewReader(source.Body()) // default to a string reader to read the body contents
+	if source.IsBase64() {
+		return base64.NewDecoder(base64.StdEncoding, stringReader) // if the lambda isBase64Encoded then we need the base64 decoder
+	}
+
+	return stringReader
+}
+
+// scanForm reads through the form counting the size of each part so limits are enforced without the form being
+// stored anywhere. It reports whether any part has a Content-Transfer-Encoding that has to be decoded.
+func scanForm(multipartReader *multipart.Reader, o *options) (bool, error) {
+	var totalSize int64
+	var hasEncodedParts bool
+
+	for {
+		part, err := multipartReader.NextPart()
+		if err == io.EOF {
+			return hasEncodedParts, nil
+		}
+		if err != nil {
+			return false, ErrReadingMultiPartForm
+		}
+
+		if isBase64Part(part) {
+			hasEncodedParts = true
+		}
+
+		partSize, err := io.Copy(io.Discard, partReader(part))
+		if err != nil {
+			return false, ErrReadingMultiPartForm
+		}
+
+		totalSize += partSize
+
+		if o.maxSizeBytes > 0 && part.FileName() != "" && partSize > o.maxSizeBytes {
+			return false, fmt.Errorf("%w: %s is larger than %d bytes", ErrFileTooLarge, part.FileName(), o.maxSizeBytes)
+		}
+
+		if o.maxTotalSizeBytes > 0 && totalSize > o.maxTotalSizeBytes {
+			return false, fmt.Errorf("%w: the form is larger than %d bytes at %s", ErrFormTooLarge, o.maxTotalSizeBytes, partName(part))
+		}
+	}
+}
+
+// isBase64Part reports whether the body of part is base64 encoded. multipart.Reader already decodes quoted-printable
+// parts but leaves base64 ones alone.
+func isBase64Part(part *multipart.Part) bool {
+	return strings.EqualFold(strings.TrimSpace(part.Header.Get("Content-Transfer-Encoding")), "base64")
+}
+
+// partReader reads the decoded body of part.
+func partReader(part *multipart.Part) io.Reader {
+	if isBase64Part(part) {
+		return base64.NewDecoder(base64.StdEncoding, part) // skips the line breaks base64 bodies are usually wrapped with
+	}
+
+	return part
+}
+
+// decodeParts rewrites the form read by multipartReader with every part decoded, as it's read, so ReadForm stores the
+// decoded bytes. It returns the rewritten form and its boundary.
+func decodeParts(multipartReader *multipart.Reader, boundary string) (io.ReadCloser, string) {
+	pipeReader, pipeWriter := io.Pipe()
+
+	multipartWriter := multipart.NewWriter(pipeWriter)
+	_ = multipartWriter.SetBoundary(boundary) // keeps the random boundary NewWriter picked if boundary isn't allowed
+
+	go func() {
+		for {
+			part, err := multipartReader.NextPart()
+			if err == io.EOF {
+				pipeWriter.CloseWithError(multipartWriter.Close())
+				return
+			}
+			if err != nil {
+				pipeWriter.CloseWithError(err)
+				return
+			}
+
+			body := partReader(part)
+			part.Header.Del("Content-Transfer-Encoding")
+
+			partWriter, err := multipartWriter.CreatePart(part.Header)
+			if err == nil {
+				_, err = copyBuffer(partWriter, body, DefaultBufferSize)
+			}
+			if err != nil {
+				pipeWriter.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return pipeReader, multipartWriter.Boundary()
+}
+
+// partName identifies part in error messages by its file name or, for fields, its form name.
+func partName(part *multipart.Part) string {
+	if part.FileName() != "" {
+		return part.FileName()
+	}
+
+	return part.FormName()
+}
+
+// fileTooLarge returns ErrFileTooLarge, naming the file, when fileHeader is larger than WithMaxSize allows.
+func fileTooLarge(fileHeader *multipart.FileHeader, o *options) error {
+	if o.maxSizeBytes > 0 && fileHeader.Size > o.maxSizeBytes {
+		return fmt.Errorf("%w: %s is larger than %d bytes", ErrFileTooLarge, fileHeader.Filename, o.maxSizeBytes)
+	}
+
+	return nil
+}
+
+// requestHeaders merges Headers and MultiValueHeaders from lambdaReq into a single http.Header.
+func requestHeaders(lambdaReq events.APIGatewayProxyRequest) http.Header {
+	return APIGatewayProxySource(lambdaReq).Headers()
+}
+
+// isNotFound reports whether err is an S3 error for a missing object. GetObject reports NoSuchKey
+// while HeadObject, which has no response body, can only report a bare 404.
+func isNotFound(err error) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) {
+		return requestFailure.StatusCode() == http.StatusNotFound
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound"
+	}
+
+	return false
 }
 
+// isNoSuchUpload reports whether err is S3 reporting that a multipart upload doesn't exist, or no longer does.
+func isNoSuchUpload(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == s3.ErrCodeNoSuchUpload
+	}
+
+	return false
+}
+
+// isNotModified reports whether err is S3 answering a conditional GET with 304 Not Modified.
+func isNotModified(err error) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) {
+		return requestFailure.StatusCode() == http.StatusNotModified
+	}
+
+	return false
+}
+
+// isPreconditionFailed reports whether err is S3 rejecting a conditional request.
+func isPreconditionFailed(err error) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) {
+		return requestFailure.StatusCode() == http.StatusPreconditionFailed
+	}
+
+	return false
+}
+
+// objectExists checks whether bucket contains an object called name with a HeadObject request.
+func objectExists(s3Client s3iface.S3API, bucket, name string) (bool, error) {
+	_, err := s3Client.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// objectClient validates the parameters shared by the helpers that read and update a single object's settings and
+// creates the S3 client they use.
+func objectClient(region, bucket, name string, opts []Option) (*s3.S3, *options, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, nil, err
+	}
+
+	if name == "" {
+		return nil, nil, ErrParameterNameEmpty
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, nil, ErrNewAWSSession
+	}
+
+	return s3.New(awsSession), o, nil
+}
+
+// setIfNoneMatchHeader makes the requests that create an object fail if the object already exists.
+// The SDK has no field for If-None-Match on writes so the header is set by hand.
+func setIfNoneMatchHeader(r *request.Request) {
+	switch r.Operation.Name {
+	case "PutObject", "CompleteMultipartUpload":
+		r.HTTPRequest.Header.Set("If-None-Match", "*")
+	}
+}
+
+// setRequesterPaysHeader sets RequestPayer=requester on every S3 request. It's added to the session's handlers
+// rather than to each input so GetObject, PutObject, HeadObject, and the multipart upload requests made by s3manager
+// all carry it.
+func setRequesterPaysHeader(r *request.Request) {
+	if r.ClientInfo.ServiceName == s3.ServiceName {
+		r.HTTPRequest.Header.Set("X-Amz-Request-Payer", s3.RequestPayerRequester)
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UploadRes describes a file successfully uploaded to S3 under Key. ETag and VersionID are copied from the S3 response
+// (VersionID is only set for versioned buckets) while BytesUploaded and ContentType come from the uploaded file header.
 type UploadRes struct {
-	S3Path string
-	S3URL  string
+	Key           string
+	S3Path        string
+	S3URL         string
+	ETag          string
+	VersionID     string
+	BytesUploaded int64
+	ContentType   string
+	// ChecksumSHA256 is the hex encoded SHA-256 digest of the file. Only set when uploading WithChecksum.
+	ChecksumSHA256 string
+	// Deduplicated is set by UploadContentAddressed when an identical file was already stored and nothing was uploaded.
+	Deduplicated bool
+	// PresignedURL is a presigned GET URL for the uploaded version of the object. Only set when uploading
+	// WithPresignedResult.
+	PresignedURL string
+	// Variants are the resized copies of the image that were uploaded alongside it. Only set when uploading an image
+	// WithThumbnails.
+	Variants []*UploadRes
 }
 
 // UploadHeader takes a single *multipart.FileHeader from the Lambda request and uploads it to S3.
-// It the upload is successful it returns the full path to the file in S3 as well as the URL for web access in UploadRes.
-func UploadHeader(fileHeader *multipart.FileHeader, region, bucket, name string) (*UploadRes, error) {
-	if region == "" {
+// It the upload is successful it returns the full path to the file in S3 as well as the URL for web access in UploadRes
+// along with enough metadata about the object that callers can store a complete record without calling HeadObject.
+//
+// The file is streamed to S3 and never copied into an intermediate buffer. The multipart.File behind the header
+// implements io.ReaderAt and io.Seeker so s3manager reads each part directly from it: small files are sent from the
+// memory ReadForm already allocated for them and files ReadForm spilled to disk are read from disk part by part.
+// Use WithMaxSize to reject files over a given size before the upload starts.
+func UploadHeader(fileHeader *multipart.FileHeader, region, bucket, name string, opts ...Option) (*UploadRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
 		return nil, ErrParameterRegionEmpty
 	}
 
-	if bucket == "" {
-		return nil, ErrParameterBucketEmpty
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
 	}
 
 	if name == "" {
 		return nil, ErrParameterNameEmpty
 	}
 
-	file, err := fileHeader.Open()
-	if err != nil {
-		return nil, ErrOpeningMultiPartFile
-	}
+	o := newOptions(opts)
 
-	var fileContents []byte
-	_, err = file.Read(fileContents)
-	if err != nil {
-		return nil, ErrReadingMultiPartFile
+	if err := fileTooLarge(fileHeader, o); err != nil {
+		return nil, err
 	}
 
 	// https://stackoverflow.com/q/47621804/584947
-	awsSession, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+	awsSession, err := o.newBucketSession(region, bucket)
 	if err != nil {
 		return nil, ErrNewAWSSession
 	}
 
-	uploader := s3manager.NewUploader(awsSession)
+	return uploadHeader(s3manager.NewUploader(awsSession), fileHeader, bucket, name, o)
+}
+
+// uploadHeader opens fileHeader and uploads it.
+func uploadHeader(uploader *s3manager.Uploader, fileHeader *multipart.FileHeader, bucket, name string, o *options) (*UploadRes, error) {
+	file, err := OpenFileHeader(fileHeader)
+	if err != nil {
+		return nil, ErrOpeningMultiPartFile
+	}
+	defer file.Close()
+
+	uploadRes, err := upload(uploader, bucket, name, file, fileHeader.Header.Get("Content-Type"), fileHeader.Size, o)
+	if err != nil || len(o.thumbnails) == 0 {
+		return uploadRes, err
+	}
+
+	uploadRes.Variants, err = uploadThumbnails(uploader, file, bucket, name, o)
+
+	return uploadRes, err
+}
 
-	uploadOutput, err := uploader.Upload(&s3manager.UploadInput{
+// upload does the actual work for UploadHeader once the parameters are validated so batch helpers
+// can share a single *s3manager.Uploader across many files.
+func upload(uploader *s3manager.Uploader, bucket, name string, body io.Reader, contentType string, size int64, o *options) (*UploadRes, error) {
+	spanOptions, done := o.instrument(OperationUpload, bucket, name)
+
+	uploadRes, err := uploadObject(uploader, bucket, name, body, contentType, size, spanOptions)
+
+	var bytesUploaded int64
+	if uploadRes != nil {
+		bytesUploaded = uploadRes.BytesUploaded
+	}
+	done(bytesUploaded, err)
+
+	return uploadRes, err
+}
+
+// uploadObject is upload without the metrics and tracing.
+func uploadObject(uploader *s3manager.Uploader, bucket, name string, body io.Reader, contentType string, size int64, o *options) (*UploadRes, error) {
+	uploadInput := &s3manager.UploadInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(name),
-		Body:   file,
-	})
+		Body:   body,
+	}
+
+	if contentType != "" {
+		uploadInput.ContentType = aws.String(contentType)
+	}
+
+	if o.cacheControl != "" {
+		uploadInput.CacheControl = aws.String(o.cacheControl)
+	}
+
+	if o.contentDisposition != "" {
+		uploadInput.ContentDisposition = aws.String(o.contentDisposition)
+	}
+
+	if o.contentLanguage != "" {
+		uploadInput.ContentLanguage = aws.String(o.contentLanguage)
+	}
+
+	if !o.expires.IsZero() {
+		uploadInput.Expires = aws.Time(o.expires)
+	}
+
+	if o.expiry > 0 {
+		uploadInput.Tagging = aws.String(expiryTagging(o.expiry))
+	}
+
+	if o.cannedACL != "" {
+		if err := o.cannedACL.validate(); err != nil {
+			return nil, err
+		}
+
+		uploadInput.ACL = aws.String(string(o.cannedACL))
+	}
+
+	if o.retention != nil {
+		if err := o.retention.validate(); err != nil {
+			return nil, err
+		}
+
+		// S3 needs a Content-MD5 to lock objects which the SDK adds for the seekable parts s3manager sends
+		uploadInput.ObjectLockMode = aws.String(string(o.retention.Mode))
+		uploadInput.ObjectLockRetainUntilDate = aws.Time(o.retention.RetainUntil)
+	}
+
+	if o.legalHold {
+		uploadInput.ObjectLockLegalHoldStatus = aws.String(s3.ObjectLockLegalHoldStatusOn)
+	}
+
+	var scanning *scanningReader
+	if o.scanner != nil {
+		scanning = newScanningReader(body, o.scanner)
+		defer scanning.Close()
+
+		body = scanning
+		uploadInput.Body = body
+	}
+
+	if len(o.uploadTransformers) > 0 {
+		transformedBody, closeTransformers, err := applyTransformers(body, o.uploadTransformers)
+		if err != nil {
+			return nil, err
+		}
+		defer closeTransformers()
+
+		body = transformedBody
+		uploadInput.Body = body
+	}
+
+	var checksum *sha256Reader
+	if o.checksum {
+		// the checksum is stored with the object so it has to be known before the upload starts
+		checksum = newSHA256Reader(body)
+
+		seeker, ok := body.(io.ReadSeeker)
+		if ok {
+			if err := checksum.precompute(seeker, o.bufferSize); err != nil {
+				return nil, ErrUploadingMultiPartFileToS3
+			}
+		} else {
+			// scanned and transformed bodies can't be rewound so they're hashed into a file the upload is sent from
+			spooled, cleanup, err := checksum.spool(body, o.tempDir, o.bufferSize)
+			defer cleanup()
+			if err != nil {
+				if scanning != nil && scanning.rejected() != nil {
+					return nil, scanning.rejected()
+				}
+				return nil, ErrUploadingMultiPartFileToS3
+			}
+
+			seeker = spooled
+		}
+
+		uploadInput.Metadata = map[string]*string{checksumMetadataKey: aws.String(checksum.hexSum())}
+		uploadInput.Body = seeker
+		if !o.gzip && o.kmsKeyID == "" { // S3 verifies this for single part uploads but it has to match the bytes sent
+			uploadInput.ChecksumSHA256 = aws.String(checksum.base64Sum())
+		}
+	}
+
+	var uploadOptions []func(*s3manager.Uploader)
+
+	if o.ifNoneMatch {
+		exists, err := objectExists(uploader.S3, bucket, name)
+		if err != nil {
+			return nil, ErrUploadingMultiPartFileToS3
+		}
+
+		if exists {
+			return nil, ErrObjectAlreadyExists
+		}
+
+		// closes the gap between the HeadObject above and the upload on endpoints supporting conditional writes
+		uploadOptions = append(uploadOptions, s3manager.WithUploaderRequestOptions(setIfNoneMatchHeader))
+	}
+
+	if o.gzip {
+		gzipBody := gzipReader(uploadInput.Body, o.bufferSize)
+		defer gzipBody.Close() // stops the compressing goroutine if the upload bails out early
+
+		uploadInput.Body = gzipBody
+		uploadInput.ContentEncoding = aws.String("gzip")
+	}
+
+	if o.kmsKeyID != "" {
+		key, err := generateDataKey(o.context(), o.awsSession, o.kmsKeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		noncePrefix, err := newNoncePrefix()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrEncryptingFile, err)
+		}
+
+		encryptedBody, err := newEncryptingReader(uploadInput.Body, key.plaintext, noncePrefix)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrEncryptingFile, err)
+		}
+
+		if uploadInput.Metadata == nil {
+			uploadInput.Metadata = map[string]*string{}
+		}
+		for metadataKey, value := range encryptionMetadata(key, noncePrefix) {
+			uploadInput.Metadata[metadataKey] = value
+		}
+
+		uploadInput.Body = encryptedBody
+	}
+
+	ctx, cancel, err := o.transferContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	uploadOptions = append(uploadOptions, leavePartsOnError, o.configureUploader)
+
+	if err = o.transfers.acquire(ctx); err != nil {
+		if o.deadlineExceeded(ctx) {
+			return nil, ErrDeadlineTooClose
+		}
+		return nil, ErrUploadingMultiPartFileToS3
+	}
+	defer o.transfers.release()
+
+	uploadOutput, err := uploader.UploadWithContext(ctx, uploadInput, uploadOptions...)
 	if err != nil {
+		abortFailedUpload(uploader.S3, bucket, name, err, o)
+		if o.deadlineExceeded(ctx) {
+			return nil, ErrDeadlineTooClose
+		}
+		if scanning != nil && scanning.rejected() != nil {
+			return nil, scanning.rejected()
+		}
+		if isPreconditionFailed(err) {
+			return nil, ErrObjectAlreadyExists
+		}
 		return nil, ErrUploadingMultiPartFileToS3
 	}
 
-	return &UploadRes{
-		S3Path: filepath.Join(bucket, name),
-		S3URL:  uploadOutput.Location,
-	}, nil
+	if o.waitTimeout > 0 {
+		if err = waitUntilExists(uploader.S3, bucket, name, o.waitTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	uploadRes := &UploadRes{
+		Key:           name,
+		S3Path:        filepath.Join(bucket, name),
+		S3URL:         o.objectURL(bucket, name, uploadOutput.Location),
+		ETag:          aws.StringValue(uploadOutput.ETag),
+		VersionID:     aws.StringValue(uploadOutput.VersionID),
+		BytesUploaded: size,
+		ContentType:   contentType,
+	}
+
+	if checksum != nil {
+		uploadRes.ChecksumSHA256 = checksum.hexSum()
+	}
+
+	if err = presignResult(uploader.S3, bucket, uploadRes, o); err != nil {
+		return uploadRes, err
+	}
+
+	if err = invalidate(name, o); err != nil {
+		return uploadRes, err
+	}
+
+	uploadEvent := newUploadEvent(bucket, uploadRes, o.eventMetadata)
+	uploadEvent.Uploader = o.uploader
+
+	if err = writeUploadRecord(uploadEvent, o); err != nil {
+		return uploadRes, err
+	}
+
+	if err = publishUploadEvent(uploadEvent, o); err != nil {
+		return uploadRes, err
+	}
+
+	return uploadRes, nil
 }
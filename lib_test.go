@@ -11,8 +11,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/jgroeneveld/trial/assert"
 	"github.com/joho/godotenv"
+	"io"
 	"log"
 	"mime/multipart"
+	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
 	"strings"
@@ -20,15 +23,21 @@ import (
 )
 
 const (
-	BoundaryValue       = "---SEAN_BOUNDARY_VALUE"
-	EmptyFileName       = "empty_file.txt"
-	MaxFileSizeBytes    = 50000000 // 50 megabytes
-	Region              = "us-east-2"
-	S3Bucket            = "golang-s3-lambda-test"
-	S3DeleteFileName    = "delete_me_dude"
-	S3FileName          = "file_slash_key_name"
-	SampleFileName      = "sample_file.csv"
-	SampleFileSizeBytes = 369
+	BoundaryValue         = "---SEAN_BOUNDARY_VALUE"
+	EmptyFileName         = "empty_file.txt"
+	KMSKeyID              = "alias/golang-s3-lambda-test"
+	MaxFileSizeBytes      = 50000000 // 50 megabytes
+	Region                = "us-east-2"
+	S3ArchivePrefix       = "archive_contents"
+	S3Bucket              = "golang-s3-lambda-test"
+	S3DeleteFileName      = "delete_me_dude"
+	S3EncryptedFileName   = "encrypted_file_slash_key_name"
+	S3FileName            = "file_slash_key_name"
+	S3GzipFileName        = "gzip_file_slash_key_name"
+	S3SyncPrefix          = "sync"
+	S3TransformedFileName = "transformed_file_slash_key_name"
+	SampleFileName        = "sample_file.csv"
+	SampleFileSizeBytes   = 369
 )
 
 func TestMain(m *testing.M) {
@@ -71,6 +80,40 @@ func TestDelete(t *testing.T) {
 	assert.True(t, errors.Is(ErrDownloadingS3File, downloadErr))
 }
 
+func TestDeleteChecked(t *testing.T) {
+	t.Run("verify err when name is empty", func(t *testing.T) {
+		deleteRes, err := DeleteChecked(Region, S3Bucket, "")
+		assert.Equal(t, deleteRes, (*DeleteRes)(nil))
+		assert.Equal(t, ErrParameterNameEmpty, err)
+	})
+	t.Run("verify DeleteChecked reports whether the object existed", func(t *testing.T) {
+		fileHeaders, err := GetHeaders(generateUploadFileReq(), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+
+		_, err = UploadHeader(fileHeaders[0], Region, S3Bucket, S3DeleteFileName)
+		assert.Nil(t, err)
+
+		deleteRes, err := DeleteChecked(Region, S3Bucket, S3DeleteFileName, WithDryRun())
+		assert.Nil(t, err)
+		assert.True(t, deleteRes.Existed)
+		assert.False(t, deleteRes.Deleted)
+
+		_, err = Download(Region, S3Bucket, S3DeleteFileName)
+		assert.Nil(t, err)
+
+		deleteRes, err = DeleteChecked(Region, S3Bucket, S3DeleteFileName)
+		assert.Nil(t, err)
+		assert.True(t, deleteRes.Existed)
+		assert.True(t, deleteRes.Deleted)
+
+		deleteRes, err = DeleteChecked(Region, S3Bucket, S3DeleteFileName)
+		assert.Nil(t, err)
+		assert.False(t, deleteRes.Existed)
+		assert.False(t, deleteRes.Deleted)
+	})
+}
+
 func TestDownload(t *testing.T) {
 	t.Run("verify err when region is empty", func(t *testing.T) {
 		fileBytes, err := Download("", S3Bucket, S3FileName)
@@ -115,6 +158,49 @@ func TestDownload(t *testing.T) {
 		assert.Equal(t, len(fileBytes), 0)
 		assert.True(t, errors.Is(err, ErrEmptyFileDownloaded))
 	})
+	t.Run("verify WithFallback downloads from the replica when the primary fails", func(t *testing.T) {
+		fileBytes, err := Download("us-east-sean", S3Bucket, S3FileName, WithFallback(Region, S3Bucket))
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+	})
+	t.Run("verify only S3 failures fall back", func(t *testing.T) {
+		assert.True(t, shouldFallBack(ErrDownloadingS3File))
+		assert.True(t, shouldFallBack(ErrNewAWSSession))
+		assert.True(t, shouldFallBack(fmt.Errorf("%w: %s", ErrChecksumMismatch, S3FileName)))
+		assert.False(t, shouldFallBack(ErrNotModified))
+		assert.False(t, shouldFallBack(ErrEmptyFileDownloaded))
+		assert.False(t, shouldFallBack(ErrObjectTooLarge))
+		assert.False(t, shouldFallBack(ErrDeadlineTooClose))
+	})
+	t.Run("verify objects over WithMaxDownloadBytes aren't downloaded", func(t *testing.T) {
+		awsSession := newFakeS3Session(t)
+
+		_, err := upload(s3manager.NewUploader(awsSession), S3Bucket, S3FileName, bytes.NewReader(make([]byte, 1024)), "", 0, newOptions(nil))
+		assert.Nil(t, err)
+
+		fileBytes, err := download(s3manager.NewDownloader(awsSession), S3Bucket, S3FileName, newOptions([]Option{WithMaxDownloadBytes(1023)}))
+		assert.True(t, errors.Is(err, ErrObjectTooLarge))
+		assert.Equal(t, 0, len(fileBytes))
+
+		fileBytes, err = download(s3manager.NewDownloader(awsSession), S3Bucket, S3FileName, newOptions([]Option{WithMaxDownloadBytes(1024)}))
+		assert.Nil(t, err)
+		assert.Equal(t, 1024, len(fileBytes))
+	})
+	t.Run("verify empty objects are downloaded WithAllowEmpty", func(t *testing.T) {
+		awsSession := newFakeS3Session(t)
+
+		_, err := upload(s3manager.NewUploader(awsSession), S3Bucket, EmptyFileName, bytes.NewReader(nil), "", 0, newOptions(nil))
+		assert.Nil(t, err)
+
+		fileBytes, err := download(s3manager.NewDownloader(awsSession), S3Bucket, EmptyFileName, newOptions(nil))
+		assert.True(t, errors.Is(err, ErrEmptyFileDownloaded))
+		assert.True(t, fileBytes == nil)
+
+		fileBytes, err = download(s3manager.NewDownloader(awsSession), S3Bucket, EmptyFileName, newOptions([]Option{WithAllowEmpty()}))
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(fileBytes))
+		assert.False(t, fileBytes == nil)
+	})
 	t.Run("verify Download works with correct inputs", func(t *testing.T) {
 		fileBytes, err := Download(Region, S3Bucket, S3FileName)
 		assert.Equal(t, len(fileBytes), SampleFileSizeBytes)
@@ -122,6 +208,39 @@ func TestDownload(t *testing.T) {
 	})
 }
 
+func TestDownloadIfChanged(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		fileBytes, eTag, err := DownloadIfChanged("", S3Bucket, S3FileName, "")
+		assert.Equal(t, len(fileBytes), 0)
+		assert.Equal(t, "", eTag)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		_, _, err := DownloadIfChanged(Region, "", S3FileName, "")
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify err when name is empty", func(t *testing.T) {
+		_, _, err := DownloadIfChanged(Region, S3Bucket, "", "")
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+	})
+	t.Run("verify err when the known ETag is current", func(t *testing.T) {
+		fileBytes, eTag, err := DownloadIfChanged(Region, S3Bucket, S3FileName, "")
+		assert.Nil(t, err)
+		assert.Equal(t, len(fileBytes), SampleFileSizeBytes)
+		assert.True(t, eTag != "")
+
+		fileBytes, _, err = DownloadIfChanged(Region, S3Bucket, S3FileName, eTag)
+		assert.Equal(t, len(fileBytes), 0)
+		assert.True(t, errors.Is(err, ErrNotModified))
+	})
+	t.Run("verify DownloadIfChanged downloads when the known ETag is stale", func(t *testing.T) {
+		fileBytes, eTag, err := DownloadIfChanged(Region, S3Bucket, S3FileName, `"stale"`)
+		assert.Nil(t, err)
+		assert.Equal(t, len(fileBytes), SampleFileSizeBytes)
+		assert.True(t, eTag != `"stale"`)
+	})
+}
+
 func TestGetHeaders(t *testing.T) {
 	t.Run("verify err when Content-Type header not set", func(t *testing.T) {
 		lambdaReq := generateUploadFileReq()
@@ -147,6 +266,15 @@ func TestGetHeaders(t *testing.T) {
 		assert.Equal(t, len(fileHeaders), 0)
 		assert.True(t, errors.Is(err, ErrBoundaryValueMissing))
 	})
+	t.Run("verify GetHeaders reads Content-Type from MultiValueHeaders", func(t *testing.T) {
+		lambdaReq := generateUploadFileReq()
+		lambdaReq.MultiValueHeaders = map[string][]string{"content-type": {lambdaReq.Headers["Content-Type"]}}
+		lambdaReq.Headers = nil
+
+		fileHeaders, err := GetHeaders(lambdaReq, MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+	})
 	t.Run("verify GetHeaders works with correct inputs", func(t *testing.T) {
 		lambdaReq := generateUploadFileReq()
 
@@ -154,6 +282,128 @@ func TestGetHeaders(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, 1, len(fileHeaders))
 	})
+	t.Run("verify RemoveAll deletes the files GetForm spilled to disk", func(t *testing.T) {
+		form, err := GetForm(generateUploadFileReq(), 1)
+		assert.Nil(t, err)
+
+		fileHeaders := FormFiles(form)
+		assert.Equal(t, 1, len(fileHeaders))
+
+		file, err := fileHeaders[0].Open()
+		assert.Nil(t, err)
+		assert.Nil(t, file.Close())
+
+		assert.Nil(t, form.RemoveAll())
+
+		_, err = fileHeaders[0].Open()
+		assert.NotNil(t, err)
+	})
+	t.Run("verify GetForm spills files WithTempDir", func(t *testing.T) {
+		tempDir := t.TempDir()
+		tmpDir := os.Getenv("TMPDIR")
+
+		form, err := GetForm(generateUploadFileReq(), 1, WithTempDir(tempDir))
+		assert.Nil(t, err)
+		assert.Equal(t, tmpDir, os.Getenv("TMPDIR"))
+
+		spilled, err := os.ReadDir(tempDir)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(spilled))
+
+		fileBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		fileHeaders := FormFiles(form)
+		assert.Equal(t, 1, len(fileHeaders))
+		assert.Equal(t, int64(len(fileBytes)), fileHeaders[0].Size)
+
+		file, err := OpenFileHeader(fileHeaders[0])
+		assert.Nil(t, err)
+		spilledBytes, err := io.ReadAll(file)
+		assert.Nil(t, err)
+		assert.Nil(t, file.Close())
+		assert.True(t, bytes.Equal(fileBytes, spilledBytes))
+
+		assert.Nil(t, RemoveForm(form))
+
+		spilled, err = os.ReadDir(tempDir)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(spilled))
+	})
+	t.Run("verify files that fit in memory aren't spilled WithTempDir", func(t *testing.T) {
+		tempDir := t.TempDir()
+
+		form, err := GetForm(generateUploadFileReq(), MaxFileSizeBytes, WithTempDir(tempDir))
+		assert.Nil(t, err)
+
+		spilled, err := os.ReadDir(tempDir)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(spilled))
+
+		fileHeaders := FormFiles(form)
+		assert.Equal(t, 1, len(fileHeaders))
+		assert.Equal(t, int64(SampleFileSizeBytes), fileHeaders[0].Size)
+		assert.Equal(t, SampleFileName, fileHeaders[0].Filename)
+	})
+	t.Run("verify base64 and quoted-printable parts are decoded", func(t *testing.T) {
+		fileBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		var multiPartBuffer bytes.Buffer
+		writer := multipart.NewWriter(&multiPartBuffer)
+
+		base64Part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition":       {`form-data; name="base64"; filename="base64.csv"`},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		assert.Nil(t, err)
+		encoded := base64.StdEncoding.EncodeToString(fileBytes)
+		for len(encoded) > 76 { // base64 bodies are wrapped at 76 characters
+			_, _ = base64Part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		_, _ = base64Part.Write([]byte(encoded))
+
+		quotedPrintablePart, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition":       {`form-data; name="qp"; filename="qp.txt"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		assert.Nil(t, err)
+		_, _ = quotedPrintablePart.Write([]byte("caf=C3=A9 au lait"))
+		assert.Nil(t, writer.Close())
+
+		form, err := GetForm(events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Content-Type": writer.FormDataContentType()},
+			Body:    multiPartBuffer.String(),
+		}, MaxFileSizeBytes, WithMaxSize(SampleFileSizeBytes))
+		assert.Nil(t, err)
+
+		for field, expected := range map[string][]byte{"base64": fileBytes, "qp": []byte("café au lait")} {
+			file, err := form.File[field][0].Open()
+			assert.Nil(t, err)
+
+			decoded, err := io.ReadAll(file)
+			assert.Nil(t, err)
+			assert.Equal(t, string(expected), string(decoded))
+			assert.Equal(t, "", form.File[field][0].Header.Get("Content-Transfer-Encoding"))
+		}
+	})
+	t.Run("verify err naming the file when a file is larger than WithMaxSize", func(t *testing.T) {
+		fileHeaders, err := GetHeaders(generateUploadFileReq(), MaxFileSizeBytes, WithMaxSize(SampleFileSizeBytes-1))
+		assert.Equal(t, len(fileHeaders), 0)
+		assert.True(t, errors.Is(err, ErrFileTooLarge))
+		assert.True(t, strings.Contains(err.Error(), SampleFileName))
+
+		fileHeaders, err = GetHeaders(generateUploadFileReq(), MaxFileSizeBytes, WithMaxSize(SampleFileSizeBytes))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+	})
+	t.Run("verify err when the form is larger than WithMaxTotalSize", func(t *testing.T) {
+		fileHeaders, err := GetHeaders(generateUploadFileReq(), MaxFileSizeBytes, WithMaxTotalSize(SampleFileSizeBytes-1))
+		assert.Equal(t, len(fileHeaders), 0)
+		assert.True(t, errors.Is(err, ErrFormTooLarge))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, StatusCode(err))
+	})
 }
 
 func TestUploadHeader(t *testing.T) {
@@ -190,10 +440,53 @@ func TestUploadHeader(t *testing.T) {
 		assert.Equal(t, uploadRes, (*UploadRes)(nil))
 		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
 	})
+	t.Run("verify err when file is larger than WithMaxSize", func(t *testing.T) {
+		lambdaReq := generateUploadFileReq()
+
+		fileHeaders, err := GetHeaders(lambdaReq, MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+
+		uploadRes, err := UploadHeader(fileHeaders[0], Region, S3Bucket, S3FileName, WithMaxSize(SampleFileSizeBytes-1))
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.True(t, errors.Is(err, ErrFileTooLarge))
+	})
+	t.Run("verify multipart file is streamed without buffering", func(t *testing.T) {
+		// s3manager only buffers parts in memory when the body isn't an io.ReaderAt and io.Seeker
+		for _, maxMemory := range []int64{MaxFileSizeBytes, 1} { // held in memory and spilled to disk
+			fileHeaders, err := GetHeaders(generateUploadFileReq(), maxMemory)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(fileHeaders))
+
+			file, err := fileHeaders[0].Open()
+			assert.Nil(t, err)
+
+			_, isReaderAt := file.(io.ReaderAt)
+			_, isSeeker := file.(io.Seeker)
+			assert.True(t, isReaderAt)
+			assert.True(t, isSeeker)
+			assert.Nil(t, file.Close())
+		}
+	})
+	t.Run("verify err when object exists and WithIfNoneMatch is set", func(t *testing.T) {
+		lambdaReq := generateUploadFileReq()
+
+		fileHeaders, err := GetHeaders(lambdaReq, MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+
+		_, err = UploadHeader(fileHeaders[0], Region, S3Bucket, S3FileName)
+		assert.Nil(t, err)
+
+		uploadRes, err := UploadHeader(fileHeaders[0], Region, S3Bucket, S3FileName, WithIfNoneMatch())
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.True(t, errors.Is(err, ErrObjectAlreadyExists))
+	})
 	t.Run("verify err when *multipart.FileHeader is empty", func(t *testing.T) {
 		uploadRes, err := UploadHeader(&multipart.FileHeader{}, Region, S3Bucket, S3FileName)
 		assert.Equal(t, uploadRes, (*UploadRes)(nil))
 		assert.True(t, errors.Is(err, ErrOpeningMultiPartFile))
+		assert.False(t, errors.Is(err, ErrReadingMultiPartFile))
 	})
 	t.Run("verify err when region is invalid and upload fails", func(t *testing.T) {
 		lambdaReq := generateUploadFileReq()
@@ -225,6 +518,10 @@ func TestUploadHeader(t *testing.T) {
 		urlBuilder.WriteString(".amazonaws.com/")
 		urlBuilder.WriteString(S3FileName)
 		assert.Equal(t, urlBuilder.String(), uploadRes.S3URL)
+
+		assert.True(t, uploadRes.ETag != "")
+		assert.Equal(t, int64(SampleFileSizeBytes), uploadRes.BytesUploaded)
+		assert.Equal(t, "application/octet-stream", uploadRes.ContentType)
 	})
 }
 
@@ -0,0 +1,209 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"sort"
+)
+
+var (
+	ErrParameterLifecycleRule = errors.New("required parameter rule must have an ID and expire objects or abort incomplete multipart uploads")
+	ErrPuttingLifecycleRule   = errors.New("unable to put the lifecycle rule")
+	ErrReadingLifecycleRules  = errors.New("unable to read the bucket's lifecycle rules")
+)
+
+// LifecycleRule is an S3 lifecycle rule in the shape upload workflows need: objects under Prefix with all of Tags
+// are expired ExpirationDays after they're created and multipart uploads under Prefix that haven't completed
+// AbortIncompleteMultipartUploadDays after they started are aborted. Zero days disables either action. An empty
+// Prefix and no Tags applies the rule to the whole bucket.
+type LifecycleRule struct {
+	ID                                 string            `json:"id"`
+	Prefix                             string            `json:"prefix,omitempty"`
+	Tags                               map[string]string `json:"tags,omitempty"`
+	ExpirationDays                     int64             `json:"expirationDays,omitempty"`
+	AbortIncompleteMultipartUploadDays int64             `json:"abortIncompleteMultipartUploadDays,omitempty"`
+	// Enabled is false for rules S3 has but doesn't apply.
+	Enabled bool `json:"enabled"`
+}
+
+// PutLifecycleRule installs rule on bucket, replacing the existing rule with the same ID if there is one. The
+// bucket's other rules are kept. The rule is always enabled.
+func PutLifecycleRule(region, bucket string, rule LifecycleRule, opts ...Option) error {
+	if region == "" && !detectsBucketRegion(opts) {
+		return ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+
+	if rule.ID == "" || (rule.ExpirationDays <= 0 && rule.AbortIncompleteMultipartUploadDays <= 0) {
+		return ErrParameterLifecycleRule
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return ErrNewAWSSession
+	}
+
+	s3Client := s3.New(awsSession)
+
+	// S3 only lets us replace the whole configuration so the rules we don't know about are put back as they were
+	s3Rules, err := getLifecycleRules(s3Client, bucket, o)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, s3Rule := range s3Rules {
+		if aws.StringValue(s3Rule.ID) == rule.ID {
+			s3Rules[i] = rule.s3Rule()
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		s3Rules = append(s3Rules, rule.s3Rule())
+	}
+
+	_, err = s3Client.PutBucketLifecycleConfigurationWithContext(o.context(), &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucket),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: s3Rules},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPuttingLifecycleRule, err)
+	}
+
+	return nil
+}
+
+// GetLifecycleRules returns the lifecycle rules of bucket. Parts of rules LifecycleRule can't express, such as
+// transitions to other storage classes, are left out.
+func GetLifecycleRules(region, bucket string, opts ...Option) ([]LifecycleRule, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	s3Rules, err := getLifecycleRules(s3.New(awsSession), bucket, o)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]LifecycleRule, 0, len(s3Rules))
+	for _, s3Rule := range s3Rules {
+		rules = append(rules, newLifecycleRule(s3Rule))
+	}
+
+	return rules, nil
+}
+
+// getLifecycleRules returns the rules of bucket as S3 has them. Buckets without any are reported as an error by S3.
+func getLifecycleRules(s3Client s3iface.S3API, bucket string, o *options) ([]*s3.LifecycleRule, error) {
+	output, err := s3Client.GetBucketLifecycleConfigurationWithContext(o.context(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == "NoSuchLifecycleConfiguration" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrReadingLifecycleRules, err)
+	}
+
+	return output.Rules, nil
+}
+
+// s3Rule converts r to the rule S3 expects.
+func (r LifecycleRule) s3Rule() *s3.LifecycleRule {
+	s3Rule := &s3.LifecycleRule{
+		ID:     aws.String(r.ID),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{},
+	}
+
+	tags := make([]*s3.Tag, 0, len(r.Tags))
+	for key, value := range r.Tags {
+		tags = append(tags, &s3.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	sort.Slice(tags, func(i, j int) bool { return aws.StringValue(tags[i].Key) < aws.StringValue(tags[j].Key) })
+
+	switch {
+	case len(tags) == 0:
+		s3Rule.Filter.Prefix = aws.String(r.Prefix)
+	case len(tags) == 1 && r.Prefix == "":
+		s3Rule.Filter.Tag = tags[0]
+	default:
+		s3Rule.Filter.And = &s3.LifecycleRuleAndOperator{Tags: tags}
+		if r.Prefix != "" {
+			s3Rule.Filter.And.Prefix = aws.String(r.Prefix)
+		}
+	}
+
+	if r.ExpirationDays > 0 {
+		s3Rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(r.ExpirationDays)}
+	}
+
+	if r.AbortIncompleteMultipartUploadDays > 0 {
+		s3Rule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int64(r.AbortIncompleteMultipartUploadDays),
+		}
+	}
+
+	return s3Rule
+}
+
+// newLifecycleRule converts a rule returned by S3 to a LifecycleRule.
+func newLifecycleRule(s3Rule *s3.LifecycleRule) LifecycleRule {
+	rule := LifecycleRule{
+		ID:      aws.StringValue(s3Rule.ID),
+		Prefix:  aws.StringValue(s3Rule.Prefix), // deprecated but still returned for rules created without a Filter
+		Enabled: aws.StringValue(s3Rule.Status) == s3.ExpirationStatusEnabled,
+	}
+
+	var tags []*s3.Tag
+	if filter := s3Rule.Filter; filter != nil {
+		switch {
+		case filter.And != nil:
+			rule.Prefix = aws.StringValue(filter.And.Prefix)
+			tags = filter.And.Tags
+		case filter.Tag != nil:
+			tags = []*s3.Tag{filter.Tag}
+		case filter.Prefix != nil:
+			rule.Prefix = aws.StringValue(filter.Prefix)
+		}
+	}
+
+	if len(tags) > 0 {
+		rule.Tags = map[string]string{}
+		for _, tag := range tags {
+			rule.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+
+	if s3Rule.Expiration != nil {
+		rule.ExpirationDays = aws.Int64Value(s3Rule.Expiration.Days)
+	}
+
+	if s3Rule.AbortIncompleteMultipartUpload != nil {
+		rule.AbortIncompleteMultipartUploadDays = aws.Int64Value(s3Rule.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+	}
+
+	return rule
+}
@@ -0,0 +1,68 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestLifecycleRule(t *testing.T) {
+	t.Run("verify rules survive the round trip through S3's shape", func(t *testing.T) {
+		for _, rule := range []LifecycleRule{
+			{ID: "bucket", ExpirationDays: 30, Enabled: true},
+			{ID: "prefix", Prefix: "tmp/", ExpirationDays: 1, AbortIncompleteMultipartUploadDays: 1, Enabled: true},
+			{ID: "tag", Tags: map[string]string{"temporary": "true"}, ExpirationDays: 1, Enabled: true},
+			{ID: "prefix-and-tags", Prefix: "uploads/", Tags: map[string]string{"temporary": "true", "team": "a"}, ExpirationDays: 7, Enabled: true},
+		} {
+			roundTripped := newLifecycleRule(rule.s3Rule())
+			assert.Equal(t, rule.ID, roundTripped.ID)
+			assert.Equal(t, rule.Prefix, roundTripped.Prefix)
+			assert.Equal(t, len(rule.Tags), len(roundTripped.Tags))
+			for key, value := range rule.Tags {
+				assert.Equal(t, value, roundTripped.Tags[key])
+			}
+			assert.Equal(t, rule.ExpirationDays, roundTripped.ExpirationDays)
+			assert.Equal(t, rule.AbortIncompleteMultipartUploadDays, roundTripped.AbortIncompleteMultipartUploadDays)
+			assert.True(t, roundTripped.Enabled)
+		}
+	})
+	t.Run("verify a single tag without a prefix doesn't need an And filter", func(t *testing.T) {
+		s3Rule := LifecycleRule{ID: "tag", Tags: map[string]string{"temporary": "true"}, ExpirationDays: 1}.s3Rule()
+		assert.True(t, s3Rule.Filter.And == nil)
+		assert.Equal(t, "temporary", aws.StringValue(s3Rule.Filter.Tag.Key))
+	})
+}
+
+func TestPutLifecycleRule(t *testing.T) {
+	t.Run("verify err when the rule has no ID or action", func(t *testing.T) {
+		err := PutLifecycleRule(Region, S3Bucket, LifecycleRule{ExpirationDays: 1})
+		assert.True(t, errors.Is(err, ErrParameterLifecycleRule))
+
+		err = PutLifecycleRule(Region, S3Bucket, LifecycleRule{ID: "nothing"})
+		assert.True(t, errors.Is(err, ErrParameterLifecycleRule))
+	})
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		_, err := GetLifecycleRules("", S3Bucket)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify rules are put and replaced by ID", func(t *testing.T) {
+		rule := LifecycleRule{ID: "lambda-s3-test", Prefix: "lifecycle/", AbortIncompleteMultipartUploadDays: 1}
+		assert.Nil(t, PutLifecycleRule(Region, S3Bucket, rule))
+
+		rule.ExpirationDays = 2
+		assert.Nil(t, PutLifecycleRule(Region, S3Bucket, rule))
+
+		rules, err := GetLifecycleRules(Region, S3Bucket)
+		assert.Nil(t, err)
+
+		found := 0
+		for _, existing := range rules {
+			if existing.ID == rule.ID {
+				found++
+				assert.Equal(t, int64(2), existing.ExpirationDays)
+			}
+		}
+		assert.Equal(t, 1, found)
+	})
+}
@@ -0,0 +1,126 @@
+package lambda_s3
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"time"
+)
+
+// ObjectSummary describes an object returned by ObjectIterator.
+type ObjectSummary struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"eTag"`
+	LastModified time.Time `json:"lastModified"`
+	StorageClass string    `json:"storageClass"`
+}
+
+// ObjectIterator iterates over the objects under a prefix one page of up to 1,000 keys at a time.
+//
+//	for objects.Next() {
+//		object := objects.Object()
+//	}
+//	if err := objects.Err(); err != nil {
+//
+// Only the current page is held in memory so prefixes with millions of keys can be processed in constant memory.
+type ObjectIterator struct {
+	s3Client s3iface.S3API
+	ctx      context.Context
+	input    *s3.ListObjectsV2Input
+	page     []*s3.Object
+	object   ObjectSummary
+	lastPage bool
+	err      error
+}
+
+// ListIterator returns an ObjectIterator over every object in bucket whose key starts with prefix, in key order.
+// Nothing is listed until Next is first called and each following page is only requested once the previous one is
+// used up. Iteration stops, and Err returns the context's error, once the context passed WithContext is cancelled.
+func ListIterator(region, bucket, prefix string, opts ...Option) (*ObjectIterator, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	return newObjectIterator(o.context(), s3.New(awsSession), bucket, prefix), nil
+}
+
+func newObjectIterator(ctx context.Context, s3Client s3iface.S3API, bucket, prefix string) *ObjectIterator {
+	return &ObjectIterator{
+		s3Client: s3Client,
+		ctx:      ctx,
+		input: &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		},
+	}
+}
+
+// Next advances the iterator to the next object, fetching the next page if the current one is used up. It returns
+// false once there are no more objects or listing failed, which Err tells apart.
+func (i *ObjectIterator) Next() bool {
+	for len(i.page) == 0 {
+		if i.err != nil || i.lastPage {
+			return false
+		}
+
+		if err := i.ctx.Err(); err != nil {
+			i.err = err
+			return false
+		}
+
+		i.fetchPage()
+	}
+
+	object := i.page[0]
+	i.page = i.page[1:]
+
+	i.object = ObjectSummary{
+		Key:          aws.StringValue(object.Key),
+		Size:         aws.Int64Value(object.Size),
+		ETag:         aws.StringValue(object.ETag),
+		LastModified: aws.TimeValue(object.LastModified),
+		StorageClass: aws.StringValue(object.StorageClass),
+	}
+
+	return true
+}
+
+func (i *ObjectIterator) fetchPage() {
+	listOutput, err := i.s3Client.ListObjectsV2WithContext(i.ctx, i.input)
+	if err != nil {
+		if ctxErr := i.ctx.Err(); ctxErr != nil {
+			i.err = ctxErr
+		} else {
+			i.err = ErrListingS3Objects
+		}
+		return
+	}
+
+	i.page = listOutput.Contents
+	i.input.ContinuationToken = listOutput.NextContinuationToken
+	i.lastPage = !aws.BoolValue(listOutput.IsTruncated)
+}
+
+// Object returns the object Next advanced to.
+func (i *ObjectIterator) Object() ObjectSummary {
+	return i.object
+}
+
+// Err returns the error that stopped the iteration, if any. It's ErrListingS3Objects if S3 failed or the context's
+// error if it was cancelled.
+func (i *ObjectIterator) Err() error {
+	return i.err
+}
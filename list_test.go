@@ -0,0 +1,90 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+// pagedLister serves pages of two keys each, numbered from 0, until it's listed count keys.
+type pagedLister struct {
+	s3iface.S3API
+	count    int
+	requests int
+	err      error
+}
+
+func (p *pagedLister) ListObjectsV2WithContext(_ aws.Context, input *s3.ListObjectsV2Input, _ ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	start := 0
+	if input.ContinuationToken != nil {
+		fmt.Sscan(aws.StringValue(input.ContinuationToken), &start)
+	}
+	p.requests++
+
+	listOutput := &s3.ListObjectsV2Output{}
+	for i := start; i < start+2 && i < p.count; i++ {
+		listOutput.Contents = append(listOutput.Contents, &s3.Object{Key: aws.String(fmt.Sprintf("%s/%d", aws.StringValue(input.Prefix), i)), Size: aws.Int64(int64(i))})
+	}
+
+	if start+2 < p.count {
+		listOutput.IsTruncated = aws.Bool(true)
+		listOutput.NextContinuationToken = aws.String(fmt.Sprint(start + 2))
+	}
+
+	return listOutput, nil
+}
+
+func TestListIterator(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		_, err := ListIterator("", S3Bucket, S3ArchivePrefix)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		_, err := ListIterator(Region, "", S3ArchivePrefix)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify every object is returned with pages fetched lazily", func(t *testing.T) {
+		lister := &pagedLister{count: 5}
+		objects := newObjectIterator(context.Background(), lister, S3Bucket, S3ArchivePrefix)
+		assert.Equal(t, 0, lister.requests)
+
+		var keys []string
+		for objects.Next() {
+			keys = append(keys, objects.Object().Key)
+			assert.Equal(t, (len(keys)+1)/2, lister.requests)
+		}
+
+		assert.Nil(t, objects.Err())
+		assert.Equal(t, 5, len(keys))
+		assert.Equal(t, S3ArchivePrefix+"/4", keys[4])
+		assert.Equal(t, int64(4), objects.Object().Size)
+	})
+	t.Run("verify iteration stops once the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		lister := &pagedLister{count: 5}
+		objects := newObjectIterator(ctx, lister, S3Bucket, S3ArchivePrefix)
+
+		assert.True(t, objects.Next())
+		cancel()
+		assert.True(t, objects.Next()) // the rest of the page was already fetched
+		assert.False(t, objects.Next())
+		assert.True(t, errors.Is(objects.Err(), context.Canceled))
+		assert.Equal(t, 1, lister.requests)
+	})
+	t.Run("verify S3 failures are reported by Err", func(t *testing.T) {
+		objects := newObjectIterator(context.Background(), &pagedLister{err: errors.New("throttled")}, S3Bucket, S3ArchivePrefix)
+		assert.False(t, objects.Next())
+		assert.True(t, errors.Is(objects.Err(), ErrListingS3Objects))
+	})
+}
@@ -0,0 +1,81 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"time"
+)
+
+var ErrWritingManifest = errors.New("unable to write the upload manifest")
+
+// Manifest is the JSON object written alongside a batch of files uploaded WithManifest so downstream jobs can find
+// and verify them without listing the bucket.
+type Manifest struct {
+	Bucket    string          `json:"bucket"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Files     []*ManifestFile `json:"files"`
+	// Failed are the keys of the files in the batch that weren't uploaded.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// ManifestFile describes an uploaded file in a Manifest.
+type ManifestFile struct {
+	Key            string `json:"key"`
+	Size           int64  `json:"size"`
+	ChecksumSHA256 string `json:"checksumSHA256"`
+	ContentType    string `json:"contentType,omitempty"`
+	ETag           string `json:"eTag,omitempty"`
+	VersionID      string `json:"versionID,omitempty"`
+}
+
+// newManifest describes the files of a batch uploaded to bucket.
+func newManifest(bucket string, uploadResults []*UploadRes, result *Result) *Manifest {
+	manifest := &Manifest{
+		Bucket:    bucket,
+		CreatedAt: time.Now().UTC(),
+		Files:     make([]*ManifestFile, 0, len(uploadResults)),
+	}
+
+	for _, uploadRes := range uploadResults {
+		manifest.Files = append(manifest.Files, &ManifestFile{
+			Key:            uploadRes.Key,
+			Size:           uploadRes.BytesUploaded,
+			ChecksumSHA256: uploadRes.ChecksumSHA256,
+			ContentType:    uploadRes.ContentType,
+			ETag:           uploadRes.ETag,
+			VersionID:      uploadRes.VersionID,
+		})
+	}
+
+	for _, keyErr := range result.Failed {
+		manifest.Failed = append(manifest.Failed, keyErr.Key)
+	}
+
+	return manifest
+}
+
+// writeManifest stores manifest in bucket under key as plain JSON, whatever options the files were uploaded with,
+// so any job can read it.
+func writeManifest(s3Client s3iface.S3API, bucket, key string, manifest *Manifest, o *options) error {
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWritingManifest, err)
+	}
+
+	_, err = s3Client.PutObjectWithContext(o.context(), &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(manifestBytes),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWritingManifest, err)
+	}
+
+	return nil
+}
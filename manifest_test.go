@@ -0,0 +1,100 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"mime/multipart"
+	"testing"
+)
+
+// objectPutter records the objects put to it or fails every put with err.
+type objectPutter struct {
+	s3iface.S3API
+	err     error
+	objects map[string][]byte
+	inputs  []*s3.PutObjectInput
+}
+
+func (p *objectPutter) PutObjectWithContext(_ aws.Context, input *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	body, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.objects == nil {
+		p.objects = map[string][]byte{}
+	}
+	p.objects[aws.StringValue(input.Key)] = body
+	p.inputs = append(p.inputs, input)
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestWithManifest(t *testing.T) {
+	uploadResults := []*UploadRes{
+		{Key: "batch/a.csv", BytesUploaded: 10, ChecksumSHA256: "aa", ContentType: "text/csv", ETag: `"etag-a"`},
+		{Key: "batch/b.csv", BytesUploaded: 20, ChecksumSHA256: "bb", ContentType: "text/csv", VersionID: "v2"},
+	}
+	result := &Result{
+		Succeeded: []string{"batch/a.csv", "batch/b.csv"},
+		Failed:    []*KeyError{{Key: "batch/c.csv", Err: ErrFileTooLarge}},
+	}
+
+	t.Run("verify the option turns on checksums", func(t *testing.T) {
+		o := newOptions([]Option{WithManifest("manifest.json")})
+		assert.Equal(t, "manifest.json", o.manifestName)
+		assert.True(t, o.checksum)
+	})
+	t.Run("verify the manifest lists every file and failure as JSON", func(t *testing.T) {
+		putter := &objectPutter{}
+
+		err := writeManifest(putter, S3Bucket, "batch/manifest.json", newManifest(S3Bucket, uploadResults, result), newOptions(nil))
+		assert.Nil(t, err)
+		assert.Equal(t, "application/json", aws.StringValue(putter.inputs[0].ContentType))
+
+		var manifest Manifest
+		assert.Nil(t, json.Unmarshal(putter.objects["batch/manifest.json"], &manifest))
+		assert.Equal(t, S3Bucket, manifest.Bucket)
+		assert.False(t, manifest.CreatedAt.IsZero())
+		assert.Equal(t, 2, len(manifest.Files))
+		assert.Equal(t, "batch/b.csv", manifest.Files[1].Key)
+		assert.Equal(t, int64(20), manifest.Files[1].Size)
+		assert.Equal(t, "bb", manifest.Files[1].ChecksumSHA256)
+		assert.Equal(t, "text/csv", manifest.Files[1].ContentType)
+		assert.Equal(t, "v2", manifest.Files[1].VersionID)
+		assert.Equal(t, 1, len(manifest.Failed))
+		assert.Equal(t, "batch/c.csv", manifest.Failed[0])
+	})
+	t.Run("verify err when the manifest can't be written", func(t *testing.T) {
+		err := writeManifest(&objectPutter{err: errors.New("AccessDenied")}, S3Bucket, "batch/manifest.json", newManifest(S3Bucket, nil, &Result{}), newOptions(nil))
+		assert.True(t, errors.Is(err, ErrWritingManifest))
+	})
+	t.Run("verify UploadMany writes the manifest alongside the files", func(t *testing.T) {
+		fileHeaders := []*multipart.FileHeader{generateFileHeader(t, SampleFileName, []byte("contents"))}
+
+		uploadResults, result := UploadMany(fileHeaders, Region, S3Bucket, "manifested", WithManifest("manifest.json"))
+		assert.Nil(t, result.Err())
+		assert.Equal(t, 1, len(uploadResults))
+
+		manifestBytes, err := Download(Region, S3Bucket, "manifested/manifest.json")
+		assert.Nil(t, err)
+
+		var manifest Manifest
+		assert.Nil(t, json.Unmarshal(manifestBytes, &manifest))
+		assert.Equal(t, 1, len(manifest.Files))
+		assert.Equal(t, uploadResults[0].ChecksumSHA256, manifest.Files[0].ChecksumSHA256)
+
+		result = DeleteMany(Region, S3Bucket, []string{uploadResults[0].Key, "manifested/manifest.json"})
+		assert.Nil(t, result.Err())
+	})
+}
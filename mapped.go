@@ -0,0 +1,168 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"mime/multipart"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrUnmappedField = errors.New("the form has files in a field that isn't mapped to a destination")
+
+// Destination is where UploadMapped uploads the files in a form field. Files are uploaded to Bucket in Region under
+// Key or, when Key is empty, under Prefix named after their Filename like UploadMany. Options are applied after the
+// options passed to UploadMapped so each field can, for example, have its own WithCannedACL or WithMaxSize.
+type Destination struct {
+	Region  string
+	Bucket  string
+	Prefix  string
+	Key     string
+	Options []Option
+}
+
+// mappedFile is a file UploadMapped uploads along with the options and uploader of its Destination.
+type mappedFile struct {
+	fileHeader *multipart.FileHeader
+	region     string
+	bucket     string
+	o          *options
+	uploader   *s3manager.Uploader
+}
+
+// UploadMapped uploads the files in form to the Destination their field is mapped to in destinations, e.g. an avatar
+// field to a public-read avatars/ prefix and a document field to a private documents/ prefix, concurrently using a
+// pool of WithConcurrency workers. Like UploadMany it returns the UploadRes of every file that was uploaded
+// successfully along with a Result keyed by the S3 key of each file. Files whose key is shared with another file,
+// such as a second file in a field mapped to a Key, fail with ErrDuplicateKey.
+//
+// A form with files in a field that isn't in destinations is rejected: nothing is uploaded and every file fails with
+// ErrUnmappedField, the unmapped ones keyed by their field name. Upload WithIgnoreUnmappedFields to skip those files
+// and upload the rest instead.
+func UploadMapped(form *multipart.Form, destinations map[string]Destination, opts ...Option) ([]*UploadRes, *Result) {
+	o := newOptions(opts)
+
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var keys, unmapped []string
+	keyFiles := map[string]*mappedFile{}
+	fieldErrs := map[string]error{}
+	var rejected []*KeyError
+
+	for _, field := range fields {
+		destination, ok := destinations[field]
+		if !ok {
+			unmapped = append(unmapped, field)
+			continue
+		}
+
+		destinationOptions := newOptions(append(append([]Option{}, opts...), destination.Options...))
+
+		for _, fileHeader := range form.File[field] {
+			key := destination.Key
+			if key == "" {
+				if fileHeader.Filename == "" {
+					rejected = append(rejected, &KeyError{Key: field, Err: ErrParameterNameEmpty})
+					continue
+				}
+
+				key = path.Join(destination.Prefix, fileHeader.Filename)
+			}
+
+			if _, ok := keyFiles[key]; ok {
+				rejected = append(rejected, &KeyError{Key: key, Err: fmt.Errorf("%w: %s", ErrDuplicateKey, key)})
+				continue
+			}
+
+			keyFiles[key] = &mappedFile{fileHeader: fileHeader, region: destination.Region, bucket: destination.Bucket, o: destinationOptions}
+			keys = append(keys, key)
+
+			if err := destinationErr(destination, destinationOptions); err != nil {
+				fieldErrs[key] = err
+			}
+		}
+	}
+
+	if len(unmapped) > 0 && !o.ignoreUnmappedFields {
+		result := failAll(keys, fmt.Errorf("%w: %s", ErrUnmappedField, strings.Join(unmapped, ", ")))
+		for _, field := range unmapped {
+			result.Failed = append(result.Failed, &KeyError{Key: field, Err: fmt.Errorf("%w: %s", ErrUnmappedField, field)})
+		}
+		result.Failed = append(result.Failed, rejected...)
+		return nil, result
+	}
+
+	// the files in a field share its options, and so a session and uploader configured by them
+	uploaders := map[*options]*s3manager.Uploader{}
+	for _, key := range keys {
+		if fieldErrs[key] != nil {
+			continue
+		}
+
+		file := keyFiles[key]
+
+		if uploaders[file.o] == nil {
+			awsSession, err := file.o.newBucketSession(file.region, file.bucket)
+			if err != nil {
+				fieldErrs[key] = ErrNewAWSSession
+				continue
+			}
+
+			uploaders[file.o] = s3manager.NewUploader(awsSession)
+		}
+
+		file.uploader = uploaders[file.o]
+	}
+
+	var mutex sync.Mutex
+	uploadResults := map[string]*UploadRes{}
+
+	errs := runConcurrently(o.concurrency, keys, func(key string) error {
+		if err := fieldErrs[key]; err != nil {
+			return err
+		}
+
+		file := keyFiles[key]
+
+		if err := fileTooLarge(file.fileHeader, file.o); err != nil {
+			return err
+		}
+
+		uploadRes, err := uploadHeader(file.uploader, file.fileHeader, file.bucket, key, file.o)
+		if err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		uploadResults[key] = uploadRes
+		mutex.Unlock()
+
+		return nil
+	})
+
+	result := newResult(keys, errs)
+	result.Failed = append(result.Failed, rejected...)
+
+	uploadResultsInOrder := make([]*UploadRes, 0, len(result.Succeeded))
+	for _, key := range result.Succeeded {
+		uploadResultsInOrder = append(uploadResultsInOrder, uploadResults[key])
+	}
+
+	return uploadResultsInOrder, result
+}
+
+// destinationErr checks the region and bucket of destination.
+func destinationErr(destination Destination, o *options) error {
+	if destination.Region == "" && !o.detectBucketRegion {
+		return ErrParameterRegionEmpty
+	}
+
+	return validateBucket(destination.Bucket)
+}
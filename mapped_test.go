@@ -0,0 +1,57 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"mime/multipart"
+	"testing"
+)
+
+func TestUploadMapped(t *testing.T) {
+	destinations := map[string]Destination{
+		"avatar":   {Region: Region, Bucket: S3Bucket, Key: "mapped/avatar", Options: []Option{WithMaxSize(1024)}},
+		"document": {Region: Region, Bucket: S3Bucket, Prefix: "mapped/documents"},
+	}
+
+	t.Run("verify forms with unmapped fields are rejected", func(t *testing.T) {
+		form := &multipart.Form{File: map[string][]*multipart.FileHeader{
+			"avatar": {generateFileHeader(t, SampleFileName, []byte("avatar"))},
+			"resume": {generateFileHeader(t, SampleFileName, []byte("resume"))},
+		}}
+
+		uploadResults, result := UploadMapped(form, destinations)
+		assert.Equal(t, 0, len(uploadResults))
+		assert.Equal(t, 0, len(result.Succeeded))
+		assert.Equal(t, 2, len(result.Failed))
+		assert.True(t, errors.Is(result.KeyErr("mapped/avatar"), ErrUnmappedField))
+		assert.True(t, errors.Is(result.KeyErr("resume"), ErrUnmappedField))
+	})
+	t.Run("verify files sharing a key and files without a region are rejected", func(t *testing.T) {
+		form := &multipart.Form{File: map[string][]*multipart.FileHeader{
+			"avatar": {
+				generateFileHeader(t, SampleFileName, []byte("avatar")),
+				generateFileHeader(t, SampleFileName, []byte("second avatar")),
+			},
+		}}
+
+		_, result := UploadMapped(form, map[string]Destination{"avatar": {Bucket: S3Bucket, Key: "mapped/avatar"}})
+		assert.Equal(t, 2, len(result.Failed))
+		assert.True(t, errors.Is(result.Failed[0], ErrParameterRegionEmpty))
+		assert.True(t, errors.Is(result.Failed[1], ErrDuplicateKey))
+	})
+	t.Run("verify each field is uploaded to its destination with its options", func(t *testing.T) {
+		form := &multipart.Form{File: map[string][]*multipart.FileHeader{
+			"avatar":   {generateFileHeader(t, SampleFileName, make([]byte, 2048))},
+			"document": {generateFileHeader(t, SampleFileName, []byte("document"))},
+			"resume":   {generateFileHeader(t, SampleFileName, []byte("resume"))},
+		}}
+
+		uploadResults, result := UploadMapped(form, destinations, WithIgnoreUnmappedFields())
+		assert.Equal(t, 1, len(uploadResults))
+		assert.Equal(t, "mapped/documents/"+SampleFileName, uploadResults[0].Key)
+		assert.True(t, errors.Is(result.KeyErr("mapped/avatar"), ErrFileTooLarge))
+		assert.Nil(t, result.KeyErr("resume"))
+
+		assert.Nil(t, Delete(Region, S3Bucket, uploadResults[0].Key))
+	})
+}
@@ -0,0 +1,236 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The operations reported to a MetricsSink.
+const (
+	OperationDelete   = "delete"
+	OperationDownload = "download"
+	OperationUpload   = "upload"
+)
+
+// Metric describes a single S3 operation.
+type Metric struct {
+	// Operation is one of OperationDelete, OperationDownload, or OperationUpload.
+	Operation string
+	Bucket    string
+	// Bytes is how many bytes of file were transferred.
+	Bytes    int64
+	Duration time.Duration
+	// Err is the error the operation failed with or nil if it succeeded.
+	Err error
+}
+
+// ErrorType names the kind of error m.Err is after the HTTP status StatusCode gives it, e.g. NotFound or BadGateway.
+// It's empty when the operation succeeded.
+func (m Metric) ErrorType() string {
+	if m.Err == nil {
+		return ""
+	}
+
+	return strings.ReplaceAll(http.StatusText(StatusCode(m.Err)), " ", "")
+}
+
+// MetricsSink is told about every upload, download, and delete made WithMetrics. Record is called from whichever
+// goroutine made the S3 request so it must be safe for concurrent use.
+type MetricsSink interface {
+	Record(metric Metric)
+}
+
+// MetricsSinkFunc adapts a function to a MetricsSink.
+type MetricsSinkFunc func(metric Metric)
+
+// Record calls f(metric).
+func (f MetricsSinkFunc) Record(metric Metric) {
+	f(metric)
+}
+
+// recordMetric tells the MetricsSink passed WithMetrics, if any, about an operation that started at start.
+func (o *options) recordMetric(operation, bucket string, start time.Time, bytes int64, err error) {
+	if o.metrics == nil {
+		return
+	}
+
+	o.metrics.Record(Metric{
+		Operation: operation,
+		Bucket:    bucket,
+		Bytes:     bytes,
+		Duration:  time.Since(start),
+		Err:       err,
+	})
+}
+
+// EMFMetrics is a MetricsSink that writes every Metric as a log line in CloudWatch Embedded Metric Format. Lambda
+// sends what it writes to stdout to CloudWatch Logs which turns the lines into Count, Bytes, Duration, and Errors
+// metrics in Namespace, dimensioned by Operation and, for errors, by Operation and ErrorType.
+type EMFMetrics struct {
+	Namespace string
+
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewEMFMetrics returns an EMFMetrics writing to w, which should be os.Stdout on Lambda.
+func NewEMFMetrics(namespace string, w io.Writer) *EMFMetrics {
+	return &EMFMetrics{Namespace: namespace, writer: w}
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDocument struct {
+	AWS       emfMetadata `json:"_aws"`
+	Operation string      `json:"Operation"`
+	Bucket    string      `json:"Bucket"`
+	ErrorType string      `json:"ErrorType,omitempty"`
+	Count     int         `json:"Count"`
+	Bytes     int64       `json:"Bytes"`
+	Duration  float64     `json:"Duration"`
+	Errors    int         `json:"Errors"`
+}
+
+// Record writes metric as a single line of JSON.
+func (e *EMFMetrics) Record(metric Metric) {
+	dimensions := [][]string{{"Operation"}}
+	errors := 0
+	if metric.Err != nil {
+		dimensions = append(dimensions, []string{"Operation", "ErrorType"})
+		errors = 1
+	}
+
+	document := emfDocument{
+		AWS: emfMetadata{
+			Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+			CloudWatchMetrics: []emfDirective{{
+				Namespace:  e.Namespace,
+				Dimensions: dimensions,
+				Metrics: []emfMetricDefinition{
+					{Name: "Count", Unit: "Count"},
+					{Name: "Bytes", Unit: "Bytes"},
+					{Name: "Duration", Unit: "Milliseconds"},
+					{Name: "Errors", Unit: "Count"},
+				},
+			}},
+		},
+		Operation: metric.Operation,
+		Bucket:    metric.Bucket, // a property rather than a dimension so it's searchable without creating a metric per bucket
+		ErrorType: metric.ErrorType(),
+		Count:     1,
+		Bytes:     metric.Bytes,
+		Duration:  float64(metric.Duration) / float64(time.Millisecond),
+		Errors:    errors,
+	}
+
+	documentBytes, _ := json.Marshal(document) // emfDocument only contains strings and numbers so marshalling can't fail
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.writer.Write(append(documentBytes, '\n'))
+}
+
+// PrometheusMetrics is a MetricsSink that totals every Metric in memory and serves the totals in the Prometheus
+// text exposition format so they can be scraped or pushed to a Pushgateway. It reports
+// lambda_s3_operations_total by operation and error_type, lambda_s3_bytes_total by operation, and
+// lambda_s3_duration_seconds as a summary by operation. It's an http.Handler rather than a prometheus.Collector so
+// this package doesn't depend on the Prometheus client. The zero value is ready to use.
+type PrometheusMetrics struct {
+	mutex      sync.Mutex
+	operations map[[2]string]int64
+	bytes      map[string]int64
+	durations  map[string]time.Duration
+	counts     map[string]int64
+}
+
+// Record adds metric to the totals.
+func (p *PrometheusMetrics) Record(metric Metric) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.operations == nil {
+		p.operations = map[[2]string]int64{}
+		p.bytes = map[string]int64{}
+		p.durations = map[string]time.Duration{}
+		p.counts = map[string]int64{}
+	}
+
+	p.operations[[2]string{metric.Operation, metric.ErrorType()}]++
+	p.bytes[metric.Operation] += metric.Bytes
+	p.durations[metric.Operation] += metric.Duration
+	p.counts[metric.Operation]++
+}
+
+// WriteTo writes the totals to w in the Prometheus text exposition format.
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var builder strings.Builder
+
+	builder.WriteString("# HELP lambda_s3_operations_total S3 operations made by lambda_s3.\n")
+	builder.WriteString("# TYPE lambda_s3_operations_total counter\n")
+	operationKeys := make([][2]string, 0, len(p.operations))
+	for operationKey := range p.operations {
+		operationKeys = append(operationKeys, operationKey)
+	}
+	sort.Slice(operationKeys, func(i, j int) bool {
+		if operationKeys[i][0] != operationKeys[j][0] {
+			return operationKeys[i][0] < operationKeys[j][0]
+		}
+		return operationKeys[i][1] < operationKeys[j][1]
+	})
+	for _, operationKey := range operationKeys {
+		fmt.Fprintf(&builder, "lambda_s3_operations_total{operation=%q,error_type=%q} %d\n", operationKey[0], operationKey[1], p.operations[operationKey])
+	}
+
+	operations := make([]string, 0, len(p.counts))
+	for operation := range p.counts {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+
+	builder.WriteString("# HELP lambda_s3_bytes_total Bytes of file transferred by lambda_s3.\n")
+	builder.WriteString("# TYPE lambda_s3_bytes_total counter\n")
+	for _, operation := range operations {
+		fmt.Fprintf(&builder, "lambda_s3_bytes_total{operation=%q} %d\n", operation, p.bytes[operation])
+	}
+
+	builder.WriteString("# HELP lambda_s3_duration_seconds How long S3 operations made by lambda_s3 took.\n")
+	builder.WriteString("# TYPE lambda_s3_duration_seconds summary\n")
+	for _, operation := range operations {
+		fmt.Fprintf(&builder, "lambda_s3_duration_seconds_sum{operation=%q} %g\n", operation, p.durations[operation].Seconds())
+		fmt.Fprintf(&builder, "lambda_s3_duration_seconds_count{operation=%q} %d\n", operation, p.counts[operation])
+	}
+
+	n, err := io.WriteString(w, builder.String())
+
+	return int64(n), err
+}
+
+// ServeHTTP responds with the totals so PrometheusMetrics can be registered as a /metrics endpoint.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	p.WriteTo(w)
+}
@@ -0,0 +1,85 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetric(t *testing.T) {
+	t.Run("verify ErrorType names the status of the error", func(t *testing.T) {
+		assert.Equal(t, "", Metric{}.ErrorType())
+		assert.Equal(t, "NotFound", Metric{Err: ErrObjectNotFound}.ErrorType())
+		assert.Equal(t, "BadGateway", Metric{Err: ErrDownloadingS3File}.ErrorType())
+	})
+	t.Run("verify failed transfers are recorded", func(t *testing.T) {
+		var metrics []Metric
+		sink := MetricsSinkFunc(func(metric Metric) {
+			metrics = append(metrics, metric)
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := Download(Region, S3Bucket, S3FileName, WithMetrics(sink), WithContext(ctx))
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, len(metrics))
+		assert.Equal(t, OperationDownload, metrics[0].Operation)
+		assert.Equal(t, S3Bucket, metrics[0].Bucket)
+		assert.True(t, metrics[0].Err == err)
+	})
+}
+
+func TestEMFMetrics(t *testing.T) {
+	t.Run("verify metrics are written in Embedded Metric Format", func(t *testing.T) {
+		var buffer bytes.Buffer
+		emf := NewEMFMetrics("uploads", &buffer)
+
+		emf.Record(Metric{Operation: OperationUpload, Bucket: S3Bucket, Bytes: 100, Duration: 1500 * time.Millisecond})
+		emf.Record(Metric{Operation: OperationDownload, Bucket: S3Bucket, Err: ErrObjectNotFound})
+
+		lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		assert.Equal(t, 2, len(lines))
+
+		var upload map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(lines[0]), &upload))
+		assert.Equal(t, "upload", upload["Operation"])
+		assert.Equal(t, float64(100), upload["Bytes"])
+		assert.Equal(t, float64(1500), upload["Duration"])
+		assert.Equal(t, float64(0), upload["Errors"])
+
+		directive := upload["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "uploads", directive["Namespace"])
+		assert.Equal(t, 1, len(directive["Dimensions"].([]interface{})))
+
+		var download map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(lines[1]), &download))
+		assert.Equal(t, "NotFound", download["ErrorType"])
+		assert.Equal(t, float64(1), download["Errors"])
+	})
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	t.Run("verify totals are served in the text exposition format", func(t *testing.T) {
+		var prometheus PrometheusMetrics
+
+		prometheus.Record(Metric{Operation: OperationUpload, Bytes: 100, Duration: time.Second})
+		prometheus.Record(Metric{Operation: OperationUpload, Bytes: 50, Duration: time.Second})
+		prometheus.Record(Metric{Operation: OperationUpload, Err: ErrUploadingMultiPartFileToS3})
+
+		recorder := httptest.NewRecorder()
+		prometheus.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		body := recorder.Body.String()
+		assert.True(t, strings.Contains(body, `lambda_s3_operations_total{operation="upload",error_type=""} 2`))
+		assert.True(t, strings.Contains(body, `lambda_s3_operations_total{operation="upload",error_type="BadGateway"} 1`))
+		assert.True(t, strings.Contains(body, `lambda_s3_bytes_total{operation="upload"} 150`))
+		assert.True(t, strings.Contains(body, `lambda_s3_duration_seconds_sum{operation="upload"} 2`))
+		assert.True(t, strings.Contains(body, `lambda_s3_duration_seconds_count{operation="upload"} 3`))
+	})
+}
@@ -0,0 +1,55 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"mime/multipart"
+)
+
+var ErrFormInvalid = errors.New("the uploaded form is invalid")
+
+// formContextKey is the context key WrapHandler stores the parsed form under.
+type formContextKey struct{}
+
+// WrapHandler returns a Handler that parses the files and values uploaded in the request, see ParseRequest, before
+// calling handler with a context holding them. Use FormFromContext to get them back. Requests that can't be parsed,
+// or that fail WithMaxSize, WithMaxTotalSize or WithFormValidator, are answered with ErrorResponse and never reach
+// handler so handlers never deal with multipart details. Temporary files are removed once handler returns.
+func WrapHandler(handler Handler, opts ...Option) Handler {
+	return func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		o := newOptions(opts)
+
+		form, err := ParseRequest(lambdaReq, APIGatewayPayloadLimit, opts...)
+		if err != nil {
+			return ErrorResponse(err), nil
+		}
+		defer RemoveForm(form)
+
+		if o.formValidator != nil {
+			if err = o.formValidator(form); err != nil {
+				return ErrorResponse(fmt.Errorf("%w: %s", ErrFormInvalid, err)), nil
+			}
+		}
+
+		return handler(context.WithValue(ctx, formContextKey{}, form), lambdaReq)
+	}
+}
+
+// FormFromContext returns the form WrapHandler parsed for the request ctx belongs to.
+func FormFromContext(ctx context.Context) (*multipart.Form, bool) {
+	form, ok := ctx.Value(formContextKey{}).(*multipart.Form)
+
+	return form, ok
+}
+
+// FilesFromContext returns the files WrapHandler parsed for the request ctx belongs to. See FormFiles.
+func FilesFromContext(ctx context.Context) []*multipart.FileHeader {
+	form, ok := FormFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	return FormFiles(form)
+}
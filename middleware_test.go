@@ -0,0 +1,58 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func TestWrapHandler(t *testing.T) {
+	okHandler := func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK}, nil
+	}
+
+	t.Run("verify bad request when the request can't be parsed", func(t *testing.T) {
+		lambdaReq := generateUploadFileReq()
+		lambdaReq.Headers = map[string]string{}
+
+		res, err := WrapHandler(okHandler)(context.Background(), lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify request entity too large when a file exceeds WithMaxSize", func(t *testing.T) {
+		res, err := WrapHandler(okHandler, WithMaxSize(SampleFileSizeBytes-1))(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+	t.Run("verify bad request when WithFormValidator fails", func(t *testing.T) {
+		validator := WithFormValidator(func(form *multipart.Form) error {
+			return errors.New("title is required")
+		})
+
+		res, err := WrapHandler(okHandler, validator)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify the parsed files are in the context", func(t *testing.T) {
+		var files []*multipart.FileHeader
+		handler := func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			files = FilesFromContext(ctx)
+			return okHandler(ctx, lambdaReq)
+		}
+
+		res, err := WrapHandler(handler)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, 1, len(files))
+		assert.Equal(t, SampleFileName, files[0].Filename)
+	})
+	t.Run("verify FormFromContext without WrapHandler", func(t *testing.T) {
+		_, ok := FormFromContext(context.Background())
+		assert.False(t, ok)
+		assert.Equal(t, 0, len(FilesFromContext(context.Background())))
+	})
+}
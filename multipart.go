@@ -0,0 +1,312 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// MaxPartNumber is the highest part number S3 accepts and MinPartSize the smallest size of every part but the last.
+const (
+	MaxPartNumber = 10000
+	MinPartSize   = 5 << 20
+)
+
+var (
+	ErrAbortingMultipartUpload   = errors.New("unable to abort the incomplete multipart upload")
+	ErrCompletingMultipartUpload = errors.New("unable to complete the multipart upload. every part but the last must be at least MinPartSize bytes")
+	ErrCreatingMultipartUpload   = errors.New("unable to create the multipart upload")
+	ErrListingMultipartUploads   = errors.New("unable to list the in-progress multipart uploads")
+	ErrParameterPartNumber       = errors.New("required parameter partNumber must be between 1 and MaxPartNumber")
+	ErrParameterUploadIDEmpty    = errors.New("required parameter UploadID is empty")
+	ErrUploadingPart             = errors.New("unable to upload the part of the multipart upload")
+)
+
+// AbortIncompleteUploads aborts the multipart uploads to bucket under prefix that were started more than olderThan
+// ago and never completed, which usually means the Lambda uploading them timed out or crashed. S3 keeps, and bills
+// for, the parts of incomplete uploads until they're aborted. An empty prefix covers the whole bucket.
+// It returns the keys of the aborted uploads. If some uploads can't be aborted the rest are still attempted and the
+// keys that were aborted are returned along with ErrAbortingMultipartUpload.
+// A lifecycle rule with AbortIncompleteMultipartUpload does the same thing on a schedule without any code.
+func AbortIncompleteUploads(region, bucket, prefix string, olderThan time.Duration) ([]string, error) {
+	if region == "" {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	awsSession, err := newOptions(nil).newSession(region)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	s3Client := s3.New(awsSession)
+	cutoff := time.Now().Add(-olderThan)
+
+	var staleUploads []*s3.MultipartUpload
+	err = s3Client.ListMultipartUploadsPagesWithContext(aws.BackgroundContext(), &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			if aws.TimeValue(upload.Initiated).Before(cutoff) {
+				staleUploads = append(staleUploads, upload)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, ErrListingMultipartUploads
+	}
+
+	var aborted []string
+	var abortErr error
+
+	for _, upload := range staleUploads {
+		_, err = s3Client.AbortMultipartUploadWithContext(aws.BackgroundContext(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		})
+		if err != nil {
+			if !isNoSuchUpload(err) { // completed or aborted since it was listed
+				abortErr = fmt.Errorf("%w: %s", ErrAbortingMultipartUpload, aws.StringValue(upload.Key))
+			}
+			continue
+		}
+
+		aborted = append(aborted, aws.StringValue(upload.Key))
+	}
+
+	return aborted, abortErr
+}
+
+// ResumableUpload is a multipart upload that outlives the invocation that started it. Files too large to upload
+// within a single invocation's timeout are uploaded a part at a time by successive invocations, or the states of a
+// Step Functions workflow, which pass the ResumableUpload between them. It marshals to JSON for that purpose.
+// Start one with CreateUpload, send the parts with UploadPart, in any order and from any number of invocations,
+// and finish with Complete. Uploads that are never completed should be cleaned up with Abort or
+// AbortIncompleteUploads.
+type ResumableUpload struct {
+	Region   string `json:"region"`
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"uploadID"`
+}
+
+// UploadedPart describes a part uploaded with ResumableUpload.UploadPart.
+type UploadedPart struct {
+	PartNumber int64  `json:"partNumber"`
+	ETag       string `json:"eTag"`
+	Size       int64  `json:"size"`
+}
+
+// CreateUpload starts a ResumableUpload of the file called name to bucket. contentType is optional.
+// WithRequesterPays and WithTransferAcceleration apply to the upload, the options that transform the file's
+// contents do not.
+func CreateUpload(region, bucket, name, contentType string, opts ...Option) (*ResumableUpload, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		return nil, ErrParameterNameEmpty
+	}
+
+	awsSession, err := newOptions(opts).newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	}
+
+	if contentType != "" {
+		createInput.ContentType = aws.String(contentType)
+	}
+
+	createOutput, err := s3.New(awsSession).CreateMultipartUploadWithContext(aws.BackgroundContext(), createInput)
+	if err != nil {
+		return nil, ErrCreatingMultipartUpload
+	}
+
+	return &ResumableUpload{
+		Region:   region,
+		Bucket:   bucket,
+		Key:      name,
+		UploadID: aws.StringValue(createOutput.UploadId),
+	}, nil
+}
+
+// client validates u and creates an S3 client for it.
+func (u *ResumableUpload) client(opts []Option) (*s3.S3, error) {
+	if u.Region == "" {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(u.Bucket); err != nil {
+		return nil, err
+	}
+
+	if u.Key == "" {
+		return nil, ErrParameterNameEmpty
+	}
+
+	if u.UploadID == "" {
+		return nil, ErrParameterUploadIDEmpty
+	}
+
+	awsSession, err := newOptions(opts).newSession(u.Region)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	return s3.New(awsSession), nil
+}
+
+// UploadPart uploads body as part partNumber of the file. Parts are numbered from 1 to MaxPartNumber and are put
+// together in that order no matter the order they're uploaded in. Uploading a part number again replaces the part.
+func (u *ResumableUpload) UploadPart(partNumber int64, body io.ReadSeeker, opts ...Option) (*UploadedPart, error) {
+	if partNumber < 1 || partNumber > MaxPartNumber {
+		return nil, ErrParameterPartNumber
+	}
+
+	s3Client, err := u.client(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, ErrUploadingPart
+	}
+
+	if _, err = body.Seek(0, io.SeekStart); err != nil {
+		return nil, ErrUploadingPart
+	}
+
+	uploadPartOutput, err := s3Client.UploadPartWithContext(aws.BackgroundContext(), &s3.UploadPartInput{
+		Bucket:     aws.String(u.Bucket),
+		Key:        aws.String(u.Key),
+		UploadId:   aws.String(u.UploadID),
+		PartNumber: aws.Int64(partNumber),
+		Body:       body,
+	})
+	if err != nil {
+		return nil, ErrUploadingPart
+	}
+
+	return &UploadedPart{
+		PartNumber: partNumber,
+		ETag:       aws.StringValue(uploadPartOutput.ETag),
+		Size:       size,
+	}, nil
+}
+
+// Parts lists the parts uploaded so far in part number order so an interrupted upload can pick up where it left off.
+func (u *ResumableUpload) Parts(opts ...Option) ([]*UploadedPart, error) {
+	s3Client, err := u.client(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.listParts(s3Client)
+}
+
+func (u *ResumableUpload) listParts(s3Client *s3.S3) ([]*UploadedPart, error) {
+	var parts []*UploadedPart
+
+	err := s3Client.ListPartsPagesWithContext(aws.BackgroundContext(), &s3.ListPartsInput{
+		Bucket:   aws.String(u.Bucket),
+		Key:      aws.String(u.Key),
+		UploadId: aws.String(u.UploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			parts = append(parts, &UploadedPart{
+				PartNumber: aws.Int64Value(part.PartNumber),
+				ETag:       aws.StringValue(part.ETag),
+				Size:       aws.Int64Value(part.Size),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, ErrListingMultipartUploads
+	}
+
+	return parts, nil
+}
+
+// Complete puts the uploaded parts together into the final object. The parts are looked up in S3 so they don't
+// need to be collected from the invocations that uploaded them.
+func (u *ResumableUpload) Complete(opts ...Option) (*UploadRes, error) {
+	s3Client, err := u.client(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := u.listParts(s3Client)
+	if err != nil {
+		return nil, err
+	}
+
+	var bytesUploaded int64
+	completedParts := make([]*s3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		bytesUploaded += part.Size
+		completedParts = append(completedParts, &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(part.PartNumber),
+		})
+	}
+
+	completeOutput, err := s3Client.CompleteMultipartUploadWithContext(aws.BackgroundContext(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.Bucket),
+		Key:             aws.String(u.Key),
+		UploadId:        aws.String(u.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completedParts},
+	})
+	if err != nil {
+		return nil, ErrCompletingMultipartUpload
+	}
+
+	return &UploadRes{
+		Key:           u.Key,
+		S3Path:        filepath.Join(u.Bucket, u.Key),
+		S3URL:         newOptions(opts).objectURL(u.Bucket, u.Key, aws.StringValue(completeOutput.Location)),
+		ETag:          aws.StringValue(completeOutput.ETag),
+		VersionID:     aws.StringValue(completeOutput.VersionId),
+		BytesUploaded: bytesUploaded,
+	}, nil
+}
+
+// Abort abandons the upload and deletes the parts uploaded so far.
+func (u *ResumableUpload) Abort(opts ...Option) error {
+	s3Client, err := u.client(opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3Client.AbortMultipartUploadWithContext(aws.BackgroundContext(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(u.Bucket),
+		Key:      aws.String(u.Key),
+		UploadId: aws.String(u.UploadID),
+	})
+	if err != nil && !isNoSuchUpload(err) {
+		return ErrAbortingMultipartUpload
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+	"time"
+)
+
+const S3MultipartPrefix = "multipart"
+
+func TestAbortIncompleteUploads(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		aborted, err := AbortIncompleteUploads("", S3Bucket, S3MultipartPrefix, time.Hour)
+		assert.Equal(t, 0, len(aborted))
+		assert.Equal(t, ErrParameterRegionEmpty, err)
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		aborted, err := AbortIncompleteUploads(Region, "", S3MultipartPrefix, time.Hour)
+		assert.Equal(t, 0, len(aborted))
+		assert.Equal(t, ErrParameterBucketEmpty, err)
+	})
+	t.Run("verify only stale uploads are aborted", func(t *testing.T) {
+		awsSession, err := newOptions(nil).newSession(Region)
+		assert.Nil(t, err)
+
+		key := S3MultipartPrefix + "/abandoned"
+		_, err = s3.New(awsSession).CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String(S3Bucket),
+			Key:    aws.String(key),
+		})
+		assert.Nil(t, err)
+
+		aborted, err := AbortIncompleteUploads(Region, S3Bucket, S3MultipartPrefix, time.Hour)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(aborted))
+
+		aborted, err = AbortIncompleteUploads(Region, S3Bucket, S3MultipartPrefix, 0)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, []string{key}, aborted)
+	})
+}
+
+func TestResumableUpload(t *testing.T) {
+	t.Run("verify err when name is empty", func(t *testing.T) {
+		resumableUpload, err := CreateUpload(Region, S3Bucket, "", "")
+		assert.Equal(t, resumableUpload, (*ResumableUpload)(nil))
+		assert.Equal(t, ErrParameterNameEmpty, err)
+	})
+	t.Run("verify err when the upload ID is empty", func(t *testing.T) {
+		resumableUpload := &ResumableUpload{Region: Region, Bucket: S3Bucket, Key: S3MultipartPrefix + "/resumable"}
+
+		uploadedPart, err := resumableUpload.UploadPart(1, bytes.NewReader([]byte("part")))
+		assert.Equal(t, uploadedPart, (*UploadedPart)(nil))
+		assert.Equal(t, ErrParameterUploadIDEmpty, err)
+
+		uploadRes, err := resumableUpload.Complete()
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.Equal(t, ErrParameterUploadIDEmpty, err)
+	})
+	t.Run("verify err when the part number is out of range", func(t *testing.T) {
+		resumableUpload := &ResumableUpload{Region: Region, Bucket: S3Bucket, Key: S3MultipartPrefix + "/resumable", UploadID: "id"}
+
+		for _, partNumber := range []int64{0, MaxPartNumber + 1} {
+			uploadedPart, err := resumableUpload.UploadPart(partNumber, bytes.NewReader([]byte("part")))
+			assert.Equal(t, uploadedPart, (*UploadedPart)(nil))
+			assert.Equal(t, ErrParameterPartNumber, err)
+		}
+	})
+	t.Run("verify parts uploaded by separate invocations are put together", func(t *testing.T) {
+		resumableUpload, err := CreateUpload(Region, S3Bucket, S3MultipartPrefix+"/resumable", "text/plain")
+		assert.Nil(t, err)
+
+		// what a Step Functions state would hand to the next invocation
+		state, err := json.Marshal(resumableUpload)
+		assert.Nil(t, err)
+
+		firstPart := bytes.Repeat([]byte("a"), MinPartSize)
+		lastPart := []byte("the end")
+
+		// upload the parts out of order from "different" invocations
+		var lastInvocation ResumableUpload
+		assert.Nil(t, json.Unmarshal(state, &lastInvocation))
+		_, err = lastInvocation.UploadPart(2, bytes.NewReader(lastPart))
+		assert.Nil(t, err)
+
+		var firstInvocation ResumableUpload
+		assert.Nil(t, json.Unmarshal(state, &firstInvocation))
+		uploadedPart, err := firstInvocation.UploadPart(1, bytes.NewReader(firstPart))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(MinPartSize), uploadedPart.Size)
+
+		parts, err := resumableUpload.Parts()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(parts))
+
+		uploadRes, err := resumableUpload.Complete()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(firstPart)+len(lastPart)), uploadRes.BytesUploaded)
+
+		fileBytes, err := Download(Region, S3Bucket, resumableUpload.Key)
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(append(firstPart, lastPart...), fileBytes))
+
+		assert.Nil(t, Delete(Region, S3Bucket, resumableUpload.Key))
+	})
+}
@@ -0,0 +1,96 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"time"
+)
+
+// The Source and DetailType of the EventBridge events published WithEventBridgeNotification.
+const (
+	UploadEventSource     = "lambda_s3"
+	UploadEventDetailType = "Object Uploaded"
+)
+
+var ErrPublishingUploadEvent = errors.New("the file was uploaded but the UploadEvent couldn't be published")
+
+// UploadEvent is published after every successful upload made WithSNSNotification or WithEventBridgeNotification.
+// Unlike S3 event notifications it carries the checksum and content type of the file and any metadata the
+// uploader attached WithEventMetadata. Uploader is set WithUploader.
+type UploadEvent struct {
+	Bucket         string            `json:"bucket"`
+	Key            string            `json:"key"`
+	Size           int64             `json:"size"`
+	ContentType    string            `json:"contentType,omitempty"`
+	ETag           string            `json:"eTag,omitempty"`
+	VersionID      string            `json:"versionID,omitempty"`
+	ChecksumSHA256 string            `json:"checksumSHA256,omitempty"`
+	Uploader       string            `json:"uploader,omitempty"`
+	UploadedAt     time.Time         `json:"uploadedAt"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+func newUploadEvent(bucket string, uploadRes *UploadRes, metadata map[string]string) *UploadEvent {
+	return &UploadEvent{
+		Bucket:         bucket,
+		Key:            uploadRes.Key,
+		Size:           uploadRes.BytesUploaded,
+		ContentType:    uploadRes.ContentType,
+		ETag:           uploadRes.ETag,
+		VersionID:      uploadRes.VersionID,
+		ChecksumSHA256: uploadRes.ChecksumSHA256,
+		UploadedAt:     time.Now().UTC(),
+		Metadata:       metadata,
+	}
+}
+
+// publishUploadEvent publishes uploadEvent to every destination o asks for.
+func publishUploadEvent(uploadEvent *UploadEvent, o *options) error {
+	if o.snsTopicARN == "" && o.eventBusName == "" {
+		return nil
+	}
+
+	if o.awsSession == nil {
+		return fmt.Errorf("%w: no AWS Session to publish with", ErrPublishingUploadEvent)
+	}
+
+	detail, err := json.Marshal(uploadEvent)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPublishingUploadEvent, err)
+	}
+
+	if o.snsTopicARN != "" {
+		_, err = sns.New(o.awsSession).PublishWithContext(o.context(), &sns.PublishInput{
+			TopicArn: aws.String(o.snsTopicARN),
+			Subject:  aws.String(UploadEventDetailType),
+			Message:  aws.String(string(detail)),
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrPublishingUploadEvent, err)
+		}
+	}
+
+	if o.eventBusName != "" {
+		putEventsOutput, err := eventbridge.New(o.awsSession).PutEventsWithContext(o.context(), &eventbridge.PutEventsInput{
+			Entries: []*eventbridge.PutEventsRequestEntry{{
+				EventBusName: aws.String(o.eventBusName),
+				Source:       aws.String(UploadEventSource),
+				DetailType:   aws.String(UploadEventDetailType),
+				Detail:       aws.String(string(detail)),
+			}},
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrPublishingUploadEvent, err)
+		}
+
+		if aws.Int64Value(putEventsOutput.FailedEntryCount) > 0 {
+			return fmt.Errorf("%w: %s", ErrPublishingUploadEvent, aws.StringValue(putEventsOutput.Entries[0].ErrorMessage))
+		}
+	}
+
+	return nil
+}
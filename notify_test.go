@@ -0,0 +1,41 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestPublishUploadEvent(t *testing.T) {
+	uploadRes := &UploadRes{
+		Key:            S3FileName,
+		BytesUploaded:  SampleFileSizeBytes,
+		ContentType:    "text/csv",
+		ChecksumSHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+
+	t.Run("verify UploadEvent describes the upload", func(t *testing.T) {
+		uploadEvent := newUploadEvent(S3Bucket, uploadRes, map[string]string{"userID": "42"})
+
+		eventBytes, err := json.Marshal(uploadEvent)
+		assert.Nil(t, err)
+
+		var detail map[string]interface{}
+		assert.Nil(t, json.Unmarshal(eventBytes, &detail))
+		assert.Equal(t, S3Bucket, detail["bucket"])
+		assert.Equal(t, S3FileName, detail["key"])
+		assert.Equal(t, float64(SampleFileSizeBytes), detail["size"])
+		assert.Equal(t, uploadRes.ChecksumSHA256, detail["checksumSHA256"])
+		assert.DeepEqual(t, map[string]interface{}{"userID": "42"}, detail["metadata"])
+	})
+	t.Run("verify nothing is published without a destination", func(t *testing.T) {
+		assert.Nil(t, publishUploadEvent(newUploadEvent(S3Bucket, uploadRes, nil), newOptions(nil)))
+	})
+	t.Run("verify err when there's no session to publish with", func(t *testing.T) {
+		o := newOptions([]Option{WithSNSNotification("arn:aws:sns:us-east-2:123456789012:uploads")})
+
+		err := publishUploadEvent(newUploadEvent(S3Bucket, uploadRes, nil), o)
+		assert.True(t, errors.Is(err, ErrPublishingUploadEvent))
+	})
+}
@@ -0,0 +1,227 @@
+package lambda_s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrFetchingOriginalObject     = errors.New("unable to fetch the original object from the presigned URL in the S3 Object Lambda event")
+	ErrParameterObjectLambdaEvent = errors.New("required parameter event is missing the output route or token of the S3 Object Lambda request")
+	ErrWritingObjectLambdaResult  = errors.New("unable to write the S3 Object Lambda response")
+)
+
+// ObjectLambdaEvent is the event S3 invokes the Lambda backing an S3 Object Lambda access point with for GetObject
+// requests. https://docs.aws.amazon.com/AmazonS3/latest/userguide/olap-event-context.html
+type ObjectLambdaEvent struct {
+	RequestID        string                    `json:"xAmzRequestId"`
+	GetObjectContext *ObjectLambdaGetContext   `json:"getObjectContext"`
+	Configuration    ObjectLambdaConfiguration `json:"configuration"`
+	UserRequest      ObjectLambdaUserRequest   `json:"userRequest"`
+	UserIdentity     map[string]interface{}    `json:"userIdentity"`
+	ProtocolVersion  string                    `json:"protocolVersion"`
+}
+
+// ObjectLambdaGetContext is where the Lambda reads the original object from, InputS3URL which is presigned, and the
+// route and token it passes to WriteGetObjectResponse to answer the request.
+type ObjectLambdaGetContext struct {
+	InputS3URL  string `json:"inputS3Url"`
+	OutputRoute string `json:"outputRoute"`
+	OutputToken string `json:"outputToken"`
+}
+
+// ObjectLambdaConfiguration is the Object Lambda access point the request was made to, the access point it reads the
+// original from, and the payload configured on the access point for the Lambda.
+type ObjectLambdaConfiguration struct {
+	AccessPointARN           string `json:"accessPointArn"`
+	SupportingAccessPointARN string `json:"supportingAccessPointArn"`
+	Payload                  string `json:"payload"`
+}
+
+// ObjectLambdaUserRequest is the request the caller made to the Object Lambda access point.
+type ObjectLambdaUserRequest struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// Key is the key of the object the caller requested, decoded from the path of their request.
+func (e ObjectLambdaEvent) Key() (string, error) {
+	userURL, err := url.Parse(e.UserRequest.URL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrDecodingEventKey, e.UserRequest.URL)
+	}
+
+	return strings.TrimPrefix(userURL.Path, "/"), nil
+}
+
+// region is the region of the Object Lambda access point, which WriteGetObjectResponse has to be sent to.
+func (e ObjectLambdaEvent) region() string {
+	parsed, err := arn.Parse(e.Configuration.AccessPointARN)
+	if err != nil {
+		return ""
+	}
+
+	return parsed.Region
+}
+
+// TransformObjectLambda answers the GetObject request in event, from the Lambda backing an S3 Object Lambda access
+// point, with the original object streamed through fn. fn reads the original from r and writes the result to w,
+// which is streamed to S3 with WriteGetObjectResponse as it's written so the object is never held in memory. The
+// Content-Type of the original is kept. When the original can't be fetched, such as when it doesn't exist, S3's
+// error is passed on to the caller. When fn returns an error the caller gets a 500 and TransformObjectLambda returns
+// the error wrapped in ErrTransformingFile.
+func TransformObjectLambda(event ObjectLambdaEvent, fn func(r io.Reader, w io.Writer) error, opts ...Option) error {
+	if event.GetObjectContext == nil || event.GetObjectContext.OutputRoute == "" || event.GetObjectContext.OutputToken == "" {
+		return ErrParameterObjectLambdaEvent
+	}
+
+	if fn == nil {
+		return ErrParameterTransformFunc
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newSession(event.region())
+	if err != nil {
+		return ErrNewAWSSession
+	}
+
+	ctx, cancel, err := o.transferContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	err = transformObjectLambda(ctx, s3.New(awsSession), http.DefaultClient, event, fn)
+	if err != nil && o.deadlineExceeded(ctx) {
+		return ErrDeadlineTooClose
+	}
+
+	return err
+}
+
+// WriteObjectLambdaError answers the GetObject request in event with err instead of the object, with the status code
+// StatusCode picks for err, e.g. when the caller isn't allowed to see the object.
+func WriteObjectLambdaError(event ObjectLambdaEvent, err error, opts ...Option) error {
+	if event.GetObjectContext == nil || event.GetObjectContext.OutputRoute == "" || event.GetObjectContext.OutputToken == "" {
+		return ErrParameterObjectLambdaEvent
+	}
+
+	o := newOptions(opts)
+
+	awsSession, sessionErr := o.newSession(event.region())
+	if sessionErr != nil {
+		return ErrNewAWSSession
+	}
+
+	statusCode := StatusCode(err)
+
+	message := http.StatusText(statusCode)
+	if err != nil {
+		message = err.Error()
+	}
+
+	return writeObjectLambdaError(o.context(), s3.New(awsSession), event, statusCode, errorCode(statusCode), message)
+}
+
+func transformObjectLambda(ctx context.Context, s3Client s3iface.S3API, httpClient *http.Client, event ObjectLambdaEvent, fn func(r io.Reader, w io.Writer) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, event.GetObjectContext.InputS3URL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFetchingOriginalObject, err)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFetchingOriginalObject, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		code, message := s3ErrorCode(res)
+		if err = writeObjectLambdaError(ctx, s3Client, event, res.StatusCode, code, message); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w: %s %s", ErrFetchingOriginalObject, res.Status, code)
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+
+	fnErr := make(chan error, 1)
+	go func() {
+		err := fn(res.Body, pipeWriter)
+		pipeWriter.CloseWithError(err) // a nil err closes the pipe normally which ends the response
+		fnErr <- err
+	}()
+
+	writeGetObjectResponseInput := &s3.WriteGetObjectResponseInput{
+		Body:         aws.ReadSeekCloser(pipeReader), // not seekable, so the SDK streams it instead of buffering it
+		RequestRoute: aws.String(event.GetObjectContext.OutputRoute),
+		RequestToken: aws.String(event.GetObjectContext.OutputToken),
+		StatusCode:   aws.Int64(http.StatusOK),
+	}
+
+	if contentType := res.Header.Get("Content-Type"); contentType != "" {
+		writeGetObjectResponseInput.ContentType = aws.String(contentType)
+	}
+
+	_, err = s3Client.WriteGetObjectResponseWithContext(ctx, writeGetObjectResponseInput)
+	pipeReader.CloseWithError(errUploadStopped) // unblocks fn if the response stopped reading early
+
+	if transformErr := <-fnErr; transformErr != nil && !errors.Is(transformErr, errUploadStopped) {
+		// best effort, S3 may have already given up on the response that failed part way through
+		_ = writeObjectLambdaError(ctx, s3Client, event, http.StatusInternalServerError, errorCode(http.StatusInternalServerError), "the object could not be transformed")
+		return fmt.Errorf("%w: %s", ErrTransformingFile, transformErr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWritingObjectLambdaResult, err)
+	}
+
+	return nil
+}
+
+func writeObjectLambdaError(ctx context.Context, s3Client s3iface.S3API, event ObjectLambdaEvent, statusCode int, code, message string) error {
+	_, err := s3Client.WriteGetObjectResponseWithContext(ctx, &s3.WriteGetObjectResponseInput{
+		ErrorCode:    aws.String(code),
+		ErrorMessage: aws.String(message),
+		RequestRoute: aws.String(event.GetObjectContext.OutputRoute),
+		RequestToken: aws.String(event.GetObjectContext.OutputToken),
+		StatusCode:   aws.Int64(int64(statusCode)),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWritingObjectLambdaResult, err)
+	}
+
+	return nil
+}
+
+// errorCode is an S3 style error code for statusCode, e.g. NotFound for 404.
+func errorCode(statusCode int) string {
+	return strings.ReplaceAll(http.StatusText(statusCode), " ", "")
+}
+
+// s3ErrorCode reads the code and message of the XML error S3 responded to the presigned URL with, falling back to
+// the status code when the body isn't one.
+func s3ErrorCode(res *http.Response) (string, string) {
+	var s3Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	if err := xml.NewDecoder(io.LimitReader(res.Body, 64*1024)).Decode(&s3Error); err != nil || s3Error.Code == "" {
+		return errorCode(res.StatusCode), res.Status
+	}
+
+	return s3Error.Code, s3Error.Message
+}
@@ -0,0 +1,128 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// responseWriter records the WriteGetObjectResponse requests it gets and the bodies it reads from them.
+type responseWriter struct {
+	s3iface.S3API
+	inputs []*s3.WriteGetObjectResponseInput
+	bodies []string
+}
+
+func (r *responseWriter) WriteGetObjectResponseWithContext(_ aws.Context, input *s3.WriteGetObjectResponseInput, _ ...request.Option) (*s3.WriteGetObjectResponseOutput, error) {
+	r.inputs = append(r.inputs, input)
+
+	var body []byte
+	if input.Body != nil {
+		var err error
+		if body, err = io.ReadAll(input.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	r.bodies = append(r.bodies, string(body))
+
+	return &s3.WriteGetObjectResponseOutput{}, nil
+}
+
+func newObjectLambdaEvent(inputS3URL string) ObjectLambdaEvent {
+	return ObjectLambdaEvent{
+		GetObjectContext: &ObjectLambdaGetContext{InputS3URL: inputS3URL, OutputRoute: "io-route", OutputToken: "token"},
+		Configuration:    ObjectLambdaConfiguration{AccessPointARN: "arn:aws:s3-object-lambda:us-west-2:123456789012:accesspoint/redact"},
+		UserRequest:      ObjectLambdaUserRequest{URL: "https://redact-123456789012.s3-object-lambda.us-west-2.amazonaws.com/docs/q3%20report.txt"},
+	}
+}
+
+func upperCase(r io.Reader, w io.Writer) error {
+	original, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(bytes.ToUpper(original))
+	return err
+}
+
+func TestTransformObjectLambda(t *testing.T) {
+	original := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("top secret"))
+	}))
+	defer original.Close()
+
+	t.Run("verify err when the event has no output token", func(t *testing.T) {
+		event := newObjectLambdaEvent(original.URL)
+		event.GetObjectContext.OutputToken = ""
+
+		err := TransformObjectLambda(event, upperCase)
+		assert.True(t, errors.Is(err, ErrParameterObjectLambdaEvent))
+	})
+	t.Run("verify err when fn is nil", func(t *testing.T) {
+		err := TransformObjectLambda(newObjectLambdaEvent(original.URL), nil)
+		assert.True(t, errors.Is(err, ErrParameterTransformFunc))
+	})
+	t.Run("verify the key and region are read from the event", func(t *testing.T) {
+		event := newObjectLambdaEvent(original.URL)
+
+		key, err := event.Key()
+		assert.Nil(t, err)
+		assert.Equal(t, "docs/q3 report.txt", key)
+		assert.Equal(t, "us-west-2", event.region())
+	})
+	t.Run("verify the original is streamed through fn", func(t *testing.T) {
+		writer := &responseWriter{}
+
+		err := transformObjectLambda(context.Background(), writer, http.DefaultClient, newObjectLambdaEvent(original.URL), upperCase)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(writer.inputs))
+		assert.Equal(t, "TOP SECRET", writer.bodies[0])
+		assert.Equal(t, int64(http.StatusOK), aws.Int64Value(writer.inputs[0].StatusCode))
+		assert.Equal(t, "text/plain", aws.StringValue(writer.inputs[0].ContentType))
+		assert.Equal(t, "io-route", aws.StringValue(writer.inputs[0].RequestRoute))
+		assert.Equal(t, "token", aws.StringValue(writer.inputs[0].RequestToken))
+	})
+	t.Run("verify S3's error is passed on when the original can't be fetched", func(t *testing.T) {
+		writer := &responseWriter{}
+
+		err := transformObjectLambda(context.Background(), writer, http.DefaultClient, newObjectLambdaEvent(original.URL+"/missing"), upperCase)
+		assert.True(t, errors.Is(err, ErrFetchingOriginalObject))
+		assert.Equal(t, 1, len(writer.inputs))
+		assert.Equal(t, int64(http.StatusNotFound), aws.Int64Value(writer.inputs[0].StatusCode))
+		assert.Equal(t, "NoSuchKey", aws.StringValue(writer.inputs[0].ErrorCode))
+	})
+	t.Run("verify the caller gets a 500 when fn fails", func(t *testing.T) {
+		writer := &responseWriter{}
+
+		err := transformObjectLambda(context.Background(), writer, http.DefaultClient, newObjectLambdaEvent(original.URL), func(r io.Reader, w io.Writer) error {
+			return errors.New("unsupported encoding")
+		})
+		assert.True(t, errors.Is(err, ErrTransformingFile))
+		assert.Equal(t, 2, len(writer.inputs))
+		assert.Equal(t, int64(http.StatusInternalServerError), aws.Int64Value(writer.inputs[1].StatusCode))
+		assert.True(t, strings.Contains(err.Error(), "unsupported encoding"))
+	})
+	t.Run("verify error codes are derived from the status code", func(t *testing.T) {
+		assert.Equal(t, "Forbidden", errorCode(StatusCode(ErrForbidden)))
+		assert.Equal(t, "NotFound", errorCode(http.StatusNotFound))
+	})
+}
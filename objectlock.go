@@ -0,0 +1,172 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"time"
+)
+
+// RetentionMode is the Object Lock mode protecting an object until its retain until date.
+type RetentionMode string
+
+const (
+	// RetentionGovernance stops objects being deleted or overwritten unless the caller has
+	// s3:BypassGovernanceRetention and asks to bypass it. See WithBypassGovernance.
+	RetentionGovernance RetentionMode = s3.ObjectLockRetentionModeGovernance
+	// RetentionCompliance stops objects being deleted or overwritten by anyone, including the root user, and its
+	// retain until date can only be extended.
+	RetentionCompliance RetentionMode = s3.ObjectLockRetentionModeCompliance
+)
+
+var (
+	ErrParameterRetention = errors.New("required parameter retention must have a mode of RetentionGovernance or RetentionCompliance and a retain until date in the future")
+	ErrReadingObjectLock  = errors.New("unable to read the object's Object Lock settings")
+	ErrUpdatingObjectLock = errors.New("unable to update the object's Object Lock settings")
+)
+
+// Retention is the Object Lock retention of an object. Objects can only be locked in buckets created with Object
+// Lock enabled.
+type Retention struct {
+	Mode        RetentionMode `json:"mode"`
+	RetainUntil time.Time     `json:"retainUntil"`
+}
+
+func (r Retention) validate() error {
+	if (r.Mode != RetentionGovernance && r.Mode != RetentionCompliance) || !r.RetainUntil.After(time.Now()) {
+		return ErrParameterRetention
+	}
+
+	return nil
+}
+
+// GetRetention returns the retention of the object called name in bucket or nil if it has none.
+func GetRetention(region, bucket, name string, opts ...Option) (*Retention, error) {
+	s3Client, o, err := objectClient(region, bucket, name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s3Client.GetObjectRetentionWithContext(o.context(), &s3.GetObjectRetentionInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if isNoObjectLockConfiguration(err) {
+			return nil, nil
+		}
+		if isNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("%w: %s", ErrReadingObjectLock, err)
+	}
+
+	if output.Retention == nil || output.Retention.Mode == nil {
+		return nil, nil
+	}
+
+	return &Retention{
+		Mode:        RetentionMode(aws.StringValue(output.Retention.Mode)),
+		RetainUntil: aws.TimeValue(output.Retention.RetainUntilDate),
+	}, nil
+}
+
+// PutRetention sets the retention of the object called name in bucket. Retention can always be extended but
+// shortening it, or changing it from governance to compliance mode, needs WithBypassGovernance in governance mode
+// and is impossible in compliance mode.
+func PutRetention(region, bucket, name string, retention Retention, opts ...Option) error {
+	if err := retention.validate(); err != nil {
+		return err
+	}
+
+	s3Client, o, err := objectClient(region, bucket, name, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3Client.PutObjectRetentionWithContext(o.context(), &s3.PutObjectRetentionInput{
+		Bucket:                    aws.String(bucket),
+		Key:                       aws.String(name),
+		BypassGovernanceRetention: aws.Bool(o.bypassGovernance),
+		Retention: &s3.ObjectLockRetention{
+			Mode:            aws.String(string(retention.Mode)),
+			RetainUntilDate: aws.Time(retention.RetainUntil),
+		},
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("%w: %s", ErrUpdatingObjectLock, err)
+	}
+
+	return nil
+}
+
+// GetLegalHold returns whether the object called name in bucket is under a legal hold.
+func GetLegalHold(region, bucket, name string, opts ...Option) (bool, error) {
+	s3Client, o, err := objectClient(region, bucket, name, opts)
+	if err != nil {
+		return false, err
+	}
+
+	output, err := s3Client.GetObjectLegalHoldWithContext(o.context(), &s3.GetObjectLegalHoldInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if isNoObjectLockConfiguration(err) {
+			return false, nil
+		}
+		if isNotFound(err) {
+			return false, ErrObjectNotFound
+		}
+		return false, fmt.Errorf("%w: %s", ErrReadingObjectLock, err)
+	}
+
+	return output.LegalHold != nil && aws.StringValue(output.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn, nil
+}
+
+// PutLegalHold places a legal hold on the object called name in bucket, or removes it when on is false. Objects
+// under a legal hold can't be deleted or overwritten, whatever their retention, until the hold is removed.
+func PutLegalHold(region, bucket, name string, on bool, opts ...Option) error {
+	s3Client, o, err := objectClient(region, bucket, name, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3Client.PutObjectLegalHoldWithContext(o.context(), &s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(name),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(legalHoldStatus(on))},
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return ErrObjectNotFound
+		}
+		return fmt.Errorf("%w: %s", ErrUpdatingObjectLock, err)
+	}
+
+	return nil
+}
+
+func legalHoldStatus(on bool) string {
+	if on {
+		return s3.ObjectLockLegalHoldStatusOn
+	}
+
+	return s3.ObjectLockLegalHoldStatusOff
+}
+
+// isNoObjectLockConfiguration reports whether err says the object has no retention or legal hold, which S3 reports
+// as an error rather than an empty response.
+func isNoObjectLockConfiguration(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == "NoSuchObjectLockConfiguration"
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	t.Run("verify retention needs a known mode and a retain until date in the future", func(t *testing.T) {
+		assert.Nil(t, Retention{Mode: RetentionGovernance, RetainUntil: time.Now().Add(time.Hour)}.validate())
+		assert.Nil(t, Retention{Mode: RetentionCompliance, RetainUntil: time.Now().Add(time.Hour)}.validate())
+		assert.True(t, errors.Is(Retention{Mode: "LOCKED", RetainUntil: time.Now().Add(time.Hour)}.validate(), ErrParameterRetention))
+		assert.True(t, errors.Is(Retention{Mode: RetentionCompliance, RetainUntil: time.Now().Add(-time.Hour)}.validate(), ErrParameterRetention))
+	})
+	t.Run("verify uploads WithRetention err before anything is sent when the retention is invalid", func(t *testing.T) {
+		_, err := UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), Region, S3Bucket, "objectlock/"+SampleFileName, WithRetention(RetentionGovernance, time.Time{}))
+		assert.True(t, errors.Is(err, ErrParameterRetention))
+	})
+	t.Run("verify PutRetention errs when the retention is invalid", func(t *testing.T) {
+		err := PutRetention(Region, S3Bucket, S3FileName, Retention{Mode: RetentionGovernance})
+		assert.True(t, errors.Is(err, ErrParameterRetention))
+	})
+	t.Run("verify err when name is empty", func(t *testing.T) {
+		_, err := GetRetention(Region, S3Bucket, "")
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+	})
+}
+
+func TestLegalHold(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		_, err := GetLegalHold("", S3Bucket, S3FileName)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+
+		err = PutLegalHold("", S3Bucket, S3FileName, true)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify objects without a lock aren't an error", func(t *testing.T) {
+		assert.True(t, isNoObjectLockConfiguration(awserr.New("NoSuchObjectLockConfiguration", "", nil)))
+		assert.False(t, isNoObjectLockConfiguration(awserr.New("AccessDenied", "", nil)))
+		assert.Equal(t, "ON", legalHoldStatus(true))
+		assert.Equal(t, "OFF", legalHoldStatus(false))
+	})
+}
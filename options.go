@@ -0,0 +1,789 @@
+package lambda_s3
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"mime/multipart"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Option is a functional option used to tweak the default behavior of the functions in this package.
+// Options that don't apply to a given function are ignored by it.
+type Option func(*options)
+
+// DefaultConcurrency is the number of simultaneous S3 transfers batch helpers such as DownloadMany use
+// unless WithConcurrency says otherwise.
+const DefaultConcurrency = 8
+
+type options struct {
+	// awsSession is the session the calling function created. It's set once the session exists so helpers can
+	// create clients for services other than S3 without callers threading the session through.
+	awsSession           *session.Session
+	allowEmpty           bool
+	bufferSize           int
+	bypassGovernance     bool
+	cache                *Cache
+	cacheControl         string
+	cacheDecrypted       bool
+	cannedACL            CannedACL
+	checksum             bool
+	concurrency          int
+	contentDisposition   string
+	contentLanguage      string
+	contentLength        int64
+	customerKey          *customerKey
+	ctx                  context.Context
+	deadlineMargin       time.Duration
+	defaultEncryption    *s3.ServerSideEncryptionByDefault
+	detectBucketRegion   bool
+	dualStack            bool
+	downloadTransformers []Transformer
+	dryRun               bool
+	eventBusName         string
+	eventMetadata        map[string]string
+	expires              time.Time
+	expiry               time.Duration
+	fallbackBucket       string
+	fallbackRegion       string
+	fileFields           []string
+	fips                 bool
+	formValidator        func(form *multipart.Form) error
+	gzip                 bool
+	ifModifiedSince      time.Time
+	ifNoneMatch          bool
+	ignoreUnmappedFields bool
+	// invalidationDistributionID and invalidationPrefix are set by WithInvalidation.
+	invalidationDistributionID string
+	invalidationPrefix         string
+	kmsKeyID                   string
+	legalHold                  bool
+	knownETag                  string
+	manifestName               string
+	maxArchiveEntries          int
+	maxArchiveSize             int64
+	maxDownloadBytes           int64
+	maxSizeBytes               int64
+	maxTotalSizeBytes          int64
+	metrics                    MetricsSink
+	parallelDownload           bool
+	partConcurrency            int
+	partSize                   int64
+	presignedResultExpiry      time.Duration
+	publicAccessBlock          bool
+	publicURL                  string
+	requesterPays              bool
+	responseContentDisposition string
+	responseContentType        string
+	retention                  *Retention
+	scanner                    Scanner
+	snsTopicARN                string
+	tempDir                    string
+	thumbnails                 []Thumbnail
+	tracerProvider             TracerProvider
+	transfers                  transferSemaphore
+	transferAcceleration       bool
+	uploader                   string
+	uploadRecord               *UploadRecord
+	uploadTransformers         []Transformer
+	versioning                 bool
+	waitTimeout                time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		bufferSize:        DefaultBufferSize,
+		concurrency:       DefaultConcurrency,
+		deadlineMargin:    DefaultDeadlineMargin,
+		maxArchiveEntries: DefaultMaxArchiveEntries,
+		maxArchiveSize:    DefaultMaxArchiveSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// context is the context S3 requests are made with.
+func (o *options) context() context.Context {
+	if o.ctx == nil {
+		return aws.BackgroundContext()
+	}
+
+	return o.ctx
+}
+
+// newSession creates the AWS Session for region configured the way o asks for and remembers it in o.awsSession.
+func (o *options) newSession(region string) (*session.Session, error) {
+	config := &aws.Config{
+		Region: aws.String(region),
+		// lets the bucket parameter be an access point ARN from a region other than the session's
+		S3UseARNRegion: aws.Bool(true),
+	}
+
+	if o.transferAcceleration {
+		config.S3UseAccelerate = aws.Bool(true)
+	}
+
+	if o.dualStack {
+		config.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+
+	if o.fips {
+		config.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+
+	awsSession, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	awsSession.Handlers.Validate.PushBack(routeDirectoryBucketRequests(awsSession))
+
+	if o.requesterPays {
+		awsSession.Handlers.Build.PushBack(setRequesterPaysHeader)
+	}
+
+	if o.customerKey != nil {
+		awsSession.Handlers.Validate.PushFront(o.customerKey.setParams)
+	}
+
+	o.awsSession = awsSession
+
+	return awsSession, nil
+}
+
+// objectURL is the URL UploadRes.S3URL reports for bucket/name. s3URL, the URL S3 itself returned, is used unless
+// WithPublicURL says otherwise.
+func (o *options) objectURL(bucket, name, s3URL string) string {
+	if o.publicURL == "" {
+		return s3URL
+	}
+
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escapedName := strings.Join(segments, "/")
+
+	if strings.Contains(o.publicURL, "{key}") {
+		return strings.NewReplacer("{bucket}", bucket, "{key}", escapedName).Replace(o.publicURL)
+	}
+
+	publicURL := strings.TrimSuffix(o.publicURL, "/")
+	if !strings.Contains(publicURL, "://") {
+		publicURL = "https://" + publicURL
+	}
+
+	return publicURL + "/" + escapedName
+}
+
+// WithMaxSize rejects files larger than maxSizeBytes with ErrFileTooLarge before any bytes are sent to S3.
+// A value <= 0 disables the limit which is also the default.
+func WithMaxSize(maxSizeBytes int64) Option {
+	return func(o *options) {
+		o.maxSizeBytes = maxSizeBytes
+	}
+}
+
+// WithAllowEmpty makes downloading a zero byte object, such as a marker or placeholder, succeed with an empty,
+// non-nil byte slice instead of failing with ErrEmptyFileDownloaded.
+func WithAllowEmpty() Option {
+	return func(o *options) {
+		o.allowEmpty = true
+	}
+}
+
+// WithBucketRegion makes requests to the region the bucket is actually in, looked up with GetBucketRegion, rather
+// than the region passed to the function which is then only used as a hint and may be empty. Lookups are cached per
+// bucket for the lifetime of the Lambda. Buckets that can't be looked up fail with ErrNewAWSSession.
+// Use it when buckets move or one Lambda serves buckets in several regions.
+func WithBucketRegion() Option {
+	return func(o *options) {
+		o.detectBucketRegion = true
+	}
+}
+
+// WithBufferSize sets the size of the buffers files are copied through while they're hashed, compressed, and
+// archived. Buffers are pooled and reused by later calls in the same warm Lambda container rather than allocated
+// on every call, so larger buffers cost memory once instead of garbage collection on every invocation.
+// DefaultBufferSize is used by default. Values < 1 are ignored.
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.bufferSize = size
+		}
+	}
+}
+
+// WithBypassGovernance lets PutRetention shorten or remove governance mode retention. The caller needs the
+// s3:BypassGovernanceRetention permission.
+func WithBypassGovernance() Option {
+	return func(o *options) {
+		o.bypassGovernance = true
+	}
+}
+
+// WithCache serves downloads from cache when the cached copy is still current and stores downloaded files in it.
+func WithCache(cache *Cache) Option {
+	return func(o *options) {
+		o.cache = cache
+	}
+}
+
+// WithCacheControl sets the Cache-Control header S3, and CloudFront, serve uploaded objects with, e.g.
+// "public, max-age=31536000, immutable" for files whose key changes with their contents.
+func WithCacheControl(cacheControl string) Option {
+	return func(o *options) {
+		o.cacheControl = cacheControl
+	}
+}
+
+// WithCacheDecrypted lets WithCache keep files that were decrypted on the way down, see Cache. Only use it when the
+// cache, and for disk caches the directory it's in, is no easier to get at than the key the files are encrypted with.
+func WithCacheDecrypted() Option {
+	return func(o *options) {
+		o.cacheDecrypted = true
+	}
+}
+
+// WithCannedACL applies acl to uploaded objects. Uploads to buckets in other accounts usually need
+// ACLBucketOwnerFullControl so the bucket owner can read them.
+func WithCannedACL(acl CannedACL) Option {
+	return func(o *options) {
+		o.cannedACL = acl
+	}
+}
+
+// WithChecksum computes the SHA-256 digest of files as they're uploaded, returns it in UploadRes.ChecksumSHA256
+// and stores it with the object. Files are hashed before they're sent, those that can't be rewound, such as scanned
+// or transformed files, by copying them to WithTempDir first, so the digest is also passed to S3 as
+// x-amz-checksum-sha256 letting S3 reject corrupted single part uploads.
+// When downloading, the digest of the downloaded file is compared to the stored one and ErrChecksumMismatch is
+// returned if they differ or ErrChecksumMissing if the object was uploaded without WithChecksum.
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// WithConcurrency sets how many S3 transfers batch helpers such as DownloadMany run at the same time.
+// Values < 1 are ignored.
+func WithConcurrency(concurrency int) Option {
+	return func(o *options) {
+		if concurrency > 0 {
+			o.concurrency = concurrency
+		}
+	}
+}
+
+// WithContentDisposition sets the Content-Disposition header S3 serves uploaded objects with, which decides whether
+// browsers show them inline or download them, and under what name. See ContentDisposition.
+func WithContentDisposition(contentDisposition string) Option {
+	return func(o *options) {
+		o.contentDisposition = contentDisposition
+	}
+}
+
+// WithContentLanguage sets the Content-Language header S3 serves uploaded objects with, e.g. "en-US".
+func WithContentLanguage(contentLanguage string) Option {
+	return func(o *options) {
+		o.contentLanguage = contentLanguage
+	}
+}
+
+// WithContentLength makes PresignUpload sign the Content-Length of the upload so S3 rejects the upload unless the
+// file is exactly contentLength bytes. Without it a presigned URL accepts a file of any size up to 5 GB.
+func WithContentLength(contentLength int64) Option {
+	return func(o *options) {
+		o.contentLength = contentLength
+	}
+}
+
+// WithContext makes S3 requests with ctx so they're cancelled when it's done. Lambda handlers should pass the
+// context they're invoked with. Defaults to a context that's never done.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithCustomerKey encrypts uploaded objects with SSE-C, server side encryption with a key S3 doesn't keep, and
+// sends the key again to download them. key must be a 32 byte AES-256 key. keyMD5 is the base64 encoded MD5
+// digest of key, which S3 uses to check the key wasn't corrupted on the way, and is computed from key when empty.
+// Objects uploaded WithCustomerKey can't be read without it.
+func WithCustomerKey(key []byte, keyMD5 string) Option {
+	return func(o *options) {
+		o.customerKey = &customerKey{key: string(key), keyMD5: keyMD5}
+	}
+}
+
+// WithDeadlineMargin sets how long before the deadline of the context passed WithContext uploads and downloads are
+// stopped with ErrDeadlineTooClose. Stopped multipart uploads are aborted instead of leaving their parts in S3.
+// Transfers that would start within the margin fail straight away. Defaults to DefaultDeadlineMargin. Zero lets
+// transfers run right up to the deadline.
+func WithDeadlineMargin(margin time.Duration) Option {
+	return func(o *options) {
+		if margin >= 0 {
+			o.deadlineMargin = margin
+		}
+	}
+}
+
+// WithDefaultEncryption makes EnsureBucket set the bucket's default encryption to SSE-KMS with kmsKeyID, and an S3
+// Bucket Key to keep down the number of KMS requests, or to SSE-S3 when kmsKeyID is empty.
+func WithDefaultEncryption(kmsKeyID string) Option {
+	return func(o *options) {
+		o.defaultEncryption = &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256)}
+		if kmsKeyID != "" {
+			o.defaultEncryption = &s3.ServerSideEncryptionByDefault{
+				SSEAlgorithm:   aws.String(s3.ServerSideEncryptionAwsKms),
+				KMSMasterKeyID: aws.String(kmsKeyID),
+			}
+		}
+	}
+}
+
+// WithDualStack makes requests to the dual-stack S3 endpoint, which is reachable over IPv6 as well as IPv4, e.g.
+// s3.dualstack.<region>.amazonaws.com. UploadRes.S3URL is reported on the same endpoint.
+func WithDualStack() Option {
+	return func(o *options) {
+		o.dualStack = true
+	}
+}
+
+// WithDryRun makes functions that change or remove objects check what they would do without doing it.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// WithEventBridgeNotification publishes an UploadEvent to the EventBridge bus eventBusName, a name or ARN, after every
+// successful upload. The events' Source is UploadEventSource and their DetailType is UploadEventDetailType.
+// If the event can't be published the UploadRes is returned along with ErrPublishingUploadEvent.
+func WithEventBridgeNotification(eventBusName string) Option {
+	return func(o *options) {
+		o.eventBusName = eventBusName
+	}
+}
+
+// WithEventMetadata adds metadata to the UploadEvents published WithSNSNotification or WithEventBridgeNotification.
+func WithEventMetadata(metadata map[string]string) Option {
+	return func(o *options) {
+		o.eventMetadata = metadata
+	}
+}
+
+// WithExpires sets the Expires header S3 serves uploaded objects with, after which caches consider them stale.
+// Cache-Control max-age takes precedence over it in every modern cache. It has nothing to do with WithExpiry, which
+// deletes objects.
+func WithExpires(expires time.Time) Option {
+	return func(o *options) {
+		o.expires = expires
+	}
+}
+
+// WithExpiry tags uploaded objects so the lifecycle rule installed by PutExpiryRule(expiry) deletes them once
+// they're expiry old. Lifecycle rules work in whole days so expiry is rounded up to the next day, and S3 deletes
+// expired objects in the background, usually within a day of them expiring.
+func WithExpiry(expiry time.Duration) Option {
+	return func(o *options) {
+		o.expiry = expiry
+	}
+}
+
+// WithFallback makes Download retry against bucket in region, such as the destination of the primary bucket's
+// cross-region replication, when the download from the primary bucket fails because S3 is unavailable or returns
+// an error. It's a simple way to keep serving files through a regional outage. Replication is asynchronous so
+// recently uploaded objects may not be in the replica yet. Only ErrDownloadingS3File, ErrNewAWSSession and
+// ErrChecksumMismatch are retried. Errors caused by the request, such as ErrNotModified, aren't.
+func WithFallback(region, bucket string) Option {
+	return func(o *options) {
+		o.fallbackRegion = region
+		o.fallbackBucket = bucket
+	}
+}
+
+// WithFIPS makes requests to the FIPS 140-2 validated S3 endpoint of the region, as required by FedRAMP and
+// GovCloud workloads, e.g. s3-fips.<region>.amazonaws.com. Regions without one fail when the request is made.
+func WithFIPS() Option {
+	return func(o *options) {
+		o.fips = true
+	}
+}
+
+// WithFileFields names the fields of urlencoded forms that hold base64 encoded files when they're read by
+// ParseRequest or ParseHTTPRequest. See GetURLEncodedHeaders.
+func WithFileFields(fields ...string) Option {
+	return func(o *options) {
+		o.fileFields = append(o.fileFields, fields...)
+	}
+}
+
+// WithFormValidator makes WrapHandler call validate with every parsed form. Requests whose form fails validation
+// are answered with a 400 and ErrFormInvalid wrapping the error validate returned.
+func WithFormValidator(validate func(form *multipart.Form) error) Option {
+	return func(o *options) {
+		o.formValidator = validate
+	}
+}
+
+// WithGzip compresses files with gzip while they're uploaded and stores them with a Content-Encoding of gzip.
+// When downloading, objects stored with a Content-Encoding of gzip are transparently decompressed.
+// Compressed uploads can't be read directly from the file so s3manager buffers each part in memory.
+func WithGzip() Option {
+	return func(o *options) {
+		o.gzip = true
+	}
+}
+
+// WithIfModifiedSince makes downloads return ErrNotModified instead of the file when the object hasn't been
+// modified since ifModifiedSince.
+func WithIfModifiedSince(ifModifiedSince time.Time) Option {
+	return func(o *options) {
+		o.ifModifiedSince = ifModifiedSince
+	}
+}
+
+// WithIfNoneMatch protects existing objects from being overwritten. Uploads to a name that already exists in the
+// bucket fail with ErrObjectAlreadyExists instead. The object is looked for with HeadObject before the upload
+// starts and the upload itself is sent with If-None-Match: * so S3 rejects it if the object appeared in between.
+func WithIfNoneMatch() Option {
+	return func(o *options) {
+		o.ifNoneMatch = true
+	}
+}
+
+// WithIgnoreUnmappedFields makes UploadMapped skip the files in form fields that aren't mapped to a Destination
+// instead of rejecting the whole form.
+func WithIgnoreUnmappedFields() Option {
+	return func(o *options) {
+		o.ignoreUnmappedFields = true
+	}
+}
+
+// WithInvalidation invalidates the file in the CloudFront distribution distributionID after every successful upload
+// or delete so the distribution doesn't keep serving the old file. The path invalidated is pathPrefix followed by the
+// key. pathPrefix is "" when the distribution serves the bucket from its root and, for example, "/files/" when it
+// routes /files/* to the bucket.
+// If the invalidation fails the result of the upload or delete is returned along with ErrInvalidatingCloudFront.
+func WithInvalidation(distributionID, pathPrefix string) Option {
+	return func(o *options) {
+		o.invalidationDistributionID = distributionID
+		o.invalidationPrefix = pathPrefix
+	}
+}
+
+// WithKMSEncryption encrypts files on the client before they're uploaded. A new AES-256 data key is generated under
+// the KMS key kmsKeyID (a key ID, key ARN, alias name, or alias ARN) for every file and the file is encrypted with it
+// while it's streamed to S3. The data key, encrypted by KMS, is stored in the object's metadata. S3 never sees the
+// plaintext file or the plaintext data key.
+// Downloads, SyncDownload, DownloadAsZip and ArchivePrefix made with this option, and the download handlers with
+// Config.KMSKeyID set, decrypt objects encrypted this way transparently as long as the caller is allowed to
+// kms:Decrypt with the key the object was encrypted under, which needn't be kmsKeyID. Without it they return the
+// ciphertext S3 stores, as presigned URLs always do. Encryption happens after WithChecksum and WithGzip so the checksum is
+// still that of the original file. Encrypted files can't be read directly from the multipart file so s3manager
+// buffers each part in memory.
+func WithKMSEncryption(kmsKeyID string) Option {
+	return func(o *options) {
+		o.kmsKeyID = kmsKeyID
+	}
+}
+
+// WithLegalHold places a legal hold on uploaded objects so they can't be deleted or overwritten until it's removed
+// with PutLegalHold. The bucket must have Object Lock enabled.
+func WithLegalHold() Option {
+	return func(o *options) {
+		o.legalHold = true
+	}
+}
+
+// WithManifest makes UploadMany write a Manifest of the files it uploaded, as JSON, to name under its prefix once
+// they're all done, e.g. WithManifest("manifest.json"). Files are uploaded WithChecksum so the manifest has their
+// digests. When the manifest can't be written it's listed in Result.Failed with ErrWritingManifest.
+func WithManifest(name string) Option {
+	return func(o *options) {
+		o.manifestName = name
+		o.checksum = true
+	}
+}
+
+// WithMaxArchiveEntries sets how many entries UploadArchiveContents accepts in a single archive.
+// Values < 1 are ignored.
+func WithMaxArchiveEntries(maxArchiveEntries int) Option {
+	return func(o *options) {
+		if maxArchiveEntries > 0 {
+			o.maxArchiveEntries = maxArchiveEntries
+		}
+	}
+}
+
+// WithMaxArchiveSize sets the total number of uncompressed bytes UploadArchiveContents accepts in a single archive.
+// Values < 1 are ignored.
+func WithMaxArchiveSize(maxArchiveSizeBytes int64) Option {
+	return func(o *options) {
+		if maxArchiveSizeBytes > 0 {
+			o.maxArchiveSize = maxArchiveSizeBytes
+		}
+	}
+}
+
+// WithMaxDownloadBytes makes Download check the size of the object with a HeadObject request before transferring
+// anything and fail with ErrObjectTooLarge if it's larger than maxDownloadBytes, so an unexpectedly huge object
+// can't run a small Lambda function out of memory. The download is pinned to the version that was checked.
+// Values < 1 don't limit the size.
+func WithMaxDownloadBytes(maxDownloadBytes int64) Option {
+	return func(o *options) {
+		o.maxDownloadBytes = maxDownloadBytes
+	}
+}
+
+// WithMaxTotalSize makes GetHeaders reject multipart forms whose parts add up to more than maxTotalSizeBytes with
+// ErrFormTooLarge. A value <= 0 disables the limit which is also the default.
+func WithMaxTotalSize(maxTotalSizeBytes int64) Option {
+	return func(o *options) {
+		o.maxTotalSizeBytes = maxTotalSizeBytes
+	}
+}
+
+// WithMaxConcurrentTransfers limits how many uploads and downloads run at the same time across every call made with
+// the returned Option, including the transfers started by batch helpers such as DownloadMany, UploadMany,
+// SyncUpload, and SyncDownload. Unlike WithConcurrency, which only applies to a single call, the limit is shared so
+// create the Option once, for example in Client.Options, and reuse it for every call that should count against it.
+// Calls wait for a free slot until their context is done. Values < 1 are ignored.
+func WithMaxConcurrentTransfers(n int) Option {
+	var transfers transferSemaphore
+	if n > 0 {
+		transfers = make(transferSemaphore, n)
+	}
+
+	return func(o *options) {
+		if transfers != nil {
+			o.transfers = transfers
+		}
+	}
+}
+
+// WithMetrics tells sink how long every upload, download, and delete took, how many bytes it transferred, and
+// whether it failed. See EMFMetrics and PrometheusMetrics.
+func WithMetrics(sink MetricsSink) Option {
+	return func(o *options) {
+		o.metrics = sink
+	}
+}
+
+// WithParallelDownload makes Download fetch large objects faster by first making a HeadObject request for the
+// object's size, allocating a buffer of exactly that size, and then fetching ranges of it in parallel straight into
+// place. How many ranges are fetched at once is tuned to the memory the Lambda function is configured with, which
+// AWS scales its vCPUs and network bandwidth with. SyncDownload pre-allocates each local file the same way. The
+// extra request isn't worth it for objects smaller than a few parts of MinPartSize.
+func WithParallelDownload() Option {
+	return func(o *options) {
+		o.parallelDownload = true
+	}
+}
+
+// WithPresignedResult sets UploadRes.PresignedURL to a GET URL for the uploaded object which is valid for expiry,
+// saving handlers that share uploads a call to presign it themselves. The object is still uploaded when presigning
+// fails, in which case the UploadRes is returned along with ErrPresigningURL.
+func WithPresignedResult(expiry time.Duration) Option {
+	return func(o *options) {
+		o.presignedResultExpiry = expiry
+	}
+}
+
+// WithProfile applies the performance settings of profile. Options after it override the settings it made, so
+// WithProfile(ProfileSmallFiles), WithConcurrency(8) uses every setting of ProfileSmallFiles but its Concurrency.
+// Part sizes below MinPartSize are raised to it.
+func WithProfile(profile Profile) Option {
+	return func(o *options) {
+		if profile.PartSize > 0 {
+			o.partSize = profile.PartSize
+			if o.partSize < MinPartSize {
+				o.partSize = MinPartSize
+			}
+		}
+
+		if profile.PartConcurrency > 0 {
+			o.partConcurrency = profile.PartConcurrency
+		}
+
+		if profile.Concurrency > 0 {
+			o.concurrency = profile.Concurrency
+		}
+
+		if profile.BufferSize > 0 {
+			o.bufferSize = profile.BufferSize
+		}
+
+		if profile.ParallelDownload {
+			o.parallelDownload = true
+		}
+	}
+}
+
+// WithPublicAccessBlock makes EnsureBucket turn on all four of the bucket's Block Public Access settings.
+func WithPublicAccessBlock() Option {
+	return func(o *options) {
+		o.publicAccessBlock = true
+	}
+}
+
+// WithPublicURL reports UploadRes.S3URL on publicURL instead of the regional S3 URL, for objects that are only
+// reachable through a CDN or custom domain. publicURL is either a base the key is appended to, such as
+// cdn.example.com or https://example.com/assets, or a template containing {key} and optionally {bucket}
+// such as https://{bucket}.example.com/files/{key}. The key is path escaped but its slashes are kept.
+func WithPublicURL(publicURL string) Option {
+	return func(o *options) {
+		o.publicURL = publicURL
+	}
+}
+
+// WithRequesterPays acknowledges that the caller, rather than the bucket owner, pays for the requests and data
+// transfer of the call. It's required to read from or write to buckets with Requester Pays enabled, such as many
+// shared public datasets, and S3 rejects requests to those buckets without it.
+func WithRequesterPays() Option {
+	return func(o *options) {
+		o.requesterPays = true
+	}
+}
+
+// WithResponseContentDisposition makes presigned GET URLs serve the object with contentDisposition rather than the
+// Content-Disposition it was uploaded with, so one object can be offered both as an inline preview and as a
+// download. See ContentDisposition.
+func WithResponseContentDisposition(contentDisposition string) Option {
+	return func(o *options) {
+		o.responseContentDisposition = contentDisposition
+	}
+}
+
+// WithResponseContentType makes presigned GET URLs serve the object with contentType rather than the Content-Type
+// it was uploaded with.
+func WithResponseContentType(contentType string) Option {
+	return func(o *options) {
+		o.responseContentType = contentType
+	}
+}
+
+// WithRetention locks uploaded objects in mode until retainUntil, giving them write once read many semantics. The
+// bucket must have Object Lock enabled. Uploads with a retainUntil that isn't in the future fail with
+// ErrParameterRetention.
+func WithRetention(mode RetentionMode, retainUntil time.Time) Option {
+	return func(o *options) {
+		o.retention = &Retention{Mode: mode, RetainUntil: retainUntil}
+	}
+}
+
+// WithScanner passes every uploaded file to scanner before it's stored. The file is scanned as it streams to S3,
+// before WithUploadTransformers see it, and the upload is aborted with ErrFileRejectedByScanner wrapping the
+// scanner's error if the scanner rejects it. Scanned files can't be read directly from the multipart file so
+// s3manager buffers each part in memory.
+func WithScanner(scanner Scanner) Option {
+	return func(o *options) {
+		o.scanner = scanner
+	}
+}
+
+// WithSNSNotification publishes an UploadEvent, as JSON, to the SNS topic topicARN after every successful upload.
+// If the event can't be published the UploadRes is returned along with ErrPublishingUploadEvent.
+func WithSNSNotification(topicARN string) Option {
+	return func(o *options) {
+		o.snsTopicARN = topicARN
+	}
+}
+
+// WithTempDir makes GetHeaders and GetForm spill the parts of forms that don't fit in memory to dir instead of
+// os.TempDir. On Lambda dir has to be under /tmp or on a mounted EFS file system. FileHeader.Open can't open the
+// files spilled to dir so open them with OpenFileHeader, as the upload functions do, and remove the form with
+// RemoveForm rather than RemoveAll.
+func WithTempDir(dir string) Option {
+	return func(o *options) {
+		o.tempDir = dir
+	}
+}
+
+// WithThumbnails makes UploadHeader store a resized copy of JPEG, PNG, and GIF images for each of thumbnails once
+// the image itself is uploaded. JPEGs are rotated upright first according to their EXIF orientation. The thumbnails
+// are uploaded with the same options as the image and returned in UploadRes.Variants, in the order given. Other
+// files are uploaded without thumbnails.
+func WithThumbnails(thumbnails ...Thumbnail) Option {
+	return func(o *options) {
+		o.thumbnails = thumbnails
+	}
+}
+
+// WithTracerProvider traces every upload, download, and delete with a Span from tracerProvider's Tracer named
+// TracerName. Spans are started from the context passed WithContext and the S3 requests are made with the Span's
+// context so they show up in the caller's trace.
+func WithTracerProvider(tracerProvider TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tracerProvider
+	}
+}
+
+// WithTransferAcceleration sends uploads and downloads through the bucket's S3 Transfer Acceleration endpoint,
+// <bucket>.s3-accelerate.amazonaws.com, which routes them over the AWS network from the nearest edge location.
+// UploadRes.S3URL is the accelerated URL of the file. Acceleration has to be enabled on the bucket first and
+// isn't available for bucket names containing dots.
+func WithTransferAcceleration() Option {
+	return func(o *options) {
+		o.transferAcceleration = true
+	}
+}
+
+// WithVersioning makes EnsureBucket turn on versioning for the bucket.
+func WithVersioning() Option {
+	return func(o *options) {
+		o.versioning = true
+	}
+}
+
+// WithWait confirms the change made by an upload or delete is visible before returning. After uploading, HeadObject
+// is polled until the object exists and after deleting until it no longer does, for up to timeout, after which
+// ErrWaitTimeout is returned. S3 is strongly consistent so this is only needed when something else, such as a
+// replica bucket or a downstream step reading through a cache, could race the change.
+func WithWait(timeout time.Duration) Option {
+	return func(o *options) {
+		o.waitTimeout = timeout
+	}
+}
+
+// WithUploader names who uploaded the file, e.g. the UserID of the request's Authorization, in the UploadEvents
+// published WithSNSNotification or WithEventBridgeNotification and the items written WithUploadRecord.
+func WithUploader(uploader string) Option {
+	return func(o *options) {
+		o.uploader = uploader
+	}
+}
+
+// WithUploadRecord writes an item describing the file to the DynamoDB table of record after every successful
+// upload, before any UploadEvent is published, so the record exists by the time anyone is notified. If the item
+// can't be written the UploadRes is returned along with ErrWritingUploadRecord.
+func WithUploadRecord(record UploadRecord) Option {
+	return func(o *options) {
+		o.uploadRecord = &record
+	}
+}
+
+// WithUploadTransformers streams files through transformers, in order, while they're uploaded. This happens
+// before WithChecksum and WithGzip see the file. Transformed files can't be read directly from the multipart
+// file so s3manager buffers each part in memory.
+func WithUploadTransformers(transformers ...Transformer) Option {
+	return func(o *options) {
+		o.uploadTransformers = append(o.uploadTransformers, transformers...)
+	}
+}
+
+// WithDownloadTransformers passes downloaded files through transformers, in order, after WithGzip and
+// WithChecksum are done with them.
+func WithDownloadTransformers(transformers ...Transformer) Option {
+	return func(o *options) {
+		o.downloadTransformers = append(o.downloadTransformers, transformers...)
+	}
+}
@@ -0,0 +1,65 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestNewSession(t *testing.T) {
+	t.Run("verify newSession remembers the session", func(t *testing.T) {
+		o := newOptions(nil)
+
+		awsSession, err := o.newSession(Region)
+		assert.Nil(t, err)
+		assert.True(t, awsSession == o.awsSession)
+		assert.Equal(t, "https://"+S3Bucket+".s3."+Region+".amazonaws.com/"+S3FileName, objectURL(s3.New(awsSession), S3Bucket, S3FileName))
+	})
+	t.Run("verify WithTransferAcceleration uses the accelerate endpoint", func(t *testing.T) {
+		o := newOptions([]Option{WithTransferAcceleration()})
+
+		awsSession, err := o.newSession(Region)
+		assert.Nil(t, err)
+		assert.Equal(t, "https://"+S3Bucket+".s3-accelerate.amazonaws.com/"+S3FileName, objectURL(s3.New(awsSession), S3Bucket, S3FileName))
+	})
+	t.Run("verify WithRequesterPays sets RequestPayer on S3 requests", func(t *testing.T) {
+		for _, requesterPays := range []bool{false, true} {
+			var opts []Option
+			if requesterPays {
+				opts = append(opts, WithRequesterPays())
+			}
+
+			awsSession, err := newOptions(opts).newSession(Region)
+			assert.Nil(t, err)
+
+			req, _ := s3.New(awsSession).HeadObjectRequest(&s3.HeadObjectInput{
+				Bucket: aws.String(S3Bucket),
+				Key:    aws.String(S3FileName),
+			})
+			assert.Nil(t, req.Build())
+			assert.Equal(t, requesterPays, req.HTTPRequest.Header.Get("X-Amz-Request-Payer") == s3.RequestPayerRequester)
+		}
+	})
+}
+
+func TestWithPublicURL(t *testing.T) {
+	s3URL := "https://" + S3Bucket + ".s3." + Region + ".amazonaws.com/reports/q1%202023.csv"
+
+	t.Run("verify the S3 URL is used by default", func(t *testing.T) {
+		assert.Equal(t, s3URL, newOptions(nil).objectURL(S3Bucket, "reports/q1 2023.csv", s3URL))
+	})
+	t.Run("verify the key is appended to a base domain", func(t *testing.T) {
+		for _, publicURL := range []string{"cdn.example.com", "https://cdn.example.com/"} {
+			o := newOptions([]Option{WithPublicURL(publicURL)})
+			assert.Equal(t, "https://cdn.example.com/reports/q1%202023.csv", o.objectURL(S3Bucket, "reports/q1 2023.csv", s3URL))
+		}
+
+		o := newOptions([]Option{WithPublicURL("http://example.com/assets")})
+		assert.Equal(t, "http://example.com/assets/reports/q1%202023.csv", o.objectURL(S3Bucket, "reports/q1 2023.csv", s3URL))
+	})
+	t.Run("verify templates are filled in", func(t *testing.T) {
+		o := newOptions([]Option{WithPublicURL("https://{bucket}.example.com/files/{key}?download=1")})
+		assert.Equal(t, "https://"+S3Bucket+".example.com/files/reports/q1%202023.csv?download=1", o.objectURL(S3Bucket, "reports/q1 2023.csv", s3URL))
+	})
+}
@@ -0,0 +1,81 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+const (
+	// MaxParallelDownloadPartSize is the largest range WithParallelDownload fetches in a single request.
+	MaxParallelDownloadPartSize = 64 << 20
+	// MaxParallelDownloadConcurrency is the most ranges WithParallelDownload fetches at the same time.
+	MaxParallelDownloadConcurrency = 32
+	// MinParallelDownloadConcurrency is the fewest ranges WithParallelDownload fetches at the same time, even on
+	// the smallest Lambda functions, since fetching ranges is bound by the network rather than the CPU.
+	MinParallelDownloadConcurrency = 4
+)
+
+// lambdaMemoryPerVCPU is how much memory, in MB, Lambda allocates a whole vCPU for. Network bandwidth scales with
+// memory the same way.
+const lambdaMemoryPerVCPU = 1769
+
+// parallelDownloadConcurrency is how many ranges to fetch at once given the memory the Lambda function is configured
+// with, or the number of CPUs outside of Lambda: eight per vCPU, which is enough requests in flight to saturate the
+// function's bandwidth without them competing for it.
+func parallelDownloadConcurrency() int {
+	concurrency := runtime.NumCPU() * 8
+
+	if memoryMB, err := strconv.Atoi(os.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE")); err == nil && memoryMB > 0 {
+		concurrency = memoryMB * 8 / lambdaMemoryPerVCPU
+	}
+
+	if concurrency < MinParallelDownloadConcurrency {
+		return MinParallelDownloadConcurrency
+	}
+
+	if concurrency > MaxParallelDownloadConcurrency {
+		return MaxParallelDownloadConcurrency
+	}
+
+	return concurrency
+}
+
+// parallelDownloadPartSize is the size of the ranges to split an object of size bytes into so each of concurrency
+// workers fetches about four of them, which keeps them all busy until the end without making so many requests that
+// their overhead dominates.
+func parallelDownloadPartSize(size int64, concurrency int) int64 {
+	partSize := size / int64(concurrency*4)
+
+	if partSize < MinPartSize {
+		return MinPartSize
+	}
+
+	if partSize > MaxParallelDownloadPartSize {
+		return MaxParallelDownloadPartSize
+	}
+
+	return partSize
+}
+
+// headForDownload makes a HeadObject request with the same conditions as getObjectInput and returns the object's
+// size. getObjectInput is then pinned to the ETag of the object so every range is fetched from the same version
+// even if it's overwritten part way through the download.
+func headForDownload(ctx aws.Context, s3Client s3iface.S3API, getObjectInput *s3.GetObjectInput) (int64, error) {
+	headOutput, err := s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:          getObjectInput.Bucket,
+		Key:             getObjectInput.Key,
+		IfNoneMatch:     getObjectInput.IfNoneMatch,
+		IfModifiedSince: getObjectInput.IfModifiedSince,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	getObjectInput.IfMatch = headOutput.ETag
+
+	return aws.Int64Value(headOutput.ContentLength), nil
+}
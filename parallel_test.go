@@ -0,0 +1,64 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+type headRecorder struct {
+	s3iface.S3API
+	input *s3.HeadObjectInput
+}
+
+func (h *headRecorder) HeadObjectWithContext(_ aws.Context, input *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+	h.input = input
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(300 << 20), ETag: aws.String(`"abc"`)}, nil
+}
+
+func TestParallelDownloadConcurrency(t *testing.T) {
+	t.Run("verify concurrency scales with the memory of the Lambda function", func(t *testing.T) {
+		t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "3538")
+		assert.Equal(t, 16, parallelDownloadConcurrency())
+	})
+	t.Run("verify small functions still fetch several ranges at once", func(t *testing.T) {
+		t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "128")
+		assert.Equal(t, MinParallelDownloadConcurrency, parallelDownloadConcurrency())
+	})
+	t.Run("verify large functions are capped", func(t *testing.T) {
+		t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "10240")
+		assert.Equal(t, MaxParallelDownloadConcurrency, parallelDownloadConcurrency())
+	})
+}
+
+func TestParallelDownloadPartSize(t *testing.T) {
+	t.Run("verify each worker gets about four parts", func(t *testing.T) {
+		assert.Equal(t, int64(10<<20), parallelDownloadPartSize(320<<20, 8))
+	})
+	t.Run("verify parts are at least MinPartSize", func(t *testing.T) {
+		assert.Equal(t, int64(MinPartSize), parallelDownloadPartSize(1<<20, 8))
+	})
+	t.Run("verify parts are at most MaxParallelDownloadPartSize", func(t *testing.T) {
+		assert.Equal(t, int64(MaxParallelDownloadPartSize), parallelDownloadPartSize(100<<30, 4))
+	})
+}
+
+func TestHeadForDownload(t *testing.T) {
+	t.Run("verify the download is pinned to the ETag of the object", func(t *testing.T) {
+		getObjectInput := &s3.GetObjectInput{
+			Bucket:      aws.String(S3Bucket),
+			Key:         aws.String(S3FileName),
+			IfNoneMatch: aws.String(`"known"`),
+		}
+
+		s3Client := &headRecorder{}
+		size, err := headForDownload(aws.BackgroundContext(), s3Client, getObjectInput)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(300<<20), size)
+		assert.Equal(t, `"known"`, aws.StringValue(s3Client.input.IfNoneMatch))
+		assert.Equal(t, `"abc"`, aws.StringValue(getObjectInput.IfMatch))
+	})
+}
@@ -0,0 +1,107 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/http"
+)
+
+// PreflightKey is the key Preflight writes, reads, and deletes to probe its permissions.
+const PreflightKey = ".lambda_s3-preflight"
+
+var ErrPreflightFailed = errors.New("unable to check the permissions on the bucket")
+
+// PreflightRes reports what the credentials Preflight was called with are allowed to do to the bucket.
+type PreflightRes struct {
+	// List is whether HeadBucket succeeded which needs s3:ListBucket.
+	List   bool `json:"list"`
+	Read   bool `json:"read"`
+	Write  bool `json:"write"`
+	Delete bool `json:"delete"`
+}
+
+// Preflight checks bucket exists and probes whether objects in it can be read, written, and deleted by writing,
+// reading, and deleting an empty object at PreflightKey. Call it from init() to fail fast when IAM is misconfigured
+// rather than on the first upload. Denied permissions are reported in PreflightRes, not as errors. Buckets that
+// don't exist fail with ErrBucketNotFound and probes that fail for any other reason with ErrPreflightFailed.
+// Without s3:ListBucket S3 can't tell a reader that an object is missing so, when the write probe is denied, Read
+// is only true if the reader also has s3:ListBucket.
+func Preflight(region, bucket string, opts ...Option) (*PreflightRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	s3Client := s3.New(awsSession)
+	preflightRes := &PreflightRes{}
+
+	_, err = s3Client.HeadBucketWithContext(o.context(), &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if preflightRes.List, err = probeAllowed(err); err != nil {
+		if isNotFound(err) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPreflightFailed, err)
+	}
+
+	_, err = s3Client.PutObjectWithContext(o.context(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(PreflightKey),
+		Body:   bytes.NewReader(nil),
+	})
+	if preflightRes.Write, err = probeAllowed(err); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPreflightFailed, err)
+	}
+
+	getObjectOutput, err := s3Client.GetObjectWithContext(o.context(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(PreflightKey),
+	})
+	if err == nil {
+		getObjectOutput.Body.Close()
+	} else if !preflightRes.Write && isNotFound(err) {
+		err = nil // the reader was told the object is missing rather than denied
+	}
+	if preflightRes.Read, err = probeAllowed(err); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPreflightFailed, err)
+	}
+
+	// deleting a missing object succeeds so this probes the permission whether or not the write probe did
+	_, err = s3Client.DeleteObjectWithContext(o.context(), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(PreflightKey),
+	})
+	if preflightRes.Delete, err = probeAllowed(err); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPreflightFailed, err)
+	}
+
+	return preflightRes, nil
+}
+
+// probeAllowed reports whether the probe that returned err was allowed. Only errors other than access being denied
+// are returned.
+func probeAllowed(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) && requestFailure.StatusCode() == http.StatusForbidden {
+		return false, nil
+	}
+
+	return false, err
+}
@@ -0,0 +1,45 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		_, err := Preflight("", S3Bucket)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is invalid", func(t *testing.T) {
+		_, err := Preflight(Region, "invalid bucket!")
+		assert.True(t, errors.Is(err, ErrInvalidBucketName))
+	})
+	t.Run("verify denied probes are reported rather than returned", func(t *testing.T) {
+		allowed, err := probeAllowed(nil)
+		assert.Nil(t, err)
+		assert.True(t, allowed)
+
+		allowed, err = probeAllowed(awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "request"))
+		assert.Nil(t, err)
+		assert.False(t, allowed)
+
+		allowed, err = probeAllowed(awserr.NewRequestFailure(awserr.New("InternalError", "Internal Error", nil), http.StatusInternalServerError, "request"))
+		assert.NotNil(t, err)
+		assert.False(t, allowed)
+	})
+	t.Run("verify the test bucket allows everything", func(t *testing.T) {
+		preflightRes, err := Preflight(Region, S3Bucket)
+		assert.Nil(t, err)
+		assert.True(t, preflightRes.List)
+		assert.True(t, preflightRes.Read)
+		assert.True(t, preflightRes.Write)
+		assert.True(t, preflightRes.Delete)
+	})
+	t.Run("verify err when the bucket doesn't exist", func(t *testing.T) {
+		_, err := Preflight(Region, "golang-s3-lambda-test-does-not-exist")
+		assert.True(t, errors.Is(err, ErrBucketNotFound))
+	})
+}
@@ -0,0 +1,109 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"net/http"
+	"time"
+)
+
+// PresignedUpload is a presigned URL clients can upload a file to directly, bypassing Lambda and API Gateway.
+// The file is sent as the body of a request with method Method to URL before ExpiresAt.
+type PresignedUpload struct {
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// PresignUpload returns a PresignedUpload for the file called name in bucket which is valid for expiry.
+// Use it for files too large to pass through API Gateway. Use WithContentLength to limit the URL to a file of the
+// size the client said it would upload.
+func PresignUpload(region, bucket, name string, expiry time.Duration, opts ...Option) (*PresignedUpload, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		return nil, ErrParameterNameEmpty
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	putObjectInput := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	}
+
+	if o.contentLength > 0 {
+		putObjectInput.ContentLength = aws.Int64(o.contentLength)
+	}
+
+	putObjectReq, _ := s3.New(awsSession).PutObjectRequest(putObjectInput)
+
+	presignedURL, err := putObjectReq.Presign(expiry)
+	if err != nil {
+		return nil, ErrPresigningURL
+	}
+
+	return &PresignedUpload{
+		URL:       presignedURL,
+		Method:    http.MethodPut,
+		Key:       name,
+		ExpiresAt: time.Now().Add(expiry).UTC(),
+	}, nil
+}
+
+// presignResult sets uploadRes.PresignedURL when uploading WithPresignedResult. The URL is for the uploaded version
+// so it keeps returning the same file if the object is overwritten in a versioned bucket.
+func presignResult(s3Client s3iface.S3API, bucket string, uploadRes *UploadRes, o *options) error {
+	if o.presignedResultExpiry <= 0 {
+		return nil
+	}
+
+	getObjectInput := o.presignedGetObjectInput(bucket, uploadRes.Key)
+
+	if uploadRes.VersionID != "" {
+		getObjectInput.VersionId = aws.String(uploadRes.VersionID)
+	}
+
+	getObjectReq, _ := s3Client.GetObjectRequest(getObjectInput)
+
+	presignedURL, err := getObjectReq.Presign(o.presignedResultExpiry)
+	if err != nil {
+		return ErrPresigningURL
+	}
+
+	uploadRes.PresignedURL = presignedURL
+
+	return nil
+}
+
+// presignedGetObjectInput is the GetObjectInput presigned GET URLs for bucket/name are made from. S3 serves the
+// object with the headers set WithResponseContentType and WithResponseContentDisposition instead of the stored ones.
+func (o *options) presignedGetObjectInput(bucket, name string) *s3.GetObjectInput {
+	getObjectInput := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	}
+
+	if o.responseContentType != "" {
+		getObjectInput.ResponseContentType = aws.String(o.responseContentType)
+	}
+
+	if o.responseContentDisposition != "" {
+		getObjectInput.ResponseContentDisposition = aws.String(o.responseContentDisposition)
+	}
+
+	return getObjectInput
+}
@@ -0,0 +1,88 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresignUpload(t *testing.T) {
+	t.Run("verify err when parameters are missing", func(t *testing.T) {
+		_, err := PresignUpload("", S3Bucket, S3FileName, time.Minute)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+
+		_, err = PresignUpload(Region, "", S3FileName, time.Minute)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+
+		_, err = PresignUpload(Region, S3Bucket, "", time.Minute)
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+	})
+	t.Run("verify PresignUpload returns a presigned PUT", func(t *testing.T) {
+		presignedUpload, err := PresignUpload(Region, S3Bucket, S3FileName, time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, http.MethodPut, presignedUpload.Method)
+		assert.Equal(t, S3FileName, presignedUpload.Key)
+		assert.True(t, strings.Contains(presignedUpload.URL, S3FileName))
+		assert.True(t, presignedUpload.ExpiresAt.After(time.Now()))
+		assert.True(t, strings.Contains(presignedUpload.URL, "X-Amz-SignedHeaders=host"))
+	})
+	t.Run("verify WithContentLength signs the size of the upload", func(t *testing.T) {
+		presignedUpload, err := PresignUpload(Region, S3Bucket, S3FileName, time.Minute, WithContentLength(SampleFileSizeBytes))
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(presignedUpload.URL, "X-Amz-SignedHeaders=content-length%3Bhost"))
+	})
+}
+
+func TestWithPresignedResult(t *testing.T) {
+	awsSession, err := newOptions(nil).newSession(Region)
+	assert.Nil(t, err)
+	s3Client := s3.New(awsSession)
+
+	t.Run("verify the URL is for the uploaded version and expires when asked", func(t *testing.T) {
+		uploadRes := &UploadRes{Key: S3FileName, VersionID: "version"}
+		assert.Nil(t, presignResult(s3Client, S3Bucket, uploadRes, newOptions([]Option{WithPresignedResult(time.Minute)})))
+		assert.True(t, strings.Contains(uploadRes.PresignedURL, S3FileName))
+		assert.True(t, strings.Contains(uploadRes.PresignedURL, "versionId=version"))
+		assert.True(t, strings.Contains(uploadRes.PresignedURL, "X-Amz-Expires=60"))
+	})
+	t.Run("verify nothing is presigned by default", func(t *testing.T) {
+		uploadRes := &UploadRes{Key: S3FileName}
+		assert.Nil(t, presignResult(s3Client, S3Bucket, uploadRes, newOptions(nil)))
+		assert.Equal(t, "", uploadRes.PresignedURL)
+	})
+	t.Run("verify uploads WithPresignedResult can be downloaded from the URL", func(t *testing.T) {
+		uploadRes, err := UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), Region, S3Bucket, "presigned/"+SampleFileName, WithPresignedResult(time.Minute))
+		assert.Nil(t, err)
+
+		resp, err := http.Get(uploadRes.PresignedURL)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Nil(t, Delete(Region, S3Bucket, uploadRes.Key))
+	})
+}
+
+func TestWithResponseContentDisposition(t *testing.T) {
+	t.Run("verify presigned URLs override the stored headers", func(t *testing.T) {
+		presignedURLs, result := PresignMany(Region, S3Bucket, []string{S3FileName}, time.Minute,
+			WithResponseContentDisposition(ContentDisposition(DispositionAttachment, "export.csv")),
+			WithResponseContentType("text/csv"))
+		assert.Nil(t, result.Err())
+
+		presignedURL, err := url.Parse(presignedURLs[S3FileName])
+		assert.Nil(t, err)
+		assert.Equal(t, "attachment; filename=export.csv", presignedURL.Query().Get("response-content-disposition"))
+		assert.Equal(t, "text/csv", presignedURL.Query().Get("response-content-type"))
+	})
+	t.Run("verify nothing is overridden by default", func(t *testing.T) {
+		getObjectInput := newOptions(nil).presignedGetObjectInput(S3Bucket, S3FileName)
+		assert.True(t, getObjectInput.ResponseContentDisposition == nil)
+		assert.True(t, getObjectInput.ResponseContentType == nil)
+	})
+}
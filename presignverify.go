@@ -0,0 +1,175 @@
+package lambda_s3
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// presignedURLClockSkew is how far in the future a presigned URL's signing time may be before it's rejected.
+const presignedURLClockSkew = 5 * time.Minute
+
+var (
+	ErrInvalidPresignedURL = errors.New("the presigned URL is malformed or its signature doesn't match")
+	ErrPresignedURLExpired = errors.New("the presigned URL has expired")
+)
+
+// PresignedObject is the object a presigned URL verified by VerifyPresignedURL gives access to.
+type PresignedObject struct {
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	VersionID string    `json:"versionID,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// VerifyPresignedURL checks that rawURL is a SigV4 presigned S3 URL for method that hasn't expired, that its
+// signature is valid, and that the object it's for is in allowed, so flows that hand a client a presigned URL and
+// have it call back with the URL can trust it. allowed holds bucket/key prefixes, e.g. "my-bucket/uploads/", and
+// "my-bucket/" allows the whole bucket. ErrForbidden is returned for objects that aren't allowed.
+//
+// The signature is recomputed with the credentials the Lambda's session resolves to, so only URLs presigned with
+// the same access key can be verified. Lambda execution roles get new credentials from time to time, after which
+// URLs presigned with the old ones fail with ErrInvalidPresignedURL. Only URLs that sign nothing but the host header,
+// which includes every GET presigned by this package, can be verified since there are no other headers to check.
+func VerifyPresignedURL(rawURL, method string, allowed []string, opts ...Option) (*PresignedObject, error) {
+	presignedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPresignedURL, err)
+	}
+
+	query := presignedURL.Query()
+
+	if query.Get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" {
+		return nil, fmt.Errorf("%w: it isn't signed with SigV4", ErrInvalidPresignedURL)
+	}
+
+	if query.Get("X-Amz-SignedHeaders") != "host" {
+		return nil, fmt.Errorf("%w: it signs headers other than host", ErrInvalidPresignedURL)
+	}
+
+	// the credential scope is <access key ID>/<date>/<region>/s3/aws4_request
+	credential := strings.Split(query.Get("X-Amz-Credential"), "/")
+	if len(credential) != 5 || credential[3] != s3.ServiceName || credential[4] != "aws4_request" {
+		return nil, fmt.Errorf("%w: its credential scope isn't for S3", ErrInvalidPresignedURL)
+	}
+
+	signTime, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPresignedURL, err)
+	}
+
+	expirySeconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expirySeconds <= 0 {
+		return nil, fmt.Errorf("%w: it has no expiry", ErrInvalidPresignedURL)
+	}
+
+	expiry := time.Duration(expirySeconds) * time.Second
+	expiresAt := signTime.Add(expiry)
+
+	if signTime.After(time.Now().Add(presignedURLClockSkew)) {
+		return nil, fmt.Errorf("%w: it was signed in the future", ErrInvalidPresignedURL)
+	}
+
+	if time.Now().After(expiresAt) {
+		return nil, ErrPresignedURLExpired
+	}
+
+	bucket, key, ok := presignedObject(presignedURL)
+	if !ok {
+		return nil, fmt.Errorf("%w: it isn't an S3 object URL", ErrInvalidPresignedURL)
+	}
+
+	if !presignedObjectAllowed(bucket, key, allowed) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrForbidden, bucket, key)
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newSession(credential[2])
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	credentials, err := awsSession.Config.Credentials.Get()
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	if credentials.AccessKeyID != credential[0] {
+		return nil, fmt.Errorf("%w: it was signed with another access key", ErrInvalidPresignedURL)
+	}
+
+	signature := query.Get("X-Amz-Signature")
+
+	// presigning again with the same credentials, time, and expiry gives the same signature if nothing was changed
+	for _, param := range []string{"X-Amz-Algorithm", "X-Amz-Credential", "X-Amz-Date", "X-Amz-Expires", "X-Amz-Security-Token", "X-Amz-SignedHeaders", "X-Amz-Signature"} {
+		query.Del(param)
+	}
+
+	unsignedURL := *presignedURL
+	unsignedURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, unsignedURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPresignedURL, err)
+	}
+
+	signer := v4.NewSigner(awsSession.Config.Credentials, func(signer *v4.Signer) {
+		signer.DisableURIPathEscaping = true // S3 doesn't escape paths twice like other services do
+	})
+
+	if _, err = signer.Presign(req, nil, s3.ServiceName, credential[2], expiry, signTime); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPresignedURL, err)
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(req.URL.Query().Get("X-Amz-Signature"))) {
+		return nil, fmt.Errorf("%w: the signature doesn't match", ErrInvalidPresignedURL)
+	}
+
+	return &PresignedObject{
+		Bucket:    bucket,
+		Key:       key,
+		VersionID: query.Get("versionId"),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// presignedObject returns the bucket and key presignedURL is for. Bucket names are in the host of virtual hosted
+// style URLs, e.g. my-bucket.s3.us-east-1.amazonaws.com/key, and in the first segment of the path of path style
+// URLs, e.g. s3.us-east-1.amazonaws.com/my-bucket/key.
+func presignedObject(presignedURL *url.URL) (string, string, bool) {
+	host := presignedURL.Hostname()
+	objectPath := strings.TrimPrefix(presignedURL.Path, "/")
+
+	if strings.HasPrefix(host, "s3.") || strings.HasPrefix(host, "s3-") {
+		bucket, key, ok := strings.Cut(objectPath, "/")
+		return bucket, key, ok && bucket != "" && key != ""
+	}
+
+	for _, separator := range []string{".s3.", ".s3-"} {
+		if i := strings.Index(host, separator); i > 0 {
+			return host[:i], objectPath, objectPath != ""
+		}
+	}
+
+	return "", "", false
+}
+
+func presignedObjectAllowed(bucket, key string, allowed []string) bool {
+	object := bucket + "/" + key
+
+	for _, prefix := range allowed {
+		if strings.Contains(prefix, "/") && strings.HasPrefix(object, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
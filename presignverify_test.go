@@ -0,0 +1,80 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyPresignedURL(t *testing.T) {
+	presignedURLs, result := PresignMany(Region, S3Bucket, []string{"uploads/" + S3FileName}, time.Minute)
+	assert.Nil(t, result.Err())
+	presignedURL := presignedURLs["uploads/"+S3FileName]
+
+	t.Run("verify URLs presigned by this package are verified", func(t *testing.T) {
+		presignedObject, err := VerifyPresignedURL(presignedURL, http.MethodGet, []string{S3Bucket + "/uploads/"})
+		assert.Nil(t, err)
+		assert.Equal(t, S3Bucket, presignedObject.Bucket)
+		assert.Equal(t, "uploads/"+S3FileName, presignedObject.Key)
+		assert.True(t, presignedObject.ExpiresAt.After(time.Now()))
+	})
+	t.Run("verify objects outside the allowlist are forbidden", func(t *testing.T) {
+		_, err := VerifyPresignedURL(presignedURL, http.MethodGet, []string{S3Bucket + "/downloads/", S3Bucket})
+		assert.True(t, errors.Is(err, ErrForbidden))
+	})
+	t.Run("verify tampered URLs and other methods are rejected", func(t *testing.T) {
+		tamperedURL := strings.Replace(presignedURL, "uploads/", "uploads/other_", 1)
+		_, err := VerifyPresignedURL(tamperedURL, http.MethodGet, []string{S3Bucket + "/"})
+		assert.True(t, errors.Is(err, ErrInvalidPresignedURL))
+
+		_, err = VerifyPresignedURL(presignedURL, http.MethodDelete, []string{S3Bucket + "/"})
+		assert.True(t, errors.Is(err, ErrInvalidPresignedURL))
+	})
+	t.Run("verify expired URLs are rejected", func(t *testing.T) {
+		parsedURL, err := url.Parse(presignedURL)
+		assert.Nil(t, err)
+
+		query := parsedURL.Query()
+		query.Set("X-Amz-Date", time.Now().Add(-time.Hour).UTC().Format("20060102T150405Z"))
+		parsedURL.RawQuery = query.Encode()
+
+		_, err = VerifyPresignedURL(parsedURL.String(), http.MethodGet, []string{S3Bucket + "/"})
+		assert.True(t, errors.Is(err, ErrPresignedURLExpired))
+	})
+	t.Run("verify URLs that aren't presigned are rejected", func(t *testing.T) {
+		_, err := VerifyPresignedURL("https://"+S3Bucket+".s3.amazonaws.com/"+S3FileName, http.MethodGet, []string{S3Bucket + "/"})
+		assert.True(t, errors.Is(err, ErrInvalidPresignedURL))
+	})
+}
+
+func TestPresignedObject(t *testing.T) {
+	t.Run("verify the bucket is found in virtual hosted and path style URLs", func(t *testing.T) {
+		for rawURL, expected := range map[string]string{
+			"https://my-bucket.s3.us-east-1.amazonaws.com/dir/file.txt":           "my-bucket",
+			"https://my.dotted.bucket.s3-us-west-2.amazonaws.com/dir/file.txt":    "my.dotted.bucket",
+			"https://s3.us-east-1.amazonaws.com/my-bucket/dir/file.txt":           "my-bucket",
+			"https://s3.dualstack.us-east-1.amazonaws.com/my-bucket/dir/file.txt": "my-bucket",
+		} {
+			parsedURL, err := url.Parse(rawURL)
+			assert.Nil(t, err)
+
+			bucket, key, ok := presignedObject(parsedURL)
+			assert.True(t, ok)
+			assert.Equal(t, expected, bucket)
+			assert.Equal(t, "dir/file.txt", key)
+		}
+	})
+	t.Run("verify URLs without an object aren't accepted", func(t *testing.T) {
+		for _, rawURL := range []string{"https://example.com/file.txt", "https://s3.us-east-1.amazonaws.com/my-bucket", "https://my-bucket.s3.amazonaws.com/"} {
+			parsedURL, err := url.Parse(rawURL)
+			assert.Nil(t, err)
+
+			_, _, ok := presignedObject(parsedURL)
+			assert.False(t, ok)
+		}
+	})
+}
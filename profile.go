@@ -0,0 +1,84 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Profile is a coherent set of performance settings for a kind of workload so callers don't have to tune part
+// sizes, concurrency, and buffering against each other themselves. Start from one of ProfileLowMemory,
+// ProfileHighThroughput, or ProfileSmallFiles and pass it WithProfile. Zero fields keep the defaults. The presets
+// are compared by BenchmarkProfiles.
+type Profile struct {
+	// PartSize is the size of the parts files are uploaded and downloaded in, at least MinPartSize.
+	PartSize int64
+	// PartConcurrency is how many parts of a single file are transferred at the same time.
+	PartConcurrency int
+	// Concurrency is how many files batch helpers such as DownloadMany transfer at the same time.
+	Concurrency int
+	// BufferSize is the size of the pooled buffers files are copied through, see WithBufferSize.
+	BufferSize int
+	// ParallelDownload pre-allocates downloads and fetches their ranges in parallel, see WithParallelDownload.
+	// PartSize and PartConcurrency are tuned to the object and the Lambda function's memory unless they're set.
+	ParallelDownload bool
+}
+
+var (
+	// ProfileLowMemory keeps the memory a transfer holds to a single MinPartSize part, for functions configured
+	// with the 128 MB minimum, at the cost of throughput on large files.
+	ProfileLowMemory = Profile{
+		PartSize:        MinPartSize,
+		PartConcurrency: 1,
+		Concurrency:     2,
+		BufferSize:      8 << 10,
+	}
+	// ProfileHighThroughput moves files of hundreds of MB as fast as possible by transferring many large parts at
+	// once. Streamed uploads hold PartSize × (PartConcurrency + 1) bytes so give the function at least 1 GB.
+	ProfileHighThroughput = Profile{
+		PartSize:         16 << 20,
+		PartConcurrency:  16,
+		Concurrency:      DefaultConcurrency,
+		BufferSize:       256 << 10,
+		ParallelDownload: true,
+	}
+	// ProfileSmallFiles suits many files of a few MB or less, which always fit in a single part, by transferring
+	// lots of them at once instead of splitting each one up.
+	ProfileSmallFiles = Profile{
+		PartSize:        MinPartSize,
+		PartConcurrency: 1,
+		Concurrency:     32,
+		BufferSize:      DefaultBufferSize,
+	}
+)
+
+// configureUploader applies the part size and concurrency of the Profile the upload was made WithProfile.
+func (o *options) configureUploader(uploader *s3manager.Uploader) {
+	if o.partSize > 0 {
+		uploader.PartSize = o.partSize
+	}
+
+	if o.partConcurrency > 0 {
+		uploader.Concurrency = o.partConcurrency
+	}
+}
+
+// configureDownloader tunes a s3manager.Downloader to fetch an object of size bytes. Downloads made
+// WithParallelDownload are tuned to the object and the Lambda function's memory and the part size and concurrency
+// of the Profile the download was made WithProfile take precedence over both.
+func (o *options) configureDownloader(size int64) func(downloader *s3manager.Downloader) {
+	return func(downloader *s3manager.Downloader) {
+		downloader.Concurrency = 0
+
+		if o.parallelDownload {
+			downloader.Concurrency = parallelDownloadConcurrency()
+			downloader.PartSize = parallelDownloadPartSize(size, downloader.Concurrency)
+		}
+
+		if o.partSize > 0 {
+			downloader.PartSize = o.partSize
+		}
+
+		if o.partConcurrency > 0 {
+			downloader.Concurrency = o.partConcurrency
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is just enough of S3 in memory to put, multipart upload, head, and ranged get objects so transfers can be
+// benchmarked without the network getting in the way.
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+	parts   map[string]map[int][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key := r.URL.Path
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := strconv.Itoa(len(f.parts) + 1)
+		f.parts[uploadID] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		f.parts[query.Get("uploadId")][partNumber], _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", `"part"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts := f.parts[query.Get("uploadId")]
+
+		partNumbers := make([]int, 0, len(parts))
+		for partNumber := range parts {
+			partNumbers = append(partNumbers, partNumber)
+		}
+		sort.Ints(partNumbers)
+
+		var object []byte
+		for _, partNumber := range partNumbers {
+			object = append(object, parts[partNumber]...)
+		}
+		f.objects[key] = object
+
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><ETag>"object"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodPut:
+		f.objects[key], _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", `"object"`)
+	default:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("ETag", `"object"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(object))
+	}
+}
+
+func newFakeS3Session(tb testing.TB) *session.Session {
+	return newHandlerSession(tb, newFakeS3())
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, parts: map[string]map[int][]byte{}}
+}
+
+// newHandlerSession returns a session whose S3 requests are served by handler.
+func newHandlerSession(tb testing.TB, handler http.Handler) *session.Session {
+	server := httptest.NewServer(handler)
+	tb.Cleanup(server.Close)
+
+	awsSession, err := session.NewSession(&aws.Config{
+		Region:           aws.String(Region),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	assert.Nil(tb, err)
+
+	return awsSession
+}
+
+func TestWithProfile(t *testing.T) {
+	t.Run("verify every setting of the profile is applied", func(t *testing.T) {
+		o := newOptions([]Option{WithProfile(ProfileHighThroughput)})
+		assert.Equal(t, ProfileHighThroughput.PartSize, o.partSize)
+		assert.Equal(t, ProfileHighThroughput.PartConcurrency, o.partConcurrency)
+		assert.Equal(t, ProfileHighThroughput.Concurrency, o.concurrency)
+		assert.Equal(t, ProfileHighThroughput.BufferSize, o.bufferSize)
+		assert.True(t, o.parallelDownload)
+	})
+	t.Run("verify later options override the profile", func(t *testing.T) {
+		o := newOptions([]Option{WithProfile(ProfileSmallFiles), WithConcurrency(4)})
+		assert.Equal(t, 4, o.concurrency)
+		assert.Equal(t, ProfileSmallFiles.PartConcurrency, o.partConcurrency)
+	})
+	t.Run("verify zero fields keep the defaults and small parts are raised to MinPartSize", func(t *testing.T) {
+		o := newOptions([]Option{WithProfile(Profile{PartSize: 1 << 20})})
+		assert.Equal(t, int64(MinPartSize), o.partSize)
+		assert.Equal(t, DefaultConcurrency, o.concurrency)
+		assert.Equal(t, DefaultBufferSize, o.bufferSize)
+	})
+	t.Run("verify the profile's part settings take precedence over WithParallelDownload tuning", func(t *testing.T) {
+		downloader := &s3manager.Downloader{}
+		newOptions([]Option{WithParallelDownload(), WithProfile(Profile{PartConcurrency: 3})}).configureDownloader(1 << 30)(downloader)
+		assert.Equal(t, 3, downloader.Concurrency)
+		assert.Equal(t, parallelDownloadPartSize(1<<30, parallelDownloadConcurrency()), downloader.PartSize)
+	})
+	t.Run("verify profiles round trip through the fake S3", func(t *testing.T) {
+		awsSession := newFakeS3Session(t)
+		fileBytes := bytes.Repeat([]byte("0123456789abcdef"), (12<<20)/16+1)
+
+		for _, profile := range []Profile{ProfileLowMemory, ProfileHighThroughput, ProfileSmallFiles} {
+			o := newOptions([]Option{WithProfile(profile)})
+
+			_, err := upload(s3manager.NewUploader(awsSession), S3Bucket, S3FileName, struct{ io.Reader }{bytes.NewReader(fileBytes)}, "", 0, o)
+			assert.Nil(t, err)
+
+			downloadedBytes, err := download(s3manager.NewDownloader(awsSession), S3Bucket, S3FileName, o)
+			assert.Nil(t, err)
+			assert.True(t, bytes.Equal(fileBytes, downloadedBytes))
+		}
+	})
+}
+
+// BenchmarkProfiles compares the presets uploading and downloading a large file and a small one. The large file
+// is streamed, rather than read from a seekable file, so it goes through the part buffers the profiles size.
+func BenchmarkProfiles(b *testing.B) {
+	profiles := []struct {
+		name    string
+		profile Profile
+	}{
+		{"Default", Profile{}},
+		{"LowMemory", ProfileLowMemory},
+		{"HighThroughput", ProfileHighThroughput},
+		{"SmallFiles", ProfileSmallFiles},
+	}
+
+	files := []struct {
+		name string
+		size int
+	}{
+		{"64MB", 64 << 20},
+		{"256KB", 256 << 10},
+	}
+
+	awsSession := newFakeS3Session(b)
+
+	for _, file := range files {
+		fileBytes := []byte(strings.Repeat("x", file.size))
+
+		if _, err := upload(s3manager.NewUploader(awsSession), S3Bucket, file.name, bytes.NewReader(fileBytes), "", 0, newOptions(nil)); err != nil {
+			b.Fatal(err)
+		}
+
+		for _, profile := range profiles {
+			o := newOptions([]Option{WithProfile(profile.profile)})
+			name := profile.name + "/" + file.name
+
+			b.Run("Upload/"+name, func(b *testing.B) {
+				b.SetBytes(int64(file.size))
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					_, err := upload(s3manager.NewUploader(awsSession), S3Bucket, name, struct{ io.Reader }{bytes.NewReader(fileBytes)}, "", 0, o)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("Download/"+name, func(b *testing.B) {
+				b.SetBytes(int64(file.size))
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					if _, err := download(s3manager.NewDownloader(awsSession), S3Bucket, file.name, o); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
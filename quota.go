@@ -0,0 +1,61 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+)
+
+var ErrQuotaExceeded = errors.New("the upload would exceed the storage quota")
+
+// Quota enforces per-user storage limits. Check is called before a user's files are uploaded with the total size
+// of the files and returns an error if the user mustn't store that many more bytes.
+type Quota interface {
+	Check(userID string, incomingBytes int64) error
+}
+
+// QuotaFunc adapts a function to a Quota.
+type QuotaFunc func(userID string, incomingBytes int64) error
+
+// Check calls f(userID, incomingBytes).
+func (f QuotaFunc) Check(userID string, incomingBytes int64) error {
+	return f(userID, incomingBytes)
+}
+
+// UsageRecorder is told about every successful upload so the usage a Quota checks against can be kept up to date.
+type UsageRecorder interface {
+	Record(userID string, bytes int64)
+}
+
+// UsageRecorderFunc adapts a function to a UsageRecorder.
+type UsageRecorderFunc func(userID string, bytes int64)
+
+// Record calls f(userID, bytes).
+func (f UsageRecorderFunc) Record(userID string, bytes int64) {
+	f(userID, bytes)
+}
+
+// checkQuota checks that userID may store fileHeaders. It allows everything when quota is nil.
+func checkQuota(quota Quota, userID string, fileHeaders ...*multipart.FileHeader) error {
+	if quota == nil {
+		return nil
+	}
+
+	var incomingBytes int64
+	for _, fileHeader := range fileHeaders {
+		incomingBytes += fileHeader.Size
+	}
+
+	if err := quota.Check(userID, incomingBytes); err != nil {
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, err)
+	}
+
+	return nil
+}
+
+// recordUsage records uploadRes against userID. It does nothing when usageRecorder is nil.
+func recordUsage(usageRecorder UsageRecorder, userID string, uploadRes *UploadRes) {
+	if usageRecorder != nil {
+		usageRecorder.Record(userID, uploadRes.BytesUploaded)
+	}
+}
@@ -0,0 +1,96 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	t.Run("verify the total size of the files is checked", func(t *testing.T) {
+		var checkedUserID string
+		var checkedBytes int64
+
+		quota := QuotaFunc(func(userID string, incomingBytes int64) error {
+			checkedUserID = userID
+			checkedBytes = incomingBytes
+			return nil
+		})
+
+		fileHeaders := []*multipart.FileHeader{
+			generateFileHeader(t, SampleFileName, []byte("contents")),
+			generateFileHeader(t, SampleFileName, []byte("more contents")),
+		}
+
+		assert.Nil(t, checkQuota(quota, "user-1", fileHeaders...))
+		assert.Equal(t, "user-1", checkedUserID)
+		assert.Equal(t, int64(len("contents")+len("more contents")), checkedBytes)
+	})
+	t.Run("verify uploads over quota are rejected", func(t *testing.T) {
+		quota := QuotaFunc(func(userID string, incomingBytes int64) error {
+			return errors.New("1 byte left")
+		})
+
+		err := checkQuota(quota, "user-1", generateFileHeader(t, SampleFileName, []byte("contents")))
+		assert.True(t, errors.Is(err, ErrQuotaExceeded))
+	})
+	t.Run("verify everything is allowed without a Quota", func(t *testing.T) {
+		assert.Nil(t, checkQuota(nil, "user-1", generateFileHeader(t, SampleFileName, []byte("contents"))))
+	})
+	t.Run("verify upload handlers reject uploads over quota", func(t *testing.T) {
+		config := Config{
+			Region: Region,
+			Bucket: S3Bucket,
+			Quota: QuotaFunc(func(userID string, incomingBytes int64) error {
+				return errors.New("no space left")
+			}),
+			UsageRecorder: UsageRecorderFunc(func(userID string, bytes int64) {
+				t.Error("usage recorded for a rejected upload")
+			}),
+		}
+
+		res, err := NewUploadHandler(config)(context.Background(), generateUploadFileReq())
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+	t.Run("verify clients check the tenant's quota", func(t *testing.T) {
+		var checkedUserID string
+
+		client := &Client{
+			Region: Region,
+			Router: TenantPrefixRouter(S3Bucket),
+			Quota: QuotaFunc(func(userID string, incomingBytes int64) error {
+				checkedUserID = userID
+				return errors.New("no space left")
+			}),
+		}
+
+		uploadRes, err := client.ForTenant("acme").UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), SampleFileName)
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.True(t, errors.Is(err, ErrQuotaExceeded))
+		assert.Equal(t, "acme", checkedUserID)
+	})
+	t.Run("verify usage is recorded after uploading", func(t *testing.T) {
+		var recordedUserID string
+		var recordedBytes int64
+
+		client := &Client{
+			Region: Region,
+			Bucket: S3Bucket,
+			UsageRecorder: UsageRecorderFunc(func(userID string, bytes int64) {
+				recordedUserID = userID
+				recordedBytes = bytes
+			}),
+		}
+
+		uploadRes, err := client.ForTenant("acme").UploadHeader(generateFileHeader(t, SampleFileName, []byte("contents")), "quota/"+SampleFileName)
+		assert.Nil(t, err)
+		assert.Equal(t, "acme", recordedUserID)
+		assert.Equal(t, uploadRes.BytesUploaded, recordedBytes)
+
+		assert.Nil(t, client.Delete("quota/"+SampleFileName))
+	})
+}
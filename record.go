@@ -0,0 +1,62 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+var ErrWritingUploadRecord = errors.New("the file was uploaded but its record couldn't be written to DynamoDB")
+
+// UploadRecord is the DynamoDB table WithUploadRecord writes an item to after every successful upload.
+type UploadRecord struct {
+	// Table is the name of the table.
+	Table string
+	// Item maps the upload to the item written to Table. Defaults to UploadItem.
+	Item func(uploadEvent *UploadEvent) (map[string]*dynamodb.AttributeValue, error)
+}
+
+// UploadItem is the default UploadRecord.Item. Its attributes are named after the JSON fields of uploadEvent, e.g.
+// key, bucket, size, checksumSHA256, uploader, and uploadedAt, so the table's partition key should be key. Empty
+// fields are left out and uploadedAt is stored as an RFC 3339 string.
+func UploadItem(uploadEvent *UploadEvent) (map[string]*dynamodb.AttributeValue, error) {
+	return dynamodbattribute.MarshalMap(uploadEvent)
+}
+
+// writeUploadRecord writes the item for uploadEvent to the table o asks for, if any.
+func writeUploadRecord(uploadEvent *UploadEvent, o *options) error {
+	if o.uploadRecord == nil {
+		return nil
+	}
+
+	if o.awsSession == nil {
+		return fmt.Errorf("%w: no AWS Session to write with", ErrWritingUploadRecord)
+	}
+
+	return putUploadRecord(dynamodb.New(o.awsSession), uploadEvent, o)
+}
+
+func putUploadRecord(dynamoDBClient dynamodbiface.DynamoDBAPI, uploadEvent *UploadEvent, o *options) error {
+	item := o.uploadRecord.Item
+	if item == nil {
+		item = UploadItem
+	}
+
+	attributes, err := item(uploadEvent)
+	if err != nil {
+		return wrapCause(ErrWritingUploadRecord, err)
+	}
+
+	_, err = dynamoDBClient.PutItemWithContext(o.context(), &dynamodb.PutItemInput{
+		TableName: aws.String(o.uploadRecord.Table),
+		Item:      attributes,
+	})
+	if err != nil {
+		return wrapCause(ErrWritingUploadRecord, err)
+	}
+
+	return nil
+}
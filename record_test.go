@@ -0,0 +1,90 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+// itemPutter records the items put to it.
+type itemPutter struct {
+	dynamodbiface.DynamoDBAPI
+	inputs []*dynamodb.PutItemInput
+}
+
+func (p *itemPutter) PutItemWithContext(_ aws.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	p.inputs = append(p.inputs, input)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestWithUploadRecord(t *testing.T) {
+	uploadRes := &UploadRes{
+		Key:            S3FileName,
+		BytesUploaded:  SampleFileSizeBytes,
+		ChecksumSHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+
+	uploadEvent := newUploadEvent(S3Bucket, uploadRes, nil)
+	uploadEvent.Uploader = "user-42"
+
+	t.Run("verify nothing is written without a table", func(t *testing.T) {
+		assert.Nil(t, writeUploadRecord(uploadEvent, newOptions(nil)))
+	})
+	t.Run("verify err when there's no session to write with", func(t *testing.T) {
+		err := writeUploadRecord(uploadEvent, newOptions([]Option{WithUploadRecord(UploadRecord{Table: "uploads"})}))
+		assert.True(t, errors.Is(err, ErrWritingUploadRecord))
+	})
+	t.Run("verify the default item is named after the fields of the UploadEvent", func(t *testing.T) {
+		putter := &itemPutter{}
+
+		err := putUploadRecord(putter, uploadEvent, newOptions([]Option{WithUploadRecord(UploadRecord{Table: "uploads"})}))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(putter.inputs))
+		assert.Equal(t, "uploads", aws.StringValue(putter.inputs[0].TableName))
+
+		item := putter.inputs[0].Item
+		assert.Equal(t, S3FileName, aws.StringValue(item["key"].S))
+		assert.Equal(t, S3Bucket, aws.StringValue(item["bucket"].S))
+		assert.Equal(t, "user-42", aws.StringValue(item["uploader"].S))
+		assert.Equal(t, uploadRes.ChecksumSHA256, aws.StringValue(item["checksumSHA256"].S))
+		assert.True(t, item["uploadedAt"].S != nil)
+		assert.True(t, item["size"].N != nil)
+		assert.True(t, item["eTag"] == nil)
+	})
+	t.Run("verify the item can be mapped", func(t *testing.T) {
+		putter := &itemPutter{}
+
+		record := UploadRecord{
+			Table: "files",
+			Item: func(uploadEvent *UploadEvent) (map[string]*dynamodb.AttributeValue, error) {
+				return map[string]*dynamodb.AttributeValue{
+					"pk": {S: aws.String("USER#" + uploadEvent.Uploader)},
+					"sk": {S: aws.String("FILE#" + uploadEvent.Key)},
+				}, nil
+			},
+		}
+
+		err := putUploadRecord(putter, uploadEvent, newOptions([]Option{WithUploadRecord(record)}))
+		assert.Nil(t, err)
+		assert.Equal(t, "USER#user-42", aws.StringValue(putter.inputs[0].Item["pk"].S))
+		assert.Equal(t, 2, len(putter.inputs[0].Item))
+	})
+	t.Run("verify err when the item can't be mapped", func(t *testing.T) {
+		errNoUploader := errors.New("no uploader")
+		record := UploadRecord{
+			Table: "files",
+			Item: func(*UploadEvent) (map[string]*dynamodb.AttributeValue, error) {
+				return nil, errNoUploader
+			},
+		}
+
+		err := putUploadRecord(&itemPutter{}, uploadEvent, newOptions([]Option{WithUploadRecord(record)}))
+		assert.True(t, errors.Is(err, ErrWritingUploadRecord))
+		assert.True(t, errors.Is(err, errNoUploader))
+		assert.Equal(t, ErrWritingUploadRecord.Error()+": no uploader", err.Error())
+	})
+}
@@ -0,0 +1,77 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"sync"
+)
+
+var ErrBucketNotFound = errors.New("the bucket doesn't exist")
+
+// bucketRegionHint is the region buckets are looked up from when the caller didn't give one.
+const bucketRegionHint = "us-east-1"
+
+// bucketRegions caches the region of every bucket looked up WithBucketRegion. A bucket can't move to another region
+// without being deleted and recreated so entries never expire.
+var bucketRegions sync.Map
+
+// BucketRegion returns the region bucket is in. region, which may be empty, is used as a hint of where to look.
+// Lookups are cached for the lifetime of the Lambda.
+func BucketRegion(region, bucket string, opts ...Option) (string, error) {
+	if err := validateBucket(bucket); err != nil {
+		return "", err
+	}
+
+	return newOptions(opts).bucketRegion(region, bucket)
+}
+
+// bucketRegion looks up the region of bucket with GetBucketRegion unless it's cached.
+func (o *options) bucketRegion(region, bucket string) (string, error) {
+	if cachedRegion, ok := bucketRegions.Load(bucket); ok {
+		return cachedRegion.(string), nil
+	}
+
+	if region == "" {
+		region = bucketRegionHint
+	}
+
+	awsSession, err := o.newSession(region)
+	if err != nil {
+		return "", ErrNewAWSSession
+	}
+
+	bucketRegion, err := s3manager.GetBucketRegion(o.context(), awsSession, bucket, region)
+	if err != nil {
+		if isNotFound(err) {
+			return "", ErrBucketNotFound
+		}
+		return "", ErrNewAWSSession
+	}
+
+	bucketRegions.Store(bucket, bucketRegion)
+
+	return bucketRegion, nil
+}
+
+// newBucketSession is newSession for requests to bucket. WithBucketRegion replaces region with the region bucket is
+// actually in. Access point ARNs already name their region and directory buckets can't be looked up so they're left
+// alone.
+func (o *options) newBucketSession(region, bucket string) (*session.Session, error) {
+	if o.detectBucketRegion && !arn.IsARN(bucket) && !isDirectoryBucket(bucket) {
+		bucketRegion, err := o.bucketRegion(region, bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		region = bucketRegion
+	}
+
+	return o.newSession(region)
+}
+
+// detectsBucketRegion reports whether opts contains WithBucketRegion, in which case an empty region is allowed.
+func detectsBucketRegion(opts []Option) bool {
+	return newOptions(opts).detectBucketRegion
+}
@@ -0,0 +1,59 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestWithBucketRegion(t *testing.T) {
+	t.Run("verify the cached region of the bucket replaces the region passed", func(t *testing.T) {
+		bucketRegions.Store("cached-region-bucket", "eu-west-1")
+		defer bucketRegions.Delete("cached-region-bucket")
+
+		o := newOptions([]Option{WithBucketRegion()})
+
+		awsSession, err := o.newBucketSession("", "cached-region-bucket")
+		assert.Nil(t, err)
+		assert.Equal(t, "eu-west-1", aws.StringValue(awsSession.Config.Region))
+
+		awsSession, err = o.newBucketSession("us-east-2", "cached-region-bucket")
+		assert.Nil(t, err)
+		assert.Equal(t, "eu-west-1", aws.StringValue(awsSession.Config.Region))
+	})
+	t.Run("verify the region passed is used without WithBucketRegion", func(t *testing.T) {
+		bucketRegions.Store("cached-region-bucket", "eu-west-1")
+		defer bucketRegions.Delete("cached-region-bucket")
+
+		awsSession, err := newOptions(nil).newBucketSession("us-east-2", "cached-region-bucket")
+		assert.Nil(t, err)
+		assert.Equal(t, "us-east-2", aws.StringValue(awsSession.Config.Region))
+	})
+	t.Run("verify access point ARNs aren't looked up", func(t *testing.T) {
+		awsSession, err := newOptions([]Option{WithBucketRegion()}).newBucketSession(Region, AccessPointARN)
+		assert.Nil(t, err)
+		assert.Equal(t, Region, aws.StringValue(awsSession.Config.Region))
+	})
+	t.Run("verify the region may only be empty WithBucketRegion", func(t *testing.T) {
+		_, err := Download("", S3Bucket, S3FileName)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+
+		assert.True(t, detectsBucketRegion([]Option{WithBucketRegion()}))
+		assert.False(t, detectsBucketRegion(nil))
+	})
+}
+
+func TestBucketRegion(t *testing.T) {
+	t.Run("verify the region of the bucket is found from any region", func(t *testing.T) {
+		bucketRegions.Delete(S3Bucket)
+
+		region, err := BucketRegion("", S3Bucket)
+		assert.Nil(t, err)
+		assert.Equal(t, Region, region)
+
+		fileBytes, err := Download("", S3Bucket, S3FileName, WithBucketRegion())
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+	})
+}
@@ -0,0 +1,118 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"strings"
+)
+
+// maxRenameBatch is how many objects RenamePrefix lists before moving them, the size of a ListObjectsV2 page.
+const maxRenameBatch = 1000
+
+var ErrParameterRenamePrefixes = errors.New("required parameters oldPrefix and newPrefix must be folders that don't contain each other")
+
+// errRenameStopped is returned for objects RenamePrefix didn't get to before its context was done.
+var errRenameStopped = errors.New("rename stopped")
+
+// RenamePrefix moves every object in bucket under oldPrefix to newPrefix, e.g. tenants/acme/logo.png to
+// tenants/acme-corp/logo.png when renaming tenants/acme to tenants/acme-corp. Prefixes are treated as folders so
+// tenants/acme doesn't also match tenants/acme-corp. Each object is copied server-side, along with its metadata, and
+// the original deleted once the copy succeeds, by up to WithConcurrency workers at once. The Result lists the old
+// key of every object moved and the error of every object that couldn't be, such as objects over 5 GB which can't be
+// copied in a single request.
+//
+// Since moved objects are no longer under oldPrefix, calling RenamePrefix again picks up where the last call left
+// off. When the context passed WithContext has a deadline, such as the Lambda's, objects stop being moved
+// WithDeadlineMargin before it and ErrDeadlineTooClose is returned along with the Result so far so the rename can be
+// finished by the next invocation.
+func RenamePrefix(region, bucket, oldPrefix, newPrefix string, opts ...Option) (*Result, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	oldPrefix, newPrefix = folderPrefix(oldPrefix), folderPrefix(newPrefix)
+
+	if oldPrefix == "" || newPrefix == "" {
+		return nil, fmt.Errorf("%w: renaming from or to the root of the bucket isn't supported", ErrParameterRenamePrefixes)
+	}
+
+	if strings.HasPrefix(newPrefix, oldPrefix) || strings.HasPrefix(oldPrefix, newPrefix) {
+		return nil, fmt.Errorf("%w: %s and %s overlap", ErrParameterRenamePrefixes, oldPrefix, newPrefix)
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	ctx, cancel, err := o.transferContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	result, err := renamePrefix(ctx, s3.New(awsSession), bucket, oldPrefix, newPrefix, o.concurrency)
+	if err != nil && o.deadlineExceeded(ctx) {
+		return result, ErrDeadlineTooClose
+	}
+
+	return result, err
+}
+
+// folderPrefix adds the trailing slash prefix needs to only match the keys in the folder it names.
+func folderPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return prefix + "/"
+	}
+
+	return prefix
+}
+
+func renamePrefix(ctx context.Context, s3Client s3iface.S3API, bucket, oldPrefix, newPrefix string, concurrency int) (*Result, error) {
+	result := &Result{}
+	objects := newObjectIterator(ctx, s3Client, bucket, oldPrefix)
+
+	for {
+		keys := make([]string, 0, maxRenameBatch)
+		for len(keys) < maxRenameBatch && objects.Next() {
+			keys = append(keys, objects.Object().Key)
+		}
+
+		if len(keys) == 0 {
+			break
+		}
+
+		errs := runConcurrently(concurrency, keys, func(key string) error {
+			if ctx.Err() != nil {
+				return errRenameStopped
+			}
+
+			return moveObject(ctx, s3Client, bucket, key, newPrefix+strings.TrimPrefix(key, oldPrefix))
+		})
+
+		for _, key := range keys {
+			err, failed := errs[key]
+			switch {
+			case !failed:
+				result.Succeeded = append(result.Succeeded, key)
+			case err != errRenameStopped && ctx.Err() == nil: // objects interrupted by the context are moved next time
+				result.Failed = append(result.Failed, &KeyError{Key: key, Err: err})
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	return result, objects.Err()
+}
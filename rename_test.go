@@ -0,0 +1,147 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jgroeneveld/trial/assert"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryBucket lists, copies, and deletes keys held in memory. Copies of keys in uncopyable fail.
+type memoryBucket struct {
+	s3iface.S3API
+	mutex      sync.Mutex
+	keys       map[string]bool
+	uncopyable map[string]bool
+	onCopy     func()
+}
+
+func (m *memoryBucket) ListObjectsV2WithContext(_ aws.Context, input *s3.ListObjectsV2Input, _ ...request.Option) (*s3.ListObjectsV2Output, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var keys []string
+	for key := range m.keys {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) && key > aws.StringValue(input.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	listOutput := &s3.ListObjectsV2Output{}
+	for i, key := range keys {
+		if i == 2 { // small pages so continuation tokens are used
+			listOutput.IsTruncated = aws.Bool(true)
+			listOutput.NextContinuationToken = aws.String(keys[1])
+			break
+		}
+		listOutput.Contents = append(listOutput.Contents, &s3.Object{Key: aws.String(key)})
+	}
+
+	return listOutput, nil
+}
+
+func (m *memoryBucket) CopyObjectWithContext(_ aws.Context, input *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+	if m.onCopy != nil {
+		m.onCopy()
+	}
+
+	copySource, _ := url.PathUnescape(aws.StringValue(input.CopySource))
+	from := strings.TrimPrefix(copySource, aws.StringValue(input.Bucket)+"/")
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.uncopyable[from] {
+		return nil, errors.New("InvalidRequest")
+	}
+
+	m.keys[aws.StringValue(input.Key)] = true
+
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (m *memoryBucket) DeleteObjectWithContext(_ aws.Context, input *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.keys, aws.StringValue(input.Key))
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestRenamePrefix(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		_, err := RenamePrefix("", S3Bucket, "tenants/acme", "tenants/acme-corp")
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		_, err := RenamePrefix(Region, "", "tenants/acme", "tenants/acme-corp")
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify err when a prefix is the root of the bucket", func(t *testing.T) {
+		_, err := RenamePrefix(Region, S3Bucket, "", "tenants/acme-corp")
+		assert.True(t, errors.Is(err, ErrParameterRenamePrefixes))
+
+		_, err = RenamePrefix(Region, S3Bucket, "tenants/acme", "")
+		assert.True(t, errors.Is(err, ErrParameterRenamePrefixes))
+	})
+	t.Run("verify err when the prefixes overlap", func(t *testing.T) {
+		_, err := RenamePrefix(Region, S3Bucket, "tenants/acme", "tenants/acme/archive")
+		assert.True(t, errors.Is(err, ErrParameterRenamePrefixes))
+
+		_, err = RenamePrefix(Region, S3Bucket, "tenants/acme/archive/", "tenants/acme")
+		assert.True(t, errors.Is(err, ErrParameterRenamePrefixes))
+	})
+	t.Run("verify every object is moved and failures are reported", func(t *testing.T) {
+		bucket := &memoryBucket{
+			keys: map[string]bool{
+				"tenants/acme/a.txt":      true,
+				"tenants/acme/b/c.txt":    true,
+				"tenants/acme/big.bin":    true,
+				"tenants/acme/d.txt":      true,
+				"tenants/acme-corp/e.txt": true,
+			},
+			uncopyable: map[string]bool{"tenants/acme/big.bin": true},
+		}
+
+		result, err := renamePrefix(context.Background(), bucket, S3Bucket, "tenants/acme/", "tenants/acme-corp/", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(result.Succeeded))
+		assert.Equal(t, 1, len(result.Failed))
+		assert.True(t, errors.Is(result.KeyErr("tenants/acme/big.bin"), ErrCopyingS3Object))
+
+		assert.True(t, bucket.keys["tenants/acme-corp/b/c.txt"])
+		assert.True(t, bucket.keys["tenants/acme-corp/e.txt"])
+		assert.False(t, bucket.keys["tenants/acme/a.txt"])
+		assert.True(t, bucket.keys["tenants/acme/big.bin"])
+		assert.Equal(t, 5, len(bucket.keys))
+	})
+	t.Run("verify objects left when the context is done are moved by the next call", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		bucket := &memoryBucket{
+			keys:   map[string]bool{"old/a": true, "old/b": true, "old/c": true},
+			onCopy: cancel,
+		}
+
+		result, err := renamePrefix(ctx, bucket, S3Bucket, "old/", "new/", 1)
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, 1, len(result.Succeeded))
+		assert.Equal(t, 0, len(result.Failed))
+
+		bucket.onCopy = nil
+		result, err = renamePrefix(context.Background(), bucket, S3Bucket, "old/", "new/", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(result.Succeeded))
+		assert.True(t, bucket.keys["new/a"] && bucket.keys["new/b"] && bucket.keys["new/c"])
+	})
+}
@@ -0,0 +1,160 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// ParseRequest reads the files uploaded in lambdaReq whatever form they were sent in: a multipart form, see GetForm,
+// a JSON body, see GetJSONHeader, an urlencoded form whose file fields are passed WithFileFields, see
+// GetURLEncodedHeaders, or the raw bytes of a single file, see GetBodyHeader. Files sent in a JSON or raw body are
+// returned under the field "file". Files in urlencoded forms are returned under their own field and the other fields
+// are returned as Values. Without WithFileFields every field of an urlencoded form is returned as a Value.
+// maxMemory is as for GetForm and the form should be cleaned up with RemoveForm once its files are uploaded.
+func ParseRequest(lambdaReq events.APIGatewayProxyRequest, maxMemory int64, opts ...Option) (*multipart.Form, error) {
+	return ParseSource(APIGatewayProxySource(lambdaReq), maxMemory, opts...)
+}
+
+// ParseSource is ParseRequest for requests from any source, including the urlencoded forms ParseHTTPRequest reads
+// into memory. See RequestSource.
+func ParseSource(source RequestSource, maxMemory int64, opts ...Option) (*multipart.Form, error) {
+	contentType := source.Headers().Get("Content-Type")
+	if contentType == "" {
+		return nil, ErrContentTypeHeaderMissing
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrParsingMediaType
+	}
+
+	o := newOptions(opts)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return getForm(source, maxMemory, o)
+	case isJSONRequest(source):
+		fileHeader, err := getJSONHeader(source, o)
+		if err != nil {
+			return nil, err
+		}
+
+		return &multipart.Form{File: map[string][]*multipart.FileHeader{"file": {fileHeader}}}, nil
+	case isURLEncodedRequest(source):
+		values, err := parseURLEncoded(source)
+		if err != nil {
+			return nil, err
+		}
+
+		fileHeaders, err := urlEncodedHeaders(values, o.fileFields, o)
+		if err != nil {
+			return nil, err
+		}
+
+		form := &multipart.Form{Value: map[string][]string{}, File: map[string][]*multipart.FileHeader{}}
+		for _, fileHeader := range fileHeaders {
+			form.File[fileHeader.Filename] = []*multipart.FileHeader{fileHeader}
+		}
+
+		for field, fieldValues := range values {
+			if !containsString(o.fileFields, field) {
+				form.Value[field] = fieldValues
+			}
+		}
+
+		return form, nil
+	default:
+		fileHeader, err := getBodyHeader(source, o)
+		if err != nil {
+			return nil, err
+		}
+
+		return &multipart.Form{File: map[string][]*multipart.FileHeader{"file": {fileHeader}}}, nil
+	}
+}
+
+// ParseHTTPRequest is ParseRequest for services running behind a net/http server, e.g. locally or on ECS, so they
+// share the same validation and upload code as Lambdas. Multipart forms are streamed from the request body rather
+// than read into memory first. WithMaxTotalSize is enforced as the body is read and WithMaxSize once the form has
+// been read, in which case the form's temporary files are removed before ErrFileTooLarge is returned. Other bodies
+// are read into memory and parsed by ParseSource. They're limited to WithMaxTotalSize, or maxHTTPBodySize without
+// it, and larger ones fail with ErrFormTooLarge.
+func ParseHTTPRequest(httpReq *http.Request, maxMemory int64, opts ...Option) (*multipart.Form, error) {
+	o := newOptions(opts)
+
+	mediaType, params, err := mime.ParseMediaType(httpReq.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		maxBodySize := o.maxTotalSizeBytes
+		if maxBodySize <= 0 {
+			maxBodySize = maxHTTPBodySize
+		}
+
+		body := &limitReader{reader: httpReq.Body, limit: maxBodySize, err: ErrFormTooLarge}
+		bodyBytes, err := io.ReadAll(body)
+		if body.exceeded() {
+			return nil, fmt.Errorf("%w: the body is larger than %d bytes", ErrFormTooLarge, maxBodySize)
+		}
+		if err != nil {
+			return nil, ErrReadingMultiPartForm
+		}
+
+		return ParseSource(httpSource(httpReq, string(bodyBytes)), maxMemory, opts...)
+	}
+
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, ErrBoundaryValueMissing
+	}
+
+	body := &limitReader{reader: httpReq.Body, limit: o.maxTotalSizeBytes, err: ErrFormTooLarge}
+	if o.maxTotalSizeBytes <= 0 {
+		body.limit = math.MaxInt64
+	}
+
+	// there's only one pass over the body so parts are always decoded, see decodeParts, rather than only when needed
+	decodedBody, decodedBoundary := decodeParts(multipart.NewReader(body, boundary), boundary)
+	defer decodedBody.Close()
+
+	form, err := readForm(multipart.NewReader(decodedBody, decodedBoundary), maxMemory, o)
+	if err != nil {
+		return nil, formReadError(err, o)
+	}
+
+	// limitReader returns the bytes past the limit along with its error so the form can be read regardless
+	if body.exceeded() {
+		_ = RemoveForm(form)
+		return nil, formReadError(ErrFormTooLarge, o)
+	}
+
+	for _, fileHeaders := range form.File {
+		for _, fileHeader := range fileHeaders {
+			fileHeader.Filename = normalizeFilename(fileHeader)
+
+			if err = fileTooLarge(fileHeader, o); err != nil {
+				_ = RemoveForm(form)
+				return nil, err
+			}
+		}
+	}
+
+	return form, nil
+}
+
+// maxHTTPBodySize is how much of a non multipart body ParseHTTPRequest reads into memory without WithMaxTotalSize.
+const maxHTTPBodySize = 10 << 20 // 10 megabytes
+
+// formReadError converts an error reading a request body into the error the parsing functions return.
+func formReadError(err error, o *options) error {
+	if errors.Is(err, ErrFormTooLarge) {
+		return fmt.Errorf("%w: the form is larger than %d bytes", ErrFormTooLarge, o.maxTotalSizeBytes)
+	}
+
+	return ErrReadingMultiPartForm
+}
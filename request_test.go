@@ -0,0 +1,158 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString(fileBytes)
+
+	t.Run("verify err when Content-Type header not set", func(t *testing.T) {
+		lambdaReq := generateUploadFileReq()
+		lambdaReq.Headers = map[string]string{}
+
+		_, err := ParseRequest(lambdaReq, MaxFileSizeBytes)
+		assert.Equal(t, ErrContentTypeHeaderMissing, err)
+	})
+	t.Run("verify multipart forms are parsed", func(t *testing.T) {
+		form, err := ParseRequest(generateUploadFileReq(), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(FormFiles(form)))
+	})
+	t.Run("verify JSON bodies are parsed", func(t *testing.T) {
+		form, err := ParseRequest(generateJSONUploadReq(`{"filename": "`+SampleFileName+`", "data": "`+encoded+`"}`), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(form.File["file"]))
+	})
+	t.Run("verify raw bodies are parsed", func(t *testing.T) {
+		form, err := ParseRequest(generateUploadBodyReq(fileBytes), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(form.File["file"]))
+	})
+	t.Run("verify urlencoded forms use WithFileFields", func(t *testing.T) {
+		body := url.Values{SampleFileName: {encoded}, "description": {"rates"}}.Encode()
+
+		form, err := ParseRequest(generateURLEncodedReq(body), MaxFileSizeBytes, WithFileFields(SampleFileName))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(form.File[SampleFileName]))
+		assert.Equal(t, "rates", form.Value["description"][0])
+		assert.Equal(t, 0, len(form.Value[SampleFileName]))
+	})
+	t.Run("verify urlencoded fields are Values without WithFileFields", func(t *testing.T) {
+		body := url.Values{SampleFileName: {encoded}, "description": {"rates"}}.Encode()
+
+		form, err := ParseRequest(generateURLEncodedReq(body), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(form.File))
+		assert.Equal(t, encoded, form.Value[SampleFileName][0])
+		assert.Equal(t, "rates", form.Value["description"][0])
+	})
+}
+
+func TestParseHTTPRequest(t *testing.T) {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	newMultipartRequest := func() *http.Request {
+		lambdaReq := generateUploadFileReq()
+		body, err := base64.StdEncoding.DecodeString(lambdaReq.Body)
+		if err != nil {
+			body = []byte(lambdaReq.Body)
+		}
+
+		httpReq := httptest.NewRequest(http.MethodPost, "/files", bytes.NewReader(body))
+		httpReq.Header.Set("Content-Type", lambdaReq.Headers["Content-Type"])
+
+		return httpReq
+	}
+
+	t.Run("verify multipart forms are parsed", func(t *testing.T) {
+		form, err := ParseHTTPRequest(newMultipartRequest(), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		defer form.RemoveAll()
+
+		fileHeaders := FormFiles(form)
+		assert.Equal(t, 1, len(fileHeaders))
+		assert.Equal(t, SampleFileName, fileHeaders[0].Filename)
+		assert.Equal(t, int64(SampleFileSizeBytes), fileHeaders[0].Size)
+	})
+	t.Run("verify err when a file is larger than WithMaxSize", func(t *testing.T) {
+		_, err := ParseHTTPRequest(newMultipartRequest(), MaxFileSizeBytes, WithMaxSize(SampleFileSizeBytes-1))
+		assert.True(t, errors.Is(err, ErrFileTooLarge))
+	})
+	t.Run("verify err when the form is larger than WithMaxTotalSize", func(t *testing.T) {
+		_, err := ParseHTTPRequest(newMultipartRequest(), MaxFileSizeBytes, WithMaxTotalSize(SampleFileSizeBytes-1))
+		assert.True(t, errors.Is(err, ErrFormTooLarge))
+	})
+	t.Run("verify multipart forms are spilled WithTempDir", func(t *testing.T) {
+		tempDir := t.TempDir()
+
+		form, err := ParseHTTPRequest(newMultipartRequest(), 1, WithTempDir(tempDir))
+		assert.Nil(t, err)
+
+		spilled, err := os.ReadDir(tempDir)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(spilled))
+
+		file, err := OpenFileHeader(FormFiles(form)[0])
+		assert.Nil(t, err)
+		spilledBytes, err := io.ReadAll(file)
+		assert.Nil(t, err)
+		assert.Nil(t, file.Close())
+		assert.True(t, bytes.Equal(fileBytes, spilledBytes))
+
+		assert.Nil(t, RemoveForm(form))
+
+		spilled, err = os.ReadDir(tempDir)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(spilled))
+	})
+	t.Run("verify raw bodies are parsed", func(t *testing.T) {
+		httpReq := httptest.NewRequest(http.MethodPut, "/files/"+SampleFileName, bytes.NewReader(fileBytes))
+		httpReq.Header.Set("Content-Type", "text/csv")
+
+		form, err := ParseHTTPRequest(httpReq, MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileName, form.File["file"][0].Filename)
+		assert.True(t, strings.HasPrefix(form.File["file"][0].Header.Get("Content-Type"), "text/csv"))
+	})
+	t.Run("verify urlencoded bodies use WithFileFields", func(t *testing.T) {
+		body := url.Values{SampleFileName: {base64.StdEncoding.EncodeToString(fileBytes)}, "description": {"rates"}}.Encode()
+		httpReq := httptest.NewRequest(http.MethodPost, "/files", strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		form, err := ParseHTTPRequest(httpReq, MaxFileSizeBytes, WithFileFields(SampleFileName))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(form.File[SampleFileName]))
+		assert.Equal(t, int64(SampleFileSizeBytes), form.File[SampleFileName][0].Size)
+		assert.Equal(t, "rates", form.Value["description"][0])
+		assert.Equal(t, 0, len(form.Value[SampleFileName]))
+	})
+	t.Run("verify err when a raw body is larger than WithMaxTotalSize", func(t *testing.T) {
+		httpReq := httptest.NewRequest(http.MethodPut, "/files/"+SampleFileName, bytes.NewReader(fileBytes))
+		httpReq.Header.Set("Content-Type", "text/csv")
+
+		_, err := ParseHTTPRequest(httpReq, MaxFileSizeBytes, WithMaxTotalSize(SampleFileSizeBytes-1))
+		assert.True(t, errors.Is(err, ErrFormTooLarge))
+	})
+	t.Run("verify err when a raw body is larger than maxHTTPBodySize", func(t *testing.T) {
+		httpReq := httptest.NewRequest(http.MethodPut, "/files/"+SampleFileName, bytes.NewReader(make([]byte, maxHTTPBodySize+1)))
+		httpReq.Header.Set("Content-Type", "application/octet-stream")
+
+		_, err := ParseHTTPRequest(httpReq, MaxFileSizeBytes)
+		assert.True(t, errors.Is(err, ErrFormTooLarge))
+	})
+}
@@ -0,0 +1,194 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+)
+
+// errorStatusCodes maps the errors returned by this package to the HTTP status code ErrorResponse responds with.
+// Every exported error is listed, even those that are internal server errors, so a new one can't be forgotten.
+// Errors from outside this package are treated as internal server errors.
+var errorStatusCodes = []struct {
+	err        error
+	statusCode int
+}{
+	{ErrBindingForm, http.StatusBadRequest},
+	{ErrBoundaryValueMissing, http.StatusBadRequest},
+	{ErrChecksumMissing, http.StatusBadRequest},
+	{ErrContentTypeHeaderMissing, http.StatusBadRequest},
+	{ErrDecodingEventKey, http.StatusBadRequest},
+	{ErrDecompressingFile, http.StatusBadRequest},
+	{ErrDuplicateKey, http.StatusBadRequest},
+	{ErrFormInvalid, http.StatusBadRequest},
+	{ErrInvalidBucketName, http.StatusBadRequest},
+	{ErrInvalidIdempotencyKey, http.StatusBadRequest},
+	{ErrInvalidKey, http.StatusBadRequest},
+	{ErrMultiRegionAccessPoint, http.StatusBadRequest},
+	{ErrNoFilesFound, http.StatusBadRequest},
+	{ErrNotInTrash, http.StatusBadRequest},
+	{ErrParameterKeys, http.StatusBadRequest},
+	{ErrParameterLifecycleRule, http.StatusBadRequest},
+	{ErrParameterACL, http.StatusBadRequest},
+	{ErrParameterBatchOperation, http.StatusBadRequest},
+	{ErrParameterBucketEmpty, http.StatusBadRequest},
+	{ErrParameterCustomerKey, http.StatusBadRequest},
+	{ErrParameterDays, http.StatusBadRequest},
+	{ErrParameterDistributionEmpty, http.StatusBadRequest},
+	{ErrParameterDistributionIDEmpty, http.StatusBadRequest},
+	{ErrParameterExpressionEmpty, http.StatusBadRequest},
+	{ErrParameterKeyPairIDEmpty, http.StatusBadRequest},
+	{ErrParameterLocalDirEmpty, http.StatusBadRequest},
+	{ErrParameterNameEmpty, http.StatusBadRequest},
+	{ErrParameterObjectLambdaEvent, http.StatusBadRequest},
+	{ErrParameterPartNumber, http.StatusBadRequest},
+	{ErrParameterPathsEmpty, http.StatusBadRequest},
+	{ErrParameterPrivateKeyNil, http.StatusBadRequest},
+	{ErrParameterRegionEmpty, http.StatusBadRequest},
+	{ErrParameterRetention, http.StatusBadRequest},
+	{ErrParameterPrefix, http.StatusBadRequest},
+	{ErrParameterRenamePrefixes, http.StatusBadRequest},
+	{ErrParameterRoleARN, http.StatusBadRequest},
+	{ErrParameterTenantID, http.StatusBadRequest},
+	{ErrParameterTransformFunc, http.StatusBadRequest},
+	{ErrParameterTrashEmpty, http.StatusBadRequest},
+	{ErrParameterTTL, http.StatusBadRequest},
+	{ErrParameterUploadIDEmpty, http.StatusBadRequest},
+	{ErrParsingBatchTask, http.StatusBadRequest},
+	{ErrParsingMediaType, http.StatusBadRequest},
+	{ErrParsingNotification, http.StatusBadRequest},
+	{ErrReadingArchive, http.StatusBadRequest},
+	{ErrReadingJSONBody, http.StatusBadRequest},
+	{ErrReadingMultiPartForm, http.StatusBadRequest},
+	{ErrUnmappedField, http.StatusBadRequest},
+	{ErrUnsupportedRestoreTier, http.StatusBadRequest},
+	{ErrUnsupportedSelectFormat, http.StatusBadRequest},
+	{ErrNotModified, http.StatusNotModified},
+	{ErrCrossTenantKey, http.StatusForbidden},
+	{ErrInvalidPresignedURL, http.StatusForbidden},
+	{ErrPresignedURLExpired, http.StatusForbidden},
+	{ErrForbidden, http.StatusForbidden},
+	{ErrBucketNotFound, http.StatusNotFound},
+	{ErrObjectNotFound, http.StatusNotFound},
+	{ErrArchiveTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrBucketNameTaken, http.StatusConflict},
+	{ErrObjectAlreadyExists, http.StatusConflict},
+	{ErrObjectNotArchived, http.StatusConflict},
+	{ErrRestoreInProgress, http.StatusConflict},
+	{ErrFileTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrObjectTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrFormTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrPayloadExceedsGatewayLimit, http.StatusRequestEntityTooLarge},
+	{ErrQuotaExceeded, http.StatusRequestEntityTooLarge},
+	{ErrUnsupportedArchive, http.StatusUnsupportedMediaType},
+	{ErrStrippingMetadata, http.StatusUnprocessableEntity},
+	{ErrRangeNotSatisfiable, http.StatusRequestedRangeNotSatisfiable},
+	{ErrFileRejectedByScanner, http.StatusUnprocessableEntity},
+	{ErrGeneratingThumbnail, http.StatusUnprocessableEntity},
+	{ErrTransformingFile, http.StatusUnprocessableEntity},
+	{ErrUploadRejected, http.StatusUnprocessableEntity},
+	{ErrChecksumMismatch, http.StatusBadGateway},
+	{ErrAbortingMultipartUpload, http.StatusBadGateway},
+	{ErrCompletingMultipartUpload, http.StatusBadGateway},
+	{ErrConfiguringBucket, http.StatusBadGateway},
+	{ErrCopyingS3Object, http.StatusBadGateway},
+	{ErrCreatingBatchJob, http.StatusBadGateway},
+	{ErrCreatingBucket, http.StatusBadGateway},
+	{ErrCreatingMultipartUpload, http.StatusBadGateway},
+	{ErrCreatingSession, http.StatusBadGateway},
+	{ErrDecryptingFile, http.StatusBadGateway},
+	{ErrDeletingS3Object, http.StatusBadGateway},
+	{ErrDownloadingS3File, http.StatusBadGateway},
+	{ErrEmptyFileDownloaded, http.StatusBadGateway},
+	{ErrEncryptingFile, http.StatusBadGateway},
+	{ErrFetchingOriginalObject, http.StatusBadGateway},
+	{ErrHeadingS3Object, http.StatusBadGateway},
+	{ErrIdempotencyStore, http.StatusBadGateway},
+	{ErrInvalidatingCloudFront, http.StatusBadGateway},
+	{ErrIssuingCredentials, http.StatusBadGateway},
+	{ErrListingMultipartUploads, http.StatusBadGateway},
+	{ErrListingS3Objects, http.StatusBadGateway},
+	{ErrPublishingUploadEvent, http.StatusBadGateway},
+	{ErrRestoringS3Object, http.StatusBadGateway},
+	{ErrSelectingS3Object, http.StatusBadGateway},
+	{ErrSyncIncomplete, http.StatusBadGateway},
+	{ErrUploadingPart, http.StatusBadGateway},
+	{ErrUploadingMultiPartFileToS3, http.StatusBadGateway},
+	{ErrPreflightFailed, http.StatusBadGateway},
+	{ErrPuttingLifecycleRule, http.StatusBadGateway},
+	{ErrReadingACL, http.StatusBadGateway},
+	{ErrReadingLifecycleRules, http.StatusBadGateway},
+	{ErrReadingObjectLock, http.StatusBadGateway},
+	{ErrUpdatingACL, http.StatusBadGateway},
+	{ErrUpdatingObjectLock, http.StatusBadGateway},
+	{ErrWritingManifest, http.StatusBadGateway},
+	{ErrWritingObjectLambdaResult, http.StatusBadGateway},
+	{ErrWritingUploadRecord, http.StatusBadGateway},
+	{ErrNewAWSSession, http.StatusServiceUnavailable},
+	{ErrDeadlineTooClose, http.StatusGatewayTimeout},
+	{ErrWaitTimeout, http.StatusGatewayTimeout},
+	{ErrCreatingArchive, http.StatusInternalServerError},
+	{ErrCreatingCacheDir, http.StatusInternalServerError},
+	{ErrGeneratingKey, http.StatusInternalServerError},
+	{ErrInvalidKeyTemplate, http.StatusInternalServerError},
+	{ErrKeyEscapesLocalDir, http.StatusInternalServerError},
+	{ErrOpeningMultiPartFile, http.StatusInternalServerError},
+	{ErrPresigningCloudFrontURL, http.StatusInternalServerError},
+	{ErrPresigningURL, http.StatusInternalServerError},
+	{ErrReadingLocalDir, http.StatusInternalServerError},
+	{ErrReadingMultiPartFile, http.StatusInternalServerError},
+	{ErrWritingLocalFile, http.StatusInternalServerError},
+}
+
+// Problem is the RFC 7807 problem details body returned by ErrorResponse.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// StatusCode returns the HTTP status code that best describes err: 400 for malformed requests, 403 for keys outside
+// the caller's tenant, 404 for missing objects, 413 for files that are too large, 502 and 503 when S3 fails or
+// returns an empty file, 504 when it doesn't answer in time, and 500 for everything else.
+func StatusCode(err error) int {
+	for _, errorStatusCode := range errorStatusCodes {
+		if errors.Is(err, errorStatusCode.err) {
+			return errorStatusCode.statusCode
+		}
+	}
+
+	return http.StatusInternalServerError
+}
+
+// ErrorResponse converts an error returned by this package into an API Gateway proxy response with the status code
+// from StatusCode and an application/problem+json body describing the error. Internal server errors don't include
+// the error message in the body so implementation details aren't leaked to clients. ErrNotModified is answered with
+// a bare 304 Not Modified since HTTP doesn't allow it a body.
+func ErrorResponse(err error) events.APIGatewayProxyResponse {
+	statusCode := StatusCode(err)
+
+	if statusCode == http.StatusNotModified {
+		return events.APIGatewayProxyResponse{StatusCode: statusCode}
+	}
+
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: http.StatusText(statusCode),
+	}
+
+	if statusCode != http.StatusInternalServerError {
+		problem.Detail = err.Error()
+	}
+
+	problemBytes, _ := json.Marshal(problem) // Problem only contains strings and ints so marshalling can't fail
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/problem+json"},
+		Body:       string(problemBytes),
+	}
+}
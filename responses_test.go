@@ -0,0 +1,96 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jgroeneveld/trial/assert"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	t.Run("verify bad request for malformed requests", func(t *testing.T) {
+		res := ErrorResponse(ErrBoundaryValueMissing)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "application/problem+json", res.Headers["Content-Type"])
+
+		var problem Problem
+		assert.Nil(t, json.Unmarshal([]byte(res.Body), &problem))
+		assert.Equal(t, http.StatusBadRequest, problem.Status)
+		assert.Equal(t, ErrBoundaryValueMissing.Error(), problem.Detail)
+	})
+	t.Run("verify status codes for wrapped errors", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, ErrorResponse(fmt.Errorf("wrapped: %w", ErrObjectNotFound)).StatusCode)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, ErrorResponse(fmt.Errorf("wrapped: %w", ErrFileTooLarge)).StatusCode)
+		assert.Equal(t, http.StatusBadGateway, ErrorResponse(fmt.Errorf("wrapped: %w", ErrUploadingMultiPartFileToS3)).StatusCode)
+		assert.Equal(t, http.StatusBadGateway, ErrorResponse(ErrEmptyFileDownloaded).StatusCode)
+	})
+	t.Run("verify not modified has no body", func(t *testing.T) {
+		res := ErrorResponse(fmt.Errorf("wrapped: %w", ErrNotModified))
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+		assert.Equal(t, "", res.Body)
+		assert.Equal(t, "", res.Headers["Content-Type"])
+	})
+	t.Run("verify internal server error hides unknown errors", func(t *testing.T) {
+		res := ErrorResponse(errors.New("secret database password"))
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+		var problem Problem
+		assert.Nil(t, json.Unmarshal([]byte(res.Body), &problem))
+		assert.Equal(t, http.StatusText(http.StatusInternalServerError), problem.Detail)
+	})
+}
+
+func TestErrorStatusCodes(t *testing.T) {
+	t.Run("verify every exported error has a status code", func(t *testing.T) {
+		packages, err := parser.ParseDir(token.NewFileSet(), ".", func(info fs.FileInfo) bool {
+			return !strings.HasSuffix(info.Name(), "_test.go")
+		}, 0)
+		assert.Nil(t, err)
+
+		var exportedErrs []string
+		listedErrs := map[string]bool{}
+
+		for _, file := range packages["lambda_s3"].Files {
+			ast.Inspect(file, func(node ast.Node) bool {
+				valueSpec, ok := node.(*ast.ValueSpec)
+				if !ok {
+					return true
+				}
+
+				for i, name := range valueSpec.Names {
+					if strings.HasPrefix(name.Name, "Err") {
+						exportedErrs = append(exportedErrs, name.Name)
+					}
+
+					if name.Name != "errorStatusCodes" {
+						continue
+					}
+
+					for _, element := range valueSpec.Values[i].(*ast.CompositeLit).Elts {
+						listedErrs[element.(*ast.CompositeLit).Elts[0].(*ast.Ident).Name] = true
+					}
+				}
+
+				return true
+			})
+		}
+
+		assert.True(t, len(exportedErrs) > 0)
+		for _, exportedErr := range exportedErrs {
+			assert.True(t, listedErrs[exportedErr], exportedErr+" isn't in errorStatusCodes")
+		}
+	})
+	t.Run("verify client faults and AWS failures aren't internal server errors", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, StatusCode(ErrChecksumMissing))
+		assert.Equal(t, http.StatusBadRequest, StatusCode(ErrDecompressingFile))
+		assert.Equal(t, http.StatusBadGateway, StatusCode(ErrUploadingPart))
+		assert.Equal(t, http.StatusGatewayTimeout, StatusCode(ErrWaitTimeout))
+	})
+}
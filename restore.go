@@ -0,0 +1,143 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"strings"
+)
+
+// RestoreTier is how fast, and how expensively, S3 restores an archived object.
+type RestoreTier string
+
+const (
+	// RestoreTierExpedited restores objects in 1-5 minutes. Not available for S3 Glacier Deep Archive.
+	RestoreTierExpedited RestoreTier = s3.TierExpedited
+	// RestoreTierStandard restores objects in 3-5 hours, or within 12 hours from S3 Glacier Deep Archive.
+	RestoreTierStandard RestoreTier = s3.TierStandard
+	// RestoreTierBulk restores objects in 5-12 hours, or within 48 hours from S3 Glacier Deep Archive.
+	RestoreTierBulk RestoreTier = s3.TierBulk
+)
+
+var (
+	ErrHeadingS3Object        = errors.New("unable to read the metadata of the S3 object")
+	ErrObjectNotArchived      = errors.New("the S3 object isn't archived so there's nothing to restore")
+	ErrParameterDays          = errors.New("required parameter days must be at least 1")
+	ErrRestoreInProgress      = errors.New("a restore of the S3 object is already in progress")
+	ErrRestoringS3Object      = errors.New("unable to restore the S3 object")
+	ErrUnsupportedRestoreTier = errors.New("unsupported restore tier. use one of the RestoreTier constants")
+)
+
+// Restore starts restoring an object archived in the S3 Glacier Flexible Retrieval or Deep Archive storage classes,
+// or an archive tier of S3 Intelligent-Tiering, so it can be downloaded. Restores take minutes to hours depending on
+// tier. Poll IsRestored to find out when it's done. The restored copy is kept for days days before it's removed
+// again, the archived object itself is never affected. Objects stored in Intelligent-Tiering ignore days.
+// Restoring an object that's already being restored returns ErrRestoreInProgress. Restoring an object that's
+// already restored extends how long the restored copy is kept.
+func Restore(region, bucket, name string, days int64, tier RestoreTier) error {
+	if region == "" {
+		return ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return err
+	}
+
+	if name == "" {
+		return ErrParameterNameEmpty
+	}
+
+	if days < 1 {
+		return ErrParameterDays
+	}
+
+	switch tier {
+	case RestoreTierExpedited, RestoreTierStandard, RestoreTierBulk:
+	default:
+		return ErrUnsupportedRestoreTier
+	}
+
+	awsSession, err := newOptions(nil).newSession(region)
+	if err != nil {
+		return ErrNewAWSSession
+	}
+
+	_, err = s3.New(awsSession).RestoreObjectWithContext(aws.BackgroundContext(), &s3.RestoreObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+		RestoreRequest: &s3.RestoreRequest{
+			Days:                 aws.Int64(days),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(string(tier))},
+		},
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) {
+			switch awsErr.Code() {
+			case "RestoreAlreadyInProgress":
+				return ErrRestoreInProgress
+			case s3.ErrCodeInvalidObjectState:
+				return ErrObjectNotArchived
+			}
+		}
+
+		if isNotFound(err) {
+			return ErrObjectNotFound
+		}
+
+		return ErrRestoringS3Object
+	}
+
+	return nil
+}
+
+// IsRestored reports whether the object called name can be downloaded. That's true once a restore started with
+// Restore has finished and also for objects that were never archived in the first place. It's false while the
+// object is archived, whether or not a restore is in progress.
+func IsRestored(region, bucket, name string) (bool, error) {
+	if region == "" {
+		return false, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return false, err
+	}
+
+	if name == "" {
+		return false, ErrParameterNameEmpty
+	}
+
+	awsSession, err := newOptions(nil).newSession(region)
+	if err != nil {
+		return false, ErrNewAWSSession
+	}
+
+	headOutput, err := s3.New(awsSession).HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return false, ErrObjectNotFound
+		}
+		return false, ErrHeadingS3Object
+	}
+
+	return isRestored(headOutput), nil
+}
+
+// isRestored reads the x-amz-restore header, e.g. ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+func isRestored(headOutput *s3.HeadObjectOutput) bool {
+	archived := headOutput.ArchiveStatus != nil // Intelligent-Tiering archive tiers
+	switch aws.StringValue(headOutput.StorageClass) {
+	case s3.StorageClassGlacier, s3.StorageClassDeepArchive:
+		archived = true
+	}
+
+	if !archived {
+		return true
+	}
+
+	return strings.Contains(aws.StringValue(headOutput.Restore), `ongoing-request="false"`)
+}
@@ -0,0 +1,47 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	t.Run("verify err when days is less than 1", func(t *testing.T) {
+		assert.Equal(t, ErrParameterDays, Restore(Region, S3Bucket, S3FileName, 0, RestoreTierBulk))
+	})
+	t.Run("verify err when tier is unsupported", func(t *testing.T) {
+		assert.Equal(t, ErrUnsupportedRestoreTier, Restore(Region, S3Bucket, S3FileName, 1, "Instant"))
+	})
+	t.Run("verify err when the object isn't archived", func(t *testing.T) {
+		assert.Equal(t, ErrObjectNotArchived, Restore(Region, S3Bucket, S3FileName, 1, RestoreTierStandard))
+	})
+}
+
+func TestIsRestored(t *testing.T) {
+	t.Run("verify err when name is empty", func(t *testing.T) {
+		restored, err := IsRestored(Region, S3Bucket, "")
+		assert.False(t, restored)
+		assert.Equal(t, ErrParameterNameEmpty, err)
+	})
+	t.Run("verify isRestored reads the storage class and restore header", func(t *testing.T) {
+		assert.True(t, isRestored(&s3.HeadObjectOutput{}))
+		assert.True(t, isRestored(&s3.HeadObjectOutput{StorageClass: aws.String(s3.StorageClassGlacierIr)}))
+		assert.False(t, isRestored(&s3.HeadObjectOutput{StorageClass: aws.String(s3.StorageClassGlacier)}))
+		assert.False(t, isRestored(&s3.HeadObjectOutput{
+			StorageClass: aws.String(s3.StorageClassDeepArchive),
+			Restore:      aws.String(`ongoing-request="true"`),
+		}))
+		assert.True(t, isRestored(&s3.HeadObjectOutput{
+			StorageClass: aws.String(s3.StorageClassGlacier),
+			Restore:      aws.String(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`),
+		}))
+		assert.False(t, isRestored(&s3.HeadObjectOutput{ArchiveStatus: aws.String(s3.ArchiveStatusArchiveAccess)}))
+	})
+	t.Run("verify objects that were never archived are restored", func(t *testing.T) {
+		restored, err := IsRestored(Region, S3Bucket, S3FileName)
+		assert.Nil(t, err)
+		assert.True(t, restored)
+	})
+}
@@ -0,0 +1,155 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/url"
+)
+
+var (
+	ErrDecodingEventKey    = errors.New("unable to URL decode the object key in the S3 event")
+	ErrParsingNotification = errors.New("unable to parse the S3 event notification in the message")
+)
+
+// ObjectRef references an S3 object named in an event, with enough detail to act on it in one call.
+type ObjectRef struct {
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionID string `json:"versionID,omitempty"`
+	ETag      string `json:"eTag,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	// EventName is the S3 event that named the object. e.g. ObjectCreated:Put or ObjectRemoved:Delete
+	EventName string `json:"eventName,omitempty"`
+}
+
+// ObjectRefsFromS3Event returns an ObjectRef for every record in an S3 event notification. S3 URL encodes the keys
+// in its events, spaces become + for example, so the keys are decoded to the actual keys of the objects.
+func ObjectRefsFromS3Event(s3Event events.S3Event) ([]*ObjectRef, error) {
+	objectRefs := make([]*ObjectRef, 0, len(s3Event.Records))
+
+	for _, record := range s3Event.Records {
+		objectRef, err := objectRefFromS3EventRecord(record)
+		if err != nil {
+			return nil, err
+		}
+
+		objectRefs = append(objectRefs, objectRef)
+	}
+
+	return objectRefs, nil
+}
+
+// ObjectRefsFromSQSEvent returns an ObjectRef for every record of the S3 event notifications delivered in an SQS
+// event, whether S3 sent them to the queue directly or through an SNS topic subscribed to by the queue. The
+// s3:TestEvent S3 sends when notifications are first configured is skipped. Messages that aren't S3 event
+// notifications fail with ErrParsingNotification naming the message.
+func ObjectRefsFromSQSEvent(sqsEvent events.SQSEvent) ([]*ObjectRef, error) {
+	var objectRefs []*ObjectRef
+
+	for _, message := range sqsEvent.Records {
+		messageRefs, err := objectRefsFromNotification(message.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: message %s: %s", ErrParsingNotification, message.MessageId, err)
+		}
+
+		objectRefs = append(objectRefs, messageRefs...)
+	}
+
+	return objectRefs, nil
+}
+
+// notification is the union of the fields of the S3 event notifications an SQS message can contain.
+type notification struct {
+	events.S3Event
+	// set when the notification was published to SNS. Message holds the S3 event notification
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+	// set when the notification is an s3:TestEvent
+	Event string `json:"Event"`
+}
+
+func objectRefsFromNotification(body string) ([]*ObjectRef, error) {
+	var n notification
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		return nil, err
+	}
+
+	if n.Type == "Notification" {
+		return objectRefsFromNotification(n.Message)
+	}
+
+	if n.Event == "s3:TestEvent" {
+		return nil, nil
+	}
+
+	if len(n.Records) == 0 {
+		return nil, errors.New("no S3 event records")
+	}
+
+	return ObjectRefsFromS3Event(n.S3Event)
+}
+
+func objectRefFromS3EventRecord(record events.S3EventRecord) (*ObjectRef, error) {
+	key, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecodingEventKey, record.S3.Object.Key)
+	}
+
+	return &ObjectRef{
+		Region:    record.AWSRegion,
+		Bucket:    record.S3.Bucket.Name,
+		Key:       key,
+		VersionID: record.S3.Object.VersionID,
+		ETag:      record.S3.Object.ETag,
+		Size:      record.S3.Object.Size,
+		EventName: record.EventName,
+	}, nil
+}
+
+// Download downloads the object. See Download.
+func (r *ObjectRef) Download(opts ...Option) ([]byte, error) {
+	return Download(r.Region, r.Bucket, r.Key, opts...)
+}
+
+// Head returns the object's metadata without downloading it.
+func (r *ObjectRef) Head(opts ...Option) (*s3.HeadObjectOutput, error) {
+	if r.Region == "" {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(r.Bucket); err != nil {
+		return nil, err
+	}
+
+	if r.Key == "" {
+		return nil, ErrParameterNameEmpty
+	}
+
+	awsSession, err := newOptions(opts).newSession(r.Region)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	headOutput, err := s3.New(awsSession).HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket: aws.String(r.Bucket),
+		Key:    aws.String(r.Key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, ErrHeadingS3Object
+	}
+
+	return headOutput, nil
+}
+
+// Delete deletes the object. See Delete.
+func (r *ObjectRef) Delete(opts ...Option) error {
+	return Delete(r.Region, r.Bucket, r.Key, opts...)
+}
@@ -0,0 +1,100 @@
+package lambda_s3
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+// generateS3Event returns an S3 event notification for key as S3 would send it.
+func generateS3Event(t *testing.T, encodedKey string) events.S3Event {
+	var s3Event events.S3Event
+	err := json.Unmarshal([]byte(`{"Records": [{
+		"eventVersion": "2.1",
+		"eventSource": "aws:s3",
+		"awsRegion": "`+Region+`",
+		"eventName": "ObjectCreated:Put",
+		"s3": {
+			"bucket": {"name": "`+S3Bucket+`"},
+			"object": {"key": "`+encodedKey+`", "size": 369, "eTag": "d41d8cd98f00b204e9800998ecf8427e"}
+		}
+	}]}`), &s3Event)
+	assert.Nil(t, err)
+
+	return s3Event
+}
+
+func TestObjectRefsFromS3Event(t *testing.T) {
+	t.Run("verify keys are URL decoded", func(t *testing.T) {
+		objectRefs, err := ObjectRefsFromS3Event(generateS3Event(t, "reports/q1+2023%28final%29.csv"))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(objectRefs))
+		assert.Equal(t, "reports/q1 2023(final).csv", objectRefs[0].Key)
+		assert.Equal(t, S3Bucket, objectRefs[0].Bucket)
+		assert.Equal(t, Region, objectRefs[0].Region)
+		assert.Equal(t, int64(369), objectRefs[0].Size)
+		assert.Equal(t, "ObjectCreated:Put", objectRefs[0].EventName)
+	})
+	t.Run("verify err when a key can't be decoded", func(t *testing.T) {
+		s3Event := events.S3Event{Records: []events.S3EventRecord{{}}}
+		s3Event.Records[0].S3.Object.Key = "bad%zzkey"
+
+		objectRefs, err := ObjectRefsFromS3Event(s3Event)
+		assert.Equal(t, 0, len(objectRefs))
+		assert.True(t, errors.Is(err, ErrDecodingEventKey))
+	})
+	t.Run("verify err when heading a ref without a key", func(t *testing.T) {
+		headOutput, err := (&ObjectRef{Region: Region, Bucket: S3Bucket}).Head()
+		assert.Equal(t, headOutput, (*s3.HeadObjectOutput)(nil))
+		assert.Equal(t, ErrParameterNameEmpty, err)
+	})
+	t.Run("verify refs can download the object", func(t *testing.T) {
+		objectRefs, err := ObjectRefsFromS3Event(generateS3Event(t, S3FileName))
+		assert.Nil(t, err)
+
+		headOutput, err := objectRefs[0].Head()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(SampleFileSizeBytes), *headOutput.ContentLength)
+
+		fileBytes, err := objectRefs[0].Download()
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+	})
+}
+
+func TestObjectRefsFromSQSEvent(t *testing.T) {
+	s3EventBody, err := json.Marshal(generateS3Event(t, "reports/q1+2023.csv"))
+	assert.Nil(t, err)
+
+	snsBody, err := json.Marshal(map[string]string{
+		"Type":     "Notification",
+		"TopicArn": "arn:aws:sns:us-east-2:123456789012:uploads",
+		"Message":  string(s3EventBody),
+	})
+	assert.Nil(t, err)
+
+	t.Run("verify S3 notifications are parsed directly and from SNS", func(t *testing.T) {
+		objectRefs, err := ObjectRefsFromSQSEvent(events.SQSEvent{Records: []events.SQSMessage{
+			{MessageId: "1", Body: string(s3EventBody)},
+			{MessageId: "2", Body: string(snsBody)},
+			{MessageId: "3", Body: `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"` + S3Bucket + `"}`},
+		}})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(objectRefs))
+
+		for _, objectRef := range objectRefs {
+			assert.Equal(t, "reports/q1 2023.csv", objectRef.Key)
+			assert.Equal(t, S3Bucket, objectRef.Bucket)
+		}
+	})
+	t.Run("verify err when a message isn't an S3 notification", func(t *testing.T) {
+		for _, body := range []string{"not json", `{"hello": "world"}`} {
+			objectRefs, err := ObjectRefsFromSQSEvent(events.SQSEvent{Records: []events.SQSMessage{{MessageId: "1", Body: body}}})
+			assert.Equal(t, 0, len(objectRefs))
+			assert.True(t, errors.Is(err, ErrParsingNotification))
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var ErrFileRejectedByScanner = errors.New("the file was rejected by the Scanner")
+
+// Scanner inspects files before they're stored in S3, for example by passing them to an antivirus engine. Scan
+// reads the file from r and returns an error describing the problem if the file must not be stored.
+type Scanner interface {
+	Scan(r io.Reader) error
+}
+
+// ScannerFunc adapts a function to a Scanner.
+type ScannerFunc func(r io.Reader) error
+
+// Scan calls f(r).
+func (f ScannerFunc) Scan(r io.Reader) error {
+	return f(r)
+}
+
+// scanningReader tees everything read through it to a Scanner running alongside the upload so the file is
+// scanned while it streams to S3 instead of being read twice. The scanner's verdict is waited for before the final
+// EOF is returned so a rejected file fails the upload before s3manager can finish it.
+type scanningReader struct {
+	reader     io.Reader
+	pipeWriter *io.PipeWriter
+	result     chan error
+	scanned    bool
+	verdict    error
+
+	mutex     sync.Mutex
+	rejection error
+}
+
+func newScanningReader(body io.Reader, scanner Scanner) *scanningReader {
+	pipeReader, pipeWriter := io.Pipe()
+
+	s := &scanningReader{
+		reader:     io.TeeReader(body, pipeWriter),
+		pipeWriter: pipeWriter,
+		result:     make(chan error, 1),
+	}
+
+	go func() {
+		err := scanner.Scan(pipeReader)
+		if err != nil {
+			err = fmt.Errorf("%w: %s", ErrFileRejectedByScanner, err)
+			s.reject(err)
+			pipeReader.CloseWithError(err) // fails the upload's next read
+		} else {
+			io.Copy(io.Discard, pipeReader) // scanners that stop reading early mustn't stall the upload
+		}
+
+		s.result <- err
+	}()
+
+	return s
+}
+
+func (s *scanningReader) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	if err == io.EOF {
+		if !s.scanned {
+			s.pipeWriter.Close()
+			s.verdict = <-s.result
+			s.scanned = true
+		}
+
+		if s.verdict != nil {
+			return n, s.verdict
+		}
+	}
+
+	return n, err
+}
+
+// Close stops the scanner if the upload ended before the whole file was read.
+func (s *scanningReader) Close() error {
+	return s.pipeWriter.CloseWithError(io.ErrUnexpectedEOF)
+}
+
+func (s *scanningReader) reject(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rejection = err
+}
+
+// rejected returns the scanner's rejection if it rejected the file.
+func (s *scanningReader) rejected() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rejection
+}
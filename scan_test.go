@@ -0,0 +1,73 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+// eicarScanner rejects files containing the EICAR antivirus test string.
+var eicarScanner = ScannerFunc(func(r io.Reader) error {
+	fileBytes, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Contains(fileBytes, []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+		return errors.New("Eicar-Test-Signature FOUND")
+	}
+
+	return nil
+})
+
+func TestScanningReader(t *testing.T) {
+	fileBytes := bytes.Repeat([]byte("clean file "), 100000)
+
+	t.Run("verify accepted files are read in full", func(t *testing.T) {
+		readBytes, err := io.ReadAll(newScanningReader(bytes.NewReader(fileBytes), eicarScanner))
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(fileBytes, readBytes))
+	})
+	t.Run("verify rejected files fail before the final EOF", func(t *testing.T) {
+		infected := append(append([]byte{}, fileBytes...), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")...)
+
+		scanning := newScanningReader(bytes.NewReader(infected), eicarScanner)
+		_, err := io.ReadAll(scanning)
+		assert.True(t, errors.Is(err, ErrFileRejectedByScanner))
+		assert.True(t, errors.Is(scanning.rejected(), ErrFileRejectedByScanner))
+	})
+	t.Run("verify scanners rejecting early fail the read", func(t *testing.T) {
+		rejectAll := ScannerFunc(func(r io.Reader) error {
+			return errors.New("no uploads allowed")
+		})
+
+		_, err := io.ReadAll(newScanningReader(bytes.NewReader(fileBytes), rejectAll))
+		assert.True(t, errors.Is(err, ErrFileRejectedByScanner))
+	})
+	t.Run("verify scanners accepting early don't stall the read", func(t *testing.T) {
+		headerOnly := ScannerFunc(func(r io.Reader) error {
+			_, err := r.Read(make([]byte, 4))
+			return err
+		})
+
+		readBytes, err := io.ReadAll(newScanningReader(bytes.NewReader(fileBytes), headerOnly))
+		assert.Nil(t, err)
+		assert.Equal(t, len(fileBytes), len(readBytes))
+	})
+	t.Run("verify WithScanner rejects uploads", func(t *testing.T) {
+		sampleBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		infected := append(sampleBytes, []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")...)
+		uploadRes, err := UploadHeader(generateFileHeader(t, SampleFileName, infected), Region, S3Bucket, "scanned/"+SampleFileName, WithScanner(eicarScanner))
+		assert.Equal(t, uploadRes, (*UploadRes)(nil))
+		assert.True(t, errors.Is(err, ErrFileRejectedByScanner))
+
+		uploadRes, err = UploadHeader(generateFileHeader(t, SampleFileName, sampleBytes), Region, S3Bucket, "scanned/"+SampleFileName, WithScanner(eicarScanner))
+		assert.Nil(t, err)
+		assert.Nil(t, Delete(Region, S3Bucket, uploadRes.Key))
+	})
+}
@@ -0,0 +1,106 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// SelectFormat is the format of an object queried with Select.
+type SelectFormat string
+
+const (
+	// SelectFormatCSV queries CSV objects whose first line is a header naming the columns. Records are returned as CSV.
+	SelectFormatCSV SelectFormat = "CSV"
+	// SelectFormatJSON queries objects containing one JSON document per line. Records are returned as JSON lines.
+	SelectFormatJSON SelectFormat = "JSON"
+	// SelectFormatParquet queries Apache Parquet objects. Records are returned as JSON lines.
+	SelectFormatParquet SelectFormat = "Parquet"
+)
+
+var (
+	ErrParameterExpressionEmpty = errors.New("required parameter sqlExpression is empty")
+	ErrSelectingS3Object        = errors.New("unable to query the given file with S3 Select")
+	ErrUnsupportedSelectFormat  = errors.New("inputFormat must be one of SelectFormatCSV, SelectFormatJSON, or SelectFormatParquet")
+)
+
+// Select runs sqlExpression, such as `SELECT s.name FROM S3Object s WHERE s.age > '21'`, against the object
+// called name using S3 Select and returns the matching records. Only the records are transferred so a few rows
+// can be pulled out of a huge object without downloading all of it. Use WithGzip for gzip compressed
+// CSV or JSON objects.
+func Select(region, bucket, name, sqlExpression string, inputFormat SelectFormat, opts ...Option) ([]byte, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		return nil, ErrParameterNameEmpty
+	}
+
+	if sqlExpression == "" {
+		return nil, ErrParameterExpressionEmpty
+	}
+
+	o := newOptions(opts)
+
+	inputSerialization := &s3.InputSerialization{}
+	outputSerialization := &s3.OutputSerialization{
+		JSON: &s3.JSONOutput{},
+	}
+
+	switch inputFormat {
+	case SelectFormatCSV:
+		inputSerialization.CSV = &s3.CSVInput{FileHeaderInfo: aws.String(s3.FileHeaderInfoUse)}
+		outputSerialization = &s3.OutputSerialization{CSV: &s3.CSVOutput{}}
+	case SelectFormatJSON:
+		inputSerialization.JSON = &s3.JSONInput{Type: aws.String(s3.JSONTypeLines)}
+	case SelectFormatParquet:
+		inputSerialization.Parquet = &s3.ParquetInput{}
+	default:
+		return nil, ErrUnsupportedSelectFormat
+	}
+
+	if o.gzip && inputFormat != SelectFormatParquet {
+		inputSerialization.CompressionType = aws.String(s3.CompressionTypeGzip)
+	}
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	selectOutput, err := s3.New(awsSession).SelectObjectContentWithContext(o.context(), &s3.SelectObjectContentInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(name),
+		Expression:          aws.String(sqlExpression),
+		ExpressionType:      aws.String(s3.ExpressionTypeSql),
+		InputSerialization:  inputSerialization,
+		OutputSerialization: outputSerialization,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, ErrSelectingS3Object
+	}
+	defer selectOutput.EventStream.Close()
+
+	var records bytes.Buffer
+
+	for event := range selectOutput.EventStream.Events() {
+		if recordsEvent, ok := event.(*s3.RecordsEvent); ok {
+			records.Write(recordsEvent.Payload)
+		}
+	}
+
+	if err = selectOutput.EventStream.Err(); err != nil {
+		return nil, ErrSelectingS3Object
+	}
+
+	return records.Bytes(), nil
+}
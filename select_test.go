@@ -0,0 +1,43 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"strings"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	const sqlExpression = "SELECT * FROM S3Object s"
+
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		records, err := Select("", S3Bucket, S3FileName, sqlExpression, SelectFormatCSV)
+		assert.Equal(t, len(records), 0)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		records, err := Select(Region, "", S3FileName, sqlExpression, SelectFormatCSV)
+		assert.Equal(t, len(records), 0)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify err when name is empty", func(t *testing.T) {
+		records, err := Select(Region, S3Bucket, "", sqlExpression, SelectFormatCSV)
+		assert.Equal(t, len(records), 0)
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+	})
+	t.Run("verify err when sqlExpression is empty", func(t *testing.T) {
+		records, err := Select(Region, S3Bucket, S3FileName, "", SelectFormatCSV)
+		assert.Equal(t, len(records), 0)
+		assert.True(t, errors.Is(err, ErrParameterExpressionEmpty))
+	})
+	t.Run("verify err when inputFormat is unsupported", func(t *testing.T) {
+		records, err := Select(Region, S3Bucket, S3FileName, sqlExpression, "XML")
+		assert.Equal(t, len(records), 0)
+		assert.True(t, errors.Is(err, ErrUnsupportedSelectFormat))
+	})
+	t.Run("verify Select works with correct inputs", func(t *testing.T) {
+		records, err := Select(Region, S3Bucket, S3FileName, "SELECT s._1 FROM S3Object s LIMIT 2", SelectFormatCSV)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(strings.Split(strings.TrimSpace(string(records)), "\n")))
+	})
+}
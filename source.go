@@ -0,0 +1,132 @@
+package lambda_s3
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RequestSource is a request carrying uploaded files, whatever kind of event or server it came from. ParseSource
+// reads the files in any RequestSource so supporting a new kind of event only takes an adapter. This package has
+// adapters for API Gateway REST and HTTP APIs, Application Load Balancers, Lambda Function URLs and net/http.
+type RequestSource interface {
+	// Headers are the request's headers.
+	Headers() http.Header
+	// Body is the request's body, base64 encoded when IsBase64 is true.
+	Body() string
+	// IsBase64 reports whether Body is base64 encoded.
+	IsBase64() bool
+	// Path is the request's path. It names files sent as a raw body.
+	Path() string
+}
+
+// requestSource is the RequestSource returned by the adapters in this package.
+type requestSource struct {
+	headers  http.Header
+	body     string
+	isBase64 bool
+	path     string
+}
+
+func (r *requestSource) Headers() http.Header { return r.headers }
+func (r *requestSource) Body() string         { return r.body }
+func (r *requestSource) IsBase64() bool       { return r.isBase64 }
+func (r *requestSource) Path() string         { return r.path }
+
+// APIGatewayProxySource adapts API Gateway REST API, and HTTP API payload format 1.0, requests.
+func APIGatewayProxySource(lambdaReq events.APIGatewayProxyRequest) RequestSource {
+	return &requestSource{
+		headers:  mergeHeaders(lambdaReq.Headers, lambdaReq.MultiValueHeaders),
+		body:     lambdaReq.Body,
+		isBase64: lambdaReq.IsBase64Encoded,
+		path:     lambdaReq.Path,
+	}
+}
+
+// APIGatewayV2Source adapts API Gateway HTTP API payload format 2.0 requests.
+func APIGatewayV2Source(lambdaReq events.APIGatewayV2HTTPRequest) RequestSource {
+	return &requestSource{
+		headers:  joinedHeaders(lambdaReq.Headers, lambdaReq.Cookies),
+		body:     lambdaReq.Body,
+		isBase64: lambdaReq.IsBase64Encoded,
+		path:     lambdaReq.RawPath,
+	}
+}
+
+// ALBSource adapts Application Load Balancer requests.
+func ALBSource(lambdaReq events.ALBTargetGroupRequest) RequestSource {
+	return &requestSource{
+		headers:  mergeHeaders(lambdaReq.Headers, lambdaReq.MultiValueHeaders),
+		body:     lambdaReq.Body,
+		isBase64: lambdaReq.IsBase64Encoded,
+		path:     lambdaReq.Path,
+	}
+}
+
+// FunctionURLSource adapts Lambda Function URL requests.
+func FunctionURLSource(lambdaReq events.LambdaFunctionURLRequest) RequestSource {
+	return &requestSource{
+		headers:  joinedHeaders(lambdaReq.Headers, lambdaReq.Cookies),
+		body:     lambdaReq.Body,
+		isBase64: lambdaReq.IsBase64Encoded,
+		path:     lambdaReq.RawPath,
+	}
+}
+
+// HTTPSource adapts net/http requests. The whole body is read into memory, as it would be by API Gateway, so
+// ParseHTTPRequest, which streams multipart forms, is usually the better choice.
+func HTTPSource(httpReq *http.Request) (RequestSource, error) {
+	bodyBytes, err := io.ReadAll(httpReq.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpSource(httpReq, string(bodyBytes)), nil
+}
+
+// httpSource adapts httpReq whose body has already been read.
+func httpSource(httpReq *http.Request, body string) RequestSource {
+	return &requestSource{
+		headers: httpReq.Header,
+		body:    body,
+		path:    httpReq.URL.Path,
+	}
+}
+
+// mergeHeaders merges the single and multi value headers of an event into one http.Header.
+func mergeHeaders(headers map[string]string, multiValueHeaders map[string][]string) http.Header {
+	// workaround for case-sensitive headers. thanks AWS!
+	// https://github.com/aws/aws-lambda-go/issues/117
+	merged := http.Header{}
+
+	for header, value := range headers {
+		merged.Add(header, value)
+	}
+
+	for header, values := range multiValueHeaders {
+		for _, value := range values {
+			if !containsString(merged.Values(header), value) {
+				merged.Add(header, value)
+			}
+		}
+	}
+
+	return merged
+}
+
+// joinedHeaders converts the headers of payload format 2.0 events, which join repeated headers with commas and
+// move cookies into their own field, to an http.Header.
+func joinedHeaders(headers map[string]string, cookies []string) http.Header {
+	joined := http.Header{}
+
+	for header, value := range headers {
+		joined.Add(header, value)
+	}
+
+	if len(cookies) > 0 {
+		joined.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	return joined
+}
@@ -0,0 +1,65 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestSources(t *testing.T) {
+	lambdaReq := generateUploadFileReq()
+	contentType := lambdaReq.Headers["Content-Type"]
+
+	sources := map[string]RequestSource{
+		"APIGatewayProxySource": APIGatewayProxySource(lambdaReq),
+		"APIGatewayV2Source": APIGatewayV2Source(events.APIGatewayV2HTTPRequest{
+			RawPath:         "/files",
+			Headers:         map[string]string{"content-type": contentType},
+			Cookies:         []string{"a=1", "b=2"},
+			Body:            lambdaReq.Body,
+			IsBase64Encoded: lambdaReq.IsBase64Encoded,
+		}),
+		"ALBSource": ALBSource(events.ALBTargetGroupRequest{
+			Path:              "/files",
+			MultiValueHeaders: map[string][]string{"content-type": {contentType}},
+			Body:              lambdaReq.Body,
+			IsBase64Encoded:   lambdaReq.IsBase64Encoded,
+		}),
+		"FunctionURLSource": FunctionURLSource(events.LambdaFunctionURLRequest{
+			RawPath:         "/files",
+			Headers:         map[string]string{"Content-Type": contentType},
+			Body:            lambdaReq.Body,
+			IsBase64Encoded: lambdaReq.IsBase64Encoded,
+		}),
+	}
+
+	body := []byte(lambdaReq.Body)
+	if lambdaReq.IsBase64Encoded {
+		body, _ = base64.StdEncoding.DecodeString(lambdaReq.Body)
+	}
+
+	httpReq := httptest.NewRequest(http.MethodPost, "/files", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", contentType)
+
+	httpSource, err := HTTPSource(httpReq)
+	assert.Nil(t, err)
+	sources["HTTPSource"] = httpSource
+
+	t.Run("verify ParseSource reads the files from every source", func(t *testing.T) {
+		for name, source := range sources {
+			form, err := ParseSource(source, MaxFileSizeBytes)
+			assert.Nil(t, err, name)
+
+			fileHeaders := FormFiles(form)
+			assert.Equal(t, 1, len(fileHeaders), name)
+			assert.Equal(t, SampleFileName, fileHeaders[0].Filename, name)
+		}
+	})
+	t.Run("verify payload format 2.0 cookies become a Cookie header", func(t *testing.T) {
+		assert.Equal(t, "a=1; b=2", sources["APIGatewayV2Source"].Headers().Get("Cookie"))
+	})
+}
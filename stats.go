@@ -0,0 +1,106 @@
+package lambda_s3
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"sync/atomic"
+)
+
+// PrefixStats is how many objects there are under a prefix and how many bytes they add up to.
+type PrefixStats struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Stats counts the objects in bucket under prefix and adds up their sizes, e.g. to show a user how much storage
+// they're using. A single listing only returns 1,000 keys per request, one after the other, so the "folders" directly
+// under prefix are listed in parallel by WithConcurrency workers instead. Prefixes with a single folder under them
+// are descended into first, so users/42 is split up by the folders under users/42/. Folder placeholders are
+// counted like any other object.
+func Stats(region, bucket, prefix string, opts ...Option) (*PrefixStats, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	return prefixStats(o.context(), s3.New(awsSession), bucket, prefix, o.concurrency)
+}
+
+func prefixStats(ctx context.Context, s3Client s3iface.S3API, bucket, prefix string, concurrency int) (*PrefixStats, error) {
+	stats := &PrefixStats{}
+
+	var folders []string
+	for {
+		var err error
+		folders, err = listFolders(ctx, s3Client, bucket, prefix, stats)
+		if err != nil {
+			return nil, err
+		}
+
+		if stats.Objects > 0 || len(folders) != 1 {
+			break
+		}
+
+		prefix = folders[0]
+	}
+
+	errs := runConcurrently(concurrency, folders, func(folder string) error {
+		return s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(folder),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			addObjects(stats, page.Contents)
+			return true
+		})
+	})
+	if len(errs) > 0 {
+		return nil, ErrListingS3Objects
+	}
+
+	return stats, nil
+}
+
+// listFolders adds the objects directly under prefix to stats and returns the folders under it.
+func listFolders(ctx context.Context, s3Client s3iface.S3API, bucket, prefix string, stats *PrefixStats) ([]string, error) {
+	var folders []string
+
+	err := s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		addObjects(stats, page.Contents)
+
+		for _, commonPrefix := range page.CommonPrefixes {
+			folders = append(folders, aws.StringValue(commonPrefix.Prefix))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, ErrListingS3Objects
+	}
+
+	return folders, nil
+}
+
+func addObjects(stats *PrefixStats, objects []*s3.Object) {
+	var bytes int64
+	for _, object := range objects {
+		bytes += aws.Int64Value(object.Size)
+	}
+
+	atomic.AddInt64(&stats.Objects, int64(len(objects)))
+	atomic.AddInt64(&stats.Bytes, bytes)
+}
@@ -0,0 +1,90 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jgroeneveld/trial/assert"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// folderLister lists objects, whose sizes are the lengths of their keys, a page per object.
+type folderLister struct {
+	s3iface.S3API
+	keys     []string
+	mutex    sync.Mutex
+	prefixes []string
+}
+
+func (f *folderLister) ListObjectsV2PagesWithContext(_ aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	prefix := aws.StringValue(input.Prefix)
+
+	f.mutex.Lock()
+	f.prefixes = append(f.prefixes, prefix)
+	f.mutex.Unlock()
+
+	folders := map[string]bool{}
+	for i, key := range f.keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		page := &s3.ListObjectsV2Output{}
+
+		if slash := strings.Index(key[len(prefix):], aws.StringValue(input.Delimiter)); input.Delimiter != nil && slash >= 0 {
+			folder := key[:len(prefix)+slash+1]
+			if folders[folder] {
+				continue
+			}
+			folders[folder] = true
+			page.CommonPrefixes = []*s3.CommonPrefix{{Prefix: aws.String(folder)}}
+		} else {
+			page.Contents = []*s3.Object{{Key: aws.String(key), Size: aws.Int64(int64(len(key)))}}
+		}
+
+		fn(page, i == len(f.keys)-1)
+	}
+
+	return nil
+}
+
+func TestStats(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		_, err := Stats("", S3Bucket, S3ArchivePrefix)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		_, err := Stats(Region, "", S3ArchivePrefix)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify every object is counted with the folders listed separately", func(t *testing.T) {
+		lister := &folderLister{keys: []string{
+			"users/42/a.txt",
+			"users/42/docs/b.txt",
+			"users/42/docs/c/d.txt",
+			"users/42/photos/e.jpg",
+			"users/43/f.txt",
+		}}
+
+		stats, err := prefixStats(context.Background(), lister, S3Bucket, "users/42", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(4), stats.Objects)
+		assert.Equal(t, int64(14+19+21+21), stats.Bytes)
+
+		// users/42 only has users/42/ under it so that's descended into before the folders are split up
+		assert.Equal(t, 4, len(lister.prefixes))
+		assert.Equal(t, "users/42", lister.prefixes[0])
+		assert.Equal(t, "users/42/", lister.prefixes[1])
+	})
+	t.Run("verify empty prefixes have no objects", func(t *testing.T) {
+		stats, err := prefixStats(context.Background(), &folderLister{}, S3Bucket, "users/44/", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), stats.Objects)
+		assert.Equal(t, int64(0), stats.Bytes)
+	})
+}
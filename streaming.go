@@ -0,0 +1,154 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// StreamingDownloadHandler is a Lambda handler for a Function URL configured with the RESPONSE_STREAM invoke mode.
+// Lambda can only stream the response when the function is compiled with `-tags lambda.norpc` or runs on the
+// `provided` / `provided.al2` runtimes.
+type StreamingDownloadHandler func(ctx context.Context, lambdaReq events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLStreamingResponse, error)
+
+// NewStreamingDownloadHandler returns a StreamingDownloadHandler that serves objects from config.Bucket. The object
+// key is the request path without its leading slash so GET /reports/2023.csv serves the key reports/2023.csv.
+// config.Authorizer is called as it is by NewDownloadHandler, with the Function URL request converted to an API
+// Gateway request whose Identity holds the caller's IAM identity, and the key is scoped to its Authorization.
+// The S3 object body is piped directly into the HTTP response instead of being buffered in memory first which
+// means objects larger than the 6 MB Lambda response payload limit can be served. Requests with a Range header for
+// a single range of bytes are served the range with 206 Partial Content so media players can seek, and requests
+// whose If-None-Match or If-Modified-Since shows the client's copy is current get a 304 Not Modified. With
+// config.KMSKeyID set, objects uploaded WithKMSEncryption are decrypted as they're streamed and served whole, even
+// for Range requests.
+func NewStreamingDownloadHandler(config Config) StreamingDownloadHandler {
+	return func(ctx context.Context, lambdaReq events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLStreamingResponse, error) {
+		if config.Region == "" {
+			return nil, ErrParameterRegionEmpty
+		}
+
+		if err := validateBucket(config.Bucket); err != nil {
+			return nil, err
+		}
+
+		authorization, err := config.authorize(ctx, functionURLProxyRequest(lambdaReq))
+		if err != nil {
+			return &events.LambdaFunctionURLStreamingResponse{StatusCode: StatusCode(err)}, nil
+		}
+
+		name, err := url.PathUnescape(strings.TrimPrefix(lambdaReq.RawPath, "/"))
+		if err != nil || name == "" {
+			return &events.LambdaFunctionURLStreamingResponse{StatusCode: http.StatusBadRequest}, nil
+		}
+
+		name, err = authorization.scope(name)
+		if err != nil {
+			return &events.LambdaFunctionURLStreamingResponse{StatusCode: StatusCode(err)}, nil
+		}
+
+		awsSession, err := newOptions(nil).newSession(config.Region)
+		if err != nil {
+			return nil, ErrNewAWSSession
+		}
+
+		getObjectInput := &s3.GetObjectInput{
+			Bucket: aws.String(config.Bucket),
+			Key:    aws.String(name),
+		}
+
+		reqHeaders := FunctionURLSource(lambdaReq).Headers()
+
+		if rangeHeader := byteRange(reqHeaders.Get("Range")); rangeHeader != "" {
+			getObjectInput.Range = aws.String(rangeHeader)
+		}
+
+		setConditions(getObjectInput, reqHeaders)
+
+		var responseHeaders responseHeaderRecorder
+
+		getObjectOutput, err := getDecryptedObject(ctx, s3.New(awsSession), awsSession, getObjectInput, config.KMSKeyID != "", responseHeaders.record)
+		if err != nil {
+			if isNotFound(err) {
+				return &events.LambdaFunctionURLStreamingResponse{StatusCode: http.StatusNotFound}, nil
+			}
+			if isNotModified(err) {
+				return &events.LambdaFunctionURLStreamingResponse{
+					StatusCode: http.StatusNotModified,
+					Headers:    notModifiedHeaders(&responseHeaders),
+				}, nil
+			}
+			if isInvalidRange(err) {
+				return &events.LambdaFunctionURLStreamingResponse{StatusCode: http.StatusRequestedRangeNotSatisfiable}, nil
+			}
+			if errors.Is(err, ErrDecryptingFile) {
+				return nil, err
+			}
+			return nil, ErrDownloadingS3File
+		}
+
+		statusCode := http.StatusOK
+		headers := objectHeaders(getObjectOutput)
+		headers["Accept-Ranges"] = "bytes"
+
+		if getObjectOutput.ContentRange != nil {
+			statusCode = http.StatusPartialContent
+			headers["Content-Range"] = aws.StringValue(getObjectOutput.ContentRange)
+		}
+
+		if getObjectOutput.ContentType != nil {
+			headers["Content-Type"] = aws.StringValue(getObjectOutput.ContentType)
+		}
+
+		if getObjectOutput.ContentLength != nil {
+			headers["Content-Length"] = strconv.FormatInt(aws.Int64Value(getObjectOutput.ContentLength), 10)
+		}
+
+		return &events.LambdaFunctionURLStreamingResponse{
+			StatusCode: statusCode,
+			Headers:    headers,
+			Body:       getObjectOutput.Body, // closed by the Lambda runtime once the response has been streamed
+		}, nil
+	}
+}
+
+// functionURLProxyRequest converts lambdaReq into the API Gateway request Authorizers are passed. The caller's IAM
+// identity, set when the Function URL uses AWS_IAM auth, is passed in RequestContext.Identity as API Gateway does.
+func functionURLProxyRequest(lambdaReq events.LambdaFunctionURLRequest) events.APIGatewayProxyRequest {
+	proxyReq := events.APIGatewayProxyRequest{
+		Resource:              lambdaReq.RawPath,
+		Path:                  lambdaReq.RawPath,
+		HTTPMethod:            lambdaReq.RequestContext.HTTP.Method,
+		Headers:               lambdaReq.Headers,
+		QueryStringParameters: lambdaReq.QueryStringParameters,
+		Body:                  lambdaReq.Body,
+		IsBase64Encoded:       lambdaReq.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:  lambdaReq.RequestContext.AccountID,
+			RequestID:  lambdaReq.RequestContext.RequestID,
+			APIID:      lambdaReq.RequestContext.APIID,
+			DomainName: lambdaReq.RequestContext.DomainName,
+			HTTPMethod: lambdaReq.RequestContext.HTTP.Method,
+			Path:       lambdaReq.RawPath,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  lambdaReq.RequestContext.HTTP.SourceIP,
+				UserAgent: lambdaReq.RequestContext.HTTP.UserAgent,
+			},
+		},
+	}
+
+	if authorizer := lambdaReq.RequestContext.Authorizer; authorizer != nil && authorizer.IAM != nil {
+		proxyReq.RequestContext.Identity.AccountID = authorizer.IAM.AccountID
+		proxyReq.RequestContext.Identity.AccessKey = authorizer.IAM.AccessKey
+		proxyReq.RequestContext.Identity.Caller = authorizer.IAM.CallerID
+		proxyReq.RequestContext.Identity.User = authorizer.IAM.UserID
+		proxyReq.RequestContext.Identity.UserArn = authorizer.IAM.UserARN
+	}
+
+	return proxyReq
+}
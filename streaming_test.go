@@ -0,0 +1,80 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestNewStreamingDownloadHandler(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		res, err := NewStreamingDownloadHandler(Config{Bucket: S3Bucket})(context.Background(), events.LambdaFunctionURLRequest{RawPath: "/" + S3FileName})
+		assert.Equal(t, res, (*events.LambdaFunctionURLStreamingResponse)(nil))
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		res, err := NewStreamingDownloadHandler(Config{Region: Region})(context.Background(), events.LambdaFunctionURLRequest{RawPath: "/" + S3FileName})
+		assert.Equal(t, res, (*events.LambdaFunctionURLStreamingResponse)(nil))
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify bad request when path is empty", func(t *testing.T) {
+		res, err := NewStreamingDownloadHandler(Config{Region: Region, Bucket: S3Bucket})(context.Background(), events.LambdaFunctionURLRequest{RawPath: "/"})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify forbidden when the Authorizer rejects the request", func(t *testing.T) {
+		config := Config{Region: Region, Bucket: S3Bucket, Authorizer: CognitoIdentityAuthorizer(AccessLevelPrivate)}
+
+		res, err := NewStreamingDownloadHandler(config)(context.Background(), events.LambdaFunctionURLRequest{RawPath: "/" + S3FileName})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+	t.Run("verify forbidden when the key escapes the caller's prefix", func(t *testing.T) {
+		authorizer := func(_ context.Context, lambdaReq events.APIGatewayProxyRequest) (*Authorization, error) {
+			return &Authorization{UserID: lambdaReq.RequestContext.Identity.User, KeyPrefix: lambdaReq.RequestContext.Identity.User}, nil
+		}
+		config := Config{Region: Region, Bucket: S3Bucket, Authorizer: authorizer}
+
+		lambdaReq := events.LambdaFunctionURLRequest{RawPath: "/../user-2/" + S3FileName}
+		lambdaReq.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+			IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserID: "user-1"},
+		}
+
+		res, err := NewStreamingDownloadHandler(config)(context.Background(), lambdaReq)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+	t.Run("verify not found when key does not exist", func(t *testing.T) {
+		res, err := NewStreamingDownloadHandler(Config{Region: Region, Bucket: S3Bucket})(context.Background(), events.LambdaFunctionURLRequest{RawPath: "/does_not_exist"})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+	t.Run("verify NewStreamingDownloadHandler works with correct inputs", func(t *testing.T) {
+		res, err := NewStreamingDownloadHandler(Config{Region: Region, Bucket: S3Bucket})(context.Background(), events.LambdaFunctionURLRequest{RawPath: "/" + S3FileName})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		fileBytes, err := io.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+		assert.Nil(t, res.Close())
+	})
+	t.Run("verify a suffix byte range is streamed as partial content", func(t *testing.T) {
+		res, err := NewStreamingDownloadHandler(Config{Region: Region, Bucket: S3Bucket})(context.Background(), events.LambdaFunctionURLRequest{
+			RawPath: "/" + S3FileName,
+			Headers: map[string]string{"range": "bytes=-10"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+		assert.Equal(t, "bytes", res.Headers["Accept-Ranges"])
+
+		fileBytes, err := io.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(fileBytes))
+		assert.Nil(t, res.Close())
+	})
+}
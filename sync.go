@@ -0,0 +1,425 @@
+package lambda_s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrKeyEscapesLocalDir     = errors.New("the object's key would place it outside the local directory")
+	ErrListingS3Objects       = errors.New("unable to list the objects under the given prefix")
+	ErrParameterLocalDirEmpty = errors.New("required parameter localDir is empty")
+	ErrReadingLocalDir        = errors.New("unable to read the given local directory")
+	ErrSyncIncomplete         = errors.New("one or more files failed to sync. check SyncRes.Failed for details")
+	ErrWritingLocalFile       = errors.New("unable to write the downloaded file to the local directory")
+)
+
+// SyncRes reports what SyncUpload and SyncDownload did with each file, identified by its path relative to the
+// local directory which is also its S3 key relative to the prefix.
+type SyncRes struct {
+	Transferred []string
+	Unchanged   []string
+	Failed      map[string]error
+}
+
+// syncObject is what we know about a file on either side of a sync.
+type syncObject struct {
+	size         int64
+	eTag         string
+	lastModified time.Time
+}
+
+// SyncUpload uploads every file under localDir to bucket under prefix, like `aws s3 sync localDir s3://bucket/prefix`.
+// Files are skipped when an object of the same size and content already exists. Content is compared using the
+// object's ETag which is the MD5 of the object for single part uploads. Objects uploaded in multiple parts have a
+// different kind of ETag so they're compared by modification time instead. Objects that don't exist locally are
+// left alone. Up to WithConcurrency files are uploaded at once. The listing and the uploads are made WithContext and
+// stopped with ErrDeadlineTooClose WithDeadlineMargin, as UploadHeader is.
+func SyncUpload(region, localDir, bucket, prefix string, opts ...Option) (*SyncRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if localDir == "" {
+		return nil, ErrParameterLocalDirEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	localFiles, err := listLocalDir(localDir)
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	ctx, cancel, err := o.transferContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	remoteObjects, err := listPrefix(ctx, s3.New(awsSession), bucket, prefix)
+	if err != nil {
+		if o.deadlineExceeded(ctx) {
+			return nil, ErrDeadlineTooClose
+		}
+		return nil, err
+	}
+
+	uploader := s3manager.NewUploader(awsSession)
+
+	return runSync(o.concurrency, localFiles, remoteObjects, func(relPath string) error {
+		localPath, err := syncLocalPath(localDir, relPath)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(localPath)
+		if err != nil {
+			return ErrReadingLocalDir
+		}
+		defer file.Close()
+
+		name := syncPrefix(prefix) + relPath
+		_, err = upload(uploader, bucket, name, file, mime.TypeByExtension(path.Ext(name)), localFiles[relPath].size, o)
+
+		return err
+	})
+}
+
+// SyncDownload downloads every object in bucket under prefix into localDir, like
+// `aws s3 sync s3://bucket/prefix localDir`, creating directories as needed. Objects are skipped when a local file
+// of the same size and content already exists, compared the same way as SyncUpload. Local files that don't exist
+// in S3 are left alone. Up to WithConcurrency objects are downloaded at once, each streamed straight to disk.
+// Objects whose keys would place them outside localDir, such as prefix/../../etc/passwd, aren't downloaded and fail
+// with ErrKeyEscapesLocalDir.
+// Objects uploaded WithKMSEncryption are decrypted when it's passed too. Their size in S3 is that of the ciphertext so it never matches
+// the decrypted file and they're downloaded again by every sync. The listing and the downloads are made WithContext
+// and stopped with ErrDeadlineTooClose WithDeadlineMargin, as Download is.
+func SyncDownload(region, bucket, prefix, localDir string, opts ...Option) (*SyncRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+
+	if localDir == "" {
+		return nil, ErrParameterLocalDirEmpty
+	}
+
+	if err := os.MkdirAll(localDir, 0700); err != nil {
+		return nil, ErrWritingLocalFile
+	}
+
+	localFiles, err := listLocalDir(localDir)
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	ctx, cancel, err := o.transferContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	remoteObjects, err := listPrefix(ctx, s3.New(awsSession), bucket, prefix)
+	if err != nil {
+		if o.deadlineExceeded(ctx) {
+			return nil, ErrDeadlineTooClose
+		}
+		return nil, err
+	}
+
+	downloader := s3manager.NewDownloader(awsSession)
+
+	return runSync(o.concurrency, remoteObjects, localFiles, func(relPath string) error {
+		localPath, err := syncLocalPath(localDir, relPath)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
+			return ErrWritingLocalFile
+		}
+
+		file, err := os.Create(localPath)
+		if err != nil {
+			return ErrWritingLocalFile
+		}
+		defer file.Close()
+
+		if err = o.transfers.acquire(ctx); err != nil {
+			if o.deadlineExceeded(ctx) {
+				return ErrDeadlineTooClose
+			}
+			return ErrDownloadingS3File
+		}
+		defer o.transfers.release()
+
+		size := remoteObjects[relPath].size
+		if o.parallelDownload {
+			if err = file.Truncate(size); err != nil {
+				return ErrWritingLocalFile
+			}
+		}
+
+		var responseHeaders responseHeaderRecorder
+
+		_, err = downloader.DownloadWithContext(ctx, file, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(syncPrefix(prefix) + relPath),
+		}, o.configureDownloader(size), s3manager.WithDownloaderRequestOptions(responseHeaders.record))
+		if err != nil {
+			if o.deadlineExceeded(ctx) {
+				return ErrDeadlineTooClose
+			}
+			return ErrDownloadingS3File
+		}
+
+		if headers := responseHeaders.all(); o.kmsKeyID != "" && isEncrypted(headers) {
+			return decryptLocalFile(ctx, awsSession, file, localPath, headers, o)
+		}
+
+		return nil
+	})
+}
+
+// decryptLocalFile replaces the ciphertext downloaded into file at localPath with its plaintext. The plaintext is
+// written to a temporary file beside it which is renamed over it, and file is removed if it can't be decrypted so
+// the ciphertext isn't taken for an up to date copy of the object by the next sync.
+func decryptLocalFile(ctx aws.Context, awsSession *session.Session, file *os.File, localPath string, headers http.Header, o *options) error {
+	err := writeDecryptedFile(ctx, awsSession, file, localPath, headers, o)
+	if err != nil {
+		_ = os.Remove(localPath)
+	}
+
+	return err
+}
+
+func writeDecryptedFile(ctx aws.Context, awsSession *session.Session, file *os.File, localPath string, headers http.Header, o *options) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return ErrWritingLocalFile
+	}
+
+	decryptedBody, err := decryptReader(ctx, awsSession, file, headers)
+	if err != nil {
+		return err
+	}
+
+	decryptedFile, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+"-")
+	if err != nil {
+		return ErrWritingLocalFile
+	}
+	defer os.Remove(decryptedFile.Name())
+
+	_, err = copyBuffer(decryptedFile, decryptedBody, o.bufferSize)
+	if closeErr := decryptedFile.Close(); err == nil && closeErr != nil {
+		err = ErrWritingLocalFile
+	}
+	if err != nil {
+		if errors.Is(err, ErrDecryptingFile) {
+			return err
+		}
+		return ErrWritingLocalFile
+	}
+
+	if err = os.Rename(decryptedFile.Name(), localPath); err != nil {
+		return ErrWritingLocalFile
+	}
+
+	return nil
+}
+
+// syncLocalPath is the path of the file at relPath under localDir. Object keys are chosen by whoever uploaded them so
+// keys that are absolute or contain .. segments, and could otherwise be used to write anywhere on the file system,
+// are rejected with ErrKeyEscapesLocalDir, as is anything else that wouldn't end up under localDir.
+func syncLocalPath(localDir, relPath string) (string, error) {
+	if path.IsAbs(relPath) || filepath.IsAbs(filepath.FromSlash(relPath)) || containsString(strings.Split(relPath, "/"), "..") {
+		return "", fmt.Errorf("%w: %s", ErrKeyEscapesLocalDir, relPath)
+	}
+
+	localPath := filepath.Clean(filepath.Join(localDir, filepath.FromSlash(relPath)))
+
+	inLocalDir, err := filepath.Rel(filepath.Clean(localDir), localPath)
+	if err != nil || inLocalDir == "." || inLocalDir == ".." || strings.HasPrefix(inLocalDir, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrKeyEscapesLocalDir, relPath)
+	}
+
+	return localPath, nil
+}
+
+// runSync transfers every file in source that differs from its counterpart in destination with transfer.
+func runSync(concurrency int, source, destination map[string]syncObject, transfer func(relPath string) error) (*SyncRes, error) {
+	syncRes := &SyncRes{}
+
+	var changed []string
+	for relPath, sourceObject := range source {
+		if destinationObject, ok := destination[relPath]; ok && !isChanged(sourceObject, destinationObject) {
+			syncRes.Unchanged = append(syncRes.Unchanged, relPath)
+		} else {
+			changed = append(changed, relPath)
+		}
+	}
+
+	syncRes.Failed = runConcurrently(concurrency, changed, transfer)
+
+	for _, relPath := range changed {
+		if _, failed := syncRes.Failed[relPath]; !failed {
+			syncRes.Transferred = append(syncRes.Transferred, relPath)
+		}
+	}
+
+	sort.Strings(syncRes.Transferred)
+	sort.Strings(syncRes.Unchanged)
+
+	if len(syncRes.Failed) > 0 {
+		return syncRes, ErrSyncIncomplete
+	}
+
+	return syncRes, nil
+}
+
+func isChanged(a, b syncObject) bool {
+	if a.size != b.size {
+		return true
+	}
+
+	// one side is always local and has no ETag. multipart ETags aren't an MD5 and contain a dash
+	if a.eTag != "" && b.eTag != "" && !strings.Contains(a.eTag+b.eTag, "-") {
+		return a.eTag != b.eTag
+	}
+
+	return a.lastModified.After(b.lastModified)
+}
+
+// listLocalDir returns every regular file under localDir keyed by its slash separated path relative to localDir.
+func listLocalDir(localDir string) (map[string]syncObject, error) {
+	localFiles := map[string]syncObject{}
+
+	err := filepath.WalkDir(localDir, func(localPath string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !dirEntry.Type().IsRegular() {
+			return nil
+		}
+
+		fileInfo, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+
+		eTag, err := md5File(localPath)
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return err
+		}
+
+		localFiles[filepath.ToSlash(relPath)] = syncObject{
+			size:         fileInfo.Size(),
+			eTag:         eTag,
+			lastModified: fileInfo.ModTime(),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, ErrReadingLocalDir
+	}
+
+	return localFiles, nil
+}
+
+func md5File(localPath string) (string, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err = copyBuffer(hash, file, DefaultBufferSize); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// syncPrefix is prefix as a directory, the prefix objects are listed under and relative keys are appended to. Keys
+// are built by appending rather than with path.Join, which would clean keys such as a//b.csv into different ones.
+func syncPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return prefix + "/"
+	}
+
+	return prefix
+}
+
+// listPrefix returns every object under prefix keyed by its key relative to prefix.
+func listPrefix(ctx aws.Context, s3Client *s3.S3, bucket, prefix string) (map[string]syncObject, error) {
+	remoteObjects := map[string]syncObject{}
+
+	listPrefix := syncPrefix(prefix)
+
+	err := s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(listPrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			relPath := strings.TrimPrefix(aws.StringValue(object.Key), listPrefix)
+			if relPath == "" || strings.HasSuffix(relPath, "/") { // folder placeholders
+				continue
+			}
+
+			remoteObjects[relPath] = syncObject{
+				size:         aws.Int64Value(object.Size),
+				eTag:         strings.Trim(aws.StringValue(object.ETag), `"`),
+				lastModified: aws.TimeValue(object.LastModified),
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, ErrListingS3Objects
+	}
+
+	return remoteObjects, nil
+}
@@ -0,0 +1,177 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jgroeneveld/trial/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncUpload(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		syncRes, err := SyncUpload("", t.TempDir(), S3Bucket, S3SyncPrefix)
+		assert.Equal(t, syncRes, (*SyncRes)(nil))
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when localDir is empty", func(t *testing.T) {
+		syncRes, err := SyncUpload(Region, "", S3Bucket, S3SyncPrefix)
+		assert.Equal(t, syncRes, (*SyncRes)(nil))
+		assert.True(t, errors.Is(err, ErrParameterLocalDirEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		syncRes, err := SyncUpload(Region, t.TempDir(), "", S3SyncPrefix)
+		assert.Equal(t, syncRes, (*SyncRes)(nil))
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify err when localDir does not exist", func(t *testing.T) {
+		syncRes, err := SyncUpload(Region, filepath.Join(t.TempDir(), "nope"), S3Bucket, S3SyncPrefix)
+		assert.Equal(t, syncRes, (*SyncRes)(nil))
+		assert.True(t, errors.Is(err, ErrReadingLocalDir))
+	})
+	t.Run("verify SyncUpload and SyncDownload only transfer changed files", func(t *testing.T) {
+		uploadDir := generateSyncDir(t)
+
+		_, err := SyncUpload(Region, uploadDir, S3Bucket, S3SyncPrefix)
+		assert.Nil(t, err)
+
+		syncRes, err := SyncUpload(Region, uploadDir, S3Bucket, S3SyncPrefix)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(syncRes.Transferred))
+		assert.DeepEqual(t, []string{"nested/" + SampleFileName, SampleFileName}, syncRes.Unchanged)
+
+		downloadDir := t.TempDir()
+
+		syncRes, err = SyncDownload(Region, S3Bucket, S3SyncPrefix, downloadDir)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, []string{"nested/" + SampleFileName, SampleFileName}, syncRes.Transferred)
+
+		fileBytes, err := os.ReadFile(filepath.Join(downloadDir, "nested", SampleFileName))
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+	})
+}
+
+func TestSyncDownload(t *testing.T) {
+	t.Run("verify err when region is empty", func(t *testing.T) {
+		syncRes, err := SyncDownload("", S3Bucket, S3SyncPrefix, t.TempDir())
+		assert.Equal(t, syncRes, (*SyncRes)(nil))
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+	})
+	t.Run("verify err when bucket is empty", func(t *testing.T) {
+		syncRes, err := SyncDownload(Region, "", S3SyncPrefix, t.TempDir())
+		assert.Equal(t, syncRes, (*SyncRes)(nil))
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+	})
+	t.Run("verify err when localDir is empty", func(t *testing.T) {
+		syncRes, err := SyncDownload(Region, S3Bucket, S3SyncPrefix, "")
+		assert.Equal(t, syncRes, (*SyncRes)(nil))
+		assert.True(t, errors.Is(err, ErrParameterLocalDirEmpty))
+	})
+	t.Run("verify keys that would escape localDir fail instead of being written", func(t *testing.T) {
+		localDir := filepath.Join(t.TempDir(), "sync")
+
+		for _, relPath := range []string{"../../etc/cron.d/x", "nested/../../x", "..", "/etc/passwd"} {
+			_, err := syncLocalPath(localDir, relPath)
+			assert.True(t, errors.Is(err, ErrKeyEscapesLocalDir), relPath)
+		}
+
+		localPath, err := syncLocalPath(localDir, "nested/v1..v2.csv")
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(localDir, "nested", "v1..v2.csv"), localPath)
+
+		remoteObjects := map[string]syncObject{"../escaped": {size: 1}, "kept": {size: 1}}
+
+		syncRes, err := runSync(2, remoteObjects, nil, func(relPath string) error {
+			localPath, err := syncLocalPath(localDir, relPath)
+			if err != nil {
+				return err
+			}
+			assert.Nil(t, os.MkdirAll(localDir, 0700))
+			return os.WriteFile(localPath, []byte("x"), 0600)
+		})
+		assert.True(t, errors.Is(err, ErrSyncIncomplete))
+		assert.DeepEqual(t, []string{"kept"}, syncRes.Transferred)
+		assert.True(t, errors.Is(syncRes.Failed["../escaped"], ErrKeyEscapesLocalDir))
+
+		_, err = os.Stat(filepath.Join(localDir, "..", "escaped"))
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("verify err when the deadline is too close to sync", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+
+		syncRes, err := SyncDownload(Region, S3Bucket, S3SyncPrefix, t.TempDir(), WithContext(ctx))
+		assert.Equal(t, syncRes, (*SyncRes)(nil))
+		assert.True(t, errors.Is(err, ErrDeadlineTooClose))
+	})
+	t.Run("verify the prefix is listed with the caller's context", func(t *testing.T) {
+		var requests int
+		awsSession := newHandlerSession(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := listPrefix(ctx, s3.New(awsSession), S3Bucket, S3SyncPrefix)
+		assert.True(t, errors.Is(err, ErrListingS3Objects))
+		assert.Equal(t, 0, requests)
+	})
+	t.Run("verify relative keys are appended to the prefix as a directory", func(t *testing.T) {
+		assert.Equal(t, "", syncPrefix(""))
+		assert.Equal(t, "sync/", syncPrefix("sync"))
+		assert.Equal(t, "sync/", syncPrefix("sync/"))
+	})
+}
+
+func TestRunSync(t *testing.T) {
+	now := time.Now()
+
+	source := map[string]syncObject{
+		"same":       {size: 1, eTag: "a"},
+		"resized":    {size: 2, eTag: "a"},
+		"edited":     {size: 1, eTag: "b"},
+		"multipart":  {size: 1, eTag: "c", lastModified: now},
+		"new":        {size: 1, eTag: "a"},
+		"broken":     {size: 1, eTag: "a"},
+		"older-part": {size: 1, eTag: "c", lastModified: now.Add(-time.Hour)},
+	}
+
+	destination := map[string]syncObject{
+		"same":       {size: 1, eTag: "a"},
+		"resized":    {size: 1, eTag: "a"},
+		"edited":     {size: 1, eTag: "a"},
+		"multipart":  {size: 1, eTag: "abc-2", lastModified: now.Add(-time.Hour)},
+		"older-part": {size: 1, eTag: "abc-2", lastModified: now},
+	}
+
+	syncRes, err := runSync(2, source, destination, func(relPath string) error {
+		if relPath == "broken" {
+			return ErrUploadingMultiPartFileToS3
+		}
+		return nil
+	})
+	assert.True(t, errors.Is(err, ErrSyncIncomplete))
+	assert.DeepEqual(t, []string{"edited", "multipart", "new", "resized"}, syncRes.Transferred)
+	assert.DeepEqual(t, []string{"older-part", "same"}, syncRes.Unchanged)
+	assert.Equal(t, 1, len(syncRes.Failed))
+	assert.True(t, errors.Is(syncRes.Failed["broken"], ErrUploadingMultiPartFileToS3))
+}
+
+// generateSyncDir returns a temporary directory containing the sample file at its root and in a nested directory.
+func generateSyncDir(t *testing.T) string {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "nested"), 0700))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, SampleFileName), fileBytes, 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "nested", SampleFileName), fileBytes, 0600))
+
+	return dir
+}
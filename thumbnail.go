@@ -0,0 +1,228 @@
+package lambda_s3
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+)
+
+// MaxThumbnailSourcePixels is the largest image, in pixels, thumbnails are made of. Decoding an image takes four
+// bytes per pixel so this keeps a small file claiming to be a huge image from exhausting the Lambda's memory.
+const MaxThumbnailSourcePixels = 50_000_000
+
+// thumbnailJPEGQuality is the quality JPEG thumbnails are encoded with.
+const thumbnailJPEGQuality = 85
+
+var ErrGeneratingThumbnail = errors.New("unable to generate a thumbnail of the image")
+
+// Thumbnail is a resized variant of uploaded images. It's scaled down, keeping its aspect ratio, to fit within
+// MaxWidth by MaxHeight and stored next to the image with Suffix added to its name before the extension, e.g. the
+// Suffix "_thumb" stores photos/cat.jpg's thumbnail as photos/cat_thumb.jpg. Images that already fit are stored as
+// they are. A MaxWidth or MaxHeight of 0 doesn't limit that dimension.
+type Thumbnail struct {
+	Suffix    string
+	MaxWidth  int
+	MaxHeight int
+}
+
+// key is the key of the thumbnail of the image stored as name.
+func (t Thumbnail) key(name string) string {
+	extension := path.Ext(name)
+	return strings.TrimSuffix(name, extension) + t.Suffix + extension
+}
+
+// size is the size of the thumbnail of an image of width by height.
+func (t Thumbnail) size(width, height int) (int, int) {
+	scale := 1.0
+
+	if t.MaxWidth > 0 && width > t.MaxWidth {
+		scale = float64(t.MaxWidth) / float64(width)
+	}
+
+	if t.MaxHeight > 0 && float64(height)*scale > float64(t.MaxHeight) {
+		scale = float64(t.MaxHeight) / float64(height)
+	}
+
+	return maxInt(1, int(float64(width)*scale+0.5)), maxInt(1, int(float64(height)*scale+0.5))
+}
+
+// uploadThumbnails uploads the thumbnails o asks for of the image in file, which was uploaded as name. Files that
+// aren't JPEG, PNG, or GIF images get no thumbnails. Thumbnails are always encoded in the image's own format.
+func uploadThumbnails(uploader *s3manager.Uploader, file io.ReadSeeker, bucket, name string, o *options) ([]*UploadRes, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrGeneratingThumbnail, err)
+	}
+
+	bufferedFile := bufio.NewReader(file)
+
+	header, _ := bufferedFile.Peek(64 << 10) // enough for the EXIF segment of almost every JPEG
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(header))
+	if err != nil {
+		return nil, nil // not an image this package can decode
+	}
+
+	if config.Width*config.Height > MaxThumbnailSourcePixels {
+		return nil, fmt.Errorf("%w: the image is larger than %d pixels", ErrGeneratingThumbnail, MaxThumbnailSourcePixels)
+	}
+
+	img, _, err := image.Decode(bufferedFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrGeneratingThumbnail, err)
+	}
+
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(header))
+	}
+
+	thumbnailOptions := *o
+	thumbnailOptions.thumbnails = nil
+
+	var thumbnailResults []*UploadRes
+
+	for _, thumbnail := range o.thumbnails {
+		width, height := thumbnail.size(img.Bounds().Dx(), img.Bounds().Dy())
+
+		var encoded bytes.Buffer
+		if err = encodeImage(&encoded, resize(img, width, height), format); err != nil {
+			return thumbnailResults, fmt.Errorf("%w: %s", ErrGeneratingThumbnail, err)
+		}
+
+		thumbnailRes, err := upload(uploader, bucket, thumbnail.key(name), bytes.NewReader(encoded.Bytes()), "image/"+format, int64(encoded.Len()), &thumbnailOptions)
+		if err != nil {
+			return thumbnailResults, err
+		}
+
+		thumbnailResults = append(thumbnailResults, thumbnailRes)
+	}
+
+	return thumbnailResults, nil
+}
+
+func encodeImage(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: thumbnailJPEGQuality})
+	case "png":
+		return png.Encode(w, img)
+	default:
+		return gif.Encode(w, img, nil)
+	}
+}
+
+// resize scales img to width by height by averaging the pixels each pixel of the result covers, which is what
+// keeps downscaled images from looking jagged.
+func resize(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return img
+	}
+
+	resized := image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		top := bounds.Min.Y + y*bounds.Dy()/height
+		bottom := maxInt(top+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+
+		for x := 0; x < width; x++ {
+			left := bounds.Min.X + x*bounds.Dx()/width
+			right := maxInt(left+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, count uint64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, count = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), count+1
+				}
+			}
+
+			resized.SetRGBA64(x, y, color.RGBA64{R: uint16(r / count), G: uint16(g / count), B: uint16(b / count), A: uint16(a / count)})
+		}
+	}
+
+	return resized
+}
+
+// jpegOrientation returns the EXIF orientation of the JPEG starting with header, or 0 when it has none.
+func jpegOrientation(header []byte) uint16 {
+	offset := 2 // after the SOI marker
+
+	for offset+4 <= len(header) && header[offset] == 0xff {
+		marker := header[offset+1]
+		length := int(header[offset+2])<<8 | int(header[offset+3])
+
+		if marker == jpegSOS || offset+2+length > len(header) {
+			return 0
+		}
+
+		payload := header[offset+4 : offset+2+length]
+		if marker == jpegAPP1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return exifOrientation(payload[6:])
+		}
+
+		offset += 2 + length
+	}
+
+	return 0
+}
+
+// orient rotates and flips img so it's upright given its EXIF orientation. Orientations 5 to 8 swap the width and
+// height.
+func orient(img image.Image, orientation uint16) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	orientedWidth, orientedHeight := width, height
+	if orientation >= 5 {
+		orientedWidth, orientedHeight = height, width
+	}
+
+	oriented := image.NewRGBA64(image.Rect(0, 0, orientedWidth, orientedHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var ox, oy int
+			switch orientation {
+			case 2: // flipped horizontally
+				ox, oy = width-1-x, y
+			case 3: // rotated 180°
+				ox, oy = width-1-x, height-1-y
+			case 4: // flipped vertically
+				ox, oy = x, height-1-y
+			case 5: // transposed
+				ox, oy = y, x
+			case 6: // rotated 90° clockwise to be upright
+				ox, oy = height-1-y, x
+			case 7: // transversed
+				ox, oy = height-1-y, width-1-x
+			case 8: // rotated 90° counterclockwise to be upright
+				ox, oy = y, width-1-x
+			}
+
+			oriented.Set(ox, oy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return oriented
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
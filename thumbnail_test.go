@@ -0,0 +1,109 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	t.Run("verify the suffix goes before the extension", func(t *testing.T) {
+		thumbnail := Thumbnail{Suffix: "_thumb"}
+		assert.Equal(t, "photos/cat_thumb.jpg", thumbnail.key("photos/cat.jpg"))
+		assert.Equal(t, "photos.v2/cat_thumb", thumbnail.key("photos.v2/cat"))
+	})
+	t.Run("verify thumbnails keep the aspect ratio of the image", func(t *testing.T) {
+		width, height := Thumbnail{MaxWidth: 200, MaxHeight: 200}.size(1600, 1200)
+		assert.Equal(t, 200, width)
+		assert.Equal(t, 150, height)
+
+		width, height = Thumbnail{MaxWidth: 200, MaxHeight: 100}.size(1600, 1200)
+		assert.Equal(t, 133, width)
+		assert.Equal(t, 100, height)
+
+		width, height = Thumbnail{MaxHeight: 100}.size(1600, 1200)
+		assert.Equal(t, 133, width)
+		assert.Equal(t, 100, height)
+	})
+	t.Run("verify images that already fit aren't enlarged", func(t *testing.T) {
+		width, height := Thumbnail{MaxWidth: 200, MaxHeight: 200}.size(120, 80)
+		assert.Equal(t, 120, width)
+		assert.Equal(t, 80, height)
+	})
+}
+
+func TestResize(t *testing.T) {
+	t.Run("verify each pixel is the average of the pixels it covers", func(t *testing.T) {
+		img := image.NewGray(image.Rect(0, 0, 4, 2))
+		copy(img.Pix, []byte{0, 100, 200, 200, 100, 200, 200, 200})
+
+		resized := resize(img, 2, 1)
+		assert.Equal(t, image.Rect(0, 0, 2, 1), resized.Bounds())
+		assert.Equal(t, uint8(100), color.GrayModel.Convert(resized.At(0, 0)).(color.Gray).Y)
+		assert.Equal(t, uint8(200), color.GrayModel.Convert(resized.At(1, 0)).(color.Gray).Y)
+	})
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	img.Pix[0] = 255 // the top left pixel
+
+	t.Run("verify orientation 6 is rotated clockwise", func(t *testing.T) {
+		oriented := orient(img, 6)
+		assert.Equal(t, image.Rect(0, 0, 2, 3), oriented.Bounds())
+		assert.Equal(t, uint8(255), color.GrayModel.Convert(oriented.At(1, 0)).(color.Gray).Y)
+	})
+	t.Run("verify orientation 3 is rotated 180 degrees", func(t *testing.T) {
+		oriented := orient(img, 3)
+		assert.Equal(t, image.Rect(0, 0, 3, 2), oriented.Bounds())
+		assert.Equal(t, uint8(255), color.GrayModel.Convert(oriented.At(2, 1)).(color.Gray).Y)
+	})
+	t.Run("verify upright images are unchanged", func(t *testing.T) {
+		assert.True(t, orient(img, 1) == image.Image(img))
+		assert.True(t, orient(img, 0) == image.Image(img))
+	})
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	var jpegBytes bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&jpegBytes, testImage(), nil))
+
+	t.Run("verify the orientation is read from the EXIF segment", func(t *testing.T) {
+		withExif := append([]byte{0xff, 0xd8}, exifSegment(6)...)
+		withExif = append(withExif, jpegBytes.Bytes()[2:]...)
+		assert.Equal(t, uint16(6), jpegOrientation(withExif))
+	})
+	t.Run("verify JPEGs without EXIF have no orientation", func(t *testing.T) {
+		assert.Equal(t, uint16(0), jpegOrientation(jpegBytes.Bytes()))
+	})
+}
+
+func TestUploadThumbnails(t *testing.T) {
+	o := newOptions([]Option{WithThumbnails(Thumbnail{Suffix: "_thumb", MaxWidth: 100})})
+
+	t.Run("verify files that aren't images get no thumbnails", func(t *testing.T) {
+		variants, err := uploadThumbnails(nil, bytes.NewReader([]byte("contents")), S3Bucket, SampleFileName, o)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(variants))
+	})
+	t.Run("verify images with too many pixels are rejected before being decoded", func(t *testing.T) {
+		var pngBytes bytes.Buffer
+		assert.Nil(t, png.Encode(&pngBytes, testImage()))
+
+		// claim the 4x4 image is 10000x10000 and fix the IHDR chunk's CRC so it still parses
+		ihdr := pngBytes.Bytes()[12:29]
+		copy(ihdr[4:], []byte{0, 0, 0x27, 0x10, 0, 0, 0x27, 0x10})
+		crc := crc32.ChecksumIEEE(ihdr)
+		copy(pngBytes.Bytes()[29:], []byte{byte(crc >> 24), byte(crc >> 16), byte(crc >> 8), byte(crc)})
+
+		variants, err := uploadThumbnails(nil, bytes.NewReader(pngBytes.Bytes()), S3Bucket, "huge.png", o)
+		assert.True(t, errors.Is(err, ErrGeneratingThumbnail))
+		assert.Equal(t, 0, len(variants))
+	})
+}
@@ -0,0 +1,86 @@
+package lambda_s3
+
+import (
+	"context"
+	"time"
+)
+
+// TracerName is the instrumentation name this package asks TracerProviders for its Tracer with.
+const TracerName = "github.com/seantcanavan/lambda_s3"
+
+// TracerProvider, Tracer, and Span are the parts of the OpenTelemetry tracing API this package uses. They're
+// declared here so this package doesn't depend on OpenTelemetry. An adapter around an OpenTelemetry
+// trace.TracerProvider only has to convert Attributes to attribute.KeyValues, e.g.
+//
+//	func (s otelSpan) SetAttributes(attributes ...lambda_s3.Attribute) {
+//		for _, a := range attributes {
+//			s.Span.SetAttributes(attribute.String(a.Key, fmt.Sprint(a.Value)))
+//		}
+//	}
+type TracerProvider interface {
+	Tracer(instrumentationName string) Tracer
+}
+
+// Tracer starts Spans. The returned context carries the Span so the S3 requests made within it, and any Spans
+// started from it, are part of the same trace.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span is a single operation within a trace.
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key value pair describing a Span. Values are strings or int64s.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// The attributes set on every Span. The bucket and key attributes follow the OpenTelemetry semantic conventions.
+const (
+	AttributeBucket = "aws.s3.bucket"
+	AttributeBytes  = "lambda_s3.bytes"
+	AttributeKey    = "aws.s3.key"
+)
+
+// instrument starts a Span for operation on the object called name in bucket when tracing WithTracerProvider. It
+// returns the options the operation should make its S3 requests with, whose context carries the Span, and the
+// function to call once the operation is done which ends the Span and records the operation's metrics.
+func (o *options) instrument(operation, bucket, name string) (*options, func(bytes int64, err error)) {
+	start := time.Now()
+
+	spanOptions := o
+	var span Span
+
+	if o.tracerProvider != nil {
+		var ctx context.Context
+		ctx, span = o.tracerProvider.Tracer(TracerName).Start(o.context(), "lambda_s3."+operation)
+		span.SetAttributes(Attribute{Key: AttributeBucket, Value: bucket}, Attribute{Key: AttributeKey, Value: name})
+
+		spanOptions = o.withContext(ctx)
+	}
+
+	return spanOptions, func(bytes int64, err error) {
+		o.recordMetric(operation, bucket, start, bytes, err)
+
+		if span != nil {
+			span.SetAttributes(Attribute{Key: AttributeBytes, Value: bytes})
+			if err != nil {
+				span.RecordError(err)
+			}
+			span.End()
+		}
+	}
+}
+
+// withContext is a copy of o that makes S3 requests with ctx.
+func (o *options) withContext(ctx context.Context) *options {
+	copied := *o
+	copied.ctx = ctx
+
+	return &copied
+}
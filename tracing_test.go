@@ -0,0 +1,84 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"testing"
+)
+
+type spanCtxKey struct{}
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (r *recordingTracer) Tracer(string) Tracer {
+	return r
+}
+
+func (r *recordingTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	span := &recordingSpan{name: spanName, attributes: map[string]interface{}{}}
+	r.spans = append(r.spans, span)
+
+	return context.WithValue(ctx, spanCtxKey{}, span), span
+}
+
+type recordingSpan struct {
+	name       string
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (r *recordingSpan) SetAttributes(attributes ...Attribute) {
+	for _, attribute := range attributes {
+		r.attributes[attribute.Key] = attribute.Value
+	}
+}
+
+func (r *recordingSpan) RecordError(err error) {
+	r.err = err
+}
+
+func (r *recordingSpan) End() {
+	r.ended = true
+}
+
+func TestWithTracerProvider(t *testing.T) {
+	t.Run("verify operations are traced with their bucket, key, and error", func(t *testing.T) {
+		tracer := &recordingTracer{}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := Download(Region, S3Bucket, S3FileName, WithTracerProvider(tracer), WithContext(ctx))
+		assert.NotNil(t, err)
+
+		assert.Equal(t, 1, len(tracer.spans))
+		span := tracer.spans[0]
+		assert.Equal(t, "lambda_s3.download", span.name)
+		assert.Equal(t, S3Bucket, span.attributes[AttributeBucket])
+		assert.Equal(t, S3FileName, span.attributes[AttributeKey])
+		assert.Equal(t, int64(0), span.attributes[AttributeBytes])
+		assert.True(t, span.err == err)
+		assert.True(t, span.ended)
+	})
+	t.Run("verify S3 requests are made with the span's context", func(t *testing.T) {
+		tracer := &recordingTracer{}
+
+		spanOptions, done := newOptions([]Option{WithTracerProvider(tracer)}).instrument(OperationUpload, S3Bucket, S3FileName)
+		assert.True(t, spanOptions.context().Value(spanCtxKey{}) == tracer.spans[0])
+
+		done(10, errors.New("failed"))
+		assert.Equal(t, int64(10), tracer.spans[0].attributes[AttributeBytes])
+		assert.True(t, tracer.spans[0].ended)
+	})
+	t.Run("verify nothing is traced without a TracerProvider", func(t *testing.T) {
+		o := newOptions(nil)
+
+		spanOptions, done := o.instrument(OperationUpload, S3Bucket, S3FileName)
+		assert.True(t, spanOptions == o)
+		done(0, nil)
+	})
+}
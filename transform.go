@@ -0,0 +1,184 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
+	"mime"
+	"path"
+)
+
+var (
+	ErrParameterTransformFunc = errors.New("required parameter fn is nil")
+	ErrTransformingFile       = errors.New("a Transformer failed to transform the file")
+)
+
+// errUploadStopped is what Transform's fn gets when it writes after the upload stopped reading.
+var errUploadStopped = errors.New("the upload stopped reading")
+
+// Transformer transforms the contents of a file while it's streamed to or from S3. Transform wraps r and returns a
+// reader of the transformed contents, reading from r only as the returned reader is read, so transforms such as
+// hashing, compression, encryption, or metadata stripping never need to buffer the whole file. If the returned
+// reader implements io.Closer it's closed once the transfer is done.
+type Transformer interface {
+	Transform(r io.Reader) (io.Reader, error)
+}
+
+// TransformerFunc adapts a function to a Transformer.
+type TransformerFunc func(r io.Reader) (io.Reader, error)
+
+// Transform calls f(r).
+func (f TransformerFunc) Transform(r io.Reader) (io.Reader, error) {
+	return f(r)
+}
+
+// applyTransformers chains transformers around r in order. The returned func closes the readers they created.
+func applyTransformers(r io.Reader, transformers []Transformer) (io.Reader, func(), error) {
+	var closers []io.Closer
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i].Close()
+		}
+	}
+
+	for _, transformer := range transformers {
+		transformed, err := transformer.Transform(r)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("%w: %s", ErrTransformingFile, err)
+		}
+
+		if closer, ok := transformed.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+
+		r = transformed
+	}
+
+	return r, closeAll, nil
+}
+
+// transformBytes runs fileBytes through transformers.
+func transformBytes(fileBytes []byte, transformers []Transformer) ([]byte, error) {
+	if len(transformers) == 0 {
+		return fileBytes, nil
+	}
+
+	transformed, closeTransformers, err := applyTransformers(bytes.NewReader(fileBytes), transformers)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTransformers()
+
+	transformedBytes, err := io.ReadAll(transformed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTransformingFile, err)
+	}
+
+	return transformedBytes, nil
+}
+
+// Transform streams the object srcKey in srcBucket through fn and uploads what fn writes as dstKey in dstBucket, so
+// Lambdas that resize, convert, or redact files never hold a whole file in memory. fn reads the source from r and
+// writes the result to w. The upload is a multipart upload that starts as soon as fn has written the first part and
+// is aborted if fn returns an error, which Transform returns wrapped in ErrTransformingFile. The destination's
+// Content-Type is that of dstKey's extension, or the source's when the extension is unknown. Upload options such as
+// WithChecksum or WithGzip apply to the destination.
+func Transform(region, srcBucket, srcKey, dstBucket, dstKey string, fn func(r io.Reader, w io.Writer) error, opts ...Option) (*UploadRes, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return nil, ErrParameterRegionEmpty
+	}
+
+	for _, bucket := range []string{srcBucket, dstBucket} {
+		if err := validateBucket(bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	if srcKey == "" || dstKey == "" {
+		return nil, ErrParameterNameEmpty
+	}
+
+	if fn == nil {
+		return nil, ErrParameterTransformFunc
+	}
+
+	o := newOptions(opts)
+
+	srcSession, err := o.newBucketSession(region, srcBucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	dstSession, err := o.newBucketSession(region, dstBucket)
+	if err != nil {
+		return nil, ErrNewAWSSession
+	}
+
+	ctx, cancel, err := o.transferContext()
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	getObjectOutput, err := s3.New(srcSession).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		if o.deadlineExceeded(ctx) {
+			return nil, ErrDeadlineTooClose
+		}
+		return nil, ErrDownloadingS3File
+	}
+	defer getObjectOutput.Body.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(dstKey))
+	if contentType == "" {
+		contentType = aws.StringValue(getObjectOutput.ContentType)
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	transformed := &countingReader{reader: pipeReader}
+
+	fnErr := make(chan error, 1)
+	go func() {
+		err := fn(getObjectOutput.Body, pipeWriter)
+		pipeWriter.CloseWithError(err) // a nil err closes the pipe normally which ends the upload
+		fnErr <- err
+	}()
+
+	uploadRes, err := upload(s3manager.NewUploader(dstSession), dstBucket, dstKey, transformed, contentType, 0, o)
+	pipeReader.CloseWithError(errUploadStopped) // unblocks fn if the upload stopped reading early
+
+	if transformErr := <-fnErr; transformErr != nil && !errors.Is(transformErr, errUploadStopped) {
+		return nil, fmt.Errorf("%w: %s", ErrTransformingFile, transformErr)
+	}
+
+	if err != nil {
+		return uploadRes, err
+	}
+
+	uploadRes.BytesUploaded = transformed.read
+
+	return uploadRes, nil
+}
+
+// countingReader counts the bytes read from reader.
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.read += int64(n)
+	return n, err
+}
@@ -0,0 +1,126 @@
+package lambda_s3
+
+import (
+	"bytes"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestTransformers(t *testing.T) {
+	upper := TransformerFunc(func(r io.Reader) (io.Reader, error) {
+		b, err := io.ReadAll(r)
+		return bytes.NewReader(bytes.ToUpper(b)), err
+	})
+	reverse := TransformerFunc(func(r io.Reader) (io.Reader, error) {
+		b, err := io.ReadAll(r)
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		return bytes.NewReader(b), err
+	})
+
+	t.Run("verify transformers are applied in order", func(t *testing.T) {
+		transformedBytes, err := transformBytes([]byte("abc"), []Transformer{upper, reverse})
+		assert.Nil(t, err)
+		assert.Equal(t, "CBA", string(transformedBytes))
+	})
+	t.Run("verify transformed readers are closed", func(t *testing.T) {
+		recorder := &closeRecorder{}
+		closing := TransformerFunc(func(r io.Reader) (io.Reader, error) {
+			recorder.Reader = r
+			return recorder, nil
+		})
+
+		transformedBytes, err := transformBytes([]byte("abc"), []Transformer{closing})
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", string(transformedBytes))
+		assert.True(t, recorder.closed)
+	})
+	t.Run("verify err when a transformer fails", func(t *testing.T) {
+		failing := TransformerFunc(func(r io.Reader) (io.Reader, error) {
+			return nil, errors.New("nope")
+		})
+
+		transformedBytes, err := transformBytes([]byte("abc"), []Transformer{upper, failing})
+		assert.Equal(t, 0, len(transformedBytes))
+		assert.True(t, errors.Is(err, ErrTransformingFile))
+	})
+	t.Run("verify transformers are applied to uploads and downloads", func(t *testing.T) {
+		fileHeaders, err := GetHeaders(generateUploadFileReq(), MaxFileSizeBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(fileHeaders))
+
+		_, err = UploadHeader(fileHeaders[0], Region, S3Bucket, S3TransformedFileName, WithUploadTransformers(upper))
+		assert.Nil(t, err)
+
+		fileBytes, err := Download(Region, S3Bucket, S3TransformedFileName, WithDownloadTransformers(reverse))
+		assert.Nil(t, err)
+		assert.Equal(t, SampleFileSizeBytes, len(fileBytes))
+		assert.True(t, strings.Contains(string(fileBytes), `"GNIMOCEB"`))
+	})
+}
+
+func TestTransform(t *testing.T) {
+	copyUpper := func(r io.Reader, w io.Writer) error {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes.ToUpper(b))
+		return err
+	}
+
+	t.Run("verify err when parameters are missing", func(t *testing.T) {
+		_, err := Transform("", S3Bucket, S3FileName, S3Bucket, "upper/"+S3FileName, copyUpper)
+		assert.True(t, errors.Is(err, ErrParameterRegionEmpty))
+
+		_, err = Transform(Region, S3Bucket, S3FileName, "", "upper/"+S3FileName, copyUpper)
+		assert.True(t, errors.Is(err, ErrParameterBucketEmpty))
+
+		_, err = Transform(Region, S3Bucket, S3FileName, S3Bucket, "", copyUpper)
+		assert.True(t, errors.Is(err, ErrParameterNameEmpty))
+
+		_, err = Transform(Region, S3Bucket, S3FileName, S3Bucket, "upper/"+S3FileName, nil)
+		assert.True(t, errors.Is(err, ErrParameterTransformFunc))
+	})
+	t.Run("verify bytes are counted as they're read", func(t *testing.T) {
+		counting := &countingReader{reader: strings.NewReader("contents")}
+		_, err := io.Copy(io.Discard, counting)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(8), counting.read)
+	})
+	t.Run("verify the source is streamed through fn to the destination", func(t *testing.T) {
+		uploadRes, err := Transform(Region, S3Bucket, S3FileName, S3Bucket, "upper/"+S3FileName, copyUpper)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(SampleFileSizeBytes), uploadRes.BytesUploaded)
+		assert.Equal(t, "text/csv; charset=utf-8", uploadRes.ContentType)
+
+		fileBytes, err := Download(Region, S3Bucket, uploadRes.Key)
+		assert.Nil(t, err)
+		assert.Equal(t, strings.ToUpper(string(fileBytes)), string(fileBytes))
+
+		assert.Nil(t, Delete(Region, S3Bucket, uploadRes.Key))
+	})
+	t.Run("verify fn's error is returned and nothing is uploaded", func(t *testing.T) {
+		_, err := Transform(Region, S3Bucket, S3FileName, S3Bucket, "failed/"+S3FileName, func(r io.Reader, w io.Writer) error {
+			return errors.New("unsupported format")
+		})
+		assert.True(t, errors.Is(err, ErrTransformingFile))
+
+		_, err = Download(Region, S3Bucket, "failed/"+S3FileName)
+		assert.True(t, errors.Is(err, ErrDownloadingS3File))
+	})
+}
@@ -0,0 +1,162 @@
+package lambda_s3
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// trashTimestampFormat is the format of the timestamp DeleteSoft puts between the trash prefix and the key.
+const trashTimestampFormat = "20060102T150405.000000000Z"
+
+var (
+	ErrCopyingS3Object     = errors.New("unable to copy the S3 object")
+	ErrDeletingS3Object    = errors.New("unable to delete the S3 object")
+	ErrNotInTrash          = errors.New("the key isn't a key DeleteSoft moved to the given trash prefix")
+	ErrParameterTrashEmpty = errors.New("required parameter trashPrefix is empty")
+)
+
+// DeleteSoft moves the object called name to the trash instead of deleting it. The object is copied, along with its
+// metadata, to <trashPrefix>/<timestamp>/<name> and then the original is deleted. It returns the key the object was
+// moved to which can be passed to Undelete to put the object back. Emptying the trash is left to a lifecycle rule
+// expiring objects under trashPrefix. Objects larger than 5 GB can't be copied in a single request and can't be
+// soft deleted. The copy and the delete are made with the options passed, such as WithContext, as Undelete's are.
+func DeleteSoft(region, bucket, name, trashPrefix string, opts ...Option) (string, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return "", ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		return "", ErrParameterNameEmpty
+	}
+
+	if trashPrefix == "" {
+		return "", ErrParameterTrashEmpty
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return "", ErrNewAWSSession
+	}
+
+	trashKey := trashedKey(trashPrefix, name, time.Now())
+
+	if err = moveObject(o.context(), s3.New(awsSession), bucket, name, trashKey); err != nil {
+		return "", err
+	}
+
+	return trashKey, nil
+}
+
+// Undelete moves an object DeleteSoft moved to the trash back to where it came from and returns its original key.
+// Use WithIfNoneMatch to fail with ErrObjectAlreadyExists rather than overwrite an object that has since been
+// uploaded under the original key.
+func Undelete(region, bucket, trashKey, trashPrefix string, opts ...Option) (string, error) {
+	if region == "" && !detectsBucketRegion(opts) {
+		return "", ErrParameterRegionEmpty
+	}
+
+	if err := validateBucket(bucket); err != nil {
+		return "", err
+	}
+
+	if trashKey == "" {
+		return "", ErrParameterNameEmpty
+	}
+
+	if trashPrefix == "" {
+		return "", ErrParameterTrashEmpty
+	}
+
+	name, err := untrashedKey(trashKey, trashPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	o := newOptions(opts)
+
+	awsSession, err := o.newBucketSession(region, bucket)
+	if err != nil {
+		return "", ErrNewAWSSession
+	}
+
+	s3Client := s3.New(awsSession)
+
+	if o.ifNoneMatch {
+		exists, err := objectExists(s3Client, bucket, name)
+		if err != nil {
+			return "", ErrCopyingS3Object
+		}
+
+		if exists {
+			return "", ErrObjectAlreadyExists
+		}
+	}
+
+	if err = moveObject(o.context(), s3Client, bucket, trashKey, name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// trashedKey is the key DeleteSoft moves name to. The parts are joined as they are rather than with path.Join, which
+// would clean names such as a//b or a/../b and make Undelete restore the object under a different key.
+func trashedKey(trashPrefix, name string, deletedAt time.Time) string {
+	return strings.TrimSuffix(trashPrefix, "/") + "/" + deletedAt.UTC().Format(trashTimestampFormat) + "/" + name
+}
+
+// untrashedKey strips the trash prefix and timestamp DeleteSoft added to trashKey.
+func untrashedKey(trashKey, trashPrefix string) (string, error) {
+	relPath := strings.TrimPrefix(trashKey, strings.TrimSuffix(trashPrefix, "/")+"/")
+	if relPath == trashKey {
+		return "", fmt.Errorf("%w: %s", ErrNotInTrash, trashKey)
+	}
+
+	timestamp, name, found := strings.Cut(relPath, "/")
+	if !found || name == "" {
+		return "", fmt.Errorf("%w: %s", ErrNotInTrash, trashKey)
+	}
+
+	if _, err := time.Parse(trashTimestampFormat, timestamp); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrNotInTrash, trashKey)
+	}
+
+	return name, nil
+}
+
+// moveObject copies bucket/from to bucket/to and deletes bucket/from once the copy succeeds.
+func moveObject(ctx aws.Context, s3Client s3iface.S3API, bucket, from, to string) error {
+	_, err := s3Client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(to),
+		CopySource: aws.String(url.PathEscape(bucket + "/" + from)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return ErrObjectNotFound
+		}
+		return ErrCopyingS3Object
+	}
+
+	_, err = s3Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(from),
+	})
+	if err != nil {
+		return ErrDeletingS3Object
+	}
+
+	return nil
+}
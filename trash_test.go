@@ -0,0 +1,73 @@
+package lambda_s3
+
+import (
+	"context"
+	"errors"
+	"github.com/jgroeneveld/trial/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const S3TrashPrefix = "trash"
+
+func TestDeleteSoft(t *testing.T) {
+	t.Run("verify err when trashPrefix is empty", func(t *testing.T) {
+		trashKey, err := DeleteSoft(Region, S3Bucket, S3FileName, "")
+		assert.Equal(t, "", trashKey)
+		assert.Equal(t, ErrParameterTrashEmpty, err)
+	})
+	t.Run("verify the object isn't moved once the context passed WithContext is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		trashKey, err := DeleteSoft(Region, S3Bucket, S3FileName, S3TrashPrefix, WithContext(ctx))
+		assert.Equal(t, "", trashKey)
+		assert.Equal(t, ErrCopyingS3Object, err)
+	})
+	t.Run("verify untrashedKey strips the trash prefix and timestamp", func(t *testing.T) {
+		name, err := untrashedKey("trash/20230117T150405.123456789Z/photos/cat.png", "trash/")
+		assert.Nil(t, err)
+		assert.Equal(t, "photos/cat.png", name)
+	})
+	t.Run("verify names that aren't clean paths are restored unchanged", func(t *testing.T) {
+		for _, name := range []string{"photos//cat.png", "photos/../cat.png", "/cat.png", "photos/"} {
+			untrashed, err := untrashedKey(trashedKey("trash/", name, time.Now()), S3TrashPrefix)
+			assert.Nil(t, err)
+			assert.Equal(t, name, untrashed)
+		}
+	})
+	t.Run("verify err when the key isn't in the trash", func(t *testing.T) {
+		for _, trashKey := range []string{"photos/cat.png", "trash/photos/cat.png", "trash/20230117T150405.123456789Z/"} {
+			_, err := untrashedKey(trashKey, S3TrashPrefix)
+			assert.True(t, errors.Is(err, ErrNotInTrash))
+		}
+	})
+	t.Run("verify soft deleted objects can be undeleted", func(t *testing.T) {
+		fileBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		key := "soft/" + SampleFileName
+		_, err = UploadHeader(generateFileHeader(t, SampleFileName, fileBytes), Region, S3Bucket, key)
+		assert.Nil(t, err)
+
+		trashKey, err := DeleteSoft(Region, S3Bucket, key, S3TrashPrefix)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(trashKey, S3TrashPrefix+"/"))
+		assert.True(t, strings.HasSuffix(trashKey, "/"+key))
+
+		_, err = Download(Region, S3Bucket, key)
+		assert.True(t, errors.Is(err, ErrDownloadingS3File))
+
+		name, err := Undelete(Region, S3Bucket, trashKey, S3TrashPrefix, WithIfNoneMatch())
+		assert.Nil(t, err)
+		assert.Equal(t, key, name)
+
+		downloadedBytes, err := Download(Region, S3Bucket, key)
+		assert.Nil(t, err)
+		assert.Equal(t, len(fileBytes), len(downloadedBytes))
+
+		assert.Nil(t, Delete(Region, S3Bucket, key))
+	})
+}
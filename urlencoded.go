@@ -0,0 +1,92 @@
+package lambda_s3
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// IsURLEncodedRequest reports whether the Content-Type of lambdaReq is application/x-www-form-urlencoded, meaning it
+// should be read with GetURLEncodedHeaders rather than GetHeaders.
+func IsURLEncodedRequest(lambdaReq events.APIGatewayProxyRequest) bool {
+	return isURLEncodedRequest(APIGatewayProxySource(lambdaReq))
+}
+
+func isURLEncodedRequest(source RequestSource) bool {
+	mediaType, _, err := mime.ParseMediaType(source.Headers().Get("Content-Type"))
+
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// GetURLEncodedHeaders is GetHeaders for legacy clients that post files as base64 encoded values of an
+// application/x-www-form-urlencoded form. Each of fileFields names a field holding a file, which is named after the
+// field, and fields that aren't listed are ignored. Missing fields are skipped. The Content-Type of each file is
+// guessed from its name or, failing that, its contents. The files are returned as *multipart.FileHeader values so
+// they can be uploaded with UploadHeader and friends and WithMaxSize and WithTempDir apply as they do to GetHeaders.
+func GetURLEncodedHeaders(lambdaReq events.APIGatewayProxyRequest, fileFields []string, opts ...Option) ([]*multipart.FileHeader, error) {
+	values, err := parseURLEncoded(APIGatewayProxySource(lambdaReq))
+	if err != nil {
+		return nil, err
+	}
+
+	return urlEncodedHeaders(values, fileFields, newOptions(opts))
+}
+
+func urlEncodedHeaders(values url.Values, fileFields []string, o *options) ([]*multipart.FileHeader, error) {
+	var files []*multipart.FileHeader
+
+	for _, field := range fileFields {
+		value := values.Get(field)
+		if value == "" {
+			continue
+		}
+
+		// clients that don't percent encode the + in base64 have it decoded as a space. base64 never contains spaces
+		data, dataContentType, err := decodeBase64Data(strings.ReplaceAll(value, " ", "+"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s is not base64 encoded", ErrReadingMultiPartForm, field)
+		}
+
+		contentType := dataContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(field))
+		}
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+
+		fileHeader, err := newFileHeader(field, contentType, data, o)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, fileHeader)
+	}
+
+	return files, nil
+}
+
+// parseURLEncoded parses the urlencoded form in the body of source.
+func parseURLEncoded(source RequestSource) (url.Values, error) {
+	body := source.Body()
+	if source.IsBase64() {
+		decodedBody, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return nil, ErrReadingMultiPartForm
+		}
+		body = string(decodedBody)
+	}
+
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrReadingMultiPartForm, err)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,61 @@
+package lambda_s3
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jgroeneveld/trial/assert"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func generateURLEncodedReq(body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		Body:    body,
+	}
+}
+
+func TestGetURLEncodedHeaders(t *testing.T) {
+	fileBytes, err := os.ReadFile(SampleFileName)
+	assert.Nil(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString(fileBytes)
+
+	t.Run("verify IsURLEncodedRequest recognizes urlencoded requests", func(t *testing.T) {
+		assert.True(t, IsURLEncodedRequest(generateURLEncodedReq("")))
+		assert.False(t, IsURLEncodedRequest(generateUploadFileReq()))
+	})
+	t.Run("verify err when a file field is not base64", func(t *testing.T) {
+		_, err := GetURLEncodedHeaders(generateURLEncodedReq(SampleFileName+"=%21%21%21"), []string{SampleFileName})
+		assert.True(t, errors.Is(err, ErrReadingMultiPartForm))
+	})
+	t.Run("verify err when a file is larger than WithMaxSize", func(t *testing.T) {
+		body := url.Values{SampleFileName: {encoded}}.Encode()
+
+		_, err := GetURLEncodedHeaders(generateURLEncodedReq(body), []string{SampleFileName}, WithMaxSize(SampleFileSizeBytes-1))
+		assert.True(t, errors.Is(err, ErrFileTooLarge))
+	})
+	t.Run("verify GetURLEncodedHeaders works with correct inputs", func(t *testing.T) {
+		body := url.Values{SampleFileName: {encoded}, "description": {"rates"}}.Encode()
+		unescapedPlusBody := SampleFileName + "=" + strings.ReplaceAll(url.QueryEscape(encoded), "%2B", "+")
+
+		for _, body := range []string{body, unescapedPlusBody} {
+			fileHeaders, err := GetURLEncodedHeaders(generateURLEncodedReq(body), []string{SampleFileName, "missing.txt"})
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(fileHeaders))
+			assert.Equal(t, SampleFileName, fileHeaders[0].Filename)
+			assert.True(t, strings.HasPrefix(fileHeaders[0].Header.Get("Content-Type"), "text/")) // from mime.types if it lists .csv
+
+			file, err := fileHeaders[0].Open()
+			assert.Nil(t, err)
+
+			contents, err := io.ReadAll(file)
+			assert.Nil(t, err)
+			assert.Equal(t, string(fileBytes), string(contents))
+		}
+	})
+}
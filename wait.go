@@ -0,0 +1,50 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"time"
+)
+
+// waitDelay is how long to wait between the HeadObject requests made WithWait.
+const waitDelay = 250 * time.Millisecond
+
+var ErrWaitTimeout = errors.New("timed out waiting for S3 to confirm the change was applied")
+
+// waitUntilExists polls HeadObject until name exists in bucket or timeout passes.
+func waitUntilExists(s3Client s3iface.S3API, bucket, name string, timeout time.Duration) error {
+	err := s3Client.WaitUntilObjectExistsWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	}, waiterOptions(timeout)...)
+	if err != nil {
+		return ErrWaitTimeout
+	}
+
+	return nil
+}
+
+// waitUntilNotExists polls HeadObject until name no longer exists in bucket or timeout passes.
+func waitUntilNotExists(s3Client s3iface.S3API, bucket, name string, timeout time.Duration) error {
+	err := s3Client.WaitUntilObjectNotExistsWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	}, waiterOptions(timeout)...)
+	if err != nil {
+		return ErrWaitTimeout
+	}
+
+	return nil
+}
+
+// waiterOptions replaces the SDK's default of 20 attempts 5 seconds apart, far too slow for a Lambda, with
+// attempts waitDelay apart for up to timeout.
+func waiterOptions(timeout time.Duration) []request.WaiterOption {
+	return []request.WaiterOption{
+		request.WithWaiterDelay(request.ConstantWaiterDelay(waitDelay)),
+		request.WithWaiterMaxAttempts(int(timeout/waitDelay) + 1),
+	}
+}
@@ -0,0 +1,34 @@
+package lambda_s3
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/jgroeneveld/trial/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithWait(t *testing.T) {
+	t.Run("verify waiterOptions polls every waitDelay until the timeout", func(t *testing.T) {
+		waiter := request.Waiter{}
+		waiter.ApplyOptions(waiterOptions(2 * time.Second)...)
+
+		assert.Equal(t, 9, waiter.MaxAttempts)
+		assert.Equal(t, waitDelay, waiter.Delay(1))
+	})
+	t.Run("verify uploads and deletes wait for the change", func(t *testing.T) {
+		fileBytes, err := os.ReadFile(SampleFileName)
+		assert.Nil(t, err)
+
+		key := "wait/" + SampleFileName
+
+		_, err = UploadHeader(generateFileHeader(t, SampleFileName, fileBytes), Region, S3Bucket, key, WithWait(5*time.Second))
+		assert.Nil(t, err)
+
+		assert.Nil(t, Delete(Region, S3Bucket, key, WithWait(5*time.Second)))
+
+		_, err = Download(Region, S3Bucket, key)
+		assert.True(t, errors.Is(err, ErrDownloadingS3File))
+	})
+}